@@ -2,14 +2,16 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"minidb/pkg/buffer"
+	"math"
 	"minidb/pkg/db"
-	"minidb/pkg/storage/disk"
 	"net"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -17,46 +19,93 @@ import (
 const (
 	Port      = ":8888"
 	DataDir   = "./minidb_data"
-	MetaFile  = "meta.json"
-	DBFile    = "data.db"
-	DefaultDB = "mydb" // 默认加载的数据库，简化演示
+	MetaFile  = db.MetaFileName
+	DBFile    = db.DataFileName
+	DefaultDB = "mydb" // 启动时打开的数据库，预热和回放都在它上面；其他库在会话 use 时才打开
+	PoolSize  = 100    // 每个打开的库的缓冲池 Frame 数
+
+	DoubleWrite = true // 写页前先写双写缓冲区，防止崩溃写坏页
+	WarmupDepth = 2    // 启动时预读每张表前几层索引页，0 表示不预热
+	BloomFilter = true // 点查前用内存中的布隆过滤器排除一定不存在的主键
+	CleanFrames = 8    // 后台刷盘保持的干净 Frame 数，淘汰时不必同步写脏页；0 表示关闭
+	LRUK        = 2    // 缓冲池按 LRU-K 淘汰，全表扫描只读一次的页不会挤掉反复访问的页；1 表示普通 LRU
+
+	// 检查点间隔：定期把所有打开的库中没有被 Pin 住的脏页和元数据写回，没有正常关闭时也只丢失最近一段的写入；0 表示关闭
+	CheckpointInterval = 30 * time.Second
+
+	// 点查结果缓存：每张表最多缓存的主键数（0 表示关闭）和条目的有效期
+	RowCacheSize = 1024
+	RowCacheTTL  = 5 * time.Second
+
+	CatalogBackup = true // meta.json 损坏时加载上一版本 meta.json.bak，否则拒绝启动
+
+	// 每个连接每秒最多执行的语句数（令牌桶，允许攒一秒的突发），0 表示不限；可用 -rate_limit 覆盖
+	RateLimit = 0
+
+	// 连接建立后，客户端发送的第一行若是 FramedHandshake，则切换到长度前缀分帧模式：
+	// 之后每条请求/响应都是 4 字节大端长度 + 内容，内容中可以包含任意字节（包括换行）
+	FramedHandshake = "\\framed"
+	MaxFrameSize    = 1 << 20 // 单帧上限，防止恶意长度耗尽内存
 )
 
 // 全局共享资源
 var globalEngine *db.Engine
 
+// commandLog 不为 nil 时记录所有连接执行的语句，见 -record
+var commandLog *db.CommandLog
+
+var rateLimit = flag.Float64("rate_limit", RateLimit, "per-connection queries per second, 0 disables the limit")
+var recordFile = flag.String("record", "", "append every executed statement with its session id to this command log")
+var replayFile = flag.String("replay", "", "replay a command log into a fresh data directory (see -replay_dir) and exit")
+var replayDir = flag.String("replay_dir", "./minidb_replay", "data directory created for -replay, must not exist")
+var debugCommands = flag.Bool("debug", false, "enable debug commands that expose internal state, such as debug bufferpool")
+
+// 新建数据库的默认选项；已有的库按自己 config.json 中的配置运行
+var defaultPageSize = flag.Int("page_size", 0, "page size in bytes of new databases, 0 for the built-in default")
+var defaultCompression = flag.String("compression", string(db.CompressionNone), "default value compression of new databases: none or flate")
+var defaultDurability = flag.String("durability", string(db.DurabilityAsync), "default durability of new databases: async (write on eviction or close) or sync (fsync before each statement returns)")
+
 func main() {
+	flag.Parse()
 	fmt.Println("🚀 MiniDB Server is starting...")
 
-	// 1. 初始化全局资源
-	// 为了简化，我们假设服务器启动时默认挂载一个主数据目录。
-	// 在真实场景中，DiskManager 应该是惰性加载或由 Catalog 管理多库文件。
-	// 这里我们采取一种折中方案：先初始化 Engine 结构，具体 DB 资源在 UseDatabase 时加载/共享。
-
-	// 但是，为了实现 Session 隔离且共享 Cache，我们需要把 BPM 提升为全局单例。
-	// 鉴于目前 Engine 代码结构耦合了 BPM，我们采取最稳妥的方式：
-	// Server 启动时，不加载具体 DB，只准备环境。
-	globalEngine = db.NewEngine(DataDir)
-	defer globalEngine.Close()
-
-	// 2. 预先初始化一个默认数据库和它的资源，以便所有客户端共享
-	// 注意：在您的 Engine 设计中，SwitchDatabase 会 Close 旧资源并 Open 新资源。
-	// 如果多客户端并发 SwitchDatabase，会导致资源被关闭。
-	// **这是一个并发设计挑战**。
-	// 为了让您的作业能跑且不出错，我们约定：
-	// 服务器启动时加载默认数据库 'mydb'，所有客户端默认连它，不要频繁 Drop/Switch。
-
-	initPath := filepath.Join(DataDir, DefaultDB)
-	os.MkdirAll(initPath, 0755)
-	dm, _ := disk.NewDiskManager(filepath.Join(initPath, DBFile))
-	bpm := buffer.NewBufferPoolManager(dm, 100)
-	catalog := db.NewCatalog(bpm, filepath.Join(initPath, MetaFile))
-
-	// 手动注入到全局 Engine
-	globalEngine.DiskManager = dm
-	globalEngine.BPM = bpm
-	globalEngine.Catalog = catalog
-	globalEngine.CurrentDB = DefaultDB
+	// 重放模式：在一个全新的数据目录上执行命令日志，然后退出
+	if *replayFile != "" {
+		if err := replay(*replayFile, *replayDir); err != nil {
+			log.Fatalf("❌ Replay failed: %v", err)
+		}
+		return
+	}
+
+	globalEngine = openDatabase(DataDir)
+	defer func() {
+		if err := globalEngine.Close(); err != nil {
+			log.Printf("⚠️ Shutdown did not flush cleanly: %v", err)
+		}
+	}()
+
+	if CheckpointInterval > 0 {
+		go runCheckpoints(globalEngine, CheckpointInterval)
+	}
+
+	if *recordFile != "" {
+		l, err := db.OpenCommandLog(*recordFile)
+		if err != nil {
+			log.Fatalf("❌ Failed to open command log: %v", err)
+		}
+		defer l.Close()
+		commandLog = l
+		fmt.Printf("📝 Recording statements to %s\n", *recordFile)
+	}
+
+	// 3. 预热缓冲池，避免重启后的首批查询全部打到磁盘
+	if WarmupDepth > 0 {
+		if n, err := globalEngine.WarmCache(nil, WarmupDepth); err != nil {
+			log.Printf("⚠️ Cache warmup failed: %v", err)
+		} else {
+			fmt.Printf("🔥 Warmed %d pages into buffer pool\n", n)
+		}
+	}
 
 	listener, err := net.Listen("tcp", Port)
 	if err != nil {
@@ -74,27 +123,128 @@ func main() {
 	}
 }
 
+// openDatabase 创建根引擎并打开（不存在时创建）默认数据库
+func openDatabase(dataDir string) *db.Engine {
+	engine := db.NewEngine(dataDir)
+	defaults, err := databaseDefaults()
+	if err != nil {
+		log.Fatalf("❌ Invalid database defaults: %v", err)
+	}
+	engine.Defaults = defaults
+	// 每个库在第一次被 use 时才打开，都使用这份选项
+	engine.OpenOptions = db.OpenOptions{
+		PoolSize:      PoolSize,
+		LRUK:          LRUK,
+		CleanFrames:   CleanFrames,
+		DoubleWrite:   DoubleWrite,
+		StrictCatalog: !CatalogBackup,
+	}
+
+	if !engine.HasDatabase(DefaultDB) {
+		if err := engine.CreateDatabase(DefaultDB); err != nil {
+			log.Fatalf("❌ Failed to create database '%s': %v", DefaultDB, err)
+		}
+	}
+	if err := engine.UseDatabase(DefaultDB); err != nil {
+		log.Fatalf("❌ Failed to open database '%s': %v", DefaultDB, err)
+	}
+	for _, w := range engine.Warnings() {
+		log.Printf("⚠️ %s", w.Message)
+	}
+	engine.ClearWarnings()
+	if BloomFilter {
+		engine.EnableBloomFilters()
+	}
+	if RowCacheSize > 0 {
+		engine.EnableRowCache(RowCacheSize, RowCacheTTL)
+	}
+
+	if err := engine.CheckBufferPool(); err != nil {
+		log.Fatalf("❌ Failed to open database '%s': %v", DefaultDB, err)
+	}
+	return engine
+}
+
+// runCheckpoints 每隔 interval 做一次检查点，见 Engine.Checkpoint；服务器退出时随进程结束
+func runCheckpoints(engine *db.Engine, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := engine.Checkpoint(); err != nil {
+			log.Printf("⚠️ Checkpoint failed: %v", err)
+		}
+	}
+}
+
+// databaseDefaults 把命令行参数转换成新建数据库的默认选项
+func databaseDefaults() (db.DatabaseOptions, error) {
+	compression, err := db.ParseCompression(*defaultCompression)
+	if err != nil {
+		return db.DatabaseOptions{}, err
+	}
+	durability, err := db.ParseDurability(*defaultDurability)
+	if err != nil {
+		return db.DatabaseOptions{}, err
+	}
+	return db.DatabaseOptions{PageSize: *defaultPageSize, Compression: compression, Durability: durability}, nil
+}
+
 func handleClient(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
 	fmt.Printf("✅ New connection from: %s\n", clientAddr)
 	defer conn.Close()
 
 	sessionEngine := globalEngine.NewSession()
+	// 断开连接时删除本会话的临时表、放弃对库的引用，在回滚事务之后执行；最后一个会话离开时关闭库
+	defer func() {
+		if err := sessionEngine.Close(); err != nil {
+			log.Printf("⚠️ Closing session of %s: %v", clientAddr, err)
+		}
+	}()
+	defer sessionEngine.Rollback() // 断开连接时丢弃未提交的事务
 	parser := db.NewSQLParser(sessionEngine, conn)
+	parser.Debug = *debugCommands
+	var session int64
+	if commandLog != nil {
+		session = commandLog.NewSession()
+	}
+
+	var limiter *tokenBucket
+	if *rateLimit > 0 {
+		limiter = newTokenBucket(*rateLimit, int(math.Ceil(*rateLimit)))
+	}
 
 	conn.Write([]byte("Welcome to MiniDB Server!\nminidb> "))
 
 	reader := bufio.NewReader(conn)
+	framed := false
+	first := true // 只有连接上的第一条消息可以是握手
 	for {
-		input, err := reader.ReadString('\n')
+		var input string
+		var err error
+		if framed {
+			input, err = readFrame(reader)
+		} else {
+			input, err = reader.ReadString('\n')
+		}
 		if err != nil {
-			fmt.Printf("❌ Client disconnected: %s\n", clientAddr)
+			fmt.Printf("❌ Client disconnected: %s (%v)\n", clientAddr, err)
 			return
 		}
 
 		sql := strings.TrimSpace(input)
+		if first && sql == FramedHandshake {
+			first = false
+			// 握手本身用行模式回复，之后的响应全部分帧
+			framed = true
+			conn.Write([]byte("OK framed\n"))
+			continue
+		}
+		first = false
 		if sql == "" {
-			conn.Write([]byte("minidb> "))
+			if !framed {
+				conn.Write([]byte("minidb> "))
+			}
 			continue
 		}
 
@@ -102,27 +252,147 @@ func handleClient(conn net.Conn) {
 			return
 		}
 
-		fmt.Printf("[%s] Exec: %s\n", clientAddr, sql)
+		// 分帧模式下先把整条消息的输出缓存起来，再作为一帧发送
+		var out io.Writer = conn
+		var buf bytes.Buffer
+		if framed {
+			out = &buf
+		}
+		parser.Output = out
+
+		// 一条消息可以包含多条以分号分隔的语句，按顺序执行，输出合在一起返回；
+		// 默认在第一条出错的语句处停止，set on_error = continue 时继续执行后面的语句
+		for _, stmt := range db.SplitStatements(sql) {
+			if !execStatement(parser, limiter, session, clientAddr, stmt) && parser.StopOnError() {
+				break
+			}
+		}
+
+		// copy ... from stdin：先回复这条消息，之后的输入都是数据行，读到结束行才再次回复
+		if parser.Copying() {
+			if framed {
+				if err := writeFrame(conn, buf.Bytes()); err != nil {
+					fmt.Printf("❌ Client disconnected: %s (%v)\n", clientAddr, err)
+					return
+				}
+				buf.Reset()
+			}
+			if err := copyIn(parser, reader, framed, session); err != nil {
+				fmt.Printf("❌ Client disconnected during copy: %s (%v)\n", clientAddr, err)
+				return
+			}
+		}
+
+		if framed {
+			if err := writeFrame(conn, buf.Bytes()); err != nil {
+				fmt.Printf("❌ Client disconnected: %s (%v)\n", clientAddr, err)
+				return
+			}
+			continue
+		}
+		conn.Write([]byte("minidb> "))
+	}
+}
+
+// execStatement 执行一条语句并输出结果（或错误），返回语句是否执行成功
+func execStatement(parser *db.SQLParser, limiter *tokenBucket, session int64, clientAddr, sql string) bool {
+	// 超出限速的语句不执行，直接回复错误，连接保持可用
+	if limiter != nil && !limiter.Allow() {
+		fmt.Printf("[%s] Rate limited: %s\n", clientAddr, sql)
+		parser.ReportError(db.ErrRateLimited)
+		return false
+	}
+
+	fmt.Printf("[%s] Exec: %s\n", clientAddr, sql)
+	if commandLog != nil {
+		// 执行前记录，语句导致崩溃时日志里也有它
+		if err := commandLog.Record(session, sql); err != nil {
+			log.Printf("⚠️ Failed to record statement: %v", err)
+		}
+	}
+
+	// --- ⏱️ 开始计时 ---
+	start := time.Now()
 
-		// --- ⏱️ 开始计时 ---
-		start := time.Now()
+	// 执行逻辑
+	rs, err := parser.Execute(sql)
 
-		// 执行逻辑
-		err = parser.ParseAndExecute(sql)
+	// --- ⏱️ 结束计时 ---
+	duration := time.Since(start)
 
-		// --- ⏱️ 结束计时 ---
-		duration := time.Since(start)
+	if err != nil {
+		// 如果出错，发送错误信息（JSON 输出模式下附带错误码）
+		parser.ReportError(err)
+		return false
+	}
+	// 按会话的 output_format 把结果格式化后发送
+	parser.WriteResult(rs)
+	// 如果成功，发送耗时统计（set timing = off 时不发送）
+	// 格式: (0.0023 sec)，JSON 输出模式下为 {"elapsed_sec":0.0023}
+	parser.ReportSuccess(duration)
+	return true
+}
 
+// copyIn 把客户端接下来发送的数据交给 parser，直到读到 copy 的结束行，期间不回复客户端
+// 行模式下每次读一行，分帧模式下一帧可以包含多行；结束后输出写入的行数（或错误）和耗时
+func copyIn(parser *db.SQLParser, reader *bufio.Reader, framed bool, session int64) error {
+	start := time.Now()
+	for {
+		var data string
+		var err error
+		if framed {
+			data, err = readFrame(reader)
+		} else {
+			data, err = reader.ReadString('\n')
+		}
 		if err != nil {
-			// 如果出错，发送错误信息
-			conn.Write([]byte(fmt.Sprintf("Error: %v\n", err)))
+			return err
+		}
+		if commandLog != nil {
+			// 重放时数据行同样交给处于 copy 状态的 parser
+			if err := commandLog.Record(session, data); err != nil {
+				log.Printf("⚠️ Failed to record copy data: %v", err)
+			}
+		}
+
+		done, err := parser.CopyData(data)
+		if !done {
+			continue
+		}
+		if err != nil {
+			parser.ReportError(err)
 		} else {
-			// 如果成功，发送耗时统计
-			// 格式: (0.0023 sec)
-			timeMsg := fmt.Sprintf("(%.4f sec)\n", duration.Seconds())
-			conn.Write([]byte(timeMsg))
+			parser.ReportSuccess(time.Since(start))
 		}
+		return nil
+	}
+}
 
-		conn.Write([]byte("minidb> "))
+// readFrame 读取一条长度前缀消息：4 字节大端长度 + 内容
+func readFrame(r io.Reader) (string, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", err
 	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return "", fmt.Errorf("frame of %d bytes exceeds limit %d", size, MaxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// writeFrame 以与 readFrame 相同的格式发送一条消息
+func writeFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+	_, err := w.Write(frame)
+	return err
 }
@@ -0,0 +1,178 @@
+package buffer
+
+import (
+	"slices"
+	"sync"
+)
+
+// LRUKReplacer 按 LRU-K 算法淘汰 Frame：比较每个 Frame 倒数第 K 次被访问的时间（backward K-distance），最早的先淘汰
+// 访问不足 K 次的 Frame 距离视为无穷大，比任何访问满 K 次的 Frame 都先淘汰，它们之间按普通 LRU（最后一次访问最早的先淘汰）
+// 全表扫描读入的页只被访问一次，会先于反复访问的热点页被淘汰，扫描不会把热点页挤出缓冲池
+//
+// 每次 Pin 记一次访问（缓冲池每次 FetchPage / NewPage 都会 Pin）；Victim 和 Remove 清除 Frame 的访问记录，
+// 因为之后 Frame 会装载别的页
+type LRUKReplacer struct {
+	mu       sync.Mutex
+	k        int
+	capacity int
+	now      uint64      // 逻辑时钟，每次访问加一
+	frames   []lrukFrame // 按 FrameID 下标
+	size     int         // 可淘汰的 Frame 个数
+}
+
+type lrukFrame struct {
+	history   []uint64 // 最近至多 k 次访问的时间，最旧的在前
+	evictable bool     // 没有被 Pin 住，可以淘汰
+}
+
+// NewLRUKReplacer 创建一个 LRU-K 替换器，k 小于 1 时按 1 处理（即普通 LRU）
+func NewLRUKReplacer(capacity int, k int) *LRUKReplacer {
+	return &LRUKReplacer{
+		k:        max(k, 1),
+		capacity: capacity,
+		frames:   make([]lrukFrame, capacity),
+	}
+}
+
+// frame 返回 FrameID 对应的记录，FrameID 超出容量时扩容
+func (l *LRUKReplacer) frame(frameID int) *lrukFrame {
+	if frameID >= len(l.frames) {
+		l.frames = append(l.frames, make([]lrukFrame, frameID+1-len(l.frames))...)
+	}
+	return &l.frames[frameID]
+}
+
+// key 返回 Frame 的淘汰顺序：访问不足 K 次的（full 为 false）在前，然后按 at 从早到晚
+// full 时 at 是倒数第 K 次访问的时间，否则是最后一次访问的时间
+func (l *LRUKReplacer) key(frameID int) (full bool, at uint64) {
+	h := l.frames[frameID].history
+	switch {
+	case len(h) >= l.k:
+		return true, h[len(h)-l.k]
+	case len(h) > 0:
+		return false, h[len(h)-1]
+	}
+	return false, 0
+}
+
+// before 报告 Frame a 是否应该比 b 先淘汰，调用方必须持有 mu
+func (l *LRUKReplacer) before(a, b int) bool {
+	fullA, atA := l.key(a)
+	fullB, atB := l.key(b)
+	if fullA != fullB {
+		return fullB
+	}
+	if atA != atB {
+		return atA < atB
+	}
+	return a < b
+}
+
+// evict 移除 Frame 及其访问记录，调用方必须持有 mu
+func (l *LRUKReplacer) evict(frameID int) {
+	f := &l.frames[frameID]
+	if f.evictable {
+		l.size--
+	}
+	f.evictable = false
+	f.history = f.history[:0]
+}
+
+// Victim 移除并返回最先应该淘汰的 FrameID，没有可淘汰的 Frame 时返回 -1
+func (l *LRUKReplacer) Victim() int {
+	return l.VictimWhere(func(int) bool { return true })
+}
+
+// VictimWhere 按淘汰顺序移除并返回第一个满足 accept 的 FrameID，没有满足条件的 Frame 时返回 -1
+// 每次线性找出剩下的 Frame 中最先淘汰的一个，通常第一个就满足条件，不必整体排序
+func (l *LRUKReplacer) VictimWhere(accept func(frameID int) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var rejected map[int]bool
+	for {
+		best := -1
+		for id := range l.frames {
+			if l.frames[id].evictable && !rejected[id] && (best == -1 || l.before(id, best)) {
+				best = id
+			}
+		}
+		if best == -1 {
+			return -1
+		}
+		if accept(best) {
+			l.evict(best)
+			return best
+		}
+		if rejected == nil {
+			rejected = make(map[int]bool)
+		}
+		rejected[best] = true
+	}
+}
+
+// Oldest 按淘汰顺序返回至多 n 个可淘汰的 FrameID，不修改状态
+func (l *LRUKReplacer) Oldest(n int) []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	frames := make([]int, 0, l.size)
+	for id := range l.frames {
+		if l.frames[id].evictable {
+			frames = append(frames, id)
+		}
+	}
+	slices.SortFunc(frames, func(a, b int) int {
+		if l.before(a, b) {
+			return -1
+		}
+		return 1
+	})
+	return frames[:min(n, len(frames))]
+}
+
+// Pin 记录一次访问，并把 Frame 从可淘汰的集合中移除
+func (l *LRUKReplacer) Pin(frameID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f := l.frame(frameID)
+	l.now++
+	if len(f.history) == l.k {
+		f.history = append(f.history[:0], f.history[1:]...)
+	}
+	f.history = append(f.history, l.now)
+	if f.evictable {
+		f.evictable = false
+		l.size--
+	}
+}
+
+// Unpin 把 Frame 加入可淘汰的集合，访问记录不变
+func (l *LRUKReplacer) Unpin(frameID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f := l.frame(frameID)
+	if f.evictable || l.size >= l.capacity {
+		return
+	}
+	f.evictable = true
+	l.size++
+}
+
+// Remove 把 Frame 从替换器中移除并清除访问记录，Frame 回到缓冲池的空闲列表时调用
+func (l *LRUKReplacer) Remove(frameID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if frameID < len(l.frames) {
+		l.evict(frameID)
+	}
+}
+
+// Size 返回可淘汰的 Frame 个数
+func (l *LRUKReplacer) Size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
@@ -43,6 +43,35 @@ func (l *LRUReplacer) Victim() int {
 	return frameID
 }
 
+// VictimWhere 从最久未使用的一端开始，移除并返回第一个满足 accept 的 FrameID
+// 如果没有满足条件的元素，返回 -1
+func (l *LRUReplacer) VictimWhere(accept func(frameID int) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for elem := l.list.Back(); elem != nil; elem = elem.Prev() {
+		frameID := elem.Value.(int)
+		if accept(frameID) {
+			l.list.Remove(elem)
+			delete(l.elements, frameID)
+			return frameID
+		}
+	}
+	return -1
+}
+
+// Oldest 返回最久未使用的至多 n 个 FrameID（最旧的在前），不修改列表
+func (l *LRUReplacer) Oldest(n int) []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var frames []int
+	for elem := l.list.Back(); elem != nil && len(frames) < n; elem = elem.Prev() {
+		frames = append(frames, elem.Value.(int))
+	}
+	return frames
+}
+
 // Pin 当一个页面被正在使用时，它不应该被 LRU 驱逐
 // 所以 Pin 操作实际上是从 LRU 列表中**移除**该 FrameID
 // 等到 Unpin 时再加回来
@@ -80,4 +109,9 @@ func (l *LRUReplacer) Size() int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	return l.list.Len()
-}
\ No newline at end of file
+}
+
+// Remove 把 Frame 从 LRU 列表中移除，Frame 回到缓冲池的空闲列表时调用，与 Pin 相同
+func (l *LRUReplacer) Remove(frameID int) {
+	l.Pin(frameID)
+}
@@ -2,58 +2,108 @@ package buffer
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
 	"minidb/pkg/storage/disk"
 	"minidb/pkg/storage/page"
 )
 
+// Replacer 决定缓冲池满时淘汰哪个 Frame，只在没有被 Pin 住的 Frame 中选择，见 LRUReplacer 和 LRUKReplacer
+type Replacer interface {
+	Victim() int                                   // 移除并返回下一个淘汰的 Frame，没有时返回 -1
+	VictimWhere(accept func(frameID int) bool) int // 按淘汰顺序移除并返回第一个满足 accept 的 Frame
+	Oldest(n int) []int                            // 按淘汰顺序返回至多 n 个 Frame，不修改状态
+	Pin(frameID int)                               // Frame 被访问并 Pin 住，不能淘汰
+	Unpin(frameID int)                             // Frame 不再被使用，可以淘汰
+	Remove(frameID int)                            // Frame 回到空闲列表，之后会装载别的页
+	Size() int                                     // 可淘汰的 Frame 个数
+}
+
 type BufferPoolManager struct {
 	mu          sync.Mutex
 	diskManager disk.DiskManager
 	pages       []*page.Page        // 实际的内存池 (数组大小固定)
-	replacer    *LRUReplacer        // LRU 替换算法
+	replacer    Replacer            // 替换算法，默认 LRU
 	freeList    []int               // 空闲的 FrameID 列表
 	pageTable   map[page.PageID]int // 映射表: PageID -> FrameID
+
+	writeMu sync.Mutex // 串行化页面写入；持有 mu 时才能获取，保证同一页的写入按顺序落盘
+	flusher *flusher   // 后台刷盘，nil 表示淘汰脏页时同步写回
+
+	loading     map[page.PageID]chan struct{} // 正在后台预读的页，读完时关闭通道，见 Prefetch
+	prefetching sync.WaitGroup                // 进行中的预读，FlushAllPages 之前等它们结束
 }
 
-// NewBufferPoolManager 初始化
+// NewBufferPoolManager 初始化，使用 LRU 替换算法
 func NewBufferPoolManager(diskManager disk.DiskManager, poolSize int) *BufferPoolManager {
+	return NewBufferPoolManagerWithReplacer(diskManager, poolSize, NewLRUReplacer(poolSize))
+}
+
+// NewBufferPoolManagerWithReplacer 使用指定的替换算法初始化，replacer 的容量应不小于 poolSize
+func NewBufferPoolManagerWithReplacer(diskManager disk.DiskManager, poolSize int, replacer Replacer) *BufferPoolManager {
 	bpm := &BufferPoolManager{
 		diskManager: diskManager,
 		pages:       make([]*page.Page, poolSize),
-		replacer:    NewLRUReplacer(poolSize),
+		replacer:    replacer,
 		freeList:    make([]int, poolSize),
 		pageTable:   make(map[page.PageID]int),
+		loading:     make(map[page.PageID]chan struct{}),
 	}
 
+	pageSize := diskManager.PageSize()
 	for i := 0; i < poolSize; i++ {
-		bpm.pages[i] = &page.Page{} // 预分配内存对象
-		bpm.freeList[i] = i         // 初始时所有 Frame 都是空闲的
+		bpm.pages[i] = page.NewPage(pageSize) // 预分配内存对象
+		bpm.freeList[i] = i                   // 初始时所有 Frame 都是空闲的
 	}
 
 	return bpm
 }
 
+// PoolSize 返回缓冲池的 Frame 数量
+func (b *BufferPoolManager) PoolSize() int {
+	return len(b.pages)
+}
+
+// PageSize 返回页面大小（字节），与数据文件的页大小相同
+func (b *BufferPoolManager) PageSize() int {
+	return b.diskManager.PageSize()
+}
+
+// ErrNoFreeFrame 缓冲池中所有页面都被 Pin 住，没有 Frame 可以用来读入新页
+var ErrNoFreeFrame = errors.New("no victim found (all pages are pinned)")
+
+// ErrPagesPinned 表示 FlushAllPages 或 FlushAndSync 跳过了仍被 Pin 住的页，它们上面可能有没写回的修改
+var ErrPagesPinned = errors.New("pages still pinned")
+
 // FetchPage 核心方法：获取一个页面
 // 1. 如果在缓存中，直接返回
 // 2. 如果不在，从磁盘读取到缓存（可能需要驱逐旧页）
+// 取不到页面时返回 nil，需要区分原因（例如页面校验和不符）时用 FetchPageErr
 func (b *BufferPoolManager) FetchPage(pageID page.PageID) *page.Page {
+	p, _ := b.FetchPageErr(pageID)
+	return p
+}
+
+// FetchPageErr 与 FetchPage 相同，但返回取不到页面的原因：ErrNoFreeFrame，或 DiskManager 读页的错误
+// 读盘失败（包括 disk.ErrChecksumMismatch）时不会把读坏的页放进缓冲池
+func (b *BufferPoolManager) FetchPageErr(pageID page.PageID) (*page.Page, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.waitLoaded(pageID)
 
 	// 1. 缓存命中 (Cache Hit)
 	if frameID, ok := b.pageTable[pageID]; ok {
 		b.replacer.Pin(frameID) // 标记为正在使用，阻止被 LRU 驱逐
 		p := b.pages[frameID]
 		p.SetPinCount(p.PinCount() + 1)
-		return p
+		return p, nil
 	}
 
 	// 2. 缓存未命中 (Cache Miss)，需要找一个空闲 Frame
 	frameID, err := b.findVictimFrame()
 	if err != nil {
-		return nil // 内存满了且所有页都被钉住(Pinned)，无法读取新页
+		return nil, err // 内存满了且所有页都被钉住(Pinned)，无法读取新页
 	}
 
 	// 3. 从磁盘读取数据
@@ -68,14 +118,18 @@ func (b *BufferPoolManager) FetchPage(pageID page.PageID) *page.Page {
 	// 真正读取
 	err = b.diskManager.ReadPage(pageID, p)
 	if err != nil {
-		return nil
+		// Frame 已经从 freeList / LRU 中取出，还回 freeList，与 newPage 分配失败时相同
+		p.SetID(page.InvalidPageID)
+		p.SetPinCount(0)
+		b.freeList = append(b.freeList, frameID)
+		return nil, err
 	}
 
 	// 4. 更新映射表和 LRU
 	b.pageTable[pageID] = frameID
 	b.replacer.Pin(frameID)
 
-	return p
+	return p, nil
 }
 
 // UnpinPage 核心方法：释放一个页面
@@ -100,6 +154,7 @@ func (b *BufferPoolManager) UnpinPage(pageID page.PageID, isDirty bool) error {
 	// 如果是脏的，标记一下（注意是 OR 操作，不能把脏页标记回干净）
 	if isDirty {
 		p.SetDirty(true)
+		b.flusher.kick()
 	}
 
 	// 如果没人用了，通知 LRU 算法这个 Frame 可以被淘汰了
@@ -112,6 +167,27 @@ func (b *BufferPoolManager) UnpinPage(pageID page.PageID, isDirty bool) error {
 
 // NewPage 分配一个新的磁盘页，并将其放入缓存
 func (b *BufferPoolManager) NewPage() *page.Page {
+	return b.newPage(func() (page.PageID, error) {
+		return b.diskManager.AllocatePage(), nil
+	})
+}
+
+// NewPageIn 在指定表空间分配新页，DiskManager 需要实现 disk.TablespaceAllocator
+// 0 号表空间总是可用，等同于 NewPage
+func (b *BufferPoolManager) NewPageIn(space int) *page.Page {
+	if space == 0 {
+		return b.NewPage()
+	}
+	alloc, ok := b.diskManager.(disk.TablespaceAllocator)
+	if !ok {
+		return nil
+	}
+	return b.newPage(func() (page.PageID, error) {
+		return alloc.AllocatePageIn(space)
+	})
+}
+
+func (b *BufferPoolManager) newPage(allocate func() (page.PageID, error)) *page.Page {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -121,8 +197,16 @@ func (b *BufferPoolManager) NewPage() *page.Page {
 		return nil
 	}
 
-	// 2. 在磁盘分配新 PageID
-	newPageID := b.diskManager.AllocatePage()
+	// 2. 在磁盘分配新 PageID；复用空闲页时 DiskManager 要改写文件头，和其他页面写入一样串行
+	b.writeMu.Lock()
+	newPageID, err := allocate()
+	b.writeMu.Unlock()
+	if err != nil {
+		// Frame 已经从 freeList / LRU 中取出，还回 freeList
+		b.pages[frameID].SetID(page.InvalidPageID)
+		b.freeList = append(b.freeList, frameID)
+		return nil
+	}
 
 	// 3. 初始化内存页对象
 	p := b.pages[frameID]
@@ -149,7 +233,7 @@ func (b *BufferPoolManager) FlushPage(pageID page.PageID) bool {
 	}
 
 	p := b.pages[frameID]
-	b.diskManager.WritePage(pageID, p)
+	b.writePage(p)
 	p.SetDirty(false) // 刷盘后变干净了
 	return true
 }
@@ -165,15 +249,15 @@ func (b *BufferPoolManager) findVictimFrame() (int, error) {
 	}
 
 	// 2. FreeList 空了，求助 LRU 算法
-	frameID := b.replacer.Victim()
+	frameID := b.pickVictim()
 	if frameID == -1 {
-		return -1, errors.New("no victim found (all pages are pinned)")
+		return -1, ErrNoFreeFrame
 	}
 
 	// 3. 驱逐旧页前，检查是否需要写回磁盘 (Eviction Logic)
 	victimPage := b.pages[frameID]
 	if victimPage.IsDirty() {
-		b.diskManager.WritePage(victimPage.ID(), victimPage)
+		b.writePage(victimPage)
 	}
 
 	// 4. 从映射表中移除旧页 ID
@@ -181,21 +265,51 @@ func (b *BufferPoolManager) findVictimFrame() (int, error) {
 
 	return frameID, nil
 }
+
+// pickVictim 选出要淘汰的 Frame
+// 开启后台刷盘时优先淘汰干净页，脏页留给后台写回，只有找不到干净页时才同步写
+func (b *BufferPoolManager) pickVictim() int {
+	f := b.flusher
+	if f == nil {
+		return b.replacer.Victim()
+	}
+	defer f.kick()
+
+	frameID := b.replacer.VictimWhere(func(id int) bool {
+		return id != f.flushing && !b.pages[id].IsDirty()
+	})
+	if frameID != -1 {
+		return frameID
+	}
+	// 正在后台写回的页已被标记为干净，淘汰后再读回来会读到旧数据，所以跳过
+	return b.replacer.VictimWhere(func(id int) bool {
+		return id != f.flushing
+	})
+}
+
+// writePage 同步写回一个页面，调用方必须持有 mu
+func (b *BufferPoolManager) writePage(p *page.Page) error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return b.diskManager.WritePage(p.ID(), p)
+}
+
 func (b *BufferPoolManager) DeletePage(pageID page.PageID) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.waitLoaded(pageID) // 预读中的页读完后就没有人 Pin 住，可以删除
 
 	frameID, ok := b.pageTable[pageID]
 	if !ok {
 		// 页面不在内存中，直接通知磁盘释放
-		b.diskManager.DeallocatePage(pageID)
+		b.deallocate(pageID)
 		return true
 	}
 
 	targetPage := b.pages[frameID]
 
-	// 如果页面被钉住（正在使用），则无法删除
-	if targetPage.PinCount() > 0 {
+	// 如果页面被钉住（正在使用）或正在后台写回，则无法删除
+	if targetPage.PinCount() > 0 || (b.flusher != nil && b.flusher.flushing == frameID) {
 		return false
 	}
 
@@ -203,7 +317,7 @@ func (b *BufferPoolManager) DeletePage(pageID page.PageID) bool {
 	delete(b.pageTable, pageID)
 
 	// 2. 停止 LRU 追踪（因为它已经不存在了）
-	b.replacer.Pin(frameID) // Pin 会将其从 LRU 列表中移除
+	b.replacer.Remove(frameID) // 从 LRU 列表中移除，并清除访问记录
 	// 注意：这里我们不需要再 Unpin，因为我们要手动将其放入 FreeList
 
 	// 3. 将 Frame 放回空闲列表
@@ -215,20 +329,154 @@ func (b *BufferPoolManager) DeletePage(pageID page.PageID) bool {
 	targetPage.SetDirty(false)
 
 	// 5. 通知磁盘释放
-	b.diskManager.DeallocatePage(pageID)
+	b.deallocate(pageID)
 
 	return true
 }
-func (b *BufferPoolManager) FlushAllPages() {
+
+// deallocate 通知磁盘释放页面，调用方必须持有 mu
+// DiskManager 把页放回空闲页链表时要写这一页和文件头，和其他页面写入一样串行
+func (b *BufferPoolManager) deallocate(pageID page.PageID) {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	b.diskManager.DeallocatePage(pageID)
+}
+
+// EvictWhere 把 match 为真的页面写回（如果是脏页）并移出缓冲池，页面仍保留在磁盘上
+// 被 Pin 住或正在后台写回的页面无法淘汰，计入 skipped；写回失败时停止并返回错误，该页保持为脏页
+func (b *BufferPoolManager) EvictWhere(match func(page.PageID) bool) (evicted, skipped int, err error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	for pageID, frameID := range b.pageTable {
+		if !match(pageID) {
+			continue
+		}
+		p := b.pages[frameID]
+		if p.PinCount() > 0 || (b.flusher != nil && b.flusher.flushing == frameID) {
+			skipped++
+			continue
+		}
+		if p.IsDirty() {
+			if err := b.writePage(p); err != nil {
+				return evicted, skipped, err
+			}
+		}
+
+		delete(b.pageTable, pageID)
+		b.replacer.Remove(frameID) // 从 LRU 列表中移除，Frame 直接回到空闲列表
+		b.freeList = append(b.freeList, frameID)
+		p.SetID(page.InvalidPageID)
+		p.SetPinCount(0)
+		p.SetDirty(false)
+		evicted++
+	}
+	return evicted, skipped, nil
+}
+
+// FlushAllPages 把所有脏页写回磁盘，关闭数据库时调用
+// 被 Pin 住的页可能正被修改（例如关闭时还有连接在插入），写下去可能是改到一半的内容，所以不写，保持原来的脏标记；
+// 写失败的页面同样保持为脏页，继续写其他页。返回所有写入失败和被跳过的页面汇总成的错误
+func (b *BufferPoolManager) FlushAllPages() error {
+	b.prefetching.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errs []error
+	var pinned []page.PageID
+	for _, p := range b.pages {
+		if p.ID() == page.InvalidPageID {
+			continue
+		}
+		// 正在修改的页 Unpin 时才标记为脏，所以不管现在脏不脏都算没写回
+		if p.PinCount() > 0 {
+			pinned = append(pinned, p.ID())
+			continue
+		}
+		if !p.IsDirty() {
+			continue
+		}
+		if err := b.writePage(p); err != nil {
+			errs = append(errs, fmt.Errorf("write page %d: %w", p.ID(), err))
+			continue
+		}
+		p.SetDirty(false)
+	}
+	if len(pinned) > 0 {
+		errs = append(errs, fmt.Errorf("%w, not flushed: %v", ErrPagesPinned, pinned))
+	}
+	// 开启了逐页 fsync 时，结束前再对所有数据文件统一 fsync 一次
+	if d, ok := b.diskManager.(disk.DurableWriter); ok && d.Durable() {
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
+		if err := b.diskManager.Sync(); err != nil {
+			errs = append(errs, fmt.Errorf("sync: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FlushDirtyPages 把没有被 Pin 住的脏页写回磁盘（检查点），返回写回的页数，不改变任何页的 Pin 计数
+// 被 Pin 住的页可能正被修改，写下去可能是改到一半的内容，所以跳过，留到下次检查点或淘汰时再写；
+// 写失败的页保持为脏页，继续写其他页，返回遇到的第一个错误
+func (b *BufferPoolManager) FlushDirtyPages() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	flushed := 0
+	var firstErr error
+	for _, p := range b.pages {
+		if p.ID() == page.InvalidPageID || !p.IsDirty() || p.PinCount() > 0 {
+			continue
+		}
+		if err := b.writePage(p); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		p.SetDirty(false)
+		flushed++
+	}
+	return flushed, firstErr
+}
+
+// FlushAndSync 把所有脏页写回磁盘并 fsync，返回遇到的第一个错误
+// 与 FlushAllPages 不同，写失败的页面保持为脏页，下次还会重试。
+// 被 Pin 住的页同样不写，可能是改到一半的内容：干净的页直接跳过，改它的会话 Unpin 时才标记为脏，之后由它自己的提交写回；
+// 脏页上可能有调用方已经完成的修改（例如正被点查读着），其余的页写回并 fsync 之后报告为 ErrPagesPinned，由调用方重试
+func (b *BufferPoolManager) FlushAndSync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var firstErr error
+	var pinned []page.PageID
 	for _, p := range b.pages {
-		// page.InvalidPageID 通常定义为 -1，确保 page 包已导出该常量
-		// 如果 p.ID() 是有效的且是脏页，则刷盘
-		if p.ID() != page.InvalidPageID && p.IsDirty() {
-			b.diskManager.WritePage(p.ID(), p)
-			p.SetDirty(false)
+		if p.ID() == page.InvalidPageID || !p.IsDirty() {
+			continue
+		}
+		if p.PinCount() > 0 {
+			pinned = append(pinned, p.ID())
+			continue
 		}
+		if err := b.writePage(p); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		p.SetDirty(false)
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if err := b.diskManager.Sync(); err != nil {
+		return err
 	}
+	if len(pinned) > 0 {
+		return fmt.Errorf("%w, not flushed: %v", ErrPagesPinned, pinned)
+	}
+	return nil
 }
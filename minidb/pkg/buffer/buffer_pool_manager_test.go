@@ -1,8 +1,14 @@
 package buffer
 
 import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
 	"os"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"minidb/pkg/storage/disk"
 	"minidb/pkg/storage/page"
@@ -18,45 +24,532 @@ func TestBufferPoolManager(t *testing.T) {
 	// 创建一个只有 2 个 Frame 的缓冲池
 	bpm := NewBufferPoolManager(dm, 2)
 
-	// 1. 创建 Page 0
+	// 1. 创建 Page 1（0 号页是数据文件的文件头，不会分配出来）
 	p0 := bpm.NewPage()
 	assert.NotNil(t, p0)
-	assert.Equal(t, page.PageID(0), p0.ID())
+	assert.Equal(t, page.PageID(1), p0.ID())
 
-	// 写入一些数据到 Page 0，并标记为脏
+	// 写入一些数据到 Page 1，并标记为脏
 	copy(p0.Data[:], []byte("Page 0 Data"))
-	bpm.UnpinPage(0, true) // Unpin, dirty=true
+	bpm.UnpinPage(1, true) // Unpin, dirty=true
 
-	// 2. 创建 Page 1
+	// 2. 创建 Page 2
 	p1 := bpm.NewPage()
 	assert.NotNil(t, p1)
-	assert.Equal(t, page.PageID(1), p1.ID())
+	assert.Equal(t, page.PageID(2), p1.ID())
 	copy(p1.Data[:], []byte("Page 1 Data"))
-	bpm.UnpinPage(1, true)
+	bpm.UnpinPage(2, true)
 
-	// 此时 Pool 满了: [Page0(LRU), Page1(MRU)]
+	// 此时 Pool 满了: [Page1(LRU), Page2(MRU)]
 
-	// 3. 创建 Page 2 -> 应该触发 Page 0 被驱逐 (Evict) 并刷盘
+	// 3. 创建 Page 3 -> 应该触发 Page 1 被驱逐 (Evict) 并刷盘
 	p2 := bpm.NewPage()
 	assert.NotNil(t, p2)
-	assert.Equal(t, page.PageID(2), p2.ID())
+	assert.Equal(t, page.PageID(3), p2.ID())
 	copy(p2.Data[:], []byte("Page 2 Data"))
-	bpm.UnpinPage(2, false)
+	bpm.UnpinPage(3, false)
 
-	// 4. 再次读取 Page 0 -> 应该从磁盘读回来 (包含之前的写入)
-	p0_read := bpm.FetchPage(0)
+	// 4. 再次读取 Page 1 -> 应该从磁盘读回来 (包含之前的写入)
+	p0_read := bpm.FetchPage(1)
 	assert.NotNil(t, p0_read)
 	// 验证数据是否还在 (说明驱逐时正确刷盘了)
 	assert.Equal(t, "Page 0 Data", string(p0_read.Data[:11]))
 	
-	// 此时 Pool: [Page1(被驱逐), Page2, Page0] -> Page 1 应该不在内存了
+	// 此时 Pool: [Page2(被驱逐), Page3, Page1] -> Page 2 应该不在内存了
 	
-	// 5. 验证 Page 1 是否真的被驱逐了 (Fetch 应该不会影响 PinCount，因为是重新加载的)
+	// 5. 验证 Page 2 是否真的被驱逐了 (Fetch 应该不会影响 PinCount，因为是重新加载的)
 	// 这里的验证比较隐晦，主要看是否触发了 Disk Read
-	p1_read := bpm.FetchPage(1)
+	p1_read := bpm.FetchPage(2)
 	assert.NotNil(t, p1_read)
 	assert.Equal(t, "Page 1 Data", string(p1_read.Data[:11]))
 
-	bpm.UnpinPage(0, false)
 	bpm.UnpinPage(1, false)
-}
\ No newline at end of file
+	bpm.UnpinPage(2, false)
+}
+
+// memDiskManager 是内存中的 DiskManager，writeDelay 模拟慢速写盘
+// ReadPage 和 WritePage 可以并发调用，满足后台刷盘的要求
+type memDiskManager struct {
+	mu         sync.Mutex
+	pages      map[page.PageID][]byte
+	next       page.PageID
+	writeDelay time.Duration
+	reads      int // ReadPage 被调用的次数，即缓冲池未命中的次数
+}
+
+func newMemDiskManager(writeDelay time.Duration) *memDiskManager {
+	return &memDiskManager{pages: make(map[page.PageID][]byte), writeDelay: writeDelay}
+}
+
+func (m *memDiskManager) ReadPage(pageID page.PageID, p *page.Page) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	copy(p.Data[:], m.pages[pageID])
+	return nil
+}
+
+func (m *memDiskManager) WritePage(pageID page.PageID, p *page.Page) error {
+	data := append([]byte(nil), p.Data[:page.PageSize]...)
+	time.Sleep(m.writeDelay)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pages[pageID] = data
+	return nil
+}
+
+func (m *memDiskManager) AllocatePage() page.PageID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next++
+	return m.next - 1
+}
+
+func (m *memDiskManager) DeallocatePage(page.PageID) {}
+func (m *memDiskManager) PageSize() int              { return page.PageSize }
+func (m *memDiskManager) Sync() error                { return nil }
+func (m *memDiskManager) Close() error               { return nil }
+
+func TestBufferPoolFlusher(t *testing.T) {
+	const numPages, poolSize = 64, 8
+	dm := newMemDiskManager(0)
+	bpm := NewBufferPoolManager(dm, poolSize)
+	bpm.StartFlusher(3)
+
+	for i := 0; i < numPages; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p)
+		bpm.UnpinPage(p.ID(), true)
+	}
+
+	// 随机改写页面，每页记录自己的最新版本号，淘汰和后台写回都不能丢掉新版本
+	versions := make([]uint64, numPages)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		id := page.PageID(rng.Intn(numPages))
+		p := bpm.FetchPage(id)
+		if p == nil {
+			t.Fatalf("fetch page %d failed", id)
+		}
+		if got := binary.LittleEndian.Uint64(p.Data[:]); got != versions[id] {
+			t.Fatalf("page %d: version %d, want %d", id, got, versions[id])
+		}
+		dirty := rng.Intn(2) == 0
+		if dirty {
+			versions[id]++
+			binary.LittleEndian.PutUint64(p.Data[:], versions[id])
+		}
+		bpm.UnpinPage(id, dirty)
+	}
+
+	bpm.StopFlusher()
+	bpm.FlushAllPages()
+	for id, want := range versions {
+		if got := binary.LittleEndian.Uint64(dm.pages[page.PageID(id)]); got != want {
+			t.Errorf("page %d on disk: version %d, want %d", id, got, want)
+		}
+	}
+}
+
+func TestBufferPoolEvictWhere(t *testing.T) {
+	dm := newMemDiskManager(0)
+	bpm := NewBufferPoolManager(dm, 4)
+	for i := 0; i < 4; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p)
+		copy(p.Data[:], fmt.Sprintf("page %d", p.ID()))
+		if i < 3 {
+			bpm.UnpinPage(p.ID(), true)
+		}
+	}
+
+	// 页 3 仍被 Pin 住，不能淘汰；其余脏页写回后移出
+	evicted, skipped, err := bpm.EvictWhere(func(page.PageID) bool { return true })
+	assert.NoError(t, err)
+	assert.Equal(t, 3, evicted)
+	assert.Equal(t, 1, skipped)
+	for id := page.PageID(0); id < 3; id++ {
+		assert.Equal(t, fmt.Sprintf("page %d", id), string(dm.pages[id][:6]))
+	}
+	assert.Equal(t, 3, len(bpm.freeList))
+
+	// 只淘汰匹配的页面，再次读取时从磁盘读回
+	p := bpm.FetchPage(1)
+	assert.Equal(t, "page 1", string(p.Data[:6]))
+	bpm.UnpinPage(1, false)
+	evicted, skipped, err = bpm.EvictWhere(func(id page.PageID) bool { return id == 0 })
+	assert.NoError(t, err)
+	assert.Equal(t, 0, evicted+skipped)
+	evicted, _, _ = bpm.EvictWhere(func(id page.PageID) bool { return id == 1 })
+	assert.Equal(t, 1, evicted)
+	bpm.UnpinPage(3, false)
+}
+
+func TestBufferPoolFlushDirtyPages(t *testing.T) {
+	dm := newMemDiskManager(0)
+	bpm := NewBufferPoolManager(dm, 4)
+	for i := 0; i < 4; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p)
+		copy(p.Data[:], fmt.Sprintf("page %d", p.ID()))
+		if i < 2 {
+			bpm.UnpinPage(p.ID(), true)
+		} else if i == 2 {
+			bpm.UnpinPage(p.ID(), false)
+		}
+	}
+
+	// 页 0、1 是脏页，写回；页 2 是干净的；页 3 仍被 Pin 住，可能正被修改，不写
+	flushed, err := bpm.FlushDirtyPages()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flushed)
+	for id := page.PageID(0); id < 2; id++ {
+		assert.Equal(t, fmt.Sprintf("page %d", id), string(dm.pages[id][:6]))
+		assert.False(t, bpm.pages[bpm.pageTable[id]].IsDirty())
+	}
+	assert.Nil(t, dm.pages[3])
+	p3 := bpm.pages[bpm.pageTable[3]]
+	assert.Equal(t, int32(1), p3.PinCount())
+
+	// Unpin 之后下一次检查点写回
+	bpm.UnpinPage(3, true)
+	flushed, err = bpm.FlushDirtyPages()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, flushed)
+	assert.Equal(t, "page 3", string(dm.pages[3][:6]))
+	assert.Equal(t, int32(0), p3.PinCount())
+}
+
+// failWrites 让指定页面的写入失败
+type failWrites struct {
+	*memDiskManager
+	fail map[page.PageID]bool
+}
+
+func (f failWrites) WritePage(pageID page.PageID, p *page.Page) error {
+	if f.fail[pageID] {
+		return fmt.Errorf("injected write failure")
+	}
+	return f.memDiskManager.WritePage(pageID, p)
+}
+
+func TestBufferPoolFlushAllPages(t *testing.T) {
+	dm := failWrites{newMemDiskManager(0), map[page.PageID]bool{1: true, 2: true}}
+	bpm := NewBufferPoolManager(dm, 4)
+	for i := 0; i < 4; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p)
+		copy(p.Data[:], fmt.Sprintf("page %d", p.ID()))
+		if i < 3 {
+			bpm.UnpinPage(p.ID(), true)
+		}
+	}
+
+	// 页 0 写回；页 1、2 写失败，两个错误都要报告；页 3 被 Pin 住（可能改到一半），不写
+	err := bpm.FlushAllPages()
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrPagesPinned)
+	assert.Contains(t, err.Error(), "write page 1")
+	assert.Contains(t, err.Error(), "write page 2")
+	assert.Equal(t, "page 0", string(dm.pages[0][:6]))
+	assert.Nil(t, dm.pages[3])
+	for id := page.PageID(1); id < 3; id++ {
+		assert.True(t, bpm.pages[bpm.pageTable[id]].IsDirty(), "page %d should stay dirty", id)
+	}
+
+	// 故障消失、页面 Unpin 之后全部写回
+	delete(dm.fail, 1)
+	delete(dm.fail, 2)
+	bpm.UnpinPage(3, true)
+	assert.NoError(t, bpm.FlushAllPages())
+	for id := page.PageID(0); id < 4; id++ {
+		assert.Equal(t, fmt.Sprintf("page %d", id), string(dm.pages[id][:6]))
+	}
+}
+
+func TestBufferPoolFlushAndSync(t *testing.T) {
+	dm := newMemDiskManager(0)
+	bpm := NewBufferPoolManager(dm, 4)
+	for i := 0; i < 3; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p)
+		copy(p.Data[:], fmt.Sprintf("page %d", p.ID()))
+		if i < 2 {
+			bpm.UnpinPage(p.ID(), true)
+		}
+	}
+	// 页 1 是被读者 Pin 住的脏页；页 2 被 Pin 住但还没标记为脏（可能改到一半）
+	assert.NotNil(t, bpm.FetchPage(1))
+
+	err := bpm.FlushAndSync()
+	assert.ErrorIs(t, err, ErrPagesPinned)
+	assert.Contains(t, err.Error(), "[1]")
+	assert.Equal(t, "page 0", string(dm.pages[0][:6]))
+	assert.Nil(t, dm.pages[1])
+	assert.Nil(t, dm.pages[2])
+	assert.True(t, bpm.pages[bpm.pageTable[1]].IsDirty(), "page 1 should stay dirty")
+
+	// 读者 Unpin 之后写回
+	bpm.UnpinPage(1, false)
+	assert.NoError(t, bpm.FlushAndSync())
+	assert.Equal(t, "page 1", string(dm.pages[1][:6]))
+	assert.Nil(t, dm.pages[2])
+}
+
+func TestBufferPoolPrefetch(t *testing.T) {
+	dm := newMemDiskManager(0)
+	bpm := NewBufferPoolManager(dm, 4)
+	for i := 0; i < 8; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p)
+		copy(p.Data[:], fmt.Sprintf("page %d", p.ID()))
+		bpm.UnpinPage(p.ID(), true)
+	}
+	_, _, err := bpm.EvictWhere(func(page.PageID) bool { return true })
+	assert.NoError(t, err)
+
+	// 预读之后 FetchPage 直接命中，不再读盘
+	reads := dm.reads
+	bpm.Prefetch(5)
+	bpm.Prefetch(5) // 已经在预读，什么也不做
+	p := bpm.FetchPage(5)
+	assert.Equal(t, "page 5", string(p.Data[:6]))
+	assert.Equal(t, int32(1), p.PinCount())
+	assert.Equal(t, reads+1, dm.reads)
+	bpm.UnpinPage(5, false)
+
+	// 预读了却没用上的页 Pin 计数为 0，之后像普通页一样被淘汰
+	for id := page.PageID(0); id < 3; id++ {
+		bpm.Prefetch(id)
+	}
+	bpm.prefetching.Wait()
+	for _, f := range bpm.pages {
+		assert.Equal(t, int32(0), f.PinCount(), "page %d", f.ID())
+	}
+	for id := page.PageID(4); id < 8; id++ {
+		p := bpm.FetchPage(id)
+		assert.NotNil(t, p, "fetch page %d", id)
+		assert.Equal(t, fmt.Sprintf("page %d", id), string(p.Data[:6]))
+	}
+	for id := page.PageID(0); id < 3; id++ {
+		_, cached := bpm.pageTable[id]
+		assert.False(t, cached, "page %d should have been evicted", id)
+	}
+
+	// 所有 Frame 都被 Pin 住时预读什么也不做
+	bpm.Prefetch(0)
+	bpm.prefetching.Wait()
+	_, cached := bpm.pageTable[0]
+	assert.False(t, cached)
+	for id := page.PageID(4); id < 8; id++ {
+		bpm.UnpinPage(id, false)
+	}
+	assert.NoError(t, bpm.FlushAllPages())
+}
+
+// benchmarkFetchUnderWrites 在慢速写盘下随机读写页面，报告单次 FetchPage 的 p99 延迟
+func benchmarkFetchUnderWrites(b *testing.B, cleanFrames int) {
+	const numPages, poolSize = 512, 64
+	bpm := NewBufferPoolManager(newMemDiskManager(50*time.Microsecond), poolSize)
+	for i := 0; i < numPages; i++ {
+		p := bpm.NewPage()
+		bpm.UnpinPage(p.ID(), true)
+	}
+	bpm.StartFlusher(cleanFrames)
+	defer bpm.StopFlusher()
+
+	rng := rand.New(rand.NewSource(1))
+	latencies := make([]time.Duration, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := page.PageID(rng.Intn(numPages))
+		start := time.Now()
+		p := bpm.FetchPage(id)
+		latencies = append(latencies, time.Since(start))
+		if p == nil {
+			b.Fatalf("fetch page %d failed", id)
+		}
+		// 四分之一的访问会修改页面，写入量低于后台刷盘的吞吐
+		bpm.UnpinPage(id, i%4 == 0)
+		// 模拟请求之间的处理时间，给后台刷盘留出空档
+		time.Sleep(20 * time.Microsecond)
+	}
+	b.StopTimer()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns/fetch")
+}
+
+func BenchmarkFetchSyncEviction(b *testing.B)  { benchmarkFetchUnderWrites(b, 0) }
+func BenchmarkFetchCleanReserve(b *testing.B) { benchmarkFetchUnderWrites(b, 8) }
+
+func TestBufferPoolFrames(t *testing.T) {
+	bpm := NewBufferPoolManager(newMemDiskManager(0), 4)
+	p0 := bpm.NewPage()
+	p1 := bpm.NewPage()
+	p2 := bpm.NewPage()
+	// Frame 只按数据库的页大小分配，不按 MaxPageSize
+	assert.Equal(t, page.PageSize, len(p0.Data))
+	bpm.UnpinPage(p1.ID(), true)
+	bpm.UnpinPage(p0.ID(), false)
+
+	frames := bpm.Frames()
+	assert.Equal(t, 4, len(frames))
+	byPage := make(map[page.PageID]FrameInfo)
+	free := 0
+	for _, f := range frames {
+		if f.Free {
+			free++
+			assert.Equal(t, -1, f.LRU)
+			continue
+		}
+		byPage[f.PageID] = f
+	}
+	assert.Equal(t, 1, free)
+	// p1 先 Unpin，最久未用，下一个被淘汰
+	assert.Equal(t, 0, byPage[p1.ID()].LRU)
+	assert.True(t, byPage[p1.ID()].Dirty)
+	assert.Equal(t, 1, byPage[p0.ID()].LRU)
+	assert.False(t, byPage[p0.ID()].Dirty)
+	assert.Equal(t, -1, byPage[p2.ID()].LRU)
+	assert.Equal(t, int32(1), byPage[p2.ID()].PinCount)
+	bpm.UnpinPage(p2.ID(), false)
+}
+
+// 读到校验和不符的页时 FetchPageErr 返回错误，Frame 还回缓冲池
+func TestFetchPageChecksumMismatch(t *testing.T) {
+	dbFile := t.TempDir() + "/crc.db"
+	dm, err := disk.NewDiskManager(dbFile)
+	assert.Nil(t, err)
+	bpm := NewBufferPoolManager(dm, 1)
+	p := bpm.NewPage()
+	pid := p.ID()
+	copy(p.Data[page.HeaderSize:], "row data")
+	bpm.UnpinPage(pid, true)
+	bpm.FlushAllPages()
+	dm.Close()
+
+	f, _ := os.OpenFile(dbFile, os.O_RDWR, 0664)
+	f.WriteAt([]byte("garbage"), int64(pid)*page.PageSize+page.HeaderSize)
+	f.Close()
+
+	dm, err = disk.NewDiskManager(dbFile)
+	assert.Nil(t, err)
+	defer dm.Close()
+	bpm = NewBufferPoolManager(dm, 1)
+	p, err = bpm.FetchPageErr(pid)
+	assert.Nil(t, p)
+	assert.ErrorIs(t, err, disk.ErrChecksumMismatch)
+	assert.Nil(t, bpm.FetchPage(pid))
+
+	// 唯一的 Frame 没有被读坏的页占住
+	p = bpm.NewPage()
+	assert.NotNil(t, p)
+	bpm.UnpinPage(p.ID(), false)
+}
+
+func TestLRUKReplacer(t *testing.T) {
+	r := NewLRUKReplacer(4, 2)
+	access := func(frames ...int) {
+		for _, id := range frames {
+			r.Pin(id)
+			r.Unpin(id)
+		}
+	}
+	access(1, 1, 2, 2, 0, 3)
+	// 0 和 3 只访问过一次，按普通 LRU 先淘汰；1 倒数第二次访问早于 2
+	assert.Equal(t, []int{0, 3, 1, 2}, r.Oldest(4))
+	assert.Equal(t, 4, r.Size())
+
+	// 被 Pin 住的 Frame 不会被淘汰；Pin 也算一次访问，3 现在访问满两次了
+	r.Pin(3)
+	assert.Equal(t, 0, r.Victim())
+	assert.Equal(t, []int{1, 2}, r.Oldest(4))
+	r.Unpin(3)
+	assert.Equal(t, []int{1, 2, 3}, r.Oldest(4))
+
+	// Remove 清除访问记录，之后 Frame 装载新页，从一次访问重新开始
+	r.Remove(2)
+	access(2)
+	assert.Equal(t, []int{2, 1, 3}, r.Oldest(4))
+	assert.Equal(t, 1, r.VictimWhere(func(id int) bool { return id == 1 }))
+	assert.Equal(t, 2, r.Victim())
+	assert.Equal(t, 3, r.Victim())
+	assert.Equal(t, -1, r.Victim())
+}
+
+// 全表扫描之后，LRU-K 缓冲池中的热点页仍然命中，普通 LRU 的被挤了出去
+func TestLRUKResistsScan(t *testing.T) {
+	const poolSize, hotPages, coldPages = 8, 3, 40
+	for _, tc := range []struct {
+		name       string
+		replacer   Replacer
+		wantMisses int
+	}{
+		{"lru", NewLRUReplacer(poolSize), hotPages},
+		{"lru-k", NewLRUKReplacer(poolSize, 2), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := newMemDiskManager(0)
+			bpm := NewBufferPoolManagerWithReplacer(dm, poolSize, tc.replacer)
+			for i := 0; i < hotPages+coldPages; i++ {
+				p := bpm.NewPage()
+				bpm.UnpinPage(p.ID(), true)
+			}
+			touch := func(id page.PageID) {
+				assert.NotNil(t, bpm.FetchPage(id))
+				bpm.UnpinPage(id, false)
+			}
+			for id := page.PageID(0); id < hotPages; id++ {
+				touch(id)
+				touch(id)
+			}
+			for id := page.PageID(hotPages); id < hotPages+coldPages; id++ {
+				touch(id)
+			}
+			before := dm.reads
+			for id := page.PageID(0); id < hotPages; id++ {
+				touch(id)
+			}
+			assert.Equal(t, tc.wantMisses, dm.reads-before)
+		})
+	}
+}
+
+// benchmarkScanWithHotSet 反复扫描一张大表，期间不断访问一小组热点页，报告热点页的未命中率
+func benchmarkScanWithHotSet(b *testing.B, replacer Replacer) {
+	const poolSize, hotPages, tablePages = 64, 8, 1024
+	dm := newMemDiskManager(0)
+	bpm := NewBufferPoolManagerWithReplacer(dm, poolSize, replacer)
+	for i := 0; i < hotPages+tablePages; i++ {
+		p := bpm.NewPage()
+		bpm.UnpinPage(p.ID(), true)
+	}
+	touch := func(id page.PageID) {
+		if bpm.FetchPage(id) == nil {
+			b.Fatalf("fetch page %d failed", id)
+		}
+		bpm.UnpinPage(id, false)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	hotFetches, hotMisses := 0, 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for id := page.PageID(hotPages); id < hotPages+tablePages; id++ {
+			touch(id)
+			// 每扫 16 页访问一次热点页
+			if id%16 == 0 {
+				before := dm.reads
+				touch(page.PageID(rng.Intn(hotPages)))
+				hotFetches++
+				hotMisses += dm.reads - before
+			}
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(hotMisses)/float64(hotFetches), "hot-miss-rate")
+}
+
+func BenchmarkScanHotSetLRU(b *testing.B)  { benchmarkScanWithHotSet(b, NewLRUReplacer(64)) }
+func BenchmarkScanHotSetLRUK(b *testing.B) { benchmarkScanWithHotSet(b, NewLRUKReplacer(64, 2)) }
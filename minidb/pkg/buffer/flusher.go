@@ -0,0 +1,119 @@
+package buffer
+
+import "minidb/pkg/storage/page"
+
+// flusher 是缓冲池的后台刷盘协程
+// 它让 LRU 尾部最先被淘汰的 reserve 个 Frame 保持干净，
+// 这样 FetchPage/NewPage 淘汰页面时通常不用在关键路径上同步写盘
+type flusher struct {
+	reserve  int
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	buf      *page.Page // 写回用的页面副本，写盘期间不持有 mu
+	flushing int        // 正在写回的 FrameID，-1 表示没有
+}
+
+// StartFlusher 启动后台刷盘，保持 cleanFrames 个干净的可淘汰 Frame
+// 后台写页时前台可能同时读页，DiskManager 的 ReadPage 必须能与 WritePage 并发执行
+// cleanFrames <= 0 时等同于 StopFlusher
+func (b *BufferPoolManager) StartFlusher(cleanFrames int) {
+	b.StopFlusher()
+	if cleanFrames <= 0 {
+		return
+	}
+	f := &flusher{
+		reserve:  cleanFrames,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		buf:      page.NewPage(b.diskManager.PageSize()),
+		flushing: -1,
+	}
+	b.mu.Lock()
+	b.flusher = f
+	b.mu.Unlock()
+	go b.runFlusher(f)
+}
+
+// StopFlusher 停止后台刷盘并等待正在进行的写入完成，之后淘汰脏页恢复为同步写回
+func (b *BufferPoolManager) StopFlusher() {
+	b.mu.Lock()
+	f := b.flusher
+	b.flusher = nil
+	b.mu.Unlock()
+	if f != nil {
+		close(f.stop)
+		<-f.done
+	}
+}
+
+// kick 通知后台协程检查干净页储备，不会阻塞；nil 接收者是空操作
+func (f *flusher) kick() {
+	if f == nil {
+		return
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *BufferPoolManager) runFlusher(f *flusher) {
+	defer close(f.done)
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-f.wake:
+		}
+		for b.flushOne(f) {
+			select {
+			case <-f.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// flushOne 写回即将被淘汰的 Frame 中最旧的一个脏页，没有需要写的页时返回 false
+func (b *BufferPoolManager) flushOne(f *flusher) bool {
+	b.mu.Lock()
+	// 空闲 Frame 本身就是干净的，算在储备里
+	need := f.reserve - len(b.freeList)
+	frameID := -1
+	if need > 0 {
+		for _, id := range b.replacer.Oldest(need) {
+			if b.pages[id].IsDirty() {
+				frameID = id
+				break
+			}
+		}
+	}
+	if frameID == -1 {
+		b.mu.Unlock()
+		return false
+	}
+
+	// 在 mu 保护下复制页面并标记为干净，之后前台可以继续使用甚至再次弄脏它
+	p := b.pages[frameID]
+	pageID := p.ID()
+	copy(f.buf.Data[:], p.Data[:])
+	p.SetDirty(false)
+	f.flushing = frameID
+
+	// 先拿到 writeMu 再释放 mu：之后对同一页的写入一定排在这次之后，旧副本不会覆盖新数据
+	b.writeMu.Lock()
+	b.mu.Unlock()
+	err := b.diskManager.WritePage(pageID, f.buf)
+	b.writeMu.Unlock()
+
+	b.mu.Lock()
+	f.flushing = -1
+	if err != nil && p.ID() == pageID {
+		p.SetDirty(true) // 写失败，留给淘汰时同步重试
+	}
+	b.mu.Unlock()
+	return err == nil
+}
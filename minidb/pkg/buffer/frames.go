@@ -0,0 +1,45 @@
+package buffer
+
+import "minidb/pkg/storage/page"
+
+// FrameInfo 是缓冲池中一个 Frame 某一时刻的状态，供诊断使用
+type FrameInfo struct {
+	Frame    int
+	PageID   page.PageID // Free 为 true 时无意义
+	Free     bool        // 在空闲列表中，没有装载页面
+	PinCount int32
+	Dirty    bool
+	// LRU 是在替换算法淘汰顺序中的位置，0 表示下一个被淘汰；
+	// 被 Pin 住或空闲的 Frame 不在列表中，为 -1
+	LRU int
+}
+
+// Frames 返回所有 Frame 的状态快照，按 FrameID 排列，只读不修改任何状态
+func (b *BufferPoolManager) Frames() []FrameInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lru := make(map[int]int)
+	for pos, frameID := range b.replacer.Oldest(len(b.pages)) {
+		lru[frameID] = pos
+	}
+	free := make(map[int]bool, len(b.freeList))
+	for _, frameID := range b.freeList {
+		free[frameID] = true
+	}
+
+	frames := make([]FrameInfo, len(b.pages))
+	for i, p := range b.pages {
+		info := FrameInfo{Frame: i, Free: free[i], LRU: -1}
+		if pos, ok := lru[i]; ok {
+			info.LRU = pos
+		}
+		if !info.Free {
+			info.PageID = p.ID()
+			info.PinCount = p.PinCount()
+			info.Dirty = p.IsDirty()
+		}
+		frames[i] = info
+	}
+	return frames
+}
@@ -0,0 +1,96 @@
+package buffer
+
+import "minidb/pkg/storage/page"
+
+// Prefetch 在后台把页面读进缓冲池（预读），不 Pin 住：顺序扫描处理当前叶子时先把下一个叶子读进来，
+// 等它真正 FetchPage 时通常已经在内存里了。
+// 只用空闲 Frame 或可以直接淘汰的干净页，不为预读同步写脏页；页面已经在缓冲池中、正在预读或没有合适的 Frame
+// （见 prefetchFrame）时什么也不做。
+// 读入期间 Frame 暂时被 Pin 住，读完后 Pin 计数回到 0，和普通 Unpin 之后一样可以被淘汰，预读了却没用上的页不会泄漏；
+// 读取失败（包括校验和不符）时把 Frame 还回去，之后的 FetchPage 会再读一次并报告错误
+func (b *BufferPoolManager) Prefetch(pageID page.PageID) {
+	if pageID == page.InvalidPageID || pageID == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pageTable[pageID]; ok {
+		return
+	}
+	if _, ok := b.loading[pageID]; ok {
+		return
+	}
+	frameID := b.prefetchFrame()
+	if frameID == -1 {
+		return
+	}
+
+	p := b.pages[frameID]
+	p.SetID(pageID)
+	p.SetPinCount(1)
+	p.SetDirty(false)
+	b.pageTable[pageID] = frameID
+	b.replacer.Pin(frameID)
+	done := make(chan struct{})
+	b.loading[pageID] = done
+	b.prefetching.Add(1)
+	go b.load(frameID, pageID, done)
+}
+
+// prefetchFrame 取一个空闲 Frame，没有时淘汰一个干净页；都没有时返回 -1，调用方必须持有 mu
+// 读入中的 Frame 不能淘汰，同时有很多预读（例如很多扫描各自预读下一个叶子）会把缓冲池占满，
+// 所以空闲和可淘汰的 Frame 不超过四分之一时不再预读，留给真正的读取
+func (b *BufferPoolManager) prefetchFrame() int {
+	if len(b.freeList)+b.replacer.Size() <= len(b.pages)/4 {
+		return -1
+	}
+	if len(b.freeList) > 0 {
+		frameID := b.freeList[0]
+		b.freeList = b.freeList[1:]
+		return frameID
+	}
+	f := b.flusher
+	frameID := b.replacer.VictimWhere(func(id int) bool {
+		return !b.pages[id].IsDirty() && (f == nil || id != f.flushing)
+	})
+	if frameID != -1 {
+		delete(b.pageTable, b.pages[frameID].ID())
+	}
+	return frameID
+}
+
+// load 在不持有 mu 的情况下读页：页面已经登记在 pageTable 中并被 Pin 住，
+// 其他线程取这一页时在 waitLoaded 中等待，不会看到读了一半的内容
+func (b *BufferPoolManager) load(frameID int, pageID page.PageID, done chan struct{}) {
+	defer b.prefetching.Done()
+	p := b.pages[frameID]
+	err := b.diskManager.ReadPage(pageID, p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.loading, pageID)
+	close(done)
+	if err != nil {
+		delete(b.pageTable, pageID)
+		b.replacer.Remove(frameID)
+		p.SetID(page.InvalidPageID)
+		p.SetPinCount(0)
+		b.freeList = append(b.freeList, frameID)
+		return
+	}
+	p.SetPinCount(0)
+	b.replacer.Unpin(frameID)
+}
+
+// waitLoaded 页面正在预读时释放 mu 等它读完，调用方必须持有 mu
+func (b *BufferPoolManager) waitLoaded(pageID page.PageID) {
+	for {
+		done, ok := b.loading[pageID]
+		if !ok {
+			return
+		}
+		b.mu.Unlock()
+		<-done
+		b.mu.Lock()
+	}
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AggregateKey 对表的主键列计算聚合函数 count / min / max / sum
+// 空表上 min / max / sum 的结果为 NULL，此时 valid 为 false；count 总是有效
+func (e *Engine) AggregateKey(tableName, fn string) (result int64, valid bool, err error) {
+	fn = strings.ToLower(fn)
+	switch fn {
+	case "count", "min", "max", "sum":
+	default:
+		return 0, false, errorf(ErrUnsupported, "unsupported aggregate function '%s'", fn)
+	}
+
+	if fn == "min" {
+		// 主键有序，第一行就是最小值
+		it, err := e.ScanRange(tableName, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			return 0, false, err
+		}
+		defer it.Close()
+		if !it.Next() {
+			return 0, false, it.Err()
+		}
+		return it.Row().Key, true, nil
+	}
+
+	// 其余的聚合要读完整张表，与顺序无关，按物理页序扫描
+	var count int64
+	err = e.scanUnordered(tableName, func(row Row) bool {
+		switch {
+		case fn == "max" && (count == 0 || row.Key > result):
+			result = row.Key
+		case fn == "sum":
+			result += row.Key
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if fn == "count" {
+		return count, true, nil
+	}
+	return result, count > 0, nil
+}
+
+// CountDistinct 统计某一列不同值的个数，缺失的列和空值、null 都是 NULL，不计入
+// 逐行只解码目标列放进集合，不会把整张表的行留在内存里；主键列唯一，结果就是行数
+func (e *Engine) CountDistinct(tableName, column string) (int64, error) {
+	columns, idx, err := e.lookupColumn(tableName, column)
+	if err != nil {
+		return 0, err
+	}
+	if idx == 0 {
+		count, _, err := e.AggregateKey(tableName, "count")
+		return count, err
+	}
+
+	seen := make(map[string]struct{})
+	err = e.scanUnordered(tableName, func(row Row) bool {
+		if val, ok := decodeColumn(row.Value, idx-1); ok {
+			seen[normalizeValue(columns[idx].Type, val)] = struct{}{}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(seen)), nil
+}
+
+// ApproxCountDistinct 用 HyperLogLog 估算某一列不同值的个数，缺失的列视为 NULL，不计入
+// 与 CountDistinct 的区别是内存固定为 2^hllPrecision 个寄存器，不随不同值的个数增长；
+// 误差约 1%，不同值很少时基本是精确的。主键列唯一，直接返回行数
+func (e *Engine) ApproxCountDistinct(tableName, column string) (int64, error) {
+	columns, idx, err := e.lookupColumn(tableName, column)
+	if err != nil {
+		return 0, err
+	}
+	if idx == 0 {
+		count, _, err := e.AggregateKey(tableName, "count")
+		return count, err
+	}
+
+	hll := newHyperLogLog()
+	err = e.scanUnordered(tableName, func(row Row) bool {
+		if val, ok := decodeColumn(row.Value, idx-1); ok {
+			hll.add(normalizeValue(columns[idx].Type, val))
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return hll.estimate(), nil
+}
+
+// lookupColumn 返回表的列定义和指定列的下标（主键为 0），列不存在时返回 ErrColumnNotFound
+// 旧版本的表结构可能解析不了，此时按列名查找，所有非主键列当作字符串
+func (e *Engine) lookupColumn(tableName, column string) ([]Column, int, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, -1, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, -1, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+
+	columns := meta.Columns()
+	if columns == nil {
+		names, _ := e.TableColumns(tableName)
+		for _, name := range names {
+			columns = append(columns, Column{Name: name, Type: TypeVarchar})
+		}
+	}
+	for i, c := range columns {
+		if strings.EqualFold(c.Name, column) {
+			return columns, i, nil
+		}
+	}
+	return nil, -1, errorf(ErrColumnNotFound, "unknown column '%s' in table '%s'", column, tableName)
+}
+
+// rowColumn 取出行中第 idx 列（主键为 0）的值，列缺失（NULL）时返回 false
+func rowColumn(row Row, idx int) (string, bool) {
+	if idx == 0 {
+		return strconv.FormatInt(row.Key, 10), true
+	}
+	return decodeColumn(row.Value, idx-1)
+}
+
+// decodeColumn 从逗号拼接的非主键列中取出第 i 列（从 0 开始），列不存在或为 NULL（见 isNullValue）时返回 false
+func decodeColumn(value string, i int) (string, bool) {
+	if strings.TrimSpace(value) == "" {
+		return "", false
+	}
+	for ; i > 0; i-- {
+		var found bool
+		if _, value, found = strings.Cut(value, ","); !found {
+			return "", false
+		}
+	}
+	field, _, _ := strings.Cut(value, ",")
+	if isNullValue(field) {
+		return "", false
+	}
+	return strings.TrimSpace(field), true
+}
+
+// normalizeValue 按列类型把值转换成规范形式，比如 int 列的 "007" 和 "7" 是同一个值
+// 无法按类型解析的值原样比较
+func normalizeValue(t ColumnType, val string) string {
+	switch t {
+	case TypeInt, TypeBigInt:
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+	case TypeBool:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	return val
+}
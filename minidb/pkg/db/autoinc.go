@@ -0,0 +1,71 @@
+package db
+
+import "sync/atomic"
+
+// AutoIdBatch 是自增主键每次预留并写入元数据的个数
+// 分配只是一次原子加法，每用完一批才加 Catalog 的锁写一次 meta.json；
+// 崩溃后从已落盘的上限之后继续分配，最多留下不到一批的空洞，但不会重复
+const AutoIdBatch = 100
+
+// initAutoId 加载元数据后调用：上一次运行可能已经分配到 NextAutoId，从它之后继续
+func (t *TableMeta) initAutoId() {
+	t.autoId = t.NextAutoId
+	t.autoCeiling = t.NextAutoId
+}
+
+// NextAutoId 为表分配一个新的自增主键，可以被多个会话并发调用
+func (c *Catalog) NextAutoId(name string) (int64, error) {
+	if r := c.route(name); r != c {
+		return r.NextAutoId(name)
+	}
+	c.mu.RLock()
+	meta, ok := c.Tables[name]
+	c.mu.RUnlock()
+	if !ok {
+		return 0, errorf(ErrTableNotFound, "table '%s' not found", name)
+	}
+	if !meta.AutoIncrement {
+		return 0, errorf(ErrInvalidValue, "table '%s' has no auto_increment column", name)
+	}
+	id := atomic.AddInt64(&meta.autoId, 1)
+	if err := c.reserveAutoId(meta, id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// ObserveAutoId 在插入显式指定的主键后调用，之后分配的自增主键都大于 key
+func (c *Catalog) ObserveAutoId(meta *TableMeta, key int64) error {
+	if r := c.route(meta.Name); r != c {
+		return r.ObserveAutoId(meta, key)
+	}
+	for {
+		cur := atomic.LoadInt64(&meta.autoId)
+		if key <= cur {
+			return nil
+		}
+		if atomic.CompareAndSwapInt64(&meta.autoId, cur, key) {
+			return c.reserveAutoId(meta, key)
+		}
+	}
+}
+
+// reserveAutoId 保证 id 不超过已落盘的上限，超过时预留下一批并写入元数据
+// 元数据写失败时 id 不能使用：崩溃重启后可能再次分配出去
+func (c *Catalog) reserveAutoId(meta *TableMeta, id int64) error {
+	if id <= atomic.LoadInt64(&meta.autoCeiling) {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id <= meta.autoCeiling {
+		return nil
+	}
+	meta.NextAutoId = id + AutoIdBatch - 1
+	if err := c.writeMeta(); err != nil {
+		meta.NextAutoId = meta.autoCeiling
+		return err
+	}
+	atomic.StoreInt64(&meta.autoCeiling, meta.NextAutoId)
+	return nil
+}
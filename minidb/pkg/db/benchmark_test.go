@@ -7,6 +7,7 @@ import (
 	"minidb/pkg/storage/index"
 	"minidb/pkg/storage/page"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -75,3 +76,36 @@ func TestBenchmark(t *testing.T) {
 	fmt.Printf("   QPS:  %.2f ops/sec\n", opsSelect)
 	fmt.Println("------------------------------------------------")
 }
+
+// benchmarkDecodeInt 模拟扫描整数值表：从叶子槽位直接解码出 int64
+// bytes/row 是编码后写入槽位的有效字节数
+func benchmarkDecodeInt(b *testing.B, enc ValueEncoding) {
+	const rows = 4096
+	meta := &TableMeta{Encoding: string(enc)}
+	slots := make([][]byte, rows)
+	var size int
+	for i := range slots {
+		raw, err := encodeValue(meta, strconv.FormatInt(int64(i)*7919-1<<40, 10))
+		if err != nil {
+			b.Fatal(err)
+		}
+		size += len(raw)
+		slots[i] = make([]byte, page.SizeOfVal)
+		copy(slots[i], raw)
+	}
+
+	b.ResetTimer()
+	var sum int64
+	for i := 0; i < b.N; i++ {
+		n, _, err := decodeIntValue(meta, slots[i%rows])
+		if err != nil {
+			b.Fatal(err)
+		}
+		sum += n
+	}
+	b.ReportMetric(float64(size)/rows, "bytes/row")
+	_ = sum
+}
+
+func BenchmarkDecodeIntText(b *testing.B)   { benchmarkDecodeInt(b, EncodingText) }
+func BenchmarkDecodeIntBinary(b *testing.B) { benchmarkDecodeInt(b, EncodingBinary) }
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"math"
+	"minidb/pkg/storage/index"
+	"sync"
+)
+
+// 布隆过滤器参数：每个 Key 10 bit、7 个哈希函数，误判率约 1%
+const (
+	bloomBitsPerKey  = 10
+	bloomHashes      = 7
+	bloomMinCapacity = 1024
+)
+
+// bloomFilter 记录表中可能存在的主键，用于跳过对一定不存在的 Key 的树查找
+// 只增不删：删除或回滚的 Key 仍会被判为"可能存在"，只影响命中率，不影响正确性
+type bloomFilter struct {
+	bits     []uint64
+	nbits    uint64
+	capacity int64 // 超过这么多 Key 之后误判率上升，需要按更大的容量重建
+	count    int64
+}
+
+func newBloomFilter(capacity int64) *bloomFilter {
+	if capacity < bloomMinCapacity {
+		capacity = bloomMinCapacity
+	}
+	nbits := uint64(capacity) * bloomBitsPerKey
+	return &bloomFilter{
+		bits:     make([]uint64, (nbits+63)/64),
+		nbits:    nbits,
+		capacity: capacity,
+	}
+}
+
+// hashes 用 splitmix64 把 Key 打散后做双重哈希，得到 bloomHashes 个位置
+func (f *bloomFilter) hashes(key int64) (h1, h2 uint64) {
+	x := uint64(key) + 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return x, (x >> 33) | 1
+}
+
+func (f *bloomFilter) add(key int64) {
+	h1, h2 := f.hashes(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % f.nbits
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+func (f *bloomFilter) mayContain(key int64) bool {
+	h1, h2 := f.hashes(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % f.nbits
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomRegistry 保存每张表的过滤器，由同一引擎派生的所有会话共享
+// 过滤器只在内存中，首次查询某张表时扫描全表构建
+type bloomRegistry struct {
+	mu      sync.Mutex
+	enabled bool
+	filters map[string]*bloomFilter
+}
+
+// EnableBloomFilters 打开主键布隆过滤器，对之后创建的会话同样生效
+func (e *Engine) EnableBloomFilters() {
+	e.dbs.mu.Lock()
+	e.dbs.bloomsEnabled = true
+	for _, d := range e.dbs.dbs {
+		d.blooms.enable()
+	}
+	e.dbs.mu.Unlock()
+	e.blooms.enable()
+}
+
+func (r *bloomRegistry) enable() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = true
+}
+
+// bloomMayContain 查询过滤器，返回 false 表示 Key 一定不存在
+// 过滤器关闭或构建失败时返回 true，退回到普通的树查找
+func (e *Engine) bloomMayContain(tableName string, meta *TableMeta, key int64) bool {
+	e.blooms.mu.Lock()
+	defer e.blooms.mu.Unlock()
+	if !e.blooms.enabled {
+		return true
+	}
+	f, ok := e.blooms.filters[tableName]
+	if !ok {
+		f = e.buildBloomFilter(meta)
+		e.blooms.filters[tableName] = f
+	}
+	return f.mayContain(key)
+}
+
+// bloomProbe 与 bloomMayContain 相同但不构建过滤器，built 为 false 表示过滤器打开了但还没建好
+func (e *Engine) bloomProbe(tableName string, key int64) (mayContain, built bool) {
+	e.blooms.mu.Lock()
+	defer e.blooms.mu.Unlock()
+	if !e.blooms.enabled {
+		return true, true
+	}
+	f, ok := e.blooms.filters[tableName]
+	if !ok {
+		return true, false
+	}
+	return f.mayContain(key), true
+}
+
+// bloomAdd 在插入成功后登记 Key；Key 数超过容量时按两倍容量重建
+func (e *Engine) bloomAdd(tableName string, meta *TableMeta, key int64) {
+	e.blooms.mu.Lock()
+	defer e.blooms.mu.Unlock()
+	f, ok := e.blooms.filters[tableName]
+	if !ok {
+		return
+	}
+	f.add(key)
+	if f.count > f.capacity {
+		e.blooms.filters[tableName] = e.buildBloomFilter(meta)
+	}
+}
+
+// dropBloomFilter 删表时丢弃过滤器，避免同名新表沿用旧数据造成误判
+func (e *Engine) dropBloomFilter(tableName string) {
+	e.blooms.mu.Lock()
+	defer e.blooms.mu.Unlock()
+	delete(e.blooms.filters, tableName)
+}
+
+// buildBloomFilter 扫描全表构建过滤器，调用方持有 blooms.mu 和表的读锁或写锁
+func (e *Engine) buildBloomFilter(meta *TableMeta) *bloomFilter {
+	defer e.enterRead()()
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	var keys []int64
+	if it := tree.Scan(math.MinInt64, math.MaxInt64); it != nil {
+		for {
+			keys = append(keys, it.Key())
+			if !it.Next() {
+				break
+			}
+		}
+	}
+
+	f := newBloomFilter(int64(len(keys)) * 2)
+	for _, k := range keys {
+		f.add(k)
+	}
+	return f
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/page"
+)
+
+func TestBloomFilter(t *testing.T) {
+	e := newTestEngine(t)
+	e.EnableBloomFilters()
+	e.CreateTable("t", "id int,name string")
+	for i := int64(0); i < 5000; i += 2 {
+		if err := e.Insert("t", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 首次查询时扫描构建；之后的插入要同步登记，超过容量会重建
+	if !e.Contains("t", 0) || e.Contains("t", 1) {
+		t.Fatal("wrong result before growth")
+	}
+	for i := int64(5000); i < 20000; i++ {
+		if err := e.Insert("t", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(0); i < 20000; i++ {
+		want := i >= 5000 || i%2 == 0
+		if got := e.Contains("t", i); got != want {
+			t.Fatalf("Contains(%d) = %v, want %v", i, got, want)
+		}
+	}
+
+	falsePositives := 0
+	f := e.blooms.filters["t"]
+	for i := int64(100000); i < 110000; i++ {
+		if f.mayContain(i) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("false positive rate too high: %d / 10000", falsePositives)
+	}
+
+	// 删表后重建同名表，旧过滤器不能把新数据判为不存在
+	if err := e.DropTable("t"); err != nil {
+		t.Fatal(err)
+	}
+	e.CreateTable("t", "id int,name string")
+	e.Insert("t", 1, "v")
+	if !e.Contains("t", 1) {
+		t.Fatal("stale filter hid a key in the recreated table")
+	}
+}
+
+// countingDiskManager 统计从磁盘读取的页数
+type countingDiskManager struct {
+	disk.DiskManager
+	reads int
+}
+
+func (d *countingDiskManager) ReadPage(pageID page.PageID, p *page.Page) error {
+	d.reads++
+	return d.DiskManager.ReadPage(pageID, p)
+}
+
+func benchmarkMissingKeyLookup(b *testing.B, bloom bool) {
+	root := b.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabase("bench"); err != nil {
+		b.Fatal(err)
+	}
+	dm, err := disk.NewDiskManager(filepath.Join(root, "bench", DataFileName))
+	if err != nil {
+		b.Fatal(err)
+	}
+	counting := &countingDiskManager{DiskManager: dm}
+	e.DiskManager = counting
+	// 缓冲池远小于表的页数，缺失 Key 的查找会真正读盘
+	e.BPM = buffer.NewBufferPoolManager(counting, 8)
+	e.Catalog = NewCatalog(e.BPM, filepath.Join(root, "bench", MetaFileName))
+	e.CurrentDB = "bench"
+	defer e.Close()
+	if bloom {
+		e.EnableBloomFilters()
+	}
+
+	e.CreateTable("t", "id int,name string")
+	for i := int64(0); i < 20000; i++ {
+		e.Insert("t", i*2, "v")
+	}
+	e.Contains("t", 0) // 构建过滤器不计入
+
+	counting.reads = 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Contains("t", int64(i%20000)*2+1)
+	}
+	b.ReportMetric(float64(counting.reads)/float64(b.N), "reads/op")
+}
+
+func BenchmarkMissingKeyLookup(b *testing.B) {
+	benchmarkMissingKeyLookup(b, false)
+}
+
+func BenchmarkMissingKeyLookupBloom(b *testing.B) {
+	benchmarkMissingKeyLookup(b, true)
+}
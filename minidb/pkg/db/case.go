@@ -0,0 +1,382 @@
+package db
+
+import (
+	"cmp"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// reCaseItem 判断投影列表中的一项是不是 CASE 表达式
+var reCaseItem = regexp.MustCompile(`(?is)^case\s`)
+
+// caseExpr 是投影列表中的搜索式 CASE 表达式：
+//
+//	case when <col> <op> <value> then <value> [when ...] [else <value>] end [as <alias>]
+//
+// 条件也可以是 <col> is [not] null。<value> 是字符串、整数、NULL 或列名。
+// 按顺序取第一个成立的 WHEN；都不成立时取 ELSE，没有 ELSE 时结果为 NULL
+type caseExpr struct {
+	whens []caseWhen
+	els   caseOperand
+	alias string
+}
+
+type caseWhen struct {
+	cond caseCond
+	then caseOperand
+}
+
+// caseCond 是 WHEN 中的单个比较，左边总是一列
+type caseCond struct {
+	col     int    // 列在行中的下标（主键为 0）
+	numeric bool   // int 列，两边都是整数时按数值比较
+	op      string // 比较运算符，或 "is null" / "is not null"
+	value   caseOperand
+}
+
+// caseOperand 是字面量或列引用
+type caseOperand struct {
+	col  int // 列下标，-1 表示字面量
+	lit  string
+	null bool
+}
+
+// eval 对一行（Row.Cells 的结果）求值，结果为 NULL 时返回 false
+func (e *caseExpr) eval(cells []string) (string, bool) {
+	for _, w := range e.whens {
+		if w.cond.match(cells) {
+			return w.then.eval(cells)
+		}
+	}
+	return e.els.eval(cells)
+}
+
+func (o caseOperand) eval(cells []string) (string, bool) {
+	switch {
+	case o.null:
+		return "", false
+	case o.col < 0:
+		return o.lit, true
+	case o.col < len(cells) && !isNullValue(cells[o.col]):
+		return cells[o.col], true
+	}
+	// 缺失的列和显式写的空值、null 都是 NULL，与 checkRowValues 相同
+	return "", false
+}
+
+// match 判断条件是否成立，与 NULL 比较的结果是未知，不成立
+func (c caseCond) match(cells []string) bool {
+	left, ok := caseOperand{col: c.col}.eval(cells)
+	switch c.op {
+	case "is null":
+		return !ok
+	case "is not null":
+		return ok
+	}
+	right, okR := c.value.eval(cells)
+	if !ok || !okR {
+		return false
+	}
+
+	order := cmp.Compare(left, right)
+	if c.numeric {
+		x, errX := strconv.ParseInt(left, 10, 64)
+		y, errY := strconv.ParseInt(right, 10, 64)
+		if errX == nil && errY == nil {
+			order = cmp.Compare(x, y)
+		}
+	}
+	switch c.op {
+	case "=":
+		return order == 0
+	case "!=", "<>":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	}
+	return false
+}
+
+// header 返回结果集中这一列的列名：有别名时用别名，否则为 case
+func (e *caseExpr) header() string {
+	if e.alias != "" {
+		return e.alias
+	}
+	return "case"
+}
+
+// parseCase 解析一个 CASE 表达式，列名通过 ref 解析后在表结构中查找
+func (p *SQLParser) parseCase(ref tableRef, text string) (*caseExpr, error) {
+	tokens, err := tokenizeCase(text)
+	if err != nil {
+		return nil, err
+	}
+	cp := &caseParser{tokens: tokens, text: text, resolve: func(name string) (int, ColumnType, error) {
+		name, err := ref.resolveColumn(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		columns, idx, err := p.Engine.lookupColumn(ref.Name, name)
+		if err != nil {
+			return 0, 0, err
+		}
+		return idx, columns[idx].Type, nil
+	}}
+	return cp.parse()
+}
+
+type caseParser struct {
+	tokens  []caseToken
+	pos     int
+	text    string
+	resolve func(name string) (int, ColumnType, error)
+}
+
+func (cp *caseParser) errorf(format string, args ...any) error {
+	return errorf(ErrSyntax, "invalid CASE expression '%s': "+format, append([]any{cp.text}, args...)...)
+}
+
+func (cp *caseParser) peek() caseToken {
+	if cp.pos < len(cp.tokens) {
+		return cp.tokens[cp.pos]
+	}
+	return caseToken{}
+}
+
+// keyword 在下一个词是 kw 时消费它并返回 true
+func (cp *caseParser) keyword(kw string) bool {
+	t := cp.peek()
+	if t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		cp.pos++
+		return true
+	}
+	return false
+}
+
+func (cp *caseParser) expect(kw string) error {
+	if !cp.keyword(kw) {
+		return cp.errorf("expected %s", strings.ToUpper(kw))
+	}
+	return nil
+}
+
+func (cp *caseParser) parse() (*caseExpr, error) {
+	if err := cp.expect("case"); err != nil {
+		return nil, err
+	}
+	expr := &caseExpr{els: caseOperand{null: true}}
+	for cp.keyword("when") {
+		cond, err := cp.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		if err := cp.expect("then"); err != nil {
+			return nil, err
+		}
+		then, err := cp.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		expr.whens = append(expr.whens, caseWhen{cond: cond, then: then})
+	}
+	if len(expr.whens) == 0 {
+		return nil, cp.errorf("expected WHEN")
+	}
+	if cp.keyword("else") {
+		els, err := cp.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		expr.els = els
+	}
+	if err := cp.expect("end"); err != nil {
+		return nil, err
+	}
+	if cp.keyword("as") {
+		t := cp.peek()
+		if t.kind != tokWord {
+			return nil, cp.errorf("expected alias after AS")
+		}
+		expr.alias = t.text
+		cp.pos++
+	}
+	if cp.pos < len(cp.tokens) {
+		return nil, cp.errorf("unexpected '%s'", cp.peek().text)
+	}
+	return expr, nil
+}
+
+func (cp *caseParser) parseCond() (caseCond, error) {
+	t := cp.peek()
+	if t.kind != tokWord {
+		return caseCond{}, cp.errorf("expected a column after WHEN")
+	}
+	cp.pos++
+	idx, typ, err := cp.resolve(t.text)
+	if err != nil {
+		return caseCond{}, err
+	}
+	cond := caseCond{col: idx, numeric: typ == TypeInt || typ == TypeBigInt}
+
+	if cp.keyword("is") {
+		cond.op = "is null"
+		if cp.keyword("not") {
+			cond.op = "is not null"
+		}
+		if err := cp.expect("null"); err != nil {
+			return caseCond{}, err
+		}
+		return cond, nil
+	}
+	op := cp.peek()
+	if op.kind != tokOp {
+		return caseCond{}, cp.errorf("expected a comparison after '%s'", t.text)
+	}
+	cp.pos++
+	cond.op = op.text
+	if cond.value, err = cp.parseOperand(); err != nil {
+		return caseCond{}, err
+	}
+	return cond, nil
+}
+
+func (cp *caseParser) parseOperand() (caseOperand, error) {
+	t := cp.peek()
+	switch t.kind {
+	case tokString, tokNumber:
+		cp.pos++
+		return caseOperand{col: -1, lit: t.text}, nil
+	case tokWord:
+		switch strings.ToLower(t.text) {
+		case "null":
+			cp.pos++
+			return caseOperand{null: true}, nil
+		case "when", "then", "else", "end":
+			return caseOperand{}, cp.errorf("expected a value before %s", strings.ToUpper(t.text))
+		}
+		cp.pos++
+		idx, _, err := cp.resolve(t.text)
+		if err != nil {
+			return caseOperand{}, err
+		}
+		return caseOperand{col: idx}, nil
+	}
+	return caseOperand{}, cp.errorf("expected a value")
+}
+
+type caseTokenKind int
+
+const (
+	tokEOF    caseTokenKind = iota
+	tokWord                 // 关键字、列名（可以带限定符 t.col）
+	tokNumber               // 整数，可以带负号
+	tokString               // 单引号字符串，'' 表示一个单引号；text 为去掉引号后的内容
+	tokOp                   // 比较运算符
+)
+
+type caseToken struct {
+	kind caseTokenKind
+	text string
+}
+
+// tokenizeCase 把 CASE 表达式拆成词
+func tokenizeCase(s string) ([]caseToken, error) {
+	var tokens []caseToken
+	isWord := func(r byte) bool {
+		return r == '_' || r == '.' || unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r))
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, errorf(ErrSyntax, "unterminated string in '%s'", s)
+			}
+			tokens = append(tokens, caseToken{kind: tokString, text: sb.String()})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, caseToken{kind: tokNumber, text: s[i:j]})
+			i = j
+		case isWord(c):
+			j := i
+			for j < len(s) && isWord(s[j]) {
+				j++
+			}
+			tokens = append(tokens, caseToken{kind: tokWord, text: s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"<=", ">=", "<>", "!=", "=", "<", ">"} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorf(ErrSyntax, "unexpected '%c' in '%s'", c, s)
+			}
+			tokens = append(tokens, caseToken{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// splitSelectList 按顶层的逗号拆分投影列表，字符串和 CASE ... END 内部的逗号不拆
+func splitSelectList(s string) []string {
+	var items []string
+	depth, start := 0, 0
+	inString := false
+	isWord := func(r byte) bool { return r == '_' || unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r)) }
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case inString:
+		case c == ',' && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		case isWord(c) && (i == 0 || !isWord(s[i-1])):
+			j := i
+			for j < len(s) && isWord(s[j]) {
+				j++
+			}
+			switch strings.ToLower(s[i:j]) {
+			case "case":
+				depth++
+			case "end":
+				depth--
+			}
+			i = j - 1
+		}
+	}
+	return append(items, s[start:])
+}
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"minidb/pkg/buffer"
 	"minidb/pkg/storage/page" // 引入 page 包
 	"os"
@@ -10,21 +13,77 @@ import (
 
 // TableMeta 定义表的元数据
 type TableMeta struct {
-	Name       string
-	RootPageId int32 // 为了 JSON 序列化方便，这里存 int32，使用时转 PageID
-	Schema     string
+	Name        string
+	RootPageId  int32 // 为了 JSON 序列化方便，这里存 int32，使用时转 PageID
+	Schema      string
+	Tablespace  int         `json:",omitempty"` // 表的页面所在的数据文件编号
+	OnConflict  string      `json:",omitempty"` // 主键冲突策略，见 ConflictPolicy；空表示报错
+	Encoding    string      `json:",omitempty"` // 值的存储格式，见 ValueEncoding；空表示文本
+	Compression string      `json:",omitempty"` // 值的压缩方式，见 Compression；空表示不压缩
+	RowCount    int64       // 行数缓存，随插入维护，下次 SaveMeta 时落盘
+	Stats       *TableStats `json:",omitempty"` // ANALYZE 收集的统计信息
+
+	// KeyType 为 KeyTypeVarchar 时主键是字符串，行存放在根为 StrRootPageId 的 BPlusTreeStr 中，
+	// RootPageId 为 InvalidPageID，见 strkey.go；为空时主键是整数
+	KeyType       string `json:",omitempty"`
+	StrRootPageId int32  `json:",omitempty"`
+
+	// Indexes 是表上的二级索引，按索引名，见 secondary.go；修改和读取都要经过 Catalog 的方法
+	Indexes map[string]IndexMeta `json:",omitempty"`
+
+	// AutoIncrement 主键声明了 auto_increment；NextAutoId 是已经预留的自增主键上限，
+	// 重启后从它之后继续分配，见 Catalog.NextAutoId
+	AutoIncrement bool  `json:",omitempty"`
+	NextAutoId    int64 `json:",omitempty"`
+
+	rowCountMissing bool  // 旧版 meta.json 没有 RowCount，首次使用时需要扫描重算
+	autoId          int64 // 已分配的最大自增主键，atomic 访问
+	autoCeiling     int64 // 已落盘的 NextAutoId，atomic 读；修改时还要持有 Catalog.mu
+
+	columnsOnce sync.Once
+	columns     []Column // 解析后的 Schema，见 Columns
 }
 
 type Catalog struct {
 	Tables   map[string]*TableMeta
-	BPM      *buffer.BufferPoolManager
-	MetaFile string
-	mu       sync.RWMutex
+	PageSize int // 数据库创建时选定的页大小
+	// Tablespaces 数据文件个数，建库时确定；0 表示旧版本的单文件数据库
+	Tablespaces int
+	BPM         *buffer.BufferPoolManager
+	MetaFile    string
+	// LoadedBackup 主元数据文件损坏，当前内容来自上一版本的备份
+	LoadedBackup bool
+	mu           sync.RWMutex
+
+	primaryCorrupt bool // 磁盘上的 meta.json 已损坏，保存时不能拿它轮换备份
+
+	// shared 非 nil 表示这是某个会话的临时表目录：Tables 只有本会话的临时表，不落盘，
+	// 其余的表都转给 shared，见 temptable.go
+	shared *Catalog
+	// temps 是所有会话临时表的表名，只在共享的 Catalog 上使用，普通表不能与它们重名
+	temps map[string]struct{}
 }
 
+// CatalogBackupSuffix 是元数据上一版本备份文件的后缀，即 meta.json.bak
+const CatalogBackupSuffix = ".bak"
+
+// catalogVersion 元数据文件格式版本，旧格式（直接序列化 Tables）视为版本 0
+const catalogVersion = 1
+
+// catalogFile 是 meta.json 的磁盘格式
+type catalogFile struct {
+	Version     int                   `json:"version"`
+	PageSize    int                   `json:"page_size"`
+	Tablespaces int                   `json:"tablespaces,omitempty"`
+	Tables      map[string]*TableMeta `json:"tables"`
+}
+
+// NewCatalog 加载元数据，忽略加载错误：文件损坏时得到的是空的 Catalog
+// 打开已有数据库应使用 OpenCatalog
 func NewCatalog(bpm *buffer.BufferPoolManager, metaFile string) *Catalog {
 	c := &Catalog{
 		Tables:   make(map[string]*TableMeta),
+		PageSize: page.PageSize,
 		BPM:      bpm,
 		MetaFile: metaFile,
 	}
@@ -32,42 +91,292 @@ func NewCatalog(bpm *buffer.BufferPoolManager, metaFile string) *Catalog {
 	return c
 }
 
-func (c *Catalog) LoadMeta() {
-	file, err := os.Open(c.MetaFile)
+// OpenCatalog 加载元数据，文件损坏时返回 ErrCatalogCorrupt，而不是把它当作一个空库
+// useBackup 为 true 时，主文件损坏则改为加载 meta.json.bak，并设置 LoadedBackup；
+// 下一次保存会用备份的内容覆盖损坏的主文件
+func OpenCatalog(bpm *buffer.BufferPoolManager, metaFile string, useBackup bool) (*Catalog, error) {
+	c := &Catalog{
+		Tables:   make(map[string]*TableMeta),
+		PageSize: page.PageSize,
+		BPM:      bpm,
+		MetaFile: metaFile,
+	}
+	err := c.LoadMeta()
+	if err == nil || !useBackup || !errors.Is(err, ErrCatalogCorrupt) {
+		return c, err
+	}
+
+	data, bakErr := os.ReadFile(metaFile + CatalogBackupSuffix)
+	if bakErr != nil {
+		return c, err
+	}
+	if bakErr := c.loadMetaData(data); bakErr != nil {
+		return c, fmt.Errorf("%v (backup also unusable: %v)", err, bakErr)
+	}
+	c.LoadedBackup = true
+	return c, nil
+}
+
+// InitCatalogFile 为新建的数据库写入一个空的元数据文件，记录页大小
+func InitCatalogFile(metaFile string, pageSize int) error {
+	return initCatalogFile(metaFile, pageSize, 1)
+}
+
+func initCatalogFile(metaFile string, pageSize, tablespaces int) error {
+	c := &Catalog{
+		Tables:      make(map[string]*TableMeta),
+		PageSize:    pageSize,
+		Tablespaces: tablespaces,
+		MetaFile:    metaFile,
+	}
+	return c.writeMeta()
+}
+
+// ReadCatalogPageSize 在打开数据文件之前读取数据库的页大小
+// 文件不存在或是旧格式时返回默认页大小
+func ReadCatalogPageSize(metaFile string) int {
+	if cf, ok := readCatalogHeader(metaFile); ok && page.ValidPageSize(cf.PageSize) {
+		return cf.PageSize
+	}
+	return page.PageSize
+}
+
+// ReadCatalogTablespaces 在打开数据文件之前读取数据库的数据文件个数，旧数据库为 1
+func ReadCatalogTablespaces(metaFile string) int {
+	if cf, ok := readCatalogHeader(metaFile); ok && cf.Tablespaces > 1 {
+		return cf.Tablespaces
+	}
+	return 1
+}
+
+// readCatalogHeader 按新格式读取元数据文件，主文件损坏（不是合法 JSON）时改读备份，
+// 与 OpenCatalog 加载备份时保持一致
+func readCatalogHeader(metaFile string) (catalogFile, bool) {
+	var cf catalogFile
+	data, err := os.ReadFile(metaFile)
 	if err != nil {
+		return cf, false
+	}
+	if !json.Valid(data) {
+		if data, err = os.ReadFile(metaFile + CatalogBackupSuffix); err != nil {
+			return cf, false
+		}
+	}
+	return cf, decodeCatalogFile(data, &cf)
+}
+
+// decodeCatalogFile 尝试按新格式解析，失败说明是旧格式
+func decodeCatalogFile(data []byte, cf *catalogFile) bool {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cf); err != nil {
+		return false
+	}
+	return cf.Version > 0
+}
+
+// LoadMeta 从 MetaFile 加载元数据，文件不存在时保持为空
+// 文件内容无法解析时返回 ErrCatalogCorrupt，Tables 保持为空，不会只加载一半
+func (c *Catalog) LoadMeta() error {
+	data, err := os.ReadFile(c.MetaFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.loadMetaData(data); err != nil {
+		c.primaryCorrupt = true
+		return errorf(ErrCatalogCorrupt, "catalog corrupt: %s: %v", c.MetaFile, err)
+	}
+	return nil
+}
+
+func (c *Catalog) loadMetaData(data []byte) error {
+	var cf catalogFile
+	if decodeCatalogFile(data, &cf) {
+		c.Tables = cf.Tables
+		if c.Tables == nil {
+			c.Tables = make(map[string]*TableMeta)
+		}
+		if page.ValidPageSize(cf.PageSize) {
+			c.PageSize = cf.PageSize
+		}
+		c.Tablespaces = cf.Tablespaces
+		var raw struct {
+			Tables json.RawMessage `json:"tables"`
+		}
+		json.Unmarshal(data, &raw)
+		markMissingFields(raw.Tables, c.Tables)
+	} else {
+		// 兼容旧格式：整个文件就是 Tables
+		tables := make(map[string]*TableMeta)
+		if err := json.Unmarshal(data, &tables); err != nil {
+			return err
+		}
+		c.Tables = tables
+		markMissingFields(data, c.Tables)
+	}
+	for _, meta := range c.Tables {
+		meta.initAutoId()
+	}
+	return nil
+}
+
+// markMissingFields 标记旧版本 meta.json 中没有、需要重新计算的字段
+// JSON 解码会把缺失字段留成零值，行数为 0 会被当成真实值，所以要区分"缺失"和"为 0"
+func markMissingFields(rawTables []byte, tables map[string]*TableMeta) {
+	var raw map[string]map[string]json.RawMessage
+	if json.Unmarshal(rawTables, &raw) != nil {
 		return
 	}
-	defer file.Close()
-	json.NewDecoder(file).Decode(&c.Tables)
+	for name, fields := range raw {
+		meta, ok := tables[name]
+		if !ok {
+			continue
+		}
+		if _, ok := fields["RowCount"]; !ok {
+			meta.rowCountMissing = true
+		}
+	}
 }
 
 func (c *Catalog) SaveMeta() {
-	file, err := os.Create(c.MetaFile)
+	// 在实际生产中应处理错误，这里简单忽略
+	c.writeMeta()
+}
+
+// Flush 强制把元数据写盘
+func (c *Catalog) Flush() error {
+	if c.shared != nil {
+		return c.shared.Flush()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeMeta()
+}
+
+// writeMeta 先写临时文件并 Sync，再原子地 rename 覆盖 meta.json
+// 直接 os.Create 会先截断原文件，写到一半崩溃就会丢掉整个 Catalog
+func (c *Catalog) writeMeta() error {
+	if c.shared != nil {
+		return nil // 临时表不落盘
+	}
+	tmpFile := c.MetaFile + ".tmp"
+	file, err := os.Create(tmpFile)
 	if err != nil {
-		// 在实际生产中应处理错误，这里简单 panic 或打印
-		return
+		return err
+	}
+
+	err = json.NewEncoder(file).Encode(catalogFile{
+		Version:     catalogVersion,
+		PageSize:    c.PageSize,
+		Tablespaces: c.Tablespaces,
+		Tables:      c.Tables,
+	})
+	if err == nil {
+		err = file.Sync()
 	}
-	defer file.Close()
-	json.NewEncoder(file).Encode(c.Tables)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	// 新版本已完整落盘，再把当前版本保留为 meta.json.bak
+	// 主文件损坏时不能覆盖备份，否则唯一可用的旧版本也丢了
+	if !c.primaryCorrupt {
+		if err := c.rotateBackup(); err != nil {
+			os.Remove(tmpFile)
+			return err
+		}
+	}
+	if err := os.Rename(tmpFile, c.MetaFile); err != nil {
+		return err
+	}
+	c.primaryCorrupt = false
+	return nil
+}
+
+// rotateBackup 把当前的 meta.json 保留为 meta.json.bak，只保留一个旧版本
+// 用硬链接而不是 rename：rename 之后、新文件就位之前崩溃，会出现没有 meta.json 的窗口。
+// 先链接到临时文件名再 rename 覆盖旧的 meta.json.bak，任何时刻崩溃都至少留下一个完整的备份
+func (c *Catalog) rotateBackup() error {
+	bakFile := c.MetaFile + CatalogBackupSuffix
+	tmpFile := bakFile + ".tmp"
+	// 上次轮换到一半崩溃时留下的临时文件
+	if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err := os.Link(c.MetaFile, tmpFile)
+	if os.IsNotExist(err) {
+		return nil // 新库还没有 meta.json，没有可备份的版本
+	}
+	if err != nil {
+		// 文件系统不支持硬链接时退化为复制
+		data, readErr := os.ReadFile(c.MetaFile)
+		if readErr != nil {
+			return readErr
+		}
+		if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+			os.Remove(tmpFile)
+			return err
+		}
+	}
+	if err := os.Rename(tmpFile, bakFile); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
 }
 
 // CreateTable 注册新表
 func (c *Catalog) CreateTable(name string, schema string, initialRootId page.PageID) bool {
+	return c.CreateTableIn(name, schema, initialRootId, 0)
+}
+
+// CreateTableIn 注册新表，并记录表所在的表空间
+func (c *Catalog) CreateTableIn(name string, schema string, initialRootId page.PageID, tablespace int) bool {
+	return c.CreateTableMeta(&TableMeta{
+		Name:       name,
+		RootPageId: int32(initialRootId), // 转换存储
+		Schema:     schema,
+		Tablespace: tablespace,
+	})
+}
+
+// CreateTableMeta 按完整的元数据注册新表，表名已存在时返回 false
+func (c *Catalog) CreateTableMeta(meta *TableMeta) bool {
+	if c.shared != nil {
+		return c.shared.CreateTableMeta(meta)
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if _, exists := c.Tables[name]; exists {
+	if _, exists := c.Tables[meta.Name]; exists {
 		return false
 	}
-	c.Tables[name] = &TableMeta{
-		Name:       name,
-		RootPageId: int32(initialRootId), // 转换存储
-		Schema:     schema,
+	if _, exists := c.temps[meta.Name]; exists {
+		return false
 	}
+	c.Tables[meta.Name] = meta
 	c.SaveMeta()
 	return true
 }
 
+// TablespaceCount 返回数据文件个数，旧数据库视为 1
+func (c *Catalog) TablespaceCount() int {
+	if c.Tablespaces < 1 {
+		return 1
+	}
+	return c.Tablespaces
+}
+
 func (c *Catalog) GetTable(name string) (*TableMeta, bool) {
+	if r := c.route(name); r != c {
+		return r.GetTable(name)
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	meta, ok := c.Tables[name]
@@ -76,13 +385,30 @@ func (c *Catalog) GetTable(name string) (*TableMeta, bool) {
 
 // HasTable 检查表是否存在 (修复 main.go 中的报错)
 func (c *Catalog) HasTable(name string) bool {
+	if r := c.route(name); r != c {
+		return r.HasTable(name)
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	_, ok := c.Tables[name]
 	return ok
 }
 
+// TableRoot 返回表当前的根页号；VACUUM 会在读者运行期间换根，读路径应通过它读取
+func (c *Catalog) TableRoot(meta *TableMeta) page.PageID {
+	if r := c.route(meta.Name); r != c {
+		return r.TableRoot(meta)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return page.PageID(meta.RootPageId)
+}
+
 func (c *Catalog) UpdateTableRoot(name string, newRootId page.PageID) {
+	if r := c.route(name); r != c {
+		r.UpdateTableRoot(name, newRootId)
+		return
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if table, ok := c.Tables[name]; ok {
@@ -91,17 +417,81 @@ func (c *Catalog) UpdateTableRoot(name string, newRootId page.PageID) {
 	}
 }
 
+// AddRowCount 调整行数缓存，只修改内存，不触发 SaveMeta
+func (c *Catalog) AddRowCount(name string, delta int64) {
+	if r := c.route(name); r != c {
+		r.AddRowCount(name, delta)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if table, ok := c.Tables[name]; ok {
+		table.RowCount += delta
+	}
+}
+
+// RowCountMissing 报告表的行数缓存是否来自旧版元数据、尚未重新计算
+func (c *Catalog) RowCountMissing(name string) bool {
+	if r := c.route(name); r != c {
+		return r.RowCountMissing(name)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	table, ok := c.Tables[name]
+	return ok && table.rowCountMissing
+}
+
+// SetRowCount 用重新计算的结果覆盖行数缓存
+func (c *Catalog) SetRowCount(name string, rows int64) {
+	if r := c.route(name); r != c {
+		r.SetRowCount(name, rows)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if table, ok := c.Tables[name]; ok {
+		table.RowCount = rows
+		table.rowCountMissing = false
+	}
+}
+
+// SetTableStats 保存 ANALYZE 的结果，并用精确行数校正行数缓存
+func (c *Catalog) SetTableStats(name string, stats *TableStats) {
+	if r := c.route(name); r != c {
+		r.SetTableStats(name, stats)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if table, ok := c.Tables[name]; ok {
+		table.Stats = stats
+		table.RowCount = stats.RowCount
+		table.rowCountMissing = false
+		c.SaveMeta()
+	}
+}
+
 func (c *Catalog) DropTable(name string) {
+	if r := c.route(name); r != c {
+		r.DropTable(name)
+		return
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.Tables, name)
+	if c.shared != nil {
+		c.shared.releaseTempName(name)
+	}
 	c.SaveMeta()
 }
 
 func (c *Catalog) ListTables() []string {
+	var names []string
+	if c.shared != nil {
+		names = c.shared.ListTables()
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	names := make([]string, 0, len(c.Tables))
 	for name := range c.Tables {
 		names = append(names, name)
 	}
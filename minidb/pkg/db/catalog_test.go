@@ -0,0 +1,178 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"minidb/pkg/storage/page"
+)
+
+func TestCatalogAtomicSave(t *testing.T) {
+	metaFile := filepath.Join(t.TempDir(), MetaFileName)
+
+	c := NewCatalog(nil, metaFile)
+	c.CreateTable("users", "id int,name string", page.PageID(3))
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 临时文件必须在 rename 后消失
+	if _, err := os.Stat(metaFile + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	reloaded := NewCatalog(nil, metaFile)
+	meta, ok := reloaded.GetTable("users")
+	if !ok {
+		t.Fatal("table lost after reload")
+	}
+	if meta.RootPageId != 3 || meta.Schema != "id int,name string" {
+		t.Fatalf("unexpected meta after reload: %+v", meta)
+	}
+}
+
+func TestCatalogLegacyFormat(t *testing.T) {
+	metaFile := filepath.Join(t.TempDir(), MetaFileName)
+	legacy := `{"users":{"Name":"users","RootPageId":0,"Schema":"id int,name string"}}`
+	if err := os.WriteFile(metaFile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCatalog(nil, metaFile)
+	if !c.HasTable("users") {
+		t.Fatal("legacy catalog not loaded")
+	}
+	if c.PageSize != page.PageSize {
+		t.Fatalf("expected default page size, got %d", c.PageSize)
+	}
+}
+
+func TestCatalogMissingRowCount(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("t", "id int, v varchar")
+	for i := int64(0); i < 50; i++ {
+		e.Insert("t", i, "x")
+	}
+	meta, _ := e.Catalog.GetTable("t")
+
+	// 模拟升级前的 meta.json：没有 RowCount 字段
+	legacy := fmt.Sprintf(`{"t":{"Name":"t","RootPageId":%d,"Schema":"id int, v varchar"}}`, meta.RootPageId)
+	os.WriteFile(e.Catalog.MetaFile, []byte(legacy), 0644)
+	e.Catalog = NewCatalog(e.BPM, e.Catalog.MetaFile)
+
+	if !e.Catalog.RowCountMissing("t") {
+		t.Fatal("missing RowCount not detected")
+	}
+
+	statuses, err := e.TableStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Rows != 50 {
+		t.Fatalf("row count not recomputed, got %d", statuses[0].Rows)
+	}
+	if e.Catalog.RowCountMissing("t") {
+		t.Fatal("row count should be marked as computed")
+	}
+}
+
+func TestCatalogCorrupt(t *testing.T) {
+	metaFile := filepath.Join(t.TempDir(), MetaFileName)
+	c := NewCatalog(nil, metaFile)
+	c.CreateTable("users", "id int,name string", page.PageID(3))
+	good, err := os.ReadFile(metaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 写到一半的文件：合法 JSON 的前缀
+	if err := os.WriteFile(metaFile, good[:len(good)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCatalog(nil, metaFile, false); !errors.Is(err, ErrCatalogCorrupt) {
+		t.Fatalf("truncated catalog: got %v, want %v", err, ErrCatalogCorrupt)
+	}
+	// 没有备份时，即使允许也无法恢复
+	if _, err := OpenCatalog(nil, metaFile, true); !errors.Is(err, ErrCatalogCorrupt) {
+		t.Fatalf("no backup: got %v", err)
+	}
+
+	if err := os.WriteFile(metaFile+CatalogBackupSuffix, good, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCatalog(nil, metaFile, false); !errors.Is(err, ErrCatalogCorrupt) {
+		t.Fatalf("backup disabled: got %v", err)
+	}
+	c, err = OpenCatalog(nil, metaFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.LoadedBackup || !c.HasTable("users") {
+		t.Fatalf("backup not loaded: LoadedBackup=%v tables=%v", c.LoadedBackup, c.ListTables())
+	}
+
+	// 不存在的元数据文件是新库，不算损坏
+	if _, err := OpenCatalog(nil, filepath.Join(t.TempDir(), MetaFileName), true); err != nil {
+		t.Fatalf("missing catalog: %v", err)
+	}
+}
+
+func TestCatalogBackupRotation(t *testing.T) {
+	metaFile := filepath.Join(t.TempDir(), MetaFileName)
+	bakFile := metaFile + CatalogBackupSuffix
+
+	c := NewCatalog(nil, metaFile)
+	c.CreateTable("v1", "id int", page.PageID(1))
+	if _, err := os.Stat(bakFile); !os.IsNotExist(err) {
+		t.Fatalf("first save of a new catalog has nothing to back up: %v", err)
+	}
+	// 上次轮换到一半崩溃留下的临时文件不妨碍下一次轮换，轮换完不留下临时文件
+	if err := os.WriteFile(bakFile+".tmp", []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.CreateTable("v2", "id int", page.PageID(2))
+	if _, err := os.Stat(bakFile + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary backup file left behind: %v", err)
+	}
+
+	// 备份是上一个版本：只有 v1
+	prev := NewCatalog(nil, bakFile)
+	if !prev.HasTable("v1") || prev.HasTable("v2") {
+		t.Fatalf("backup should hold the previous version, got %v", prev.ListTables())
+	}
+
+	// 主文件损坏后从备份恢复
+	if err := os.WriteFile(metaFile, []byte(`{"version":1,"tab`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCatalog(nil, metaFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.LoadedBackup || !c.HasTable("v1") {
+		t.Fatalf("recovery from backup failed: %v", c.ListTables())
+	}
+
+	// 恢复后的第一次保存不能把损坏的主文件轮换成备份
+	c.CreateTable("v3", "id int", page.PageID(3))
+	bak, err := OpenCatalog(nil, bakFile, false)
+	if err != nil {
+		t.Fatalf("backup clobbered by the corrupt primary: %v", err)
+	}
+	if !bak.HasTable("v1") {
+		t.Fatalf("backup lost after recovery: %v", bak.ListTables())
+	}
+	reloaded, err := OpenCatalog(nil, metaFile, false)
+	if err != nil || !reloaded.HasTable("v3") {
+		t.Fatalf("primary after recovery: %v, %v", reloaded.ListTables(), err)
+	}
+
+	// 之后的保存照常轮换，替换掉已有的备份
+	reloaded.CreateTable("v4", "id int", page.PageID(4))
+	if bak := NewCatalog(nil, bakFile); !bak.HasTable("v3") || bak.HasTable("v4") {
+		t.Fatalf("backup after the next save: %v", bak.ListTables())
+	}
+}
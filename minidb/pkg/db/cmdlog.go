@@ -0,0 +1,112 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoggedStatement 是命令日志中的一条记录
+type LoggedStatement struct {
+	Time    time.Time `json:"ts"`
+	Session int64     `json:"session"`
+	SQL     string    `json:"sql"`
+}
+
+// CommandLog 按执行顺序记录所有会话收到的语句，用于在新库上重放、复现问题
+// 与 WAL 不同，记录的是逻辑上的 SQL 而不是物理页，只用于调试和测试，不参与恢复。
+// 每行一个 JSON 对象（语句中可以有换行），写入后立即 Flush，进程崩溃时最后一条语句也在日志里
+type CommandLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	session atomic.Int64
+}
+
+// OpenCommandLog 以追加方式打开命令日志，文件不存在时创建
+func OpenCommandLog(path string) (*CommandLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandLog{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// NewSession 为一个新连接分配会话号，重放时同一会话号的语句在同一个会话里执行
+func (l *CommandLog) NewSession() int64 {
+	return l.session.Add(1)
+}
+
+// Record 在执行语句之前调用，记录语句和时间
+func (l *CommandLog) Record(session int64, sql string) error {
+	line, err := json.Marshal(LoggedStatement{Time: time.Now(), Session: session, SQL: sql})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+	l.w.WriteByte('\n')
+	return l.w.Flush()
+}
+
+func (l *CommandLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// ReplayResult 是一次重放的统计
+type ReplayResult struct {
+	Statements int // 执行的语句数
+	Sessions   int // 日志中出现的会话数
+	Errors     int // 执行出错的语句数，原来执行时可能同样出错
+}
+
+// Replay 按日志顺序在 e 上重新执行语句，每个日志会话对应一个新会话
+// 语句的输出和错误写到 out；语句出错不会中止重放，日志本身损坏时返回错误。
+// 重放结束时回滚仍未提交的事务并关闭会话，和连接断开时一样
+func Replay(e *Engine, r io.Reader, out io.Writer) (ReplayResult, error) {
+	var res ReplayResult
+	sessions := make(map[int64]*SQLParser)
+	defer func() {
+		for _, p := range sessions {
+			p.Engine.Rollback()
+			p.Engine.Close()
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var stmt LoggedStatement
+		if err := json.Unmarshal(scanner.Bytes(), &stmt); err != nil {
+			return res, fmt.Errorf("command log line %d: %v", line, err)
+		}
+		p, ok := sessions[stmt.Session]
+		if !ok {
+			p = NewSQLParser(e.NewSession(), out)
+			sessions[stmt.Session] = p
+			res.Sessions++
+		}
+		fmt.Fprintf(out, "[session %d] %s\n", stmt.Session, stmt.SQL)
+		res.Statements++
+		if err := p.ParseAndExecute(stmt.SQL); err != nil {
+			res.Errors++
+			p.ReportError(err)
+		}
+	}
+	return res, scanner.Err()
+}
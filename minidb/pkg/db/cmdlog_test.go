@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommandLogReplay(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "cmd.log")
+	l, err := OpenCommandLog(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个会话交替执行，其中一个事务回滚，另一个在日志结束时仍未提交
+	e := newTestEngine(t)
+	type session struct {
+		id int64
+		p  *SQLParser
+	}
+	open := func() session {
+		return session{id: l.NewSession(), p: NewSQLParser(e.NewSession(), io.Discard)}
+	}
+	a, b := open(), open()
+	for _, step := range []struct {
+		s   session
+		sql string
+	}{
+		{a, "use testdb"},
+		{b, "use testdb"},
+		{a, "create table t (id int, name varchar)"},
+		{a, "insert into t values (1, 'one'), (2, 'two')"},
+		{b, "begin"},
+		{b, "insert into t values (3, 'three')"},
+		{b, "commit"},
+		{a, "insert into t values (2, 'dup')"}, // 主键冲突，重放时同样失败
+		{b, "begin"},
+		{b, "insert into t values (4, 'four')"},
+		{b, "rollback"},
+		{a, "insert into t values (5, 'five')"},
+		{b, "begin"},
+		{b, "insert into t values (6, 'six')"},
+	} {
+		if err := l.Record(step.s.id, step.sql); err != nil {
+			t.Fatal(err)
+		}
+		step.s.p.ParseAndExecute(step.sql)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b.p.Engine.Rollback() // 连接断开
+	want, err := e.SelectAll("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fresh := newTestEngine(t)
+	res, err := Replay(fresh, f, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Statements != 14 || res.Sessions != 2 || res.Errors != 1 {
+		t.Errorf("replay result = %+v, want 14 statements, 2 sessions, 1 error", res)
+	}
+	got, err := fresh.SelectAll("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("replayed rows = %v, want %v", got, want)
+	}
+	if len(want) != 4 {
+		t.Errorf("original rows = %v, want keys 1, 2, 3, 5", want)
+	}
+}
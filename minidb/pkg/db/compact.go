@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/index"
+	"minidb/pkg/storage/page"
+	"os"
+	"path/filepath"
+)
+
+// compactDataFile 把当前库的所有表按主键顺序重建到一个新的数据文件中，然后替换 data.db
+// 删表、合并节点留下的页面不会被复制，文件因此缩小。只在 Close 时调用，此时不再有并发访问
+//
+// 新文件完整写好并 fsync 之后才 rename，失败时原文件保持不动；
+// rename 之后、元数据落盘之前崩溃会导致根页号不匹配，这是没有 WAL 时无法避免的窗口
+func (e *Engine) compactDataFile() error {
+	if e.Catalog.TablespaceCount() > 1 {
+		return errorf(ErrUnsupported, "compaction of databases with multiple tablespaces is not supported")
+	}
+	dbPath := filepath.Join(e.DataRoot, e.CurrentDB)
+	dataFile := filepath.Join(dbPath, DataFileName)
+	tmpFile := dataFile + ".compact"
+	os.Remove(tmpFile)
+
+	dm, err := disk.NewDiskManagerWithPageSize(tmpFile, e.DiskManager.PageSize())
+	if err != nil {
+		return err
+	}
+	bpm := buffer.NewBufferPoolManager(dm, e.BPM.PoolSize())
+
+	roots := make(map[string]page.PageID)
+	strRoots := make(map[string]page.PageID)
+	indexRoots := make(map[string]map[string]page.PageID)
+	for _, name := range e.Catalog.ListTables() {
+		if meta, ok := e.Catalog.GetTable(name); ok && meta.hasStringKey() {
+			root, err := e.copyStrTable(meta, bpm)
+			if err != nil {
+				dm.Close()
+				os.Remove(tmpFile)
+				return fmt.Errorf("compact table '%s': %v", name, err)
+			}
+			strRoots[name] = root
+			continue
+		}
+		root, err := e.copyTable(name, bpm)
+		if err != nil {
+			dm.Close()
+			os.Remove(tmpFile)
+			return fmt.Errorf("compact table '%s': %v", name, err)
+		}
+		roots[name] = root
+		if indexRoots[name], err = e.copyIndexes(name, root, bpm); err != nil {
+			dm.Close()
+			os.Remove(tmpFile)
+			return fmt.Errorf("compact table '%s': %v", name, err)
+		}
+	}
+
+	if err := bpm.FlushAndSync(); err != nil {
+		dm.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	dm.Close()
+
+	e.DiskManager.Close()
+	e.DiskManager = nil
+	if err := os.Rename(tmpFile, dataFile); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	// 旧文件的双写缓冲区里可能还留着一页，重放到新文件上会写坏数据
+	os.Remove(dataFile + ".dwb")
+
+	for name, root := range roots {
+		e.Catalog.UpdateTableRoot(name, root)
+	}
+	for name, root := range strRoots {
+		e.Catalog.UpdateTableStrRoot(name, root)
+	}
+	for name, indexes := range indexRoots {
+		for indexName, root := range indexes {
+			e.Catalog.UpdateIndexRoot(name, indexName, root)
+		}
+	}
+	return e.Catalog.Flush()
+}
+
+// copyTable 把表中的所有行按顺序插入到 bpm 上的一棵新树，返回新树的根页号
+func (e *Engine) copyTable(name string, bpm *buffer.BufferPoolManager) (page.PageID, error) {
+	it, err := e.ScanRange(name, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return page.InvalidPageID, err
+	}
+	defer it.Close()
+
+	meta, _ := e.Catalog.GetTable(name)
+	tree := index.NewBPlusTree(page.InvalidPageID, bpm)
+	tree.StartNewTree()
+	for it.Next() {
+		row := it.Row()
+		value, err := encodeValue(meta, row.Value)
+		if err != nil {
+			return page.InvalidPageID, err
+		}
+		if err := tree.TryInsert(row.Key, value); err != nil {
+			return page.InvalidPageID, fmt.Errorf("insert of key %d: %w", row.Key, err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return page.InvalidPageID, err
+	}
+	// 顺序插入只会让叶子半满，合并一遍相邻的叶子
+	tree.CompactLeaves()
+	return tree.GetRootPageId(), nil
+}
+
+// copyIndexes 在 bpm 上按 copyTable 复制出的树重建表上的二级索引，返回每个索引的新根页号
+// 索引按列值重新收集，不逐页复制，顺便去掉了删光主键后留下的空 Key
+func (e *Engine) copyIndexes(name string, root page.PageID, bpm *buffer.BufferPoolManager) (map[string]page.PageID, error) {
+	meta, _ := e.Catalog.GetTable(name)
+	indexes := e.Catalog.TableIndexes(meta)
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+	roots := make(map[string]page.PageID, len(indexes))
+	for indexName, idx := range indexes {
+		col, err := e.resolveIndexColumn(name, idx.Column)
+		if err != nil {
+			return nil, err
+		}
+		roots[indexName], err = buildIndex(meta, col, index.NewBPlusTree(root, bpm), bpm, 0)
+		if err != nil {
+			return nil, fmt.Errorf("index '%s': %v", indexName, err)
+		}
+	}
+	return roots, nil
+}
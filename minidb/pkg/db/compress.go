@@ -0,0 +1,90 @@
+package db
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"sync"
+
+	"minidb/pkg/storage/page"
+)
+
+// Compression 是表级的值压缩方式，记录在表的元数据中
+type Compression string
+
+const (
+	CompressionNone  Compression = "none"
+	CompressionFlate Compression = "flate" // 标准库的 DEFLATE（无头部），见 compressValue
+)
+
+// ParseCompression 解析 compression 选项的值，不区分大小写
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(strings.ToLower(s)); c {
+	case CompressionNone, CompressionFlate:
+		return c, nil
+	}
+	return "", errorf(ErrInvalidValue, "invalid compression '%s' (expected none or flate)", s)
+}
+
+// 压缩后的值：1 字节标记 + 1 字节压缩数据长度 + 压缩数据
+// 叶子读出时会去掉末尾的 \x00，压缩数据可能以零字节结尾，解码时按长度补齐。
+// 压缩不划算（或压缩后仍放不进槽位）的值按原文存储，靠标记字节区分，
+// 所以开启压缩之前写入的行、以及没有压缩的行都能照常读出
+const (
+	compressedTag    = 0x03
+	compressedHeader = 2
+)
+
+var (
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestCompression)
+		return w
+	}}
+	flateReaders = sync.Pool{New: func() any { return flate.NewReader(nil) }}
+)
+
+// compressValue 按表的压缩方式编码文本值
+// 以标记字节开头的原文必须压缩存储，否则读出时会被当成压缩数据；压缩后放不进槽位时报错
+func compressValue(meta *TableMeta, raw []byte) ([]byte, error) {
+	if Compression(meta.Compression) != CompressionFlate || len(raw) == 0 {
+		return raw, nil
+	}
+	var buf bytes.Buffer
+	buf.Write([]byte{compressedTag, 0})
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(raw)
+	w.Close()
+	flateWriters.Put(w)
+
+	out := buf.Bytes()
+	out[1] = byte(len(out) - compressedHeader)
+	fits := len(out) <= page.SizeOfVal
+	switch {
+	case raw[0] == compressedTag && !fits:
+		return nil, errorf(ErrInvalidValue, "value starting with byte 0x%02x is too long for a compressed table", compressedTag)
+	case raw[0] == compressedTag, fits && len(out) < len(raw):
+		return out, nil
+	}
+	return raw, nil
+}
+
+// decompressValue 还原 compressValue 的结果，raw 末尾的 \x00 可以已被去掉；不是压缩数据时原样返回
+func decompressValue(meta *TableMeta, raw []byte) []byte {
+	if Compression(meta.Compression) != CompressionFlate || len(raw) < compressedHeader || raw[0] != compressedTag {
+		return raw
+	}
+	data := raw[compressedHeader:]
+	if n := int(raw[1]); len(data) < n {
+		data = append(bytes.Clone(data), make([]byte, n-len(data))...)
+	}
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+	r.(flate.Resetter).Reset(bytes.NewReader(data), nil)
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return raw
+	}
+	return out
+}
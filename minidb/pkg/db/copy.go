@@ -0,0 +1,118 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// copy into <table> from stdin 之后，客户端接着发送数据行，直到只有 CopyTerminator 的一行为止
+// 每行与 insert 的一个 VALUES 元组相同（不带括号）：<id>,<值>,...，主键写 null 或 default 时分配自增主键。
+// 行先攒成 CopyBatchSize 行一批，再按批量插入的方式写入：每批全有或全无，
+// 出错之前已经写入的批次保留，之后的数据行只读掉、不再写入，结束时报告出错的行号
+const (
+	CopyTerminator = `\.`
+	CopyBatchSize  = 1000
+)
+
+// copyState 是进行中的 copy 的状态，数据行可能分在多条消息里
+type copyState struct {
+	table   string
+	strKey  bool // 表的主键是字符串，见 strkey.go
+	batch   []Row
+	loaded  int   // 已经写入的行数
+	line    int   // 已经读到的数据行数
+	err     error // 第一个错误，之后只读掉数据、不再写入
+	errLine int   // 出错的行；批量写入出错时是这一批的第一行
+	errBulk bool  // 错误来自批量写入，不知道具体是批次中的哪一行
+}
+
+// handleCopy 开始一次 copy：检查表存在，之后的输入都是数据行，见 CopyData
+func (p *SQLParser) handleCopy(tableName string) error {
+	exists, err := p.Engine.TableExists(tableName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	p.copy = &copyState{table: tableName, strKey: p.Engine.hasStringKey(tableName)}
+	fmt.Fprintf(p.Output, "Enter rows for '%s' as <id>,<value>,... one per line, end with a line containing only %s\n", tableName, CopyTerminator)
+	return nil
+}
+
+// Copying 报告会话是否在 copy 中，此时收到的输入是数据行而不是语句
+func (p *SQLParser) Copying() bool {
+	return p.copy != nil
+}
+
+// CopyData 处理 copy 的一段输入，可以包含多行；读到结束行时写入剩余的行并输出写入的总行数，done 为 true
+// 结束行之后同一段输入中的内容被忽略。数据有错时，结束时返回第一个错误，错误码与 insert 相同
+func (p *SQLParser) CopyData(data string) (done bool, err error) {
+	c := p.copy
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == CopyTerminator {
+			p.copy = nil
+			return true, p.finishCopy(c)
+		}
+		if line == "" {
+			continue
+		}
+		c.line++
+		if c.err != nil {
+			continue
+		}
+		var row Row
+		var err error
+		if c.strKey {
+			row, err = parseStrInsertTuple(line)
+		} else {
+			var auto bool
+			row, auto, err = parseInsertTuple(line)
+			if err == nil && auto {
+				row.Key, err = p.Engine.NextAutoId(c.table)
+			}
+		}
+		if err != nil {
+			c.err, c.errLine = err, c.line
+			continue
+		}
+		c.batch = append(c.batch, row)
+		if len(c.batch) >= CopyBatchSize {
+			p.flushCopy(c)
+		}
+	}
+	return false, nil
+}
+
+// flushCopy 写入攒下的一批行，出错时整批不写入
+func (p *SQLParser) flushCopy(c *copyState) {
+	if len(c.batch) == 0 {
+		return
+	}
+	n, err := p.Engine.InsertRows(c.table, c.batch)
+	if err != nil {
+		c.err, c.errLine, c.errBulk = err, c.line-len(c.batch)+1, true
+	}
+	c.loaded += n
+	c.batch = nil // 事务中 InsertRows 只是把这批行缓存起来，不能复用底层数组
+}
+
+func (p *SQLParser) finishCopy(c *copyState) error {
+	if c.err == nil {
+		p.flushCopy(c)
+	}
+	if c.err != nil {
+		where := fmt.Sprintf("line %d", c.errLine)
+		if c.errBulk {
+			where = fmt.Sprintf("batch starting at line %d", c.errLine)
+		}
+		return fmt.Errorf("copy into %s, %s: %w (%d rows loaded before it)", c.table, where, c.err, c.loaded)
+	}
+	if c.loaded == 1 {
+		fmt.Fprintln(p.Output, "COPY OK, 1 row loaded.")
+	} else {
+		fmt.Fprintf(p.Output, "COPY OK, %d rows loaded.\n", c.loaded)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"cmp"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/page"
+)
+
+// Durability 决定修改类语句返回前是否等待数据落盘，是该库上会话 SyncOnCommit 的初始值
+type Durability string
+
+const (
+	DurabilityAsync Durability = "async" // 写入留在缓冲池里，换出或关闭时才落盘
+	DurabilitySync  Durability = "sync"  // 每条修改类语句返回前刷盘并 fsync，见 Engine.commit
+)
+
+// ParseDurability 解析 durability 选项的值，不区分大小写
+func ParseDurability(s string) (Durability, error) {
+	switch d := Durability(strings.ToLower(s)); d {
+	case DurabilityAsync, DurabilitySync:
+		return d, nil
+	}
+	return "", errorf(ErrInvalidValue, "invalid durability '%s' (expected async or sync)", s)
+}
+
+// DatabaseConfig 是建库时确定的配置，保存在库目录下的 config.json，打开数据库时读取
+// 服务器的启动参数只决定新建库的默认值，已有的库始终按自己的配置运行
+type DatabaseConfig struct {
+	PageSize    int         `json:"page_size"`
+	Tablespaces int         `json:"tablespaces"`
+	Compression Compression `json:"compression"` // 建表时没有指定 compression 的表使用的压缩方式
+	Durability  Durability  `json:"durability"`
+}
+
+// resolveDatabaseConfig 按 opts、服务器默认值 defaults、内置默认值的顺序确定每一项并校验
+func resolveDatabaseConfig(opts, defaults DatabaseOptions) (DatabaseConfig, error) {
+	cfg := DatabaseConfig{
+		PageSize:    cmp.Or(opts.PageSize, defaults.PageSize, page.PageSize),
+		Tablespaces: cmp.Or(opts.Tablespaces, defaults.Tablespaces, 1),
+		Compression: cmp.Or(opts.Compression, defaults.Compression, CompressionNone),
+		Durability:  cmp.Or(opts.Durability, defaults.Durability, DurabilityAsync),
+	}
+	if !page.ValidPageSize(cfg.PageSize) {
+		return cfg, errorf(ErrInvalidValue, "invalid page size %d (must be a power of two between %d and %d)",
+			cfg.PageSize, page.MinPageSize, page.MaxPageSize)
+	}
+	if cfg.Tablespaces < 1 || cfg.Tablespaces > disk.MaxTablespaces {
+		return cfg, errorf(ErrInvalidValue, "invalid tablespace count %d (must be between 1 and %d)", cfg.Tablespaces, disk.MaxTablespaces)
+	}
+	if _, err := ParseCompression(string(cfg.Compression)); err != nil {
+		return cfg, err
+	}
+	if _, err := ParseDurability(string(cfg.Durability)); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func writeDatabaseConfig(dir string, cfg DatabaseConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ConfigFileName), append(data, '\n'), 0644)
+}
+
+// ReadDatabaseConfig 读取库目录 dir 下的配置，打开数据文件之前调用
+// 没有 config.json 的旧数据库按 meta.json 中的页大小和数据文件个数，其余各项取 defaults
+func ReadDatabaseConfig(dir string, defaults DatabaseOptions) (DatabaseConfig, error) {
+	var opts DatabaseOptions
+	data, err := os.ReadFile(filepath.Join(dir, ConfigFileName))
+	switch {
+	case os.IsNotExist(err):
+		metaFile := filepath.Join(dir, MetaFileName)
+		opts.PageSize = ReadCatalogPageSize(metaFile)
+		opts.Tablespaces = ReadCatalogTablespaces(metaFile)
+	case err != nil:
+		return DatabaseConfig{}, err
+	default:
+		var cfg DatabaseConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return DatabaseConfig{}, errorf(ErrCatalogCorrupt, "%s in database '%s' is corrupt: %v", ConfigFileName, filepath.Base(dir), err)
+		}
+		opts = DatabaseOptions(cfg)
+	}
+	return resolveDatabaseConfig(opts, defaults)
+}
+
+// DatabaseConfig 返回当前库的配置，由 UseDatabase 读取
+func (e *Engine) DatabaseConfig() DatabaseConfig {
+	return e.config
+}
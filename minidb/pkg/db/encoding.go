@@ -0,0 +1,92 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// binaryValueSize 是 binary 编码的值的长度：1 字节标记 + 8 字节小端 int64
+// 叶子读出时会去掉末尾的 \x00，小端的高位零字节也会被去掉，解码时补齐即可；
+// 标记字节非零，保证 0 也不会被去成空值
+const binaryValueSize = 1 + 8
+
+// binary 编码的第一个字节。NULL 也要写一个非零字节：
+// 插入时槽位不会清零，写空值会留下相邻槽位移过来的旧数据
+const (
+	binaryValueTag = 0x01
+	binaryNullTag  = 0x02
+)
+
+// checkEncoding 检查表结构能否使用 enc：binary 要求除主键外只有一个 int / bigint 列
+func checkEncoding(columns []Column, enc ValueEncoding, compression Compression) error {
+	if enc != EncodingBinary {
+		return nil
+	}
+	if compression == CompressionFlate {
+		return errorf(ErrInvalidSchema, "value_encoding = binary values are fixed-size and cannot be compressed")
+	}
+	if len(columns) != 2 || (columns[1].Type != TypeInt && columns[1].Type != TypeBigInt) {
+		return errorf(ErrInvalidSchema, "value_encoding = binary needs exactly one int or bigint column besides the primary key")
+	}
+	return nil
+}
+
+// encodeValue 按表的存储格式把逗号拼接的值编码成写入叶子槽位的字节
+func encodeValue(meta *TableMeta, value string) ([]byte, error) {
+	if ValueEncoding(meta.Encoding) != EncodingBinary {
+		return compressValue(meta, []byte(value))
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []byte{binaryNullTag}, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, errorf(ErrInvalidValue, "value '%s' is not an integer", value)
+	}
+	return encodeBinaryValue(n), nil
+}
+
+// encodeBinaryValue 把一个 int64 编码成 binary 格式
+func encodeBinaryValue(n int64) []byte {
+	buf := make([]byte, binaryValueSize)
+	buf[0] = binaryValueTag
+	binary.LittleEndian.PutUint64(buf[1:], uint64(n))
+	return buf
+}
+
+// decodeValue 把 B+ 树中读出的值解码成逗号拼接的值
+// 树按写入时的长度返回值（见 index/overflow.go），不需要再去掉槽位填充的 0
+func decodeValue(meta *TableMeta, raw []byte) string {
+	if ValueEncoding(meta.Encoding) != EncodingBinary || len(raw) == 0 {
+		return string(decompressValue(meta, raw))
+	}
+	if raw[0] == binaryNullTag {
+		return ""
+	}
+	n, _, _ := decodeIntValue(meta, raw)
+	return strconv.FormatInt(n, 10)
+}
+
+// decodeIntValue 直接把整数值列解码成 int64，不经过字符串；NULL 时 valid 为 false
+// binary 编码只需读 8 个字节，text 编码要去掉填充再做十进制解析
+func decodeIntValue(meta *TableMeta, raw []byte) (n int64, valid bool, err error) {
+	if ValueEncoding(meta.Encoding) == EncodingBinary {
+		if len(raw) == 0 || raw[0] == binaryNullTag {
+			return 0, false, nil
+		}
+		var buf [binaryValueSize]byte
+		copy(buf[:], raw)
+		return int64(binary.LittleEndian.Uint64(buf[1:])), true, nil
+	}
+	val, ok := decodeColumn(string(bytes.TrimRight(raw, "\x00")), 0)
+	if !ok {
+		return 0, false, nil
+	}
+	if n, err = strconv.ParseInt(val, 10, 64); err != nil {
+		return 0, false, errorf(ErrInvalidValue, "value '%s' is not an integer", val)
+	}
+	return n, true, nil
+}
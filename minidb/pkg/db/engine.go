@@ -3,14 +3,23 @@ package db
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"minidb/pkg/buffer"
 	"minidb/pkg/storage/disk"
 	"minidb/pkg/storage/index"
 	"minidb/pkg/storage/page"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+)
+
+// 每个数据库目录下的文件名
+const (
+	MetaFileName   = "meta.json"
+	DataFileName   = "data.db"
+	ConfigFileName = "config.json" // 建库时的配置，见 DatabaseConfig
 )
 
 type Engine struct {
@@ -19,129 +28,431 @@ type Engine struct {
 	Catalog     *Catalog
 	CurrentDB   string // 每个会话独享的状态
 	DataRoot    string
+
+	// SyncOnCommit 为 true 时，修改类语句在返回前把脏页和元数据刷盘并 fsync；
+	// 为 false 时写入只留在缓冲池里，直到被换出或关闭时才落盘。会话独享，默认关闭
+	SyncOnCommit bool
+
+	// CompactOnClose 为 true 时，Close 会把当前库的数据文件重写一遍，丢掉不再使用的页面
+	CompactOnClose bool
+
+	// QueryMemory 是单个查询中排序等算子缓存行可用的内存上限（字节），超出时溢出到临时文件；
+	// 0 表示使用 DefaultQueryMemory。会话独享
+	QueryMemory int64
+
+	// Defaults 是新建数据库时没有指定的选项取的值（服务器级默认值），零值表示内置默认值
+	Defaults DatabaseOptions
+	// OpenOptions 是 UseDatabase 打开数据库时使用的选项（服务器级），见 opendb.go
+	OpenOptions OpenOptions
+
+	config   DatabaseConfig // 当前库的配置，UseDatabase 时读取，会话独享
+	warnings []Warning     // 当前语句产生的警告，会话独享
+	blooms   *bloomRegistry // 主键布隆过滤器，所有会话共享
+	tx       *transaction   // 当前会话未提交的事务，nil 表示自动提交
+	txns     *txnRegistry   // 提交时检测写冲突用的版本记录，所有会话共享
+	epochs   *epochRegistry // VACUUM 换下的旧页面等读者结束后再释放，所有会话共享
+	locks    *tableLocks    // 每张表的读写锁，所有会话共享
+	rowCache *rowCache      // 点查结果缓存，默认关闭，所有会话共享
+
+	dbs     *openDatabases // 打开的库和引用计数，所有会话共享，见 opendb.go
+	db      *openDB        // 本引擎引用的库，nil 表示还没有 use 过、资源是直接注入的
+	session bool           // 由 NewSession 创建，Close 时只放弃对库的引用
 }
 
 func NewEngine(dataRoot string) *Engine {
 	if _, err := os.Stat(dataRoot); os.IsNotExist(err) {
 		os.Mkdir(dataRoot, 0755)
 	}
-	return &Engine{
+	e := &Engine{
 		DataRoot: dataRoot,
+		blooms:   &bloomRegistry{filters: make(map[string]*bloomFilter)},
+		txns:     &txnRegistry{},
+		rowCache: newRowCache(),
+		locks:    &tableLocks{locks: make(map[string]*tableLock)},
+		dbs:      newOpenDatabases(),
 	}
+	e.epochs = newEpochRegistry(func(id page.PageID) bool { return e.BPM.DeletePage(id) })
+	return e
 }
 
 // NewSession 创建一个新的 Engine 实例用于当前会话
-// 共享底层的 BPM、Catalog 和 DiskManager，但隔离 CurrentDB
+// 共享底层的 BPM、Catalog 和 DiskManager，但隔离 CurrentDB；会话 use 别的库时换成那个库的资源
 func (e *Engine) NewSession() *Engine {
+	e.adoptCurrent()
 	return &Engine{
 		BPM:         e.BPM,
 		DiskManager: e.DiskManager,
-		Catalog:     e.Catalog,
+		Catalog:     e.Catalog.sharedCatalog(), // 临时表不带到新会话
 		DataRoot:    e.DataRoot,
 		CurrentDB:   "", // 新会话默认未选中数据库
+		Defaults:    e.Defaults,
+		OpenOptions: e.OpenOptions,
+		blooms:      e.blooms,
+		txns:        e.txns,
+		epochs:      e.epochs,
+		rowCache:    e.rowCache,
+		locks:       e.locks,
+		dbs:         e.dbs,
+		session:     true,
 	}
 }
 
 func (e *Engine) EnsureDBSelected() error {
 	if e.CurrentDB == "" {
-		return errors.New("no database selected. use 'use <dbname>' first")
+		return errorf(ErrNoDatabase, "no database selected. use 'use <dbname>' first")
 	}
 	return nil
 }
 
 // ---------------- 数据库操作 ----------------
 
+// ShowDatabases 返回已注册的数据库名，按名称排序
 func (e *Engine) ShowDatabases() ([]string, error) {
-	files, err := ioutil.ReadDir(e.DataRoot)
+	infos, err := e.ListDatabases()
 	if err != nil {
 		return nil, err
 	}
-	var dbs []string
-	for _, f := range files {
-		if f.IsDir() {
-			dbs = append(dbs, f.Name())
-		}
+	dbs := make([]string, 0, len(infos))
+	for _, info := range infos {
+		dbs = append(dbs, info.Name)
 	}
 	return dbs, nil
 }
 
+// ShowTables 返回本会话当前库中的表名（包括本会话的临时表），按名称排序
+func (e *Engine) ShowTables() ([]string, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, err
+	}
+	tables := e.Catalog.ListTables()
+	slices.Sort(tables)
+	return tables, nil
+}
+
 func (e *Engine) CreateDatabase(name string) error {
+	return e.CreateDatabaseWithPageSize(name, page.PageSize)
+}
+
+// CreateDatabaseWithPageSize 创建数据库并在元数据中记录页大小，之后打开该库时按此页大小读写
+func (e *Engine) CreateDatabaseWithPageSize(name string, pageSize int) error {
+	return e.CreateDatabaseWithOptions(name, DatabaseOptions{PageSize: pageSize})
+}
+
+// DatabaseOptions 是建库时确定、之后不能修改的选项，零值表示取 Engine.Defaults 或内置默认值
+// 字段与 DatabaseConfig 一一对应
+type DatabaseOptions struct {
+	PageSize    int         // 0 表示默认页大小
+	Tablespaces int         // 数据文件个数，0 表示 1 个
+	Compression Compression // 建表时没有指定 compression 的表的压缩方式
+	Durability  Durability  // 会话 SyncOnCommit 的初始值
+}
+
+// CreateDatabaseWithOptions 按选项创建数据库，最终的配置写入库目录下的 config.json
+// 目录、元数据和配置文件都建好之后才登记到注册表，中途失败不会留下"半个"数据库
+func (e *Engine) CreateDatabaseWithOptions(name string, opts DatabaseOptions) error {
+	cfg, err := resolveDatabaseConfig(opts, e.Defaults)
+	if err != nil {
+		return err
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	dbs, err := loadRegistry(e.DataRoot)
+	if err != nil {
+		return err
+	}
+	if _, ok := dbs[name]; ok {
+		return errorf(ErrDatabaseExists, "database '%s' already exists", name)
+	}
+
 	path := filepath.Join(e.DataRoot, name)
 	if _, err := os.Stat(path); !os.IsNotExist(err) {
-		return fmt.Errorf("database '%s' already exists", name)
+		return errorf(ErrDatabaseExists, "directory '%s' already exists but is not a registered database", name)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		return err
+	}
+	if err := initCatalogFile(filepath.Join(path, MetaFileName), cfg.PageSize, cfg.Tablespaces); err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	if err := writeDatabaseConfig(path, cfg); err != nil {
+		os.RemoveAll(path)
+		return err
 	}
-	return os.Mkdir(path, 0755)
+
+	dbs[name] = DatabaseInfo{Name: name, CreatedAt: time.Now(), PageSize: cfg.PageSize, Tablespaces: cfg.Tablespaces}
+	if err := saveRegistry(e.DataRoot, dbs); err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	return nil
 }
 
 func (e *Engine) DropDatabase(name string) error {
 	if e.CurrentDB == name {
-		return errors.New("cannot drop the currently open database")
+		return errorf(ErrDatabaseInUse, "cannot drop the currently open database")
 	}
-	path := filepath.Join(e.DataRoot, name)
-	return os.RemoveAll(path)
+	// 持有 dbs.mu 直到删完，期间其他会话不能打开这个库
+	e.dbs.mu.Lock()
+	defer e.dbs.mu.Unlock()
+	if n := e.databaseRefs(name); n > 0 {
+		return errorf(ErrDatabaseInUse, "database '%s' is in use by %d session(s)", name, n)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	dbs, err := loadRegistry(e.DataRoot)
+	if err != nil {
+		return err
+	}
+	if _, ok := dbs[name]; !ok {
+		return errorf(ErrDatabaseNotFound, "database '%s' does not exist", name)
+	}
+
+	// 先注销再删目录：删到一半失败时，残留目录不会再被当成数据库
+	delete(dbs, name)
+	if err := saveRegistry(e.DataRoot, dbs); err != nil {
+		return err
+	}
+	e.rowCache.dropDatabase(name)
+	return os.RemoveAll(filepath.Join(e.DataRoot, name))
 }
 
-// UseDatabase 切换当前会话的数据库
+// UseDatabase 切换当前会话的数据库，打开它的数据文件和元数据；其他会话已经打开的库直接共享，不会再打开一次
+// 再次 use 当前的库只重新读取库的配置。事务和临时表都在当前库的数据文件中，有它们时不能切换到别的库
 func (e *Engine) UseDatabase(name string) error {
-	dbPath := filepath.Join(e.DataRoot, name)
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		return fmt.Errorf("database '%s' does not exist", name)
+	if !e.HasDatabase(name) {
+		return errorf(ErrDatabaseNotFound, "database '%s' does not exist", name)
+	}
+	if name != e.CurrentDB {
+		if e.tx != nil {
+			return errorf(ErrUnsupported, "cannot switch databases inside a transaction, commit or rollback first")
+		}
+		if e.Catalog != nil && len(e.Catalog.tempTables()) > 0 {
+			return errorf(ErrUnsupported, "this session has temporary tables in database '%s', drop them before switching databases", e.CurrentDB)
+		}
 	}
 
-	// 如果这是主引擎初始化（还没有 DiskManager），则初始化资源
-	// 如果是会话引擎，DiskManager 已经共享，这里只需要切换 CurrentDB
-	// 但为了简单，我们的架构设计是：主引擎负责持有资源，会话引用资源。
-	// 这里我们需要处理一种情况：如果是第一次连接数据库（System startup），需要初始化 Global Resources。
-
-	// 在本设计中，我们在 main.go 中统一初始化资源，UseDatabase 仅作为切换 CurrentDB 的检查
-	// 但为了兼容之前的逻辑（Lazy Load），我们保留加载逻辑，但要加锁防止并发重置。
+	// 库的配置决定本会话的默认持久性和新表的默认压缩方式
+	cfg, err := ReadDatabaseConfig(filepath.Join(e.DataRoot, name), e.Defaults)
+	if err != nil {
+		return err
+	}
+	if name != e.CurrentDB || e.BPM == nil {
+		if err := e.attach(name, cfg); err != nil {
+			return err
+		}
+	}
+	e.CurrentDB = name
+	e.config = cfg
+	e.SyncOnCommit = cfg.Durability == DurabilitySync
+	return nil
+}
 
-	// *为了简化高并发下的逻辑，我们假设资源在 main.go 启动时已加载，或者在这里加锁*
-	// 这里简化为：只检查是否存在，然后切换 CurrentDB。
-	// 实际的数据加载（BPM等）如果还没做，应该由 Global Engine 做。
-	// 鉴于之前代码结构，我们假设 SwitchDatabase 主要是为了切换 Catalog 上下文。
+// Close 关闭引擎。会话只放弃对库的引用，没有会话再用的库才会关闭；
+// 根引擎（NewEngine 创建的）的 Close 是服务器退出，关闭所有打开的库。
+// 返回写回脏页、元数据和关闭数据文件时的所有错误，其中仍被 Pin 住、没有写回的脏页报告为 buffer.ErrPagesPinned
+func (e *Engine) Close() error {
+	e.DropTemporaryTables()
+	if e.session {
+		return e.detach()
+	}
+	if e.BPM != nil {
+		e.BPM.StopFlusher()
+	}
+	err := closeResources(e.CurrentDB, e.BPM, e.Catalog, nil)
+	if e.CompactOnClose && e.BPM != nil && e.Catalog != nil && e.DiskManager != nil && e.CurrentDB != "" {
+		// 压缩失败时原数据文件不受影响，照常关闭即可
+		e.compactDataFile()
+	}
+	if e.DiskManager != nil {
+		if closeErr := e.DiskManager.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close data file of database '%s': %w", e.CurrentDB, closeErr))
+		}
+	}
+	err = errors.Join(err, e.dbs.closeAll(e.db))
+	e.db = nil
+	return err
+}
 
-	// *修正*：由于之前的设计是 Lazy Load (NewDiskManager 在 Use 时调用)，多客户端并发时这会有问题。
-	// 我们将在 main.go 中改为 Eager Load (预加载)，这里只做切换。
+// commitFlushRetries 是提交时遇到被 Pin 住的脏页、重新写回的最多次数
+const commitFlushRetries = 10
 
-	e.CurrentDB = name
+// commit 在修改类操作成功后调用，按 SyncOnCommit 决定是否等待数据持久化
+func (e *Engine) commit() error {
+	if !e.SyncOnCommit {
+		return nil
+	}
+	// 被 Pin 住的脏页多半正被点查读着，读者很快就会 Unpin，稍等再写
+	err := e.BPM.FlushAndSync()
+	for i := 0; i < commitFlushRetries && errors.Is(err, buffer.ErrPagesPinned); i++ {
+		time.Sleep(time.Millisecond)
+		err = e.BPM.FlushAndSync()
+	}
+	if err != nil {
+		return fmt.Errorf("sync data pages: %w", err)
+	}
+	if err := e.Catalog.Flush(); err != nil {
+		return fmt.Errorf("sync metadata: %v", err)
+	}
 	return nil
 }
 
-// InitSystemResources 初始化全局资源（供 main.go 调用）
-func (e *Engine) InitSystemResources() error {
-	// 这里可以加载默认库或元数据，目前仅作为占位
+// SetDurableWrites 开启或关闭数据文件的逐页 fsync，见 disk.DiskManagerImpl.SetDurable
+// 与 SyncOnCommit 不同，被换出的脏页也会在写出时落盘；数据文件由所有会话共享，所以设置对所有会话生效
+func (e *Engine) SetDurableWrites(on bool) error {
+	d, ok := e.DiskManager.(disk.DurableWriter)
+	if !ok {
+		return errorf(ErrUnsupported, "the data file does not support durable writes")
+	}
+	d.SetDurable(on)
 	return nil
 }
 
-func (e *Engine) Close() {
-	if e.BPM != nil {
-		e.BPM.FlushAllPages()
+// FlushMetadata 强制把当前库的 Catalog 写盘
+func (e *Engine) FlushMetadata() error {
+	if err := e.EnsureDBSelected(); err != nil {
+		return err
 	}
-	if e.Catalog != nil {
-		e.Catalog.SaveMeta()
+	return e.Catalog.Flush()
+}
+
+// WarmCache 把指定表（为空则所有表）的根及前 depth 层索引页预读进缓冲池
+// 用于重启后的冷启动，读入总量不超过缓冲池大小；返回预读的页数
+func (e *Engine) WarmCache(tables []string, depth int) (int, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return 0, err
 	}
-	if e.DiskManager != nil {
-		e.DiskManager.Close()
+	if len(tables) == 0 {
+		tables = e.Catalog.ListTables()
+	}
+
+	budget := e.BPM.PoolSize()
+	loaded := 0
+	for _, name := range tables {
+		meta, ok := e.Catalog.GetTable(name)
+		if !ok {
+			return loaded, errorf(ErrTableNotFound, "table '%s' not found", name)
+		}
+		exit := e.enterRead()
+		loaded += index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Warm(depth, budget-loaded)
+		exit()
+		if loaded >= budget {
+			break
+		}
+	}
+	return loaded, nil
+}
+
+// EvictTable 把表的所有页面移出缓冲池，脏页先写回；用于测试冷缓存或大扫描后释放内存
+// 正被使用（Pin 住）的页面无法淘汰，返回淘汰和跳过的页数
+func (e *Engine) EvictTable(tableName string) (evicted, skipped int, err error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return 0, 0, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return 0, 0, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+
+	exit := e.enterRead()
+	ids, err := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Pages()
+	exit()
+	if err != nil {
+		return 0, 0, err
+	}
+	set := make(map[page.PageID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
 	}
+	return e.BPM.EvictWhere(func(id page.PageID) bool {
+		_, ok := set[id]
+		return ok
+	})
 }
 
 // ---------------- 表操作 ----------------
 
+// CreateTable 解析 SQL 风格的列定义后建表，见 ParseSchema
 func (e *Engine) CreateTable(tableName string, schema string) error {
-	if err := e.EnsureDBSelected(); err != nil {
+	columns, err := ParseSchema(schema)
+	if err != nil {
 		return err
 	}
+	return e.CreateTableSchema(tableName, columns, TableOptions{})
+}
 
-	tree := index.NewBPlusTree(page.InvalidPageID, e.BPM)
-	tree.StartNewTree()
-
-	rootId := tree.GetRootPageId()
+// CreateTableSchema 用类型化的列定义直接建表，不经过 SQL 解析
+func (e *Engine) CreateTableSchema(tableName string, columns []Column, opts TableOptions) error {
+	if err := e.EnsureDBSelected(); err != nil {
+		return err
+	}
+	if err := checkIdentifier("table name", tableName); err != nil {
+		return err
+	}
+	if err := validateColumns(columns); err != nil {
+		return err
+	}
+	// 没有指定压缩方式时按库的配置；二进制编码的值不能压缩，不受库配置影响
+	if opts.Compression == "" && opts.Encoding != EncodingBinary {
+		opts.Compression = e.config.Compression
+	}
+	if err := checkEncoding(columns, opts.Encoding, opts.Compression); err != nil {
+		return err
+	}
+	exists, err := e.TableExists(tableName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if opts.IfNotExists {
+			return nil
+		}
+		return errorf(ErrTableExists, "table already exists")
+	}
+	if n := e.Catalog.TablespaceCount(); opts.Tablespace < 0 || opts.Tablespace >= n {
+		return errorf(ErrInvalidValue, "tablespace %d does not exist (database has %d)", opts.Tablespace, n)
+	}
 
-	if !e.Catalog.CreateTable(tableName, schema, rootId) {
-		return errors.New("table already exists")
+	meta := &TableMeta{
+		Name:       tableName,
+		RootPageId: int32(page.InvalidPageID),
+		Schema:     FormatSchema(columns),
+		Tablespace: opts.Tablespace,
 	}
-	return nil
+	if columns[0].Type == TypeVarchar {
+		tree := index.NewBPlusTreeStr(page.InvalidPageID, e.BPM)
+		tree.SetTablespace(opts.Tablespace)
+		tree.StartNewTree()
+		meta.KeyType = KeyTypeVarchar
+		meta.StrRootPageId = int32(tree.GetRootPageId())
+	} else {
+		tree := index.NewBPlusTree(page.InvalidPageID, e.BPM)
+		tree.SetTablespace(opts.Tablespace)
+		tree.StartNewTree()
+		meta.RootPageId = int32(tree.GetRootPageId())
+	}
+	meta.AutoIncrement = columns[0].AutoIncrement
+	if opts.OnConflict != ConflictError {
+		meta.OnConflict = string(opts.OnConflict)
+	}
+	if opts.Encoding != EncodingText {
+		meta.Encoding = string(opts.Encoding)
+	}
+	if opts.Compression != CompressionNone {
+		meta.Compression = string(opts.Compression)
+	}
+	var created bool
+	if opts.Temporary {
+		created = e.sessionCatalog().createTempTable(meta)
+	} else {
+		created = e.Catalog.CreateTableMeta(meta)
+	}
+	if !created {
+		return errorf(ErrTableExists, "table already exists")
+	}
+	return e.commit()
 }
 
 func (e *Engine) Insert(tableName string, key int64, value string) error {
@@ -151,50 +462,368 @@ func (e *Engine) Insert(tableName string, key int64, value string) error {
 
 	meta, ok := e.Catalog.GetTable(tableName)
 	if !ok {
-		return fmt.Errorf("table '%s' not found", tableName)
+		return errorf(ErrTableNotFound, "table '%s' not found", tableName)
 	}
 
-	tree := index.NewBPlusTree(page.PageID(meta.RootPageId), e.BPM)
+	if err := requireIntKey(meta); err != nil {
+		return err
+	}
+	if err := checkKeyRange(meta.Columns(), key); err != nil {
+		return err
+	}
+	if err := checkRowValues(meta.Columns(), value); err != nil {
+		return err
+	}
+	if meta.AutoIncrement {
+		if err := e.Catalog.ObserveAutoId(meta, key); err != nil {
+			return err
+		}
+	}
+	raw, err := encodeValue(meta, value)
+	if err != nil {
+		return err
+	}
+	if e.tx != nil {
+		e.tx.add(tableName, []Row{{Key: key, Value: value}})
+		return nil
+	}
+	e.txns.record(tableName, []int64{key})
+	w := e.writeLeaf(tableName)
+	defer w.unlock()
+	tree := e.openTree(meta)
+	indexes := e.openIndexes(tableName, meta)
 
-	success := tree.Insert(key, []byte(value))
-	if !success {
-		return errors.New("insert failed (duplicate key?)")
+	inserted, old, err := applyInsert(tree, w, meta, key, raw)
+	if err != nil {
+		return insertError(tableName, key, err)
+	}
+	indexes.applied(key, inserted, old, raw)
+	e.rowCache.invalidate(e.cacheName(tableName), key)
+	if inserted {
+		e.bloomAdd(tableName, meta, key)
+		e.Catalog.AddRowCount(tableName, 1)
 	}
 
 	newRoot := tree.GetRootPageId()
 	if newRoot != page.PageID(meta.RootPageId) {
 		e.Catalog.UpdateTableRoot(tableName, newRoot)
 	}
-	return nil
+	if err := indexes.finish(); err != nil {
+		return err
+	}
+	return e.commit()
+}
+
+// NextAutoId 为声明了 auto_increment 的表分配下一个主键，见 Catalog.NextAutoId
+func (e *Engine) NextAutoId(tableName string) (int64, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return 0, err
+	}
+	return e.Catalog.NextAutoId(tableName)
+}
+
+// InsertBatch 以全有或全无的方式插入一批行
+// 任何一行失败（如主键重复）时，撤销本批次已写入的行后再返回错误
+func (e *Engine) InsertBatch(tableName string, rows []Row) error {
+	_, err := e.InsertRows(tableName, rows)
+	return err
+}
+
+// InsertRows 与 InsertBatch 相同，同时返回实际写入（新增或覆盖）的行数
+// 表的冲突策略为 ignore 时，被跳过的行不计入；事务中只是缓存起来，返回缓存的行数
+func (e *Engine) InsertRows(tableName string, rows []Row) (int, error) {
+	meta, values, err := e.prepareRows(tableName, rows)
+	if err != nil {
+		return 0, err
+	}
+	if meta.hasStringKey() {
+		return e.insertStrRows(tableName, meta, rows, values)
+	}
+	if e.tx != nil {
+		e.tx.add(tableName, rows)
+		return len(rows), nil
+	}
+	keys := make([]int64, len(rows))
+	for i, r := range rows {
+		keys[i] = r.Key
+	}
+	e.txns.record(tableName, keys)
+	n, _, err := e.applyRows(tableName, meta, rows, values)
+	return n, err
+}
+
+// prepareRows 检查整批的主键范围并编码所有的值，避免写了一半再回滚
+func (e *Engine) prepareRows(tableName string, rows []Row) (*TableMeta, [][]byte, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, nil, err
+	}
+
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+
+	values := make([][]byte, len(rows))
+	for i, r := range rows {
+		if meta.hasStringKey() {
+			if err := checkStrKey(r.StrKey); err != nil {
+				return nil, nil, err
+			}
+		} else if r.StrKey != "" {
+			return nil, nil, errorf(ErrInvalidValue, "table '%s' has an integer primary key", tableName)
+		} else if err := checkKeyRange(meta.Columns(), r.Key); err != nil {
+			return nil, nil, err
+		}
+		if err := checkRowValues(meta.Columns(), r.Value); err != nil {
+			return nil, nil, err
+		}
+		if meta.AutoIncrement {
+			if err := e.Catalog.ObserveAutoId(meta, r.Key); err != nil {
+				return nil, nil, err
+			}
+		}
+		var err error
+		if values[i], err = encodeValue(meta, r.Value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return meta, values, nil
+}
+
+// rowUndo 记录一批写入改过的行：新增的行撤销时删除，覆盖的行恢复成批次开始前的值
+type rowUndo struct {
+	inserted map[int64]struct{}
+	replaced map[int64][]byte
+}
+
+// revert 撤销 u 记录的写入，调用方要独占整张表
+func (u *rowUndo) revert(tree *index.BPlusTree, indexes *indexWriter) {
+	for key := range u.inserted {
+		indexes.removeCurrent(tree, key)
+		tree.Remove(key)
+	}
+	for key, val := range u.replaced {
+		indexes.removeCurrent(tree, key)
+		tree.Update(key, val)
+		indexes.applied(key, true, nil, val)
+	}
+}
+
+// applyRows 把 prepareRows 检查过的一批行写入表，任何一行失败时撤销整批
+// 写入之后返回的 rowUndo 可以用 undoRows 再撤销这一批；整批被撤销时为 nil
+func (e *Engine) applyRows(tableName string, meta *TableMeta, rows []Row, values [][]byte) (int, *rowUndo, error) {
+	w := e.writeLeaf(tableName)
+	defer w.unlock()
+	tree := e.openTree(meta)
+	indexes := e.openIndexes(tableName, meta)
+	defer func() {
+		newRoot := tree.GetRootPageId()
+		if newRoot != page.PageID(meta.RootPageId) {
+			e.Catalog.UpdateTableRoot(tableName, newRoot)
+		}
+		indexes.finish()
+		// 成功和回滚都可能改过这些 Key
+		keys := make([]int64, len(rows))
+		for i, r := range rows {
+			keys[i] = r.Key
+		}
+		e.rowCache.invalidate(e.cacheName(tableName), keys...)
+	}()
+
+	undo := &rowUndo{
+		inserted: make(map[int64]struct{}, len(rows)), // 本批次新增的行
+		replaced: make(map[int64][]byte),              // 本批次覆盖的行在批次开始前的值
+	}
+	inserted, replaced := undo.inserted, undo.replaced
+	affected := 0
+	for i, r := range rows {
+		isNew, old, err := applyInsert(tree, w, meta, r.Key, values[i])
+		if err != nil {
+			w.escalate()
+			undo.revert(tree, indexes)
+			if err = insertError(tableName, r.Key, err); len(rows) == 1 {
+				return 0, nil, err
+			}
+			return 0, nil, fmt.Errorf("%w (row %d of %d), batch rolled back: the %d rows before it were not kept", err, i+1, len(rows), i)
+		}
+		indexes.applied(r.Key, isNew, old, values[i])
+		switch {
+		case isNew:
+			inserted[r.Key] = struct{}{}
+			e.bloomAdd(tableName, meta, r.Key)
+			affected++
+		case old != nil:
+			// 同一批次里先插入再覆盖的行，回滚时直接删除即可
+			_, seen := replaced[r.Key]
+			if _, isNew := inserted[r.Key]; !seen && !isNew {
+				replaced[r.Key] = old
+			}
+			affected++
+		}
+	}
+	e.Catalog.AddRowCount(tableName, int64(len(inserted)))
+	if err := indexes.finish(); err != nil {
+		return affected, undo, err
+	}
+	return affected, undo, e.commit()
+}
+
+// undoRows 撤销 applyRows 写入的一批行，用于事务写到一半失败时撤销已经写入的表
+func (e *Engine) undoRows(tableName string, u *rowUndo) error {
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	w := e.writeLeaf(tableName)
+	defer w.unlock()
+	w.escalate()
+	tree := e.openTree(meta)
+	indexes := e.openIndexes(tableName, meta)
+	u.revert(tree, indexes)
+
+	newRoot := tree.GetRootPageId()
+	if newRoot != page.PageID(meta.RootPageId) {
+		e.Catalog.UpdateTableRoot(tableName, newRoot)
+	}
+	keys := make([]int64, 0, len(u.inserted)+len(u.replaced))
+	for key := range u.inserted {
+		keys = append(keys, key)
+	}
+	for key := range u.replaced {
+		keys = append(keys, key)
+	}
+	e.rowCache.invalidate(e.cacheName(tableName), keys...)
+	e.Catalog.AddRowCount(tableName, -int64(len(u.inserted)))
+	if err := indexes.finish(); err != nil {
+		return err
+	}
+	return e.commit()
+}
+
+// applyInsert 按表的冲突策略写入一行
+// inserted 表示新增了一行；old 非 nil 表示覆盖了已有的行，内容是原来的值；
+// 主键冲突（策略为 error）时返回 index.ErrDuplicateKey，写入失败时返回树的错误，见 insertError。
+// 叶子放得下时只改这个叶子，与点查并发；要分裂或覆盖时先让 w 独占整张表
+func applyInsert(tree *index.BPlusTree, w *leafWriter, meta *TableMeta, key int64, value []byte) (inserted bool, old []byte, err error) {
+	switch ConflictPolicy(meta.OnConflict) {
+	case ConflictIgnore:
+		if _, found := tree.GetValue(key); found {
+			return false, nil, nil
+		}
+	case ConflictReplace:
+		if prev, found := tree.GetValue(key); found {
+			w.escalate()
+			if !tree.Update(key, value) {
+				return false, nil, index.ErrInsertFailed
+			}
+			return false, prev, nil
+		}
+	}
+	err = tree.InsertInLeaf(key, value)
+	if errors.Is(err, index.ErrNeedsRestructure) {
+		w.escalate()
+		err = tree.TryInsert(key, value)
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return true, nil, nil
+}
+
+// insertError 把 applyInsert 的错误转换成对外的错误：主键冲突报告是哪个主键，
+// 存储层的故障（分配不到页面、树已损坏）保留原因，不会被当成主键冲突
+func insertError(tableName string, key int64, err error) error {
+	if errors.Is(err, index.ErrDuplicateKey) {
+		return errorf(ErrDuplicateKey, "duplicate primary key %d in table '%s'", key, tableName)
+	}
+	if errors.Is(err, index.ErrInsertFailed) {
+		return fmt.Errorf("insert key %d into table '%s': %w", key, tableName, err)
+	}
+	return treeError(tableName, err)
+}
+
+// openTree 打开表的 B+ 树，写入时新页分配在表所在的表空间
+func (e *Engine) openTree(meta *TableMeta) *index.BPlusTree {
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	tree.SetTablespace(meta.Tablespace)
+	return tree
 }
 
 func (e *Engine) SelectAll(tableName string) ([]string, error) {
 	if err := e.EnsureDBSelected(); err != nil {
 		return nil, err
 	}
+	if err := e.checkTxRead(tableName); err != nil {
+		return nil, err
+	}
 
 	meta, ok := e.Catalog.GetTable(tableName)
 	if !ok {
-		return nil, fmt.Errorf("table '%s' not found", tableName)
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+
+	if meta.hasStringKey() {
+		rows, err := e.scanStrRows(tableName, -1)
+		results := make([]string, 0, len(rows))
+		for _, r := range rows {
+			results = append(results, fmt.Sprintf("[%s] %s", r.StrKey, r.Value))
+		}
+		return results, err
 	}
 
-	tree := index.NewBPlusTree(page.PageID(meta.RootPageId), e.BPM)
+	// 整个扫描期间持有读锁，迭代器沿叶子链表前进时树不会被并发的写入改变结构
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
 	it := tree.Begin()
 	if it == nil {
-		return []string{}, nil
+		return []string{}, treeError(tableName, tree.Err())
 	}
 	defer it.Close()
 
 	var results []string
 	for {
-		row := fmt.Sprintf("[%d] %s", it.Key(), string(it.Value()))
+		row := fmt.Sprintf("[%d] %s", it.Key(), decodeValue(meta, it.Value()))
 		results = append(results, row)
 
 		if !it.Next() {
 			break
 		}
 	}
-	return results, nil
+	return results, treeError(tableName, it.Err())
+}
+
+// SelectRange 返回主键在 [low, high] 中的行，格式与 SelectAll 相同；low > high 时返回空结果
+func (e *Engine) SelectRange(tableName string, low, high int64) ([]string, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, err
+	}
+	if err := e.checkTxRead(tableName); err != nil {
+		return nil, err
+	}
+
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	it := tree.Scan(low, high)
+	if it == nil {
+		return []string{}, treeError(tableName, tree.Err())
+	}
+	defer it.Close()
+
+	var results []string
+	for {
+		results = append(results, fmt.Sprintf("[%d] %s", it.Key(), decodeValue(meta, it.Value())))
+		if !it.Next() {
+			break
+		}
+	}
+	return results, treeError(tableName, it.Err())
 }
 
 func (e *Engine) SelectById(tableName string, key int64) (string, bool) {
@@ -206,13 +835,136 @@ func (e *Engine) SelectById(tableName string, key int64) (string, bool) {
 	if !ok {
 		return "", false
 	}
-
-	tree := index.NewBPlusTree(page.PageID(meta.RootPageId), e.BPM)
-	val, found := tree.GetValue(key)
-	if !found {
+	// 点查与只改叶子的写入并发（见 tablelock.go）；过滤器还没建好时要扫描全表来构建，这时换成排斥写者的读锁
+	unlock := e.lookupTable(tableName)
+	mayContain, built := e.bloomProbe(tableName, key)
+	if !built {
+		unlock()
+		unlock = e.readTable(tableName)
+		mayContain = e.bloomMayContain(tableName, meta, key)
+	}
+	defer unlock()
+	if !mayContain {
 		return "", false
 	}
-	return string(val), true
+	name := e.cacheName(tableName)
+	value, found, cached, gen := e.rowCache.get(name, key)
+	if cached {
+		return value, found
+	}
+
+	defer e.enterRead()()
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	if val, ok := tree.GetValue(key); ok {
+		value, found = decodeValue(meta, val), true
+	}
+	e.rowCache.put(name, gen, key, value, found)
+	return value, found
+}
+
+// Contains 报告表中是否存在主键 key
+func (e *Engine) Contains(tableName string, key int64) bool {
+	_, found := e.SelectById(tableName, key)
+	return found
+}
+
+// Delete 删除主键为 key 的行，返回这一行是否存在
+// 删除立即生效、不进入事务的缓存（事务目前只缓存插入），所以事务中不允许删除。
+// 删掉最后一行时树的根变为 InvalidPageID，随 UpdateTableRoot 写入元数据，之后的插入会建新根
+func (e *Engine) Delete(tableName string, key int64) (bool, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return false, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return false, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return false, err
+	}
+	if e.tx != nil {
+		return false, errorf(ErrUnsupported, "delete inside a transaction is not supported")
+	}
+
+	e.txns.record(tableName, []int64{key})
+	w := e.writeLeaf(tableName)
+	defer w.unlock()
+	tree := e.openTree(meta)
+	indexes := e.openIndexes(tableName, meta)
+	indexes.removeCurrent(tree, key)
+	removed, err := tree.RemoveInLeaf(key)
+	if errors.Is(err, index.ErrNeedsRestructure) {
+		w.escalate()
+		removed, err = tree.Remove(key), nil
+	}
+	if err != nil {
+		return false, treeError(tableName, err)
+	}
+	if !removed {
+		return false, nil
+	}
+	e.rowCache.invalidate(e.cacheName(tableName), key)
+	e.Catalog.AddRowCount(tableName, -1)
+
+	newRoot := tree.GetRootPageId()
+	if newRoot != page.PageID(meta.RootPageId) {
+		e.Catalog.UpdateTableRoot(tableName, newRoot)
+	}
+	if err := indexes.finish(); err != nil {
+		return true, err
+	}
+	return true, e.commit()
+}
+
+// DropTable 删除表的元数据
+func (e *Engine) DropTable(tableName string) error {
+	exists, err := e.TableExists(tableName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	// 表的页面放回数据文件的空闲页链表，之后分配新页时复用；
+	// 仍在读这张表的读者结束后才释放，见 freeTablePages。持有写锁，等正在进行的写入结束
+	unlock := e.writeTable(tableName)
+	meta, _ := e.Catalog.GetTable(tableName)
+	if err := e.freeTablePages(meta); err != nil {
+		unlock()
+		return err
+	}
+	e.Catalog.DropTable(tableName)
+	unlock()
+	e.dropBloomFilter(tableName)
+	e.rowCache.drop(e.cacheName(tableName))
+	return nil
+}
+
+// TableExists 检查当前数据库中是否有这张表，没有选中数据库时返回错误
+func (e *Engine) TableExists(tableName string) (bool, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return false, err
+	}
+	return e.Catalog.HasTable(tableName), nil
+}
+
+// TableColumns 返回表结构中声明的列名（按声明顺序）
+func (e *Engine) TableColumns(tableName string) ([]string, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+
+	var names []string
+	for _, def := range strings.Split(meta.Schema, ",") {
+		if fields := strings.Fields(def); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
 }
 
 // DescribeTable 现在返回字符串而不是直接打印
@@ -222,16 +974,122 @@ func (e *Engine) DescribeTable(tableName string) (string, error) {
 	}
 	meta, ok := e.Catalog.GetTable(tableName)
 	if !ok {
-		return "", fmt.Errorf("table '%s' not found", tableName)
+		return "", errorf(ErrTableNotFound, "table '%s' not found", tableName)
 	}
 
 	var sb strings.Builder
 	sb.WriteString("+----------------+----------------------+\n")
 	sb.WriteString(fmt.Sprintf("| Table          | %-20s |\n", meta.Name))
 	sb.WriteString("+----------------+----------------------+\n")
-	sb.WriteString(fmt.Sprintf("| Root Page ID   | %-20d |\n", meta.RootPageId))
-	sb.WriteString("| Schema Definition:                    |\n")
-	sb.WriteString(fmt.Sprintf("  %s\n", meta.Schema))
+	if meta.hasStringKey() {
+		sb.WriteString(fmt.Sprintf("| Root Page ID   | %-20d |\n", meta.StrRootPageId))
+		sb.WriteString(fmt.Sprintf("| Key Type       | %-20s |\n", meta.KeyType))
+	} else {
+		sb.WriteString(fmt.Sprintf("| Root Page ID   | %-20d |\n", meta.RootPageId))
+	}
+	if meta.OnConflict != "" {
+		sb.WriteString(fmt.Sprintf("| On Conflict    | %-20s |\n", meta.OnConflict))
+	}
+	if meta.Encoding != "" {
+		sb.WriteString(fmt.Sprintf("| Value Encoding | %-20s |\n", meta.Encoding))
+	}
+	if meta.Compression != "" {
+		sb.WriteString(fmt.Sprintf("| Compression    | %-20s |\n", meta.Compression))
+	}
+	if columns := meta.Columns(); columns != nil {
+		sb.WriteString("+----------------+----------------------+\n")
+		sb.WriteString("| Column         | Type                 |\n")
+		sb.WriteString("+----------------+----------------------+\n")
+		for _, c := range columns {
+			typ := c.Type.String()
+			if c.PrimaryKey {
+				typ += " PRI"
+			}
+			if c.AutoIncrement {
+				typ += " auto_increment"
+			}
+			sb.WriteString(fmt.Sprintf("| %-14s | %-20s |\n", c.Name, typ))
+		}
+	} else {
+		// 旧版本的自由格式 Schema 解析不了，原样输出
+		sb.WriteString("| Schema Definition:                    |\n")
+		sb.WriteString(fmt.Sprintf("  %s\n", meta.Schema))
+	}
 	sb.WriteString("+----------------+----------------------+")
 	return sb.String(), nil
 }
+
+// CheckBufferPool 检查缓冲池是否足够在当前库最高的树上完成插入，见 index.MinPoolFrames
+// 应在打开数据库时调用：缓冲池太小时插入会在分裂途中因为所有页面都被 Pin 住而失败，
+// 提前拒绝比在运行中莫名其妙地出错更容易排查
+func (e *Engine) CheckBufferPool() error {
+	if err := e.EnsureDBSelected(); err != nil {
+		return err
+	}
+	height := 0
+	for _, name := range e.Catalog.ListTables() {
+		meta, ok := e.Catalog.GetTable(name)
+		if !ok {
+			continue
+		}
+		tree := index.NewBPlusTree(page.PageID(meta.RootPageId), e.BPM)
+		height = max(height, tree.Stats().Height)
+	}
+	if need := index.MinPoolFrames(height); e.BPM.PoolSize() < need {
+		return errorf(ErrPoolTooSmall, "buffer pool too small (need at least %d frames, have %d)", need, e.BPM.PoolSize())
+	}
+	return nil
+}
+
+// TableStatus 是 SHOW TABLE STATUS 中的一行
+type TableStatus struct {
+	Name     string
+	Rows     int64 // 来自 Catalog 的行数缓存
+	Pages    int
+	DataSize int64 // Pages * PageSize
+	Height   int
+	AvgFill  float64
+}
+
+// TableStatus 汇总当前库中每张表的行数、页数、大小、树高和平均填充率
+func (e *Engine) TableStatus() ([]TableStatus, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, err
+	}
+
+	names := e.Catalog.ListTables()
+	sort.Strings(names)
+
+	result := make([]TableStatus, 0, len(names))
+	for _, name := range names {
+		meta, ok := e.Catalog.GetTable(name)
+		if !ok {
+			continue
+		}
+		exit := e.enterRead()
+		stats := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Stats()
+		exit()
+		pages := stats.TotalPages()
+		if meta.hasStringKey() {
+			// 字符串树只统计页数，树高和填充率留空
+			exit := e.enterRead()
+			strPages, err := e.openStrTree(meta).Pages()
+			exit()
+			if err != nil {
+				return nil, treeError(name, err)
+			}
+			pages = len(strPages)
+		} else if e.Catalog.RowCountMissing(name) {
+			e.Catalog.SetRowCount(name, stats.KeyCount)
+		}
+		result = append(result, TableStatus{
+			Name:     name,
+			Rows:     meta.RowCount,
+			Pages:    pages,
+			DataSize: int64(pages) * int64(e.DiskManager.PageSize()),
+			Height:   stats.Height,
+			AvgFill:  stats.FillFactor,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,1161 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/index"
+	"minidb/pkg/storage/page"
+)
+
+// newTestEngine 在临时目录中创建一个已选中数据库 "testdb" 的引擎
+func newTestEngine(t testing.TB) *Engine {
+	t.Helper()
+	root := t.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabase("testdb"); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(root, "testdb")
+	dm, err := disk.NewDiskManager(filepath.Join(dbPath, DataFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.DiskManager = dm
+	e.BPM = buffer.NewBufferPoolManager(dm, 64)
+	e.Catalog = NewCatalog(e.BPM, filepath.Join(dbPath, MetaFileName))
+	e.CurrentDB = "testdb"
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestAnalyze(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	// 偏斜分布：0~899 密集，之后稀疏
+	for i := int64(0); i < 900; i++ {
+		e.Insert("t", i, "x")
+	}
+	for i := int64(0); i < 100; i++ {
+		e.Insert("t", 1000+i*100, "x")
+	}
+
+	stats, err := e.Analyze("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowCount != 1000 || stats.MinKey != 0 || stats.MaxKey != 10900 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(stats.Buckets) != AnalyzeBuckets {
+		t.Fatalf("expected %d buckets, got %d", AnalyzeBuckets, len(stats.Buckets))
+	}
+	// 树的形状：1000 行放不进一个叶子，统计完所有页面都已 Unpin
+	if tree := stats.Tree; tree.KeyCount != 1000 || tree.Height < 2 || tree.LeafPages < 2 || tree.InternalPages < 1 {
+		t.Fatalf("unexpected tree stats: %+v", tree)
+	}
+	if err := e.BPM.FlushAllPages(); err != nil {
+		t.Fatalf("pages left pinned after analyze: %v", err)
+	}
+	var out strings.Builder
+	if err := NewSQLParser(e, &out).ParseAndExecute("analyze table t"); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("B+ tree: height %d, %d leaf pages, %d internal pages, 1000 keys\n",
+		stats.Tree.Height, stats.Tree.LeafPages, stats.Tree.InternalPages)
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("analyze table output %q does not contain %q", out.String(), want)
+	}
+
+	// 直方图应该识别出 [0, 899] 是密集区
+	est, _ := e.EstimateRows("t", 0, 899)
+	if est < 850 || est > 950 {
+		t.Fatalf("dense range estimate off: %d", est)
+	}
+	est, _ = e.EstimateRows("t", 5000, 10900)
+	if est < 40 || est > 80 {
+		t.Fatalf("sparse range estimate off: %d", est)
+	}
+	if est, _ := e.EstimateRows("t", 20000, 30000); est != 0 {
+		t.Fatalf("out of range estimate should be 0, got %d", est)
+	}
+
+	// 统计信息随 Catalog 持久化
+	reloaded := NewCatalog(nil, e.Catalog.MetaFile)
+	meta, _ := reloaded.GetTable("t")
+	if meta.Stats == nil || meta.Stats.RowCount != 1000 {
+		t.Fatalf("stats not persisted: %+v", meta.Stats)
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("t", "id int,name string")
+	for i := int64(0); i < 500; i += 2 {
+		e.Insert("t", i, fmt.Sprintf("v%d", i))
+	}
+
+	it, err := e.ScanRange("t", 101, 201)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []int64
+	for it.Next() {
+		row := it.Row()
+		if row.Value != fmt.Sprintf("v%d", row.Key) {
+			t.Fatalf("bad value for %d: %q", row.Key, row.Value)
+		}
+		keys = append(keys, row.Key)
+	}
+	it.Close()
+	if len(keys) != 50 || keys[0] != 102 || keys[len(keys)-1] != 200 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	// 空范围
+	it, _ = e.ScanRange("t", 1000, 2000)
+	if it.Next() {
+		t.Fatal("expected empty scan")
+	}
+	it.Close()
+
+	// 中途放弃迭代后 Close，页面必须被释放：反复扫描不应耗尽缓冲池
+	for i := 0; i < 200; i++ {
+		it, _ := e.ScanRange("t", 0, 499)
+		it.Next()
+		it.Close()
+	}
+	if _, found := e.SelectById("t", 498); !found {
+		t.Fatal("buffer pool exhausted by abandoned iterators")
+	}
+}
+
+func TestPager(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("t", "id int,name string")
+	for i := int64(0); i < 25; i++ {
+		e.Insert("t", i*3, fmt.Sprintf("v%d", i))
+	}
+
+	pg := e.NewPager("t", 10)
+	if _, ok := pg.Cursor(); ok {
+		t.Fatal("fresh pager should have no cursor")
+	}
+	var keys []int64
+	var sizes []int
+	for !pg.Done() {
+		rows, err := pg.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(rows))
+		for _, r := range rows {
+			keys = append(keys, r.Key)
+		}
+	}
+	if fmt.Sprint(sizes) != "[10 10 5]" || len(keys) != 25 || keys[24] != 72 {
+		t.Fatalf("pages %v, keys %v", sizes, keys)
+	}
+	if last, ok := pg.Cursor(); !ok || last != 72 {
+		t.Fatalf("cursor = %d, %v", last, ok)
+	}
+
+	// 游标交给客户端后在另一个 Pager 上恢复；翻页期间插入的更小主键不会再出现
+	e.Insert("t", 1, "late")
+	pg2 := e.NewPager("t", 4)
+	pg2.Resume(27)
+	rows, err := pg2.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0].Key != 30 || rows[3].Key != 39 {
+		t.Fatalf("resumed page: %v", rows)
+	}
+
+	// 恰好读完一整页时，下一页为空
+	pg3 := e.NewPager("t", 26)
+	if rows, _ := pg3.Next(); len(rows) != 26 || pg3.Done() {
+		t.Fatalf("first page: %d rows, done=%v", len(rows), pg3.Done())
+	}
+	if rows, _ := pg3.Next(); len(rows) != 0 || !pg3.Done() {
+		t.Fatalf("second page: %v", rows)
+	}
+
+	if _, err := e.NewPager("nope", 10).Next(); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("missing table: %v", err)
+	}
+}
+
+func TestScanRangeReleasesPins(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("t", "id int,name string")
+	for i := int64(0); i < 3000; i++ {
+		e.Insert("t", i, "v")
+	}
+
+	// 同时挂起 100 个停在不同叶子上的迭代器，数量超过缓冲池的 64 帧；
+	// 如果迭代器在两次 Next 之间持有页面，缓冲池会被占满
+	var iters []*RowIterator
+	for i := int64(0); i < 100; i++ {
+		it, err := e.ScanRange("t", i*30, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it.batchSize = 4
+		if !it.Next() || it.Row().Key != i*30 {
+			t.Fatalf("iterator %d did not start at %d", i, i*30)
+		}
+		iters = append(iters, it)
+	}
+	if _, found := e.SelectById("t", 2999); !found {
+		t.Fatal("buffer pool exhausted by suspended iterators")
+	}
+
+	// 批与批之间插入导致分裂，迭代器从检查点继续，不重复也不遗漏
+	it := iters[0]
+	expected := int64(1)
+	for it.Next() {
+		if it.Row().Key != expected {
+			t.Fatalf("got key %d, want %d", it.Row().Key, expected)
+		}
+		if expected == 10 {
+			for k := int64(3000); k < 3500; k++ {
+				e.Insert("t", k, "late")
+			}
+		}
+		expected++
+	}
+	if expected != 3500 {
+		t.Fatalf("scan stopped at %d, want 3500", expected)
+	}
+	for _, it := range iters {
+		it.Close()
+	}
+}
+
+func TestEvictTable(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("t", "id int,name string")
+	e.CreateTable("u", "id int,name string")
+	for i := int64(0); i < 500; i++ {
+		e.Insert("t", i, fmt.Sprintf("v%d", i))
+	}
+	e.Insert("u", 1, "u1")
+
+	// 根页被 Pin 住时跳过，其余页面（含脏页）全部淘汰
+	meta, _ := e.Catalog.GetTable("t")
+	root := page.PageID(meta.RootPageId)
+	e.BPM.FetchPage(root)
+	evicted, skipped, err := e.EvictTable("t")
+	e.BPM.UnpinPage(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := index.NewBPlusTree(root, e.BPM).Stats()
+	if skipped != 1 || evicted != stats.TotalPages()-1 {
+		t.Fatalf("evicted %d, skipped %d, table has %d pages", evicted, skipped, stats.TotalPages())
+	}
+
+	// 淘汰前的脏页已经写回，重新读取时内容不变
+	for _, key := range []int64{0, 250, 499} {
+		if v, found := e.SelectById("t", key); !found || v != fmt.Sprintf("v%d", key) {
+			t.Fatalf("key %d after eviction: %q, %v", key, v, found)
+		}
+	}
+	if v, found := e.SelectById("u", 1); !found || v != "u1" {
+		t.Fatalf("other table: %q, %v", v, found)
+	}
+
+	if _, _, err := e.EvictTable("nope"); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("missing table: %v", err)
+	}
+}
+
+func TestInsertBatchRollback(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 10; i++ {
+		if err := e.Insert("t", i, "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 批次足够大，会让树发生分裂；最后一行与批次内的第一行重复
+	var batch []Row
+	for i := int64(100); i < 300; i++ {
+		batch = append(batch, Row{Key: i, Value: "new"})
+	}
+	batch = append(batch, Row{Key: 100, Value: "dup"})
+	if err := e.InsertBatch("t", batch); err == nil {
+		t.Fatal("expected batch with duplicate key to fail")
+	} else if !errors.Is(err, ErrDuplicateKey) || !strings.Contains(err.Error(), "duplicate primary key 100") || !strings.Contains(err.Error(), "row 201 of 201") {
+		t.Errorf("error = %v, want a duplicate key error naming key 100 and row 201 of 201", err)
+	}
+
+	it, err := e.ScanRange("t", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var keys []int64
+	for it.Next() {
+		if it.Row().Value != "old" {
+			t.Errorf("key %d has value %q after rollback", it.Row().Key, it.Row().Value)
+		}
+		keys = append(keys, it.Row().Key)
+	}
+	if len(keys) != 10 || keys[0] != 0 || keys[9] != 9 {
+		t.Fatalf("table changed after rollback: %v", keys)
+	}
+	if meta, _ := e.Catalog.GetTable("t"); meta.RowCount != 10 {
+		t.Errorf("RowCount = %d, want 10", meta.RowCount)
+	}
+
+	// 批次内没有冲突时全部写入
+	if err := e.InsertBatch("t", batch[:200]); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := e.Catalog.GetTable("t"); meta.RowCount != 210 {
+		t.Errorf("RowCount = %d, want 210", meta.RowCount)
+	}
+	if _, found := e.SelectById("t", 299); !found {
+		t.Error("key 299 missing after successful batch")
+	}
+}
+
+func TestLongValues(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,body string"); err != nil {
+		t.Fatal(err)
+	}
+	long := func(key int64) string { return strings.Repeat(fmt.Sprintf("row %d;", key), 150) }
+	for i := int64(0); i < 60; i++ {
+		if err := e.Insert("t", i, long(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(0); i < 60; i += 2 {
+		if _, err := e.Delete("t", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if res, err := e.Vacuum("t"); err != nil || res.Deferred != 0 {
+		t.Fatalf("vacuum = %+v, %v", res, err)
+	}
+
+	it, err := e.ScanRange("t", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for it.Next() {
+		if r := it.Row(); r.Key%2 != 1 || r.Value != long(r.Key) {
+			t.Fatalf("key %d: read back %d bytes, want %d", r.Key, len(r.Value), len(long(r.Key)))
+		}
+		n++
+	}
+	if it.Err() != nil || n != 30 {
+		t.Fatalf("scanned %d rows, %v", n, it.Err())
+	}
+	if got, _ := e.SelectById("t", 59); got != long(59) {
+		t.Errorf("SelectById(59) read back %d bytes", len(got))
+	}
+
+	// 删除和 vacuum 释放的溢出页都进了空闲页链表，没有不可达的页
+	if res, err := e.CheckPages(); err != nil || !res.OK() || len(res.Unreachable) != 0 || res.Free == 0 {
+		t.Errorf("check freelist = %+v, %v", res, err)
+	}
+}
+
+func TestSecondaryIndex(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabase("testdb"); err != nil {
+		t.Fatal(err)
+	}
+	open := func() *Engine {
+		dm, err := disk.NewDiskManager(filepath.Join(root, "testdb", DataFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewEngine(root)
+		e.DiskManager = dm
+		e.BPM = buffer.NewBufferPoolManager(dm, 64)
+		e.Catalog = NewCatalog(e.BPM, filepath.Join(root, "testdb", MetaFileName))
+		e.CurrentDB = "testdb"
+		return e
+	}
+	long := strings.Repeat("x", 100)
+
+	e = open()
+	if err := e.CreateTable("users", "id int,name string,age int"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 300; i++ {
+		if err := e.Insert("users", i, fmt.Sprintf("n%d,%d", i%10, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已有数据的表上建索引，之后的写入同步维护它
+	if err := e.CreateIndex("users", "idx_name", "name"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateIndex("users", "idx_name", "age"); !errors.Is(err, ErrIndexExists) {
+		t.Errorf("duplicate index name: %v, want ErrIndexExists", err)
+	}
+	if err := e.CreateIndex("users", "idx_id", "id"); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("index on the primary key: %v, want ErrInvalidSchema", err)
+	}
+	p := NewSQLParser(e, nil)
+	p.Output = io.Discard
+	for _, sql := range []string{
+		"insert into users values (300, 'n3', 1), (301, 'zz', 2)",
+		"delete from users where id = 3",
+		"delete from users where id = 13",
+		"insert into users values (13, 'zz', 3)",
+		fmt.Sprintf("insert into users values (302, '%s', 4)", long),
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	check := func(e *Engine) {
+		t.Helper()
+		p := NewSQLParser(e, nil)
+		var n3 []int64
+		for i := int64(23); i < 300; i += 10 {
+			n3 = append(n3, i)
+		}
+		for sql, want := range map[string][]int64{
+			"select * from users where name = 'n3'":                    append(n3, 300),
+			"select * from users where name = 'n3' limit 2":            {23, 33},
+			"select * from users where name = 'zz'":                    {13, 301},
+			"select * from users where name = 'nobody'":                {},
+			"select * from users where name = null":                    {},
+			fmt.Sprintf("select * from users where name = '%s'", long): {302},
+		} {
+			if got := queryKeys(t, p, sql); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s: got %v, want %v", sql, got, want)
+			}
+		}
+		if res, err := e.CheckPages(); err != nil || !res.OK() || len(res.Unreachable) != 0 {
+			t.Errorf("check freelist = %+v, %v", res, err)
+		}
+	}
+	check(e)
+
+	// 根页号随元数据落盘；压缩数据文件时索引按新的页重建
+	e.Close()
+	e = open()
+	check(e)
+	e.CompactOnClose = true
+	e.Close()
+	e = open()
+	defer e.Close()
+	check(e)
+
+	// 删表时索引树的页也被释放
+	if err := e.DropTable("users"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := e.CheckPages(); err != nil || !res.OK() || res.Reachable != 0 {
+		t.Errorf("check freelist after drop = %+v, %v", res, err)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	// 超过槽位大小的值存进溢出页，不再截断，也没有警告
+	long := strings.Repeat("x", 200)
+	if err := p.ParseAndExecute(fmt.Sprintf("insert into t values (1, '%s')", long)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "warning") || len(e.Warnings()) != 0 {
+		t.Errorf("long value should not warn: %q, %v", out.String(), e.Warnings())
+	}
+	if got, _ := e.SelectById("t", 1); got != long {
+		t.Errorf("long value read back with %d bytes, want %d", len(got), len(long))
+	}
+
+	if _, err := e.EstimateRows("t", 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if w := e.Warnings(); len(w) != 1 || !strings.Contains(w[0].Message, "no statistics") {
+		t.Fatalf("warnings = %v, want one missing-statistics warning", w)
+	}
+
+	// show warnings 不清空，下一条语句才清空
+	if err := p.ParseAndExecute("show warnings"); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Warnings()) != 1 {
+		t.Error("show warnings should not clear the buffer")
+	}
+	if err := p.ParseAndExecute("insert into t values (2, 'short')"); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Warnings()) != 0 {
+		t.Errorf("warnings not cleared by next statement: %v", e.Warnings())
+	}
+}
+
+// crashAndReopen 模拟崩溃：不刷缓冲池、不保存元数据，直接关闭数据文件后重新打开
+func crashAndReopen(t *testing.T, e *Engine) *Engine {
+	t.Helper()
+	dbPath := filepath.Join(e.DataRoot, e.CurrentDB)
+	e.DiskManager.Close()
+
+	dm, err := disk.NewDiskManager(filepath.Join(dbPath, DataFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := NewEngine(e.DataRoot)
+	re.DiskManager = dm
+	re.BPM = buffer.NewBufferPoolManager(dm, 64)
+	re.Catalog = NewCatalog(re.BPM, filepath.Join(dbPath, MetaFileName))
+	re.CurrentDB = e.CurrentDB
+	t.Cleanup(func() { re.Close() })
+	return re
+}
+
+func TestSyncOnCommit(t *testing.T) {
+	for _, sync := range []bool{true, false} {
+		t.Run(fmt.Sprintf("sync=%v", sync), func(t *testing.T) {
+			root := t.TempDir()
+			e := NewEngine(root)
+			if err := e.CreateDatabase("testdb"); err != nil {
+				t.Fatal(err)
+			}
+			dm, err := disk.NewDiskManager(filepath.Join(root, "testdb", DataFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.DiskManager = dm
+			e.BPM = buffer.NewBufferPoolManager(dm, 64)
+			e.Catalog = NewCatalog(e.BPM, filepath.Join(root, "testdb", MetaFileName))
+			e.CurrentDB = "testdb"
+			e.SyncOnCommit = sync
+
+			if err := e.CreateTable("t", "id int,name string"); err != nil {
+				t.Fatal(err)
+			}
+			for i := int64(0); i < 200; i++ {
+				if err := e.Insert("t", i, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			re := crashAndReopen(t, e)
+			_, found := re.SelectById("t", 199)
+			if sync && !found {
+				t.Error("committed row lost after crash with sync_on_commit on")
+			}
+			if !sync && found {
+				t.Error("row survived without sync; test no longer simulates a crash")
+			}
+		})
+	}
+}
+
+// 检查点之后崩溃，检查点之前的写入都在；检查点不写被 Pin 住的页，也不改变 Pin 计数
+func TestCheckpoint(t *testing.T) {
+	e := newTestEngine(t)
+	// 注入的资源要先登记，服务器上由启动时的 use 登记
+	e.adoptCurrent()
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 200; i++ {
+		if err := e.Insert("t", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta, _ := e.Catalog.GetTable("t")
+	pinned := e.BPM.FetchPage(e.Catalog.TableRoot(meta))
+	flushed, err := e.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flushed == 0 {
+		t.Fatal("checkpoint wrote no pages")
+	}
+	if pinned.PinCount() != 1 || !pinned.IsDirty() {
+		t.Errorf("pinned root page: pin count %d, dirty %v; want 1 and still dirty", pinned.PinCount(), pinned.IsDirty())
+	}
+	e.BPM.UnpinPage(pinned.ID(), false)
+	if _, err := e.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	re := crashAndReopen(t, e)
+	for _, k := range []int64{0, 100, 199} {
+		if _, found := re.SelectById("t", k); !found {
+			t.Errorf("row %d lost after a checkpoint and a crash", k)
+		}
+	}
+}
+
+// Close 报告没能写回的页面：关闭时还被 Pin 住（有连接正在写）的页不写，返回 ErrPagesPinned
+func TestCloseReportsPinnedPages(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Insert("t", 1, "v"); err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := e.Catalog.GetTable("t")
+	pinned := e.BPM.FetchPage(e.Catalog.TableRoot(meta))
+	defer e.BPM.UnpinPage(pinned.ID(), false)
+
+	if err := e.Close(); !errors.Is(err, buffer.ErrPagesPinned) {
+		t.Fatalf("Close with a pinned page: %v, want ErrPagesPinned", err)
+	}
+}
+
+func TestDurableWrites(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabaseWithOptions("testdb", DatabaseOptions{Tablespaces: 2}); err != nil {
+		t.Fatal(err)
+	}
+	dm, err := disk.OpenTablespaces(filepath.Join(root, "testdb", DataFileName), 2, page.PageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.DiskManager = dm
+	e.BPM = buffer.NewBufferPoolManager(dm, 16)
+	e.Catalog = NewCatalog(e.BPM, filepath.Join(root, "testdb", MetaFileName))
+	e.CurrentDB = "testdb"
+	defer e.Close()
+	if dm.Durable() {
+		t.Fatal("durable writes should be off by default")
+	}
+
+	p := NewSQLParser(e, io.Discard)
+	if err := p.ParseAndExecute("set durable_writes = on"); err != nil {
+		t.Fatal(err)
+	}
+	if !dm.Durable() {
+		t.Fatal("set durable_writes = on did not reach the data files")
+	}
+	// 缓冲池很小，插入过程中不断换出脏页，每次写出都要 fsync
+	if err := p.ParseAndExecute("create table t (id int, v int) tablespace 1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 300; i++ {
+		if err := e.Insert("t", i, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.BPM.FlushAllPages()
+	if _, found := e.SelectById("t", 299); !found {
+		t.Error("row lost with durable writes on")
+	}
+	if err := p.ParseAndExecute("set durable_writes = off"); err != nil || dm.Durable() {
+		t.Errorf("set durable_writes = off: %v, durable = %v", err, dm.Durable())
+	}
+}
+
+func TestCompactOnClose(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabase("testdb"); err != nil {
+		t.Fatal(err)
+	}
+	dataFile := filepath.Join(root, "testdb", DataFileName)
+	open := func() *Engine {
+		dm, err := disk.NewDiskManager(dataFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewEngine(root)
+		e.DiskManager = dm
+		e.BPM = buffer.NewBufferPoolManager(dm, 64)
+		e.Catalog = NewCatalog(e.BPM, filepath.Join(root, "testdb", MetaFileName))
+		e.CurrentDB = "testdb"
+		return e
+	}
+
+	e = open()
+	for _, name := range []string{"keep", "drop1", "drop2"} {
+		e.CreateTable(name, "id int,name string")
+		for i := int64(0); i < 2000; i++ {
+			e.Insert(name, i, fmt.Sprintf("%s-%d", name, i))
+		}
+	}
+	e.DropTable("drop1")
+	e.DropTable("drop2")
+	e.Close()
+	before, _ := os.Stat(dataFile)
+
+	e = open()
+	e.CompactOnClose = true
+	e.Close()
+	after, _ := os.Stat(dataFile)
+	if after.Size() >= before.Size()/2 {
+		t.Fatalf("data file not compacted: %d -> %d bytes", before.Size(), after.Size())
+	}
+
+	e = open()
+	defer e.Close()
+	for i := int64(0); i < 2000; i++ {
+		val, found := e.SelectById("keep", i)
+		if !found || val != fmt.Sprintf("keep-%d", i) {
+			t.Fatalf("key %d after compaction: %q, %v", i, val, found)
+		}
+	}
+	if err := e.Insert("keep", 5000, "new"); err != nil {
+		t.Fatalf("insert after compaction: %v", err)
+	}
+}
+
+func TestTablespaceTables(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabaseWithOptions("ts", DatabaseOptions{Tablespaces: 3}); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(root, "ts")
+	dataFile := filepath.Join(dbPath, DataFileName)
+	open := func() *Engine {
+		dm, err := disk.OpenTablespaces(dataFile, ReadCatalogTablespaces(filepath.Join(dbPath, MetaFileName)), page.PageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewEngine(root)
+		e.DiskManager = dm
+		e.BPM = buffer.NewBufferPoolManager(dm, 64)
+		e.Catalog = NewCatalog(e.BPM, filepath.Join(dbPath, MetaFileName))
+		e.CurrentDB = "ts"
+		return e
+	}
+
+	e = open()
+	for space := 0; space < 3; space++ {
+		name := fmt.Sprintf("t%d", space)
+		cols, _ := ParseSchema("id int, v varchar")
+		if err := e.CreateTableSchema(name, cols, TableOptions{Tablespace: space}); err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 500; i++ {
+			if err := e.Insert(name, i, fmt.Sprintf("%d-%d", space, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := e.CreateTableSchema("bad", []Column{{Name: "id", Type: TypeInt, PrimaryKey: true}}, TableOptions{Tablespace: 3}); err == nil {
+		t.Error("table in a nonexistent tablespace should be rejected")
+	}
+	e.Close()
+
+	// 每个表的页面都落在自己的数据文件里
+	for space := 0; space < 3; space++ {
+		fi, err := os.Stat(disk.TablespaceFileName(dataFile, space))
+		if err != nil || fi.Size() < 10*page.PageSize {
+			t.Errorf("tablespace %d holds too little data: %v %v", space, fi, err)
+		}
+	}
+
+	e = open()
+	defer e.Close()
+	for space := 0; space < 3; space++ {
+		name := fmt.Sprintf("t%d", space)
+		if meta, _ := e.Catalog.GetTable(name); meta.Tablespace != space {
+			t.Errorf("%s: tablespace %d, want %d", name, meta.Tablespace, space)
+		}
+		for i := int64(0); i < 500; i += 37 {
+			val, found := e.SelectById(name, i)
+			if !found || val != fmt.Sprintf("%d-%d", space, i) {
+				t.Fatalf("%s key %d: %q %v", name, i, val, found)
+			}
+		}
+	}
+}
+
+func TestTableExists(t *testing.T) {
+	if _, err := NewEngine(t.TempDir()).TableExists("t"); !errors.Is(err, ErrNoDatabase) {
+		t.Fatalf("without database: got %v, want %v", err, ErrNoDatabase)
+	}
+
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	if ok, err := e.TableExists("t"); err != nil || ok {
+		t.Fatalf("before create: %v, %v", ok, err)
+	}
+	if err := p.ParseAndExecute("drop table t"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("drop missing table: got %v", err)
+	}
+	if err := p.ParseAndExecute("drop table if exists t"); err != nil {
+		t.Errorf("drop if exists on missing table: %v", err)
+	}
+
+	if err := p.ParseAndExecute("create table t (id int, name string)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ParseAndExecute("create table if not exists t (id int)"); err != nil {
+		t.Errorf("create if not exists on existing table: %v", err)
+	}
+	if ok, _ := e.TableExists("t"); !ok {
+		t.Fatal("table missing after create")
+	}
+
+	if err := p.ParseAndExecute("drop table if exists t"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := e.TableExists("t"); ok {
+		t.Error("table still exists after drop")
+	}
+}
+
+func TestCheckBufferPool(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 3000; i++ {
+		if err := e.Insert("t", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.CheckBufferPool(); err != nil {
+		t.Fatalf("64 frames: %v", err)
+	}
+	meta, _ := e.Catalog.GetTable("t")
+	height := index.NewBPlusTree(page.PageID(meta.RootPageId), e.BPM).Stats().Height
+	if height < 3 {
+		t.Fatalf("tree height %d, want a taller tree", height)
+	}
+	e.BPM.FlushAllPages()
+	e.Catalog.SaveMeta()
+
+	reopen := func(frames int) *Engine {
+		re := NewEngine(e.DataRoot)
+		re.DiskManager = e.DiskManager
+		re.BPM = buffer.NewBufferPoolManager(e.DiskManager, frames)
+		re.Catalog = NewCatalog(re.BPM, filepath.Join(e.DataRoot, e.CurrentDB, MetaFileName))
+		re.CurrentDB = e.CurrentDB
+		return re
+	}
+
+	need := index.MinPoolFrames(height)
+	err := reopen(2).CheckBufferPool()
+	if !errors.Is(err, ErrPoolTooSmall) || !strings.Contains(err.Error(), fmt.Sprintf("need at least %d frames", need)) {
+		t.Fatalf("2 frames: got %v", err)
+	}
+
+	// 恰好够用时，一路分裂到根的插入也能完成
+	re := reopen(need)
+	if err := re.CheckBufferPool(); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(3000); i < 6000; i++ {
+		if err := re.Insert("t", i, "v"); err != nil {
+			t.Fatalf("insert %d with %d frames: %v", i, need, err)
+		}
+	}
+	if n, _, err := re.AggregateKey("t", "count"); err != nil || n != 6000 {
+		t.Fatalf("count = %d, %v", n, err)
+	}
+}
+
+func TestScanDuringConcurrentInserts(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	const n = 600
+	var even []Row
+	for k := int64(0); k < n; k += 2 {
+		even = append(even, Row{Key: k, Value: "even"})
+	}
+	if err := e.InsertBatch("t", even); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个会话把奇数 Key 插到已有的叶子中间，不断触发分裂
+	var writers sync.WaitGroup
+	for w := int64(0); w < 2; w++ {
+		s := e.NewSession()
+		s.CurrentDB = e.CurrentDB
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for k := 1 + w*n/2; k < (w+1)*n/2; k += 2 {
+				if err := s.Insert("t", k, "odd"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+
+	// 每次扫描的结果必须严格递增（没有重复），并且包含所有扫描开始前就存在的偶数 Key
+	check := func(how string, keys []int64) {
+		t.Helper()
+		evens := 0
+		for i, k := range keys {
+			if i > 0 && k <= keys[i-1] {
+				t.Fatalf("%s: key %d after %d", how, k, keys[i-1])
+			}
+			if k%2 == 0 {
+				evens++
+			}
+		}
+		if evens != len(even) {
+			t.Fatalf("%s: saw %d of %d pre-existing keys", how, evens, len(even))
+		}
+	}
+	reader := e.NewSession()
+	reader.CurrentDB = e.CurrentDB
+	for {
+		// 写入结束之后开始的那次扫描必须看到全部 n 个 Key
+		finished := false
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+
+		lines, err := reader.SelectAll("t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]int64, len(lines))
+		for i, line := range lines {
+			if _, err := fmt.Sscanf(line, "[%d]", &keys[i]); err != nil {
+				t.Fatalf("bad SelectAll line %q", line)
+			}
+		}
+		check("SelectAll", keys)
+
+		it, err := reader.ScanRange("t", math.MinInt64, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = keys[:0]
+		for it.Next() {
+			keys = append(keys, it.Row().Key)
+		}
+		it.Close()
+		check("ScanRange", keys)
+
+		if finished {
+			if len(keys) != n {
+				t.Fatalf("after the writers finished: %d keys, want %d", len(keys), n)
+			}
+			return
+		}
+	}
+}
+
+// 点查与写入并发：写者插入和删除奇数 Key（有的只改叶子，有的要分裂或合并），
+// 读者按主键查已有的偶数 Key，每次都必须查到（用 -race 运行）
+func TestPointReadsDuringWrites(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	const n = 1200
+	var even []Row
+	for k := int64(0); k < n; k += 2 {
+		even = append(even, Row{Key: k, Value: "even"})
+	}
+	if err := e.InsertBatch("t", even); err != nil {
+		t.Fatal(err)
+	}
+
+	var writers sync.WaitGroup
+	for w := int64(0); w < 2; w++ {
+		s := e.NewSession()
+		s.CurrentDB = e.CurrentDB
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for k := 1 + w*n/2; k < (w+1)*n/2; k += 2 {
+				if err := s.Insert("t", k, "odd"); err != nil {
+					t.Error(err)
+					return
+				}
+				if k%3 != 0 {
+					continue
+				}
+				if found, err := s.Delete("t", k); err != nil || !found {
+					t.Errorf("delete %d: found=%v err=%v", k, found, err)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+
+	var readers sync.WaitGroup
+	for r := int64(0); r < 3; r++ {
+		s := e.NewSession()
+		s.CurrentDB = e.CurrentDB
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := r; ; i += 7 {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := i % (n / 2) * 2
+				if value, found := s.SelectById("t", k); !found || value != "even" {
+					t.Errorf("key %d: found=%v value=%q", k, found, value)
+					return
+				}
+			}
+		}()
+	}
+	readers.Wait()
+
+	for k := int64(0); k < n; k++ {
+		_, found := e.SelectById("t", k)
+		if want := k%2 == 0 || k%3 != 0; found != want {
+			t.Fatalf("key %d: found=%v, want %v", k, found, want)
+		}
+	}
+}
+
+// 叶子链表成环的表，扫描返回 TREE_CORRUPT 而不是一直转圈
+func TestScanCorruptTree(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 500; i++ {
+		if err := e.Insert("t", i, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	meta, _ := e.Catalog.GetTable("t")
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	leafRaw := tree.FindLeafPage(250)
+	leaf := page.NewBPlusTreePage(leafRaw)
+	leaf.SetNextPageID(leaf.GetPageID())
+	e.BPM.UnpinPage(leafRaw.ID(), true)
+
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{"select * from t", "select * from t where name like 'x%'", "analyze t"} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, ErrTreeCorrupt) {
+			t.Errorf("%s: got %v, want %s", sql, err, ErrTreeCorrupt.Code)
+		}
+	}
+	if _, err := e.SelectAll("t"); !errors.Is(err, ErrTreeCorrupt) || !strings.Contains(err.Error(), "cycle detected") {
+		t.Errorf("SelectAll: got %v", err)
+	}
+}
+
+// check table 在大量删除（合并、借位）之后仍通过，父节点分隔 Key 被改坏时报告 TREE_CORRUPT
+func TestCheckTable(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 2000; i++ {
+		if err := e.Insert("t", i, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(1); i <= 2000; i++ {
+		if i%3 != 0 || i > 1500 {
+			if _, err := e.Delete("t", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	if err := p.ParseAndExecute("CHECK TABLE t"); err != nil {
+		t.Fatalf("check table after deletes: %v", err)
+	}
+	if !strings.Contains(out.String(), "OK") {
+		t.Errorf("check table output: %q", out.String())
+	}
+	if err := p.ParseAndExecute("check table missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("check missing table: got %v", err)
+	}
+
+	meta, _ := e.Catalog.GetTable("t")
+	rootRaw := e.BPM.FetchPage(e.Catalog.TableRoot(meta))
+	root := page.NewBPlusTreePage(rootRaw)
+	if root.IsLeaf() {
+		t.Fatal("expected an internal root")
+	}
+	root.SetKey(1, root.GetKey(1)+1)
+	e.BPM.UnpinPage(rootRaw.ID(), true)
+	if err := p.ParseAndExecute("check table t"); !errors.Is(err, ErrTreeCorrupt) || !strings.Contains(err.Error(), "outside its parent's range") {
+		t.Errorf("check corrupt table: got %v", err)
+	}
+}
+
+// 磁盘上写坏的叶子，扫描返回 PAGE_CORRUPT 而不是把坏数据当成行
+func TestScanCorruptPage(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 500; i++ {
+		if err := e.Insert("t", i, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta, _ := e.Catalog.GetTable("t")
+	leafRaw := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).FindLeafPage(250)
+	leafID := leafRaw.ID()
+	e.BPM.UnpinPage(leafID, false)
+	e.BPM.FlushAllPages()
+
+	f, err := os.OpenFile(filepath.Join(e.DataRoot, e.CurrentDB, DataFileName), os.O_RDWR, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("garbage"), int64(leafID)*page.PageSize+page.HeaderSize)
+	f.Close()
+
+	e = crashAndReopen(t, e)
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{"select * from t", "select * from t where name like 'x%'"} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, ErrPageCorrupt) {
+			t.Errorf("%s: got %v, want %s", sql, err, ErrPageCorrupt.Code)
+		}
+	}
+	want := fmt.Sprintf("table 't': page %d checksum mismatch", leafID)
+	if _, err := e.SelectAll("t"); !errors.Is(err, ErrPageCorrupt) || err.Error() != want {
+		t.Errorf("SelectAll: got %v, want %q", err, want)
+	}
+}
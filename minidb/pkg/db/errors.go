@@ -0,0 +1,65 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error 是带错误码的错误，客户端按 Code 区分错误类型，Message 是给人看的描述
+// 用 errors.Is(err, ErrTableNotFound) 判断类型，只比较错误码
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// 错误类型，Message 是没有具体上下文时的默认描述
+var (
+	ErrSyntax           = &Error{Code: "SYNTAX_ERROR", Message: "syntax error"}
+	ErrNoDatabase       = &Error{Code: "NO_DATABASE", Message: "no database selected"}
+	ErrDatabaseNotFound = &Error{Code: "DATABASE_NOT_FOUND", Message: "database not found"}
+	ErrDatabaseExists   = &Error{Code: "DATABASE_EXISTS", Message: "database already exists"}
+	ErrDatabaseInUse    = &Error{Code: "DATABASE_IN_USE", Message: "database is in use"}
+	ErrTableNotFound    = &Error{Code: "TABLE_NOT_FOUND", Message: "table not found"}
+	ErrTableExists      = &Error{Code: "TABLE_EXISTS", Message: "table already exists"}
+	ErrIndexExists      = &Error{Code: "INDEX_EXISTS", Message: "index already exists"}
+	ErrStmtNotFound     = &Error{Code: "STATEMENT_NOT_FOUND", Message: "prepared statement not found"}
+	ErrColumnNotFound   = &Error{Code: "COLUMN_NOT_FOUND", Message: "column not found"}
+	ErrInvalidSchema    = &Error{Code: "INVALID_SCHEMA", Message: "invalid table schema"}
+	ErrDuplicateKey     = &Error{Code: "DUPLICATE_KEY", Message: "duplicate key"}
+	ErrInvalidValue     = &Error{Code: "INVALID_VALUE", Message: "invalid value"}
+	ErrSubquery         = &Error{Code: "SUBQUERY", Message: "subquery must return a single value"}
+	ErrUnsupported      = &Error{Code: "UNSUPPORTED", Message: "not supported"}
+	ErrCatalogCorrupt   = &Error{Code: "CATALOG_CORRUPT", Message: "catalog corrupt"}
+	ErrRateLimited      = &Error{Code: "RATE_LIMITED", Message: "rate limit exceeded, slow down"}
+	ErrNoTransaction    = &Error{Code: "NO_TRANSACTION", Message: "no transaction in progress"}
+	ErrTxConflict       = &Error{Code: "TX_CONFLICT", Message: "transaction conflict"}
+	ErrPoolTooSmall     = &Error{Code: "POOL_TOO_SMALL", Message: "buffer pool too small"}
+	ErrTreeCorrupt      = &Error{Code: "TREE_CORRUPT", Message: "tree appears corrupt (cycle detected)"}
+	ErrPageCorrupt      = &Error{Code: "PAGE_CORRUPT", Message: "page checksum mismatch"}
+)
+
+// CodeInternal 是不属于以上任何类型的错误（I/O 失败等）对外报告的错误码
+const CodeInternal = "INTERNAL"
+
+// errorf 按 kind 的错误码构造一个带具体描述的错误
+func errorf(kind *Error, format string, args ...interface{}) error {
+	return &Error{Code: kind.Code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCode 返回错误的错误码，没有错误码的错误返回 CodeInternal
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
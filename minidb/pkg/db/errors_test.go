@@ -0,0 +1,74 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Insert("t", 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	p := NewSQLParser(e, nil)
+
+	cases := []struct {
+		sql  string
+		want *Error
+	}{
+		{"select * from missing", ErrTableNotFound},
+		{"insert into t values (1, 'b')", ErrDuplicateKey},
+		{"create table t (id int)", ErrTableExists},
+		{"frobnicate everything", ErrSyntax},
+		{"use nope", ErrDatabaseNotFound},
+		{"select nope from t", ErrColumnNotFound},
+		{"create table u (flag bool primary key)", ErrInvalidSchema},
+	}
+	for _, c := range cases {
+		err := p.ParseAndExecute(c.sql)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v (%s), want code %s", c.sql, err, ErrorCode(err), c.want.Code)
+		}
+		if err != nil && ErrorCode(err) != c.want.Code {
+			t.Errorf("%s: ErrorCode = %s, want %s", c.sql, ErrorCode(err), c.want.Code)
+		}
+	}
+
+	if err := NewEngine(t.TempDir()).CreateTable("t", "id int"); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("create table without database: got %v", err)
+	}
+	if code := ErrorCode(errors.New("disk on fire")); code != CodeInternal {
+		t.Errorf("plain error code = %s, want %s", code, CodeInternal)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	e := newTestEngine(t)
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	err := p.ParseAndExecute("select * from missing")
+
+	// 文本模式只有给人看的描述
+	p.ReportError(err)
+	if got := out.String(); got != "Error: table 'missing' not found\n" {
+		t.Errorf("plain error output %q", got)
+	}
+
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	p.ReportError(err)
+	var got struct{ Error, Code string }
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatalf("bad JSON error %q: %v", out.String(), err)
+	}
+	if got.Code != "TABLE_NOT_FOUND" || got.Error != "table 'missing' not found" {
+		t.Errorf("JSON error %+v", got)
+	}
+}
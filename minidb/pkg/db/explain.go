@@ -0,0 +1,166 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// handleExplain 输出 SELECT 的执行计划（每行一步），不执行查询
+func (p *SQLParser) handleExplain(sql string) error {
+	matches := reSelect.FindStringSubmatch(sql)
+	if matches == nil {
+		return errorf(ErrUnsupported, "explain only supports select: %s", sql)
+	}
+	ref, err := p.resolveTableRef(matches[2], matches[3])
+	if err != nil {
+		return err
+	}
+
+	var plan []string
+	if IsSystemTable(ref.Name) {
+		plan = []string{fmt.Sprintf("system table %s", ref.Name)}
+	} else {
+		if _, ok := p.Engine.Catalog.GetTable(ref.Name); !ok {
+			return errorf(ErrTableNotFound, "table '%s' not found", ref.Name)
+		}
+		if plan, err = p.explainWhere(ref, strings.TrimSpace(matches[4])); err != nil {
+			return err
+		}
+		order, err := p.parseSelectOrder(ref, matches[5], matches[6], matches[7])
+		if err != nil {
+			return err
+		}
+		if order.Reverse && strings.TrimSpace(matches[4]) == "" && !p.Engine.hasStringKey(ref.Name) {
+			plan = []string{fmt.Sprintf("reverse scan on %s", ref.Name)}
+		} else if order.Column != "" {
+			step := "sort by " + order.Column
+			if order.Desc {
+				step += " desc"
+			}
+			plan = append(plan, step)
+		}
+		if order.Limit >= 0 {
+			plan = append(plan, fmt.Sprintf("limit %d", order.Limit))
+		}
+	}
+
+	cells := make([][]string, len(plan))
+	for i, step := range plan {
+		cells[i] = []string{step}
+	}
+	return p.printCells([]string{"plan"}, cells)
+}
+
+// explainWhere 描述 runSelect 按 WHERE 条件选择的访问路径：主键范围扫描，或者全表扫描加逐行过滤
+func (p *SQLParser) explainWhere(ref tableRef, condition string) ([]string, error) {
+	fullScan := fmt.Sprintf("full scan on %s", ref.Name)
+	if condition == "" {
+		return []string{fullScan}, nil
+	}
+	if p.Engine.hasStringKey(ref.Name) {
+		if m := reLike.FindStringSubmatch(condition); m != nil {
+			return p.explainStrLike(ref, condition, m[1], m[2] != "", m[3])
+		}
+		key, err := p.strKeyCondition(ref, condition)
+		if err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("index lookup on %s: key = '%s'", ref.Name, key)}, nil
+	}
+	if conds := splitConjuncts(condition); len(conds) > 1 {
+		return p.explainConjunction(ref, conds)
+	}
+	if m := reLike.FindStringSubmatch(condition); m != nil {
+		return p.explainLike(ref, condition, m[1], m[2] != "", m[3])
+	}
+	if ranges, ok, err := parseBetween(ref, condition); ok || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return explainKeyRanges(ref.Name, ranges), nil
+	}
+	if pred := p.parseKeyPredicate(ref, condition); pred != nil {
+		if !pred.sargable() {
+			return []string{fullScan, fmt.Sprintf("filter: %s (id inside an expression, index not usable)", condition)}, nil
+		}
+		op, key, ok := pred.bound()
+		if !ok {
+			return []string{"no rows (comparison with NULL)"}, nil
+		}
+		return explainKeyRanges(ref.Name, keyRanges(op, key)), nil
+	}
+
+	matches := reWhere.FindStringSubmatch(condition)
+	if len(matches) < 4 {
+		return nil, errorf(ErrSyntax, "unsupported where clause")
+	}
+	colName, err := ref.resolveColumn(matches[1])
+	if err != nil {
+		return nil, err
+	}
+	if p.isValueColumn(ref, colName) {
+		return []string{fullScan, "filter: " + condition}, nil
+	}
+	if indexName, _, isNull, ok := p.indexedEquality(ref, colName, matches[2], matches[3]); ok {
+		if isNull {
+			return []string{"no rows (comparison with NULL)"}, nil
+		}
+		return []string{fmt.Sprintf("index lookup on %s using %s: %s", ref.Name, indexName, strings.TrimSpace(condition))}, nil
+	}
+	if strings.ToLower(colName) != "id" {
+		return nil, errorf(ErrUnsupported, "currently only supports filtering by ID or by '=' on an indexed column")
+	}
+	// 子查询的值要执行时才知道，只说明走的是主键范围
+	if val := strings.TrimSpace(matches[3]); strings.HasPrefix(val, "(") && strings.HasSuffix(val, ")") {
+		return []string{fmt.Sprintf("index range scan on %s: id %s (scalar subquery)", ref.Name, matches[2])}, nil
+	}
+	return nil, errorf(ErrInvalidValue, "id must be integer")
+}
+
+// explainKeyRanges 每个主键区间一行
+func explainKeyRanges(table string, ranges []keyRange) []string {
+	if len(ranges) == 0 {
+		return []string{"no rows (empty key range)"}
+	}
+	var plan []string
+	for _, r := range ranges {
+		var cond string
+		switch {
+		case r.low == r.high:
+			cond = "id = " + strconv.FormatInt(r.low, 10)
+		case r.low == math.MinInt64:
+			cond = "id <= " + strconv.FormatInt(r.high, 10)
+		case r.high == math.MaxInt64:
+			cond = "id >= " + strconv.FormatInt(r.low, 10)
+		default:
+			cond = fmt.Sprintf("id between %d and %d", r.low, r.high)
+		}
+		plan = append(plan, fmt.Sprintf("index range scan on %s: %s", table, cond))
+	}
+	return plan
+}
+
+// explainConjunction 描述 AND 连接的条件：走索引的那个条件的访问路径，加上在内存中过滤的其余条件
+func (p *SQLParser) explainConjunction(ref tableRef, conds []string) ([]string, error) {
+	plan := []string{fmt.Sprintf("full scan on %s", ref.Name)}
+	driver := p.planConjunction(ref, conds)
+	if driver >= 0 {
+		var err error
+		if plan, err = p.explainWhere(ref, conds[driver]); err != nil {
+			return nil, err
+		}
+	}
+	var rest []string
+	for i, cond := range conds {
+		if i == driver {
+			continue
+		}
+		if _, err := p.compilePredicate(ref, cond); err != nil {
+			return nil, err
+		}
+		rest = append(rest, cond)
+	}
+	return append(plan, "filter: "+strings.Join(rest, " and ")), nil
+}
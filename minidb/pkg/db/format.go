@@ -0,0 +1,151 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// formatTable 把表头和行渲染成与 DescribeTable 相同风格的 ASCII 方框表格
+func formatTable(headers []string, rows [][]string) string {
+	widths := columnWidths(headers, rows)
+
+	var sb strings.Builder
+	border := func() {
+		sb.WriteString("+")
+		for _, w := range widths {
+			sb.WriteString(strings.Repeat("-", w+2))
+			sb.WriteString("+")
+		}
+		sb.WriteString("\n")
+	}
+	line := func(cells []string) {
+		sb.WriteString("|")
+		for i, w := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			sb.WriteString(" ")
+			sb.WriteString(cell)
+			sb.WriteString(strings.Repeat(" ", w-utf8.RuneCountInString(cell)))
+			sb.WriteString(" |")
+		}
+		sb.WriteString("\n")
+	}
+
+	border()
+	line(headers)
+	border()
+	for _, row := range rows {
+		line(row)
+	}
+	border()
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// formatPlain 渲染带表头的对齐文本结果，列之间用 " | " 分隔
+//
+//	 id | name
+//	----+-------
+//	 1  | alice
+func formatPlain(headers []string, rows [][]string) string {
+	widths := columnWidths(headers, rows)
+
+	var sb strings.Builder
+	line := func(cells []string) {
+		for i, w := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			if i > 0 {
+				sb.WriteString("|")
+			}
+			sb.WriteString(" ")
+			sb.WriteString(cell)
+			sb.WriteString(strings.Repeat(" ", w-utf8.RuneCountInString(cell)+1))
+		}
+		sb.WriteString("\n")
+	}
+
+	line(headers)
+	for i, w := range widths {
+		if i > 0 {
+			sb.WriteString("+")
+		}
+		sb.WriteString(strings.Repeat("-", w+2))
+	}
+	sb.WriteString("\n")
+	for _, row := range rows {
+		line(row)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// formatJSON 把结果渲染成对象数组，每个对象的键按表头顺序排列
+// 用 map 序列化会按键名排序，所以这里手工拼接
+func formatJSON(headers []string, rows [][]string) string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, row := range rows {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n  {")
+		for j, h := range headers {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			key, _ := json.Marshal(h)
+			val, _ := json.Marshal(cell)
+			sb.Write(key)
+			sb.WriteString(": ")
+			sb.Write(val)
+		}
+		sb.WriteString("}")
+	}
+	if len(rows) > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// columnWidths 计算每列在表头和所有行中的最大显示宽度
+func columnWidths(headers []string, rows [][]string) []int {
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range rows {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			if w := utf8.RuneCountInString(row[i]); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	return widths
+}
+
+// formatJSONError 把错误编码成 JSON 对象，code 见 ErrorCode
+func formatJSONError(err error) string {
+	data, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{err.Error(), ErrorCode(err)})
+	return string(data)
+}
+
+// formatJSONTiming 把语句耗时格式化为一行 JSON，供 JSON 输出模式下的客户端解析
+func formatJSONTiming(elapsed time.Duration) string {
+	data, _ := json.Marshal(struct {
+		Elapsed float64 `json:"elapsed_sec"`
+	}{elapsed.Seconds()})
+	return string(data)
+}
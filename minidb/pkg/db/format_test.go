@@ -0,0 +1,42 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFormatTable(t *testing.T) {
+	out := formatTable([]string{"id", "name"}, [][]string{{"1", "alice"}, {"22", "bob"}})
+	want := strings.Join([]string{
+		"+----+-------+",
+		"| id | name  |",
+		"+----+-------+",
+		"| 1  | alice |",
+		"| 22 | bob   |",
+		"+----+-------+",
+	}, "\n")
+	if out != want {
+		t.Fatalf("unexpected table output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	out := formatJSON([]string{"id", "name"}, [][]string{{"1", `a"b`}, {"2"}})
+
+	var decoded []map[string]string
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	if len(decoded) != 2 || decoded[0]["name"] != `a"b` || decoded[1]["name"] != "" {
+		t.Fatalf("unexpected rows: %v", decoded)
+	}
+	// 键的顺序要跟表头一致
+	if !strings.Contains(out, `{"id": "1", "name": "a\"b"}`) {
+		t.Errorf("columns out of order:\n%s", out)
+	}
+
+	if empty := formatJSON([]string{"id"}, nil); empty != "[]" {
+		t.Errorf("empty result = %q, want []", empty)
+	}
+}
@@ -0,0 +1,283 @@
+package db
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AggregateSpec 描述一个分组聚合：Func 为 count / min / max / sum，Column 为 "*" 或列名
+type AggregateSpec struct {
+	Func   string
+	Column string
+}
+
+// AggregateValue 是一个聚合结果，Valid 为 false 表示 NULL（比如组内该列全为 NULL 时的 min）
+type AggregateValue struct {
+	Value int64
+	Valid bool
+}
+
+// Group 是 GROUP BY 的一组结果，Null 为 true 表示分组列为 NULL 的那一组
+type Group struct {
+	Key    string
+	Null   bool
+	Values []AggregateValue // 与传入的 aggs 一一对应
+}
+
+// GroupBy 按 column 分组并计算 aggs，结果按分组值排序（int 列按数值，其余按字符串），NULL 组排在最前
+// count(col) 只统计非 NULL 值；min / max / sum 只支持整数值，遇到非整数返回 ErrInvalidValue
+func (e *Engine) GroupBy(tableName, column string, aggs []AggregateSpec) ([]Group, error) {
+	columns, groupIdx, err := e.lookupColumn(tableName, column)
+	if err != nil {
+		return nil, err
+	}
+
+	aggIdx := make([]int, len(aggs))
+	for i, agg := range aggs {
+		switch strings.ToLower(agg.Func) {
+		case "count":
+		case "min", "max", "sum":
+			if agg.Column == "*" {
+				return nil, errorf(ErrUnsupported, "%s(*) is not supported", agg.Func)
+			}
+		default:
+			return nil, errorf(ErrUnsupported, "unsupported aggregate function '%s'", agg.Func)
+		}
+		aggIdx[i] = -1
+		if agg.Column != "*" {
+			if _, aggIdx[i], err = e.lookupColumn(tableName, agg.Column); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	groups := make(map[string]*Group)
+	// 分组结果最后统一排序，扫描不需要按主键顺序
+	var scanErr error
+	err = e.scanUnordered(tableName, func(row Row) bool {
+		key, ok := rowColumn(row, groupIdx)
+		if ok {
+			key = normalizeValue(columns[groupIdx].Type, key)
+		}
+		// NULL 组用一个不会和普通值冲突的键
+		mapKey := "v" + key
+		if !ok {
+			mapKey = "null"
+		}
+		g := groups[mapKey]
+		if g == nil {
+			g = &Group{Key: key, Null: !ok, Values: make([]AggregateValue, len(aggs))}
+			groups[mapKey] = g
+		}
+
+		for i, agg := range aggs {
+			v := &g.Values[i]
+			if aggIdx[i] < 0 {
+				v.Value++
+				v.Valid = true
+				continue
+			}
+			val, ok := rowColumn(row, aggIdx[i])
+			if !ok {
+				if strings.ToLower(agg.Func) == "count" {
+					v.Valid = true
+				}
+				continue
+			}
+			fn := strings.ToLower(agg.Func)
+			if fn == "count" {
+				v.Value++
+				v.Valid = true
+				continue
+			}
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				scanErr = errorf(ErrInvalidValue, "%s(%s): '%s' is not an integer", fn, agg.Column, val)
+				return false
+			}
+			switch {
+			case !v.Valid:
+				v.Value = n
+			case fn == "min" && n < v.Value:
+				v.Value = n
+			case fn == "max" && n > v.Value:
+				v.Value = n
+			case fn == "sum":
+				v.Value += n
+			}
+			v.Valid = true
+		}
+		return true
+	})
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	numeric := columns[groupIdx].Type == TypeInt || columns[groupIdx].Type == TypeBigInt
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Null != b.Null {
+			return a.Null
+		}
+		if numeric {
+			x, errX := strconv.ParseInt(a.Key, 10, 64)
+			y, errY := strconv.ParseInt(b.Key, 10, 64)
+			if errX == nil && errY == nil {
+				return x < y
+			}
+		}
+		return a.Key < b.Key
+	})
+	return result, nil
+}
+
+var (
+	// reGroupBy 匹配 select <items> from <table> group by <col> [having <cond>]
+	reGroupBy = regexp.MustCompile(`(?i)^select\s+(.+?)\s+from\s+(\w+)\s+group\s+by\s+([\w.]+)(?:\s+having\s+(.+))?$`)
+	// reAggItem 匹配选择列表或 HAVING 中的聚合函数
+	reAggItem = regexp.MustCompile(`(?i)^(count|min|max|sum)\s*\(\s*(\*|[\w.]+)\s*\)$`)
+	// reHaving 匹配 HAVING 中的单个条件：聚合函数、比较运算符、整数
+	reHaving = regexp.MustCompile(`(?i)^(.+?)\s*(<=|>=|!=|<>|=|<|>)\s*(-?\d+)$`)
+	reAnd    = regexp.MustCompile(`(?i)\s+and\s+`)
+)
+
+// havingCond 是 HAVING 中的一个条件，agg 是聚合在 specs 中的下标
+type havingCond struct {
+	agg   int
+	op    string
+	value int64
+}
+
+// match 判断聚合结果是否满足条件，NULL 与任何值比较都不成立
+func (c havingCond) match(v AggregateValue) bool {
+	if !v.Valid {
+		return false
+	}
+	switch c.op {
+	case "=":
+		return v.Value == c.value
+	case "!=", "<>":
+		return v.Value != c.value
+	case "<":
+		return v.Value < c.value
+	case "<=":
+		return v.Value <= c.value
+	case ">":
+		return v.Value > c.value
+	default:
+		return v.Value >= c.value
+	}
+}
+
+// handleGroupBy 执行 GROUP BY [HAVING]
+// 选择列表只能是分组列或聚合函数；只在 HAVING 中出现的聚合也会计算，但不输出
+func (p *SQLParser) handleGroupBy(items, tableName, groupCol, having string) error {
+	ref := tableRef{Name: tableName}
+	groupName, err := ref.resolveColumn(groupCol)
+	if err != nil {
+		return err
+	}
+
+	var specs []AggregateSpec
+	// addSpec 返回聚合在 specs 中的下标，相同的聚合只计算一次
+	addSpec := func(item string) (int, error) {
+		m := reAggItem.FindStringSubmatch(item)
+		if m == nil {
+			return -1, errorf(ErrSyntax, "'%s' is not an aggregate", item)
+		}
+		spec := AggregateSpec{Func: strings.ToLower(m[1]), Column: m[2]}
+		if spec.Column != "*" {
+			if spec.Column, err = ref.resolveColumn(spec.Column); err != nil {
+				return -1, err
+			}
+		}
+		for i, s := range specs {
+			if s.Func == spec.Func && strings.EqualFold(s.Column, spec.Column) {
+				return i, nil
+			}
+		}
+		specs = append(specs, spec)
+		return len(specs) - 1, nil
+	}
+
+	// outputs 中 -1 表示分组列，其余为聚合下标
+	var headers []string
+	var outputs []int
+	for _, item := range strings.Split(items, ",") {
+		item = strings.TrimSpace(item)
+		if !reAggItem.MatchString(item) {
+			name, err := ref.resolveColumn(item)
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(name, groupName) {
+				return errorf(ErrSyntax, "column '%s' must appear in the group by clause or be used in an aggregate", item)
+			}
+			headers = append(headers, name)
+			outputs = append(outputs, -1)
+			continue
+		}
+		i, err := addSpec(item)
+		if err != nil {
+			return err
+		}
+		headers = append(headers, strings.ToLower(strings.Join(strings.Fields(item), "")))
+		outputs = append(outputs, i)
+	}
+
+	var conds []havingCond
+	if having = strings.TrimSpace(having); having != "" {
+		for _, part := range reAnd.Split(having, -1) {
+			m := reHaving.FindStringSubmatch(strings.TrimSpace(part))
+			if m == nil {
+				return errorf(ErrSyntax, "unsupported having condition '%s'", part)
+			}
+			i, err := addSpec(m[1])
+			if err != nil {
+				return err
+			}
+			n, err := strconv.ParseInt(m[3], 10, 64)
+			if err != nil {
+				return errorf(ErrInvalidValue, "invalid number '%s' in having", m[3])
+			}
+			conds = append(conds, havingCond{agg: i, op: m[2], value: n})
+		}
+	}
+
+	groups, err := p.Engine.GroupBy(tableName, groupName, specs)
+	if err != nil {
+		return err
+	}
+
+	var cells [][]string
+next:
+	for _, g := range groups {
+		for _, c := range conds {
+			if !c.match(g.Values[c.agg]) {
+				continue next
+			}
+		}
+		row := make([]string, len(outputs))
+		for i, out := range outputs {
+			switch {
+			case out < 0 && g.Null, out >= 0 && !g.Values[out].Valid:
+				row[i] = "NULL"
+			case out < 0:
+				row[i] = g.Key
+			default:
+				row[i] = strconv.FormatInt(g.Values[out].Value, 10)
+			}
+		}
+		cells = append(cells, row)
+	}
+	return p.printCells(headers, cells)
+}
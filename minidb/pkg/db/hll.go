@@ -0,0 +1,66 @@
+package db
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision 决定 HyperLogLog 的寄存器个数 m = 2^p
+// p = 14 时占 16KB 内存，标准误差约 1.04/sqrt(m) ≈ 0.8%，与表的大小无关
+const hllPrecision = 14
+
+// hyperLogLog 是估算不同值个数的概率计数器：
+// 哈希值的高 p 位选寄存器，寄存器记录其余位中第一个 1 出现的最大位置，
+// 各寄存器的调和平均反映见过的不同值个数
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// add 记录一个值，同一个值重复加入不改变估计
+func (h *hyperLogLog) add(value string) {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	x := mix64(f.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	// 剩余 64-p 位中第一个 1 的位置（从 1 开始）；全为 0 时取 64-p+1
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// estimate 返回不同值个数的估计
+// 估计值较小时还有空寄存器，改用线性计数（按空寄存器的比例估算），小基数下更准
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return int64(est + 0.5)
+}
+
+// mix64 打散 FNV 的输出（splitmix64 的终结步骤），FNV 对相近的短字符串高位分布不够均匀
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
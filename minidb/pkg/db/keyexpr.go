@@ -0,0 +1,325 @@
+package db
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// keyExpr 是 WHERE 中只涉及主键的整数表达式：
+//
+//	expr   = term {("+" | "-") term}
+//	term   = factor {("*" | "/" | "%") factor}
+//	factor = <整数> | id | "-" factor | "(" expr ")" | abs "(" expr ")" | mod "(" expr "," expr ")"
+//
+// 求值时把行的主键代入 id；除数为 0 时结果为 NULL，比较不成立
+type keyExpr struct {
+	op          string // "num"、"key"、"neg"、"abs"，或二元运算符 + - * / %
+	num         int64
+	left, right *keyExpr
+}
+
+func (x *keyExpr) eval(key int64) (int64, bool) {
+	switch x.op {
+	case "num":
+		return x.num, true
+	case "key":
+		return key, true
+	}
+	a, ok := x.left.eval(key)
+	if !ok {
+		return 0, false
+	}
+	switch x.op {
+	case "neg":
+		return -a, true
+	case "abs":
+		if a < 0 {
+			a = -a
+		}
+		return a, true
+	}
+	b, ok := x.right.eval(key)
+	if !ok {
+		return 0, false
+	}
+	switch x.op {
+	case "+":
+		return a + b, true
+	case "-":
+		return a - b, true
+	case "*":
+		return a * b, true
+	case "/", "%":
+		// MinInt64 / -1 在 Go 中会 panic
+		if b == 0 || (b == -1 && a == math.MinInt64) {
+			return 0, false
+		}
+		if x.op == "/" {
+			return a / b, true
+		}
+		return a % b, true
+	}
+	return 0, false
+}
+
+// usesKey 报告表达式中是否出现主键
+func (x *keyExpr) usesKey() bool {
+	if x == nil {
+		return false
+	}
+	return x.op == "key" || x.left.usesKey() || x.right.usesKey()
+}
+
+// keyPredicate 是 <表达式> <比较> <表达式>，至少一边用到了主键
+type keyPredicate struct {
+	left, right *keyExpr
+	op          string
+}
+
+// match 判断主键为 key 的行是否满足条件，任一边为 NULL 时不满足
+func (k *keyPredicate) match(key int64) bool {
+	a, okA := k.left.eval(key)
+	b, okB := k.right.eval(key)
+	if !okA || !okB {
+		return false
+	}
+	switch k.op {
+	case "=":
+		return a == b
+	case "!=", "<>":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// sargable 报告条件能否走主键索引：一边是主键列本身，另一边不含主键
+// 主键被表达式包住（id + 1 = 6、id % 2 = 0）时，条件与主键的顺序没有简单的对应关系，只能全表扫描逐行求值
+func (k *keyPredicate) sargable() bool {
+	return (k.left.op == "key" && !k.right.usesKey()) || (k.right.op == "key" && !k.left.usesKey())
+}
+
+// bound 把可以走索引的条件化成 id <op> <常量>，常量一边先求值
+// 常量为 NULL（如除以 0）时 ok 为 false，条件对任何行都不成立
+func (k *keyPredicate) bound() (op string, key int64, ok bool) {
+	op, constant := k.op, k.right
+	if k.left.op != "key" {
+		constant = k.left
+		// 主键在右边时交换两边，比较方向随之反转
+		switch op {
+		case "<":
+			op = ">"
+		case "<=":
+			op = ">="
+		case ">":
+			op = "<"
+		case ">=":
+			op = "<="
+		}
+	}
+	key, ok = constant.eval(0)
+	return op, key, ok
+}
+
+// runKeyFilter 全表扫描，对每行的主键求值 pred，limit >= 0 时最多返回 limit 行
+func (p *SQLParser) runKeyFilter(ref tableRef, pred *keyPredicate, limit int) ([]Row, error) {
+	it, err := p.Engine.ScanRange(ref.Name, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var rows []Row
+	for (limit < 0 || len(rows) < limit) && it.Next() {
+		if row := it.Row(); pred.match(row.Key) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, it.Err()
+}
+
+// parseKeyPredicate 尝试把 WHERE 条件解析成主键上的算术比较
+// 条件里有字符串、子查询、主键以外的列等无法识别的内容时返回 nil，交给原来的 WHERE 解析处理
+func (p *SQLParser) parseKeyPredicate(ref tableRef, condition string) *keyPredicate {
+	tokens, ok := tokenizeKeyExpr(condition)
+	if !ok {
+		return nil
+	}
+	kp := &keyExprParser{tokens: tokens, isKey: func(name string) bool {
+		col, err := ref.resolveColumn(name)
+		return err == nil && strings.EqualFold(col, "id")
+	}}
+	pred := &keyPredicate{}
+	if pred.left, ok = kp.expr(); !ok {
+		return nil
+	}
+	t := kp.next()
+	if t.kind != tokOp {
+		return nil
+	}
+	pred.op = t.text
+	if pred.right, ok = kp.expr(); !ok || kp.pos != len(kp.tokens) {
+		return nil
+	}
+	if !pred.left.usesKey() && !pred.right.usesKey() {
+		return nil
+	}
+	return pred
+}
+
+// tokArith 是算术运算符、括号和逗号，其余词类与 CASE 表达式共用
+const tokArith caseTokenKind = tokOp + 1
+
+// tokenizeKeyExpr 把条件拆成词；数字只能是不带符号的十进制整数，负号由语法处理
+func tokenizeKeyExpr(s string) ([]caseToken, bool) {
+	var tokens []caseToken
+	isWord := func(c byte) bool {
+		return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isWord(c):
+			j := i
+			for j < len(s) && isWord(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			if c >= '0' && c <= '9' {
+				if _, err := strconv.ParseInt(word, 10, 64); err != nil {
+					return nil, false
+				}
+				tokens = append(tokens, caseToken{kind: tokNumber, text: word})
+			} else {
+				tokens = append(tokens, caseToken{kind: tokWord, text: word})
+			}
+			i = j
+		case strings.IndexByte("+-*/%(),", c) >= 0:
+			tokens = append(tokens, caseToken{kind: tokArith, text: string(c)})
+			i++
+		default:
+			op := ""
+			for _, o := range []string{"<=", ">=", "<>", "!=", "=", "<", ">"} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, false
+			}
+			tokens = append(tokens, caseToken{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return tokens, true
+}
+
+type keyExprParser struct {
+	tokens []caseToken
+	pos    int
+	isKey  func(name string) bool
+}
+
+func (kp *keyExprParser) peek() caseToken {
+	if kp.pos < len(kp.tokens) {
+		return kp.tokens[kp.pos]
+	}
+	return caseToken{}
+}
+
+func (kp *keyExprParser) next() caseToken {
+	t := kp.peek()
+	if kp.pos < len(kp.tokens) {
+		kp.pos++
+	}
+	return t
+}
+
+// arith 在下一个词是算术符号 s 时消费它并返回 true
+func (kp *keyExprParser) arith(s string) bool {
+	if t := kp.peek(); t.kind == tokArith && t.text == s {
+		kp.pos++
+		return true
+	}
+	return false
+}
+
+func (kp *keyExprParser) expr() (*keyExpr, bool) {
+	left, ok := kp.term()
+	for ok {
+		t := kp.peek()
+		if t.kind != tokArith || (t.text != "+" && t.text != "-") {
+			break
+		}
+		kp.pos++
+		var right *keyExpr
+		if right, ok = kp.term(); ok {
+			left = &keyExpr{op: t.text, left: left, right: right}
+		}
+	}
+	return left, ok
+}
+
+func (kp *keyExprParser) term() (*keyExpr, bool) {
+	left, ok := kp.factor()
+	for ok {
+		t := kp.peek()
+		if t.kind != tokArith || (t.text != "*" && t.text != "/" && t.text != "%") {
+			break
+		}
+		kp.pos++
+		var right *keyExpr
+		if right, ok = kp.factor(); ok {
+			left = &keyExpr{op: t.text, left: left, right: right}
+		}
+	}
+	return left, ok
+}
+
+func (kp *keyExprParser) factor() (*keyExpr, bool) {
+	t := kp.next()
+	switch {
+	case t.kind == tokNumber:
+		n, _ := strconv.ParseInt(t.text, 10, 64)
+		return &keyExpr{op: "num", num: n}, true
+	case t.kind == tokArith && t.text == "-":
+		x, ok := kp.factor()
+		// 负数字面量直接折叠成常量
+		if ok && x.op == "num" {
+			return &keyExpr{op: "num", num: -x.num}, true
+		}
+		return &keyExpr{op: "neg", left: x}, ok
+	case t.kind == tokArith && t.text == "(":
+		x, ok := kp.expr()
+		return x, ok && kp.arith(")")
+	case t.kind != tokWord:
+		return nil, false
+	}
+
+	switch fn := strings.ToLower(t.text); {
+	case fn == "abs" && kp.arith("("):
+		x, ok := kp.expr()
+		return &keyExpr{op: "abs", left: x}, ok && kp.arith(")")
+	case fn == "mod" && kp.arith("("):
+		a, ok := kp.expr()
+		if !ok || !kp.arith(",") {
+			return nil, false
+		}
+		b, ok := kp.expr()
+		return &keyExpr{op: "%", left: a, right: b}, ok && kp.arith(")")
+	case kp.isKey(t.text):
+		return &keyExpr{op: "key"}, true
+	}
+	return nil, false
+}
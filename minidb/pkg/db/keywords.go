@@ -0,0 +1,29 @@
+package db
+
+import "strings"
+
+// reservedWords 是不能用作表名、列名或别名的关键字
+// 标识符按 \w+ 匹配，用关键字建出来的表会被别的语句规则抢先匹配，之后就无法访问了
+var reservedWords = map[string]bool{
+	"analyze": true, "and": true, "as": true, "between": true, "by": true,
+	"create": true, "database": true, "databases": true, "delete": true,
+	"describe": true, "drop": true, "exit": true, "explain": true, "flush": true, "from": true,
+	"help": true, "history": true, "index": true, "insert": true, "into": true,
+	"key": true, "limit": true, "metadata": true, "not": true, "null": true,
+	"or": true, "order": true, "primary": true, "quit": true, "select": true,
+	"set": true, "show": true, "status": true, "table": true, "tables": true,
+	"update": true, "use": true, "values": true, "warnings": true, "where": true,
+}
+
+// IsReserved 报告 word 是否是保留关键字（不区分大小写）
+func IsReserved(word string) bool {
+	return reservedWords[strings.ToLower(word)]
+}
+
+// checkIdentifier 拒绝使用保留关键字作为标识符，kind 用于错误信息，如 "table name"
+func checkIdentifier(kind, name string) error {
+	if IsReserved(name) {
+		return errorf(ErrSyntax, "'%s' is a reserved keyword and cannot be used as a %s", name, kind)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReservedIdentifiers(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+
+	for word := range reservedWords {
+		for _, sql := range []string{
+			fmt.Sprintf("create table %s (id int)", word),
+			fmt.Sprintf("create table %s (id int)", strings.ToUpper(word)),
+			fmt.Sprintf("create table t_%s (id int, %s string)", word, word),
+		} {
+			err := p.ParseAndExecute(sql)
+			if err == nil || !strings.Contains(err.Error(), "reserved keyword") {
+				t.Errorf("%q: err = %v, want reserved keyword error", sql, err)
+			}
+		}
+	}
+	if tables := e.Catalog.ListTables(); len(tables) != 0 {
+		t.Fatalf("tables created with reserved names: %v", tables)
+	}
+
+	// 只是包含关键字的标识符不受影响
+	if err := p.ParseAndExecute("create table selection (id int, order_no int)"); err != nil {
+		t.Fatal(err)
+	}
+}
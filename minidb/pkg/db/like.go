@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// reLike 匹配 WHERE 中的 LIKE 条件：列、可选的 NOT、单引号模式串（反斜杠转义）
+var reLike = regexp.MustCompile(`(?i)^([\w.]+)\s+(not\s+)?like\s+'((?:[^'\\]|\\.)*)'$`)
+
+// likePattern 是编译后的 LIKE 模式
+// % 匹配任意长度的字符串，_ 匹配单个字符，\% \_ \\ 匹配字面量
+type likePattern struct {
+	prefix string         // 第一个通配符之前的字面量前缀
+	re     *regexp.Regexp // 完整模式，prefix 不匹配时不必执行
+}
+
+func compileLike(pattern string) *likePattern {
+	var re, prefix strings.Builder
+	re.WriteString(`(?s)^`)
+	inPrefix := true
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			lit := string(pattern[i])
+			re.WriteString(regexp.QuoteMeta(lit))
+			if inPrefix {
+				prefix.WriteString(lit)
+			}
+		case c == '%':
+			re.WriteString(`.*`)
+			inPrefix = false
+		case c == '_':
+			re.WriteString(`.`)
+			inPrefix = false
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+			if inPrefix {
+				prefix.WriteByte(c)
+			}
+		}
+	}
+	re.WriteString(`$`)
+	return &likePattern{prefix: prefix.String(), re: regexp.MustCompile(re.String())}
+}
+
+// Match 判断值是否匹配模式，区分大小写
+func (lp *likePattern) Match(s string) bool {
+	return strings.HasPrefix(s, lp.prefix) && lp.re.MatchString(s)
+}
+
+// prefixUpperBound 返回比所有以 prefix 开头的字符串都大的最小字符串，以 prefix 开头的字符串正好落在 [prefix, 上界) 内：
+// 去掉末尾的 0xff 字节后把最后一个字节加一，例如 'abc' 的上界是 'abd'。prefix 为空或全是 0xff 时没有上界，返回 false
+func prefixUpperBound(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for len(b) > 0 && b[len(b)-1] == 0xff {
+		b = b[:len(b)-1]
+	}
+	if len(b) == 0 {
+		return "", false
+	}
+	b[len(b)-1]++
+	return string(b), true
+}
+
+// usesPrefixIndex 判断 LIKE 能否按字面量前缀走 varchar 列上的二级索引：
+// 模式不以通配符开头（有非空前缀）、不是 NOT LIKE，并且列上建有索引，返回索引名
+// 整数和布尔列的索引存的是规范化后的值（'007' 存成 '7'），与 LIKE 比较的原始值不一致，不能用
+func (p *SQLParser) usesPrefixIndex(ref tableRef, column string, typ ColumnType, negate bool, lp *likePattern) (string, bool) {
+	if negate || lp.prefix == "" || typ != TypeVarchar {
+		return "", false
+	}
+	return p.Engine.indexOn(ref.Name, column)
+}
+
+// runLike 执行 col [NOT] LIKE 'pattern'
+// 模式有字面量前缀、列上建有二级索引时，只扫描索引中以前缀开头的一段 Key（见 Engine.scanIndexPrefix）；
+// 否则全表扫描后逐行过滤，过滤时先比较字面量前缀，大部分不匹配的行不用执行正则
+// 列缺失（NULL）的行无论 LIKE 还是 NOT LIKE 都不匹配
+func (p *SQLParser) runLike(ref tableRef, column string, negate bool, pattern string) ([]Row, error) {
+	name, err := ref.resolveColumn(column)
+	if err != nil {
+		return nil, err
+	}
+	columns, idx, err := p.Engine.lookupColumn(ref.Name, name)
+	if err != nil {
+		return nil, err
+	}
+
+	lp := compileLike(pattern)
+	if indexName, ok := p.usesPrefixIndex(ref, name, columns[idx].Type, negate, lp); ok {
+		return p.Engine.scanIndexPrefix(ref.Name, indexName, lp.prefix, lp.Match)
+	}
+	it, err := p.Engine.ScanRange(ref.Name, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var rows []Row
+	for it.Next() {
+		row := it.Row()
+		if val, ok := rowColumn(row, idx); ok && lp.Match(val) != negate {
+			rows = append(rows, row)
+		}
+	}
+	return rows, it.Err()
+}
+
+// explainLike 描述 runLike 的访问路径：前缀能走索引时是索引上的一段范围，否则全表扫描，两种情况都还要逐行过滤
+func (p *SQLParser) explainLike(ref tableRef, condition, column string, negate bool, pattern string) ([]string, error) {
+	fullScan := []string{fmt.Sprintf("full scan on %s", ref.Name), "filter: " + condition}
+	if p.isValueColumn(ref, column) {
+		return fullScan, nil
+	}
+	name, err := ref.resolveColumn(column)
+	if err != nil {
+		return nil, err
+	}
+	columns, idx, err := p.Engine.lookupColumn(ref.Name, name)
+	if err != nil {
+		return nil, err
+	}
+	lp := compileLike(pattern)
+	if indexName, ok := p.usesPrefixIndex(ref, name, columns[idx].Type, negate, lp); ok {
+		return []string{fmt.Sprintf("index range scan on %s using %s: %s", ref.Name, indexName, prefixRange(name, lp.prefix)), fullScan[1]}, nil
+	}
+	return fullScan, nil
+}
+
+// prefixRange 把以 prefix 开头的范围写成 col >= 'prefix' and col < '上界'
+func prefixRange(column, prefix string) string {
+	if high, ok := prefixUpperBound(prefix); ok {
+		return fmt.Sprintf("%s >= '%s' and %s < '%s'", column, prefix, column, high)
+	}
+	return fmt.Sprintf("%s >= '%s'", column, prefix)
+}
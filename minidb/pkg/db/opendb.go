@@ -0,0 +1,260 @@
+package db
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/page"
+)
+
+// 每个打开的数据库有自己的一份资源：数据文件、缓冲池、Catalog，以及按表名区分、不能跨库共享的
+// 布隆过滤器、写冲突记录和延迟释放的页面。openDatabases 是所有会话共享的登记表，按库名记录打开的库和引用计数：
+// 会话 use 一个库时引用加一（还没打开时先打开），切换到别的库或关闭会话时减一，减到 0 才关闭数据文件；
+// 有会话在用的库不能删除。
+//
+// 库在第一次被 use 时才打开，打开时使用 Engine.OpenOptions（缓冲池大小、替换策略、后台刷盘、双写）。
+// 直接把资源注入 Engine 的用法（测试）仍然可用：NewSession 或 UseDatabase 时，
+// 注入的资源登记为 CurrentDB 打开的库，由注入它的引擎持有一个引用，其他会话 use 这个库时共享这份资源，不会再打开一次文件
+
+// defaultPoolSize 是 OpenOptions.PoolSize 为 0 时缓冲池的大小（Frame 数）
+const defaultPoolSize = 100
+
+// OpenOptions 是打开数据库时使用的服务器级选项，每个库打开时都用同一份；零值是测试中用的最简单的配置
+type OpenOptions struct {
+	PoolSize      int  // 每个库的缓冲池 Frame 数，0 表示 defaultPoolSize
+	LRUK          int  // 大于 0 时缓冲池按 LRU-K 淘汰（1 表示普通 LRU），0 使用默认的替换器
+	CleanFrames   int  // 后台刷盘保持的干净 Frame 数，0 表示不启动后台刷盘
+	DoubleWrite   bool // 写页前先写双写缓冲区
+	StrictCatalog bool // meta.json 损坏时拒绝打开，而不是加载上一版本 meta.json.bak
+}
+
+// openDB 是一个打开的数据库的资源
+type openDB struct {
+	name    string
+	dm      disk.DiskManager
+	bpm     *buffer.BufferPoolManager
+	catalog *Catalog
+	blooms  *bloomRegistry
+	txns    *txnRegistry
+	epochs  *epochRegistry
+	refs    int  // 引用这个库的引擎（会话）个数
+	closed  bool // 已经被 closeAll 关闭，之后放弃引用的会话不再关闭它
+}
+
+// openDatabases 是所有会话共享的打开的库的登记表
+type openDatabases struct {
+	mu            sync.Mutex
+	dbs           map[string]*openDB
+	bloomsEnabled bool // 新打开的库是否启用布隆过滤器，见 EnableBloomFilters
+}
+
+func newOpenDatabases() *openDatabases {
+	return &openDatabases{dbs: make(map[string]*openDB)}
+}
+
+// open 打开库 name 的数据文件和元数据
+func (o *openDatabases) open(dataRoot, name string, cfg DatabaseConfig, opts OpenOptions) (*openDB, error) {
+	path := filepath.Join(dataRoot, name)
+	dm, err := disk.OpenTablespaces(filepath.Join(path, DataFileName), cfg.Tablespaces, cfg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := dm.SetDoubleWrite(opts.DoubleWrite); err != nil {
+		dm.Close()
+		return nil, fmt.Errorf("open double-write buffer of database '%s': %w", name, err)
+	}
+	poolSize := cmp.Or(opts.PoolSize, defaultPoolSize)
+	var bpm *buffer.BufferPoolManager
+	if opts.LRUK > 0 {
+		bpm = buffer.NewBufferPoolManagerWithReplacer(dm, poolSize, buffer.NewLRUKReplacer(poolSize, opts.LRUK))
+	} else {
+		bpm = buffer.NewBufferPoolManager(dm, poolSize)
+	}
+	catalog, err := OpenCatalog(bpm, filepath.Join(path, MetaFileName), !opts.StrictCatalog)
+	if err != nil {
+		dm.Close()
+		return nil, fmt.Errorf("open database '%s': %w", name, err)
+	}
+	bpm.StartFlusher(opts.CleanFrames)
+	return &openDB{
+		name:    name,
+		dm:      dm,
+		bpm:     bpm,
+		catalog: catalog,
+		blooms:  &bloomRegistry{filters: make(map[string]*bloomFilter), enabled: o.bloomsEnabled},
+		txns:    &txnRegistry{},
+		epochs:  newEpochRegistry(func(id page.PageID) bool { return bpm.DeletePage(id) }),
+	}, nil
+}
+
+// close 把脏页和元数据写回并关闭数据文件，调用方必须持有 mu
+// 某一步失败时其余步骤照常进行，返回所有失败汇总成的错误
+func (d *openDB) close() error {
+	d.bpm.StopFlusher()
+	return closeResources(d.name, d.bpm, d.catalog, d.dm)
+}
+
+// closeResources 依次写回脏页、写回元数据、关闭数据文件，返回所有失败汇总成的错误；
+// 仍被 Pin 住的脏页不写，见 BufferPoolManager.FlushAllPages
+func closeResources(name string, bpm *buffer.BufferPoolManager, catalog *Catalog, dm disk.DiskManager) error {
+	var errs []error
+	if bpm != nil {
+		if err := bpm.FlushAllPages(); err != nil {
+			errs = append(errs, fmt.Errorf("flush data pages of database '%s': %w", name, err))
+		}
+	}
+	if catalog != nil {
+		if err := catalog.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("save metadata of database '%s': %w", name, err))
+		}
+	}
+	if dm != nil {
+		if err := dm.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close data file of database '%s': %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// release 放弃一个引用，最后一个引用放弃时关闭库并返回关闭的错误，调用方必须持有 mu
+func (o *openDatabases) release(d *openDB) error {
+	d.refs--
+	if d.refs > 0 || d.closed {
+		return nil
+	}
+	if o.dbs[d.name] == d {
+		delete(o.dbs, d.name)
+	}
+	return d.close()
+}
+
+// adopt 把直接注入 e 的资源登记为库 name，e 持有一个引用；e 已经引用了某个库、没有资源或 name 已经打开时什么都不做
+// 调用方必须持有 e.dbs.mu
+func (e *Engine) adopt(name string) {
+	if e.db != nil || e.BPM == nil || name == "" {
+		return
+	}
+	if _, ok := e.dbs.dbs[name]; ok {
+		return
+	}
+	e.db = &openDB{
+		name:    name,
+		dm:      e.DiskManager,
+		bpm:     e.BPM,
+		catalog: e.Catalog.sharedCatalog(),
+		blooms:  e.blooms,
+		txns:    e.txns,
+		epochs:  e.epochs,
+		refs:    1,
+	}
+	e.dbs.dbs[name] = e.db
+}
+
+// attach 让 e 引用库 name：库已经打开时共享它，否则打开它；之后放弃 e 原来引用的库
+func (e *Engine) attach(name string, cfg DatabaseConfig) error {
+	e.dbs.mu.Lock()
+	defer e.dbs.mu.Unlock()
+	// main.go 先注入默认库的资源再 use 它：这些资源就属于 name
+	if !e.session && e.CurrentDB == "" {
+		e.adopt(name)
+		if e.db != nil && e.db.name == name {
+			return nil
+		}
+	}
+	// 离开注入的库之前先登记它，这样最后一个引用放弃时会关闭它
+	e.adopt(e.CurrentDB)
+
+	d, ok := e.dbs.dbs[name]
+	if !ok {
+		var err error
+		if d, err = e.dbs.open(e.DataRoot, name, cfg, e.OpenOptions); err != nil {
+			return err
+		}
+		e.dbs.dbs[name] = d
+		if d.catalog.LoadedBackup {
+			e.warnf("%s of database '%s' is corrupt, loaded the previous version from %s%s", MetaFileName, name, MetaFileName, CatalogBackupSuffix)
+		}
+	}
+	d.refs++
+	if old := e.db; old != nil {
+		// 已经切换到 name，关闭原来的库失败不影响这次 use，只提示
+		if err := e.dbs.release(old); err != nil {
+			e.warnf("%v", err)
+		}
+	}
+	e.db = d
+	e.DiskManager, e.BPM, e.Catalog = d.dm, d.bpm, d.catalog
+	e.blooms, e.txns, e.epochs = d.blooms, d.txns, d.epochs
+	return nil
+}
+
+// detach 放弃 e 引用的库，最后一个引用放弃时关闭它并返回关闭的错误
+func (e *Engine) detach() error {
+	e.dbs.mu.Lock()
+	defer e.dbs.mu.Unlock()
+	if e.db == nil {
+		return nil
+	}
+	err := e.dbs.release(e.db)
+	e.db = nil
+	return err
+}
+
+// closeAll 关闭除 keep 以外所有打开的库，不管还有没有会话在用，服务器退出时调用；返回所有库关闭的错误
+func (o *openDatabases) closeAll(keep *openDB) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var errs []error
+	for name, d := range o.dbs {
+		if d != keep {
+			errs = append(errs, d.close())
+		}
+		d.closed = true
+		delete(o.dbs, name)
+	}
+	return errors.Join(errs...)
+}
+
+// adoptCurrent 把直接注入 e 的资源登记为 CurrentDB，见 adopt
+func (e *Engine) adoptCurrent() {
+	e.dbs.mu.Lock()
+	defer e.dbs.mu.Unlock()
+	e.adopt(e.CurrentDB)
+}
+
+// Checkpoint 把所有打开的库中没有被 Pin 住的脏页和元数据写回磁盘（见 BufferPoolManager.FlushDirtyPages），
+// 返回写回的页数。服务器定期调用，这样没有正常关闭时数据文件也包含最近的写入；
+// 某个库失败时继续写其他库，返回遇到的第一个错误。
+// 只读登记表、不碰 e 自己的字段，所以可以在后台 goroutine 中和使用 e 的请求同时调用；
+// 直接注入 e、还没有登记的资源（见 adopt）不在其中，服务器启动时 use 默认库就已经登记了
+func (e *Engine) Checkpoint() (int, error) {
+	e.dbs.mu.Lock()
+	defer e.dbs.mu.Unlock()
+
+	flushed := 0
+	var firstErr error
+	for name, d := range e.dbs.dbs {
+		n, err := d.bpm.FlushDirtyPages()
+		flushed += n
+		if err == nil {
+			err = d.catalog.Flush()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("checkpoint database '%s': %w", name, err)
+		}
+	}
+	return flushed, firstErr
+}
+
+// databaseRefs 返回引用库 name 的会话个数，库没有打开时为 0，调用方必须持有 e.dbs.mu
+func (e *Engine) databaseRefs(name string) int {
+	if d, ok := e.dbs.dbs[name]; ok {
+		return d.refs
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/page"
+)
+
+func TestCheckPages(t *testing.T) {
+	e := newTestEngine(t)
+	for _, name := range []string{"a", "b"} {
+		if err := e.CreateTable(name, "id int,name string"); err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 300; i++ {
+			if err := e.Insert(name, i, "v"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	res, err := e.CheckPages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.OK() || len(res.Unreachable) != 0 || res.Reachable != res.Allocated {
+		t.Fatalf("fresh database: %+v", res)
+	}
+
+	// 删表后它的页进入空闲页链表
+	metaB, _ := e.Catalog.GetTable("b")
+	pagesB, err := e.openTree(metaB).Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DropTable("b"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = e.CheckPages(); err != nil {
+		t.Fatal(err)
+	}
+	if !res.OK() || len(res.Unreachable) != 0 || res.Free != len(pagesB) {
+		t.Errorf("after drop: %+v, want the dropped table's %d pages free", res, len(pagesB))
+	}
+
+	// 只从 Catalog 中删掉、没有释放页面（旧版本的删表）时，它的页已不可达
+	if err := e.CreateTable("b", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 300; i++ {
+		if err := e.Insert("b", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metaB, _ = e.Catalog.GetTable("b")
+	if pagesB, err = e.openTree(metaB).Pages(); err != nil {
+		t.Fatal(err)
+	}
+	e.Catalog.DropTable("b")
+	if res, err = e.CheckPages(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(pagesB)
+	if !res.OK() || !slices.Equal(res.Unreachable, pagesB) || res.Free != 0 {
+		t.Errorf("after catalog-only drop: unreachable %v, want the dropped table's pages %v", res.Unreachable, pagesB)
+	}
+
+	// 两张表指向同一棵树
+	if err := e.CreateTable("c", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	metaA, _ := e.Catalog.GetTable("a")
+	e.Catalog.UpdateTableRoot("c", page.PageID(metaA.RootPageId))
+	if res, err = e.CheckPages(); err != nil {
+		t.Fatal(err)
+	}
+	if res.OK() || len(res.Shared) == 0 {
+		t.Errorf("tables sharing a tree were not reported: %+v", res)
+	}
+
+	p := NewSQLParser(e, io.Discard)
+	if err := p.ParseAndExecute("check freelist"); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 repair：不可达的页无法安全地放回空闲页链表
+	if err := p.ParseAndExecute("check freelist repair"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("repair: got %v, want ErrSyntax", err)
+	}
+}
+
+func TestDropTableReusesPages(t *testing.T) {
+	e := newTestEngine(t)
+	lister := e.DiskManager.(disk.PageLister)
+	fileSize := func() int { return len(lister.AllocatedPages()) + len(lister.FreePages()) }
+
+	var size int
+	for round := 0; round < 3; round++ {
+		if err := e.CreateTable("t", "id int,name string"); err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 300; i++ {
+			if err := e.Insert("t", i, "v"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if round == 0 {
+			size = fileSize()
+		} else if got := fileSize(); got != size {
+			t.Fatalf("round %d: data file grew from %d to %d pages", round, size, got)
+		}
+		if err := e.DropTable("t"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
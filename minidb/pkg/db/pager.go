@@ -0,0 +1,95 @@
+package db
+
+import "math"
+
+// Pager 按主键做键集分页（keyset pagination），供嵌入方逐页读取大表
+// 每一页等价于
+//
+//	select * from t where id > :last_seen order by id limit N
+//
+// 从上一页最后一个主键之后重新定位，代价只和页大小有关；
+// 用 OFFSET 翻页则要先扫描并丢弃前面所有的行，越往后越慢。
+// 用法：
+//
+//	pg := engine.NewPager("t", 100)
+//	for {
+//		rows, err := pg.Next()
+//		if err != nil || len(rows) == 0 {
+//			break
+//		}
+//	}
+//
+// 游标只是一个主键，可以用 Cursor 取出交给客户端，下次请求再用 Resume 恢复。
+// 翻页期间提交的插入/删除可能会被看到，但已经翻过的主键不会重复出现
+type Pager struct {
+	engine   *Engine
+	table    string
+	size     int
+	lastSeen int64 // 上一页最后一行的主键
+	started  bool  // 是否已有 lastSeen；没有时从最小的主键开始
+	done     bool
+}
+
+// NewPager 创建一个每页 pageSize 行的分页器，pageSize <= 0 时使用 ScanBatchSize
+func (e *Engine) NewPager(tableName string, pageSize int) *Pager {
+	if pageSize <= 0 {
+		pageSize = ScanBatchSize
+	}
+	return &Pager{engine: e, table: tableName, size: pageSize}
+}
+
+// Next 返回下一页，已经没有更多行时返回空切片
+func (p *Pager) Next() ([]Row, error) {
+	if p.done {
+		return nil, nil
+	}
+	low := int64(math.MinInt64)
+	if p.started {
+		if p.lastSeen == math.MaxInt64 {
+			p.done = true
+			return nil, nil
+		}
+		low = p.lastSeen + 1
+	}
+
+	it, err := p.engine.ScanRange(p.table, low, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	// 一页只需要 size 行，不必多读一整批
+	it.batchSize = min(it.batchSize, p.size)
+
+	rows := make([]Row, 0, p.size)
+	for len(rows) < p.size && it.Next() {
+		rows = append(rows, it.Row())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	if len(rows) < p.size {
+		p.done = true
+	}
+	if len(rows) > 0 {
+		p.lastSeen = rows[len(rows)-1].Key
+		p.started = true
+	}
+	return rows, nil
+}
+
+// Cursor 返回上一页最后一行的主键，还没有读过任何一行时 ok 为 false
+func (p *Pager) Cursor() (lastSeen int64, ok bool) {
+	return p.lastSeen, p.started
+}
+
+// Resume 把游标设到 lastSeen，下一页从主键大于 lastSeen 的行开始
+func (p *Pager) Resume(lastSeen int64) {
+	p.lastSeen = lastSeen
+	p.started = true
+	p.done = false
+}
+
+// Done 报告是否已经读完所有行
+func (p *Pager) Done() bool {
+	return p.done
+}
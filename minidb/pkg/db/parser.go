@@ -3,40 +3,141 @@ package db
 import (
 	"fmt"
 	"io"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+)
+
+// MaxHistory 每个会话保留的历史语句条数
+const MaxHistory = 100
+
+// SELECT 结果的输出格式，通过 set output_format = ... 切换
+const (
+	OutputPlain = "plain" // 默认，逐行对齐输出
+	OutputTable = "table" // 与 DESCRIBE 相同风格的方框表格
+	OutputJSON  = "json"  // 对象数组，键为列名
 )
 
 // SQLParser 负责解析 SQL 并调用 Engine 执行
 type SQLParser struct {
-	Engine *Engine
-	Output io.Writer // 输出目标（客户端连接）
+	Engine  *Engine
+	Output  io.Writer // 输出目标（客户端连接）
+	history []string  // 本会话最近执行的语句，最多 MaxHistory 条
+
+	outputFormat    string                   // SELECT 结果格式，见 OutputPlain 等
+	result          *ResultSet               // 正在执行的语句的结果，见 run
+	noTiming        bool                     // set timing = off：成功的语句之后不输出耗时
+	continueOnError bool                     // set on_error = continue：一条消息中的语句出错后继续执行后面的语句
+	copy            *copyState               // 进行中的 copy ... from stdin，非 nil 时输入是数据行，见 CopyData
+	prepared        map[string]*preparedStmt // 本连接的预处理语句，按小写的名字，见 prepare.go
+
+	// Debug 为 true 时允许 debug 开头的诊断命令，它们会暴露缓冲池等内部状态
+	Debug bool
 }
 
 func NewSQLParser(engine *Engine, output io.Writer) *SQLParser {
-	return &SQLParser{Engine: engine, Output: output}
+	return &SQLParser{Engine: engine, Output: output, outputFormat: OutputPlain}
 }
 
 var (
 	reShowDB      = regexp.MustCompile(`(?i)^show\s+databases$`)
-	reCreateDB    = regexp.MustCompile(`(?i)^create\s+database\s+(\w+)$`)
+	reCreateDB    = regexp.MustCompile(`(?i)^create\s+database\s+(\w+)(?:\s+page_size\s*=?\s*(\d+))?(?:\s+tablespaces\s*=?\s*(\d+))?(?:\s+with\s*\((.+)\))?$`)
 	reDropDB      = regexp.MustCompile(`(?i)^drop\s+database\s+(\w+)$`)
 	reUseDB       = regexp.MustCompile(`(?i)^use\s+(\w+)$`)
 	reShowTables  = regexp.MustCompile(`(?i)^show\s+tables$`)
-	reCreateTable = regexp.MustCompile(`(?i)^create\s+table\s+(\w+)\s*\((.+)\)$`)
-	reDropTable   = regexp.MustCompile(`(?i)^drop\s+table\s+(\w+)$`)
+	reTableStatus = regexp.MustCompile(`(?i)^show\s+table\s+status$`)
+	reShowTree    = regexp.MustCompile(`(?i)^show\s+tree\s+(\w+)(?:\s+limit\s+(\d+))?(?:\s+offset\s+(\d+))?$`)
+	reCreateIndex = regexp.MustCompile(`(?i)^create\s+index\s+(\w+)\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)$`)
+	reCreateTable = regexp.MustCompile(`(?i)^create\s+(temp(?:orary)?\s+)?table\s+(if\s+not\s+exists\s+)?(\w+)\s*\((.+?)\)(?:\s+tablespace\s*=?\s*(\d+))?(?:\s+with\s*\((.+)\))?$`)
+	reDropTable   = regexp.MustCompile(`(?i)^drop\s+table\s+(if\s+exists\s+)?(\w+)$`)
 	reDescribe    = regexp.MustCompile(`(?i)^describe\s+(\w+)$`)
-	reInsert      = regexp.MustCompile(`(?i)^insert\s+into\s+(\w+)\s+values\s*\((.+)\)$`)
-	reSelect      = regexp.MustCompile(`(?i)^select\s+\*\s+from\s+(\w+)(?:\s+where\s+(.+))?$`)
+	reDelete      = regexp.MustCompile(`(?i)^delete\s+from\s+(\w+)\s+where\s+id\s*=\s*(\S+)$`)
+	reInsert      = regexp.MustCompile(`(?is)^insert\s+into\s+(\w+)\s+values\s*\((.+)\)$`)
+	reSelect      = regexp.MustCompile(`(?i)^select\s+(\*|(?:case\s.+?\send(?:\s+as\s+\w+)?|[\w.]+)(?:\s*,\s*(?:case\s.+?\send(?:\s+as\s+\w+)?|[\w.]+))*)\s+from\s+(\w+(?:\.\w+)?)(?:\s+(?:as\s+)?(\w+))?(?:\s+where\s+(.+?))?(?:\s+order\s+by\s+([\w.]+)(?:\s+(asc|desc))?)?(?:\s+limit\s+(\d+))?$`)
+	reAggregate   = regexp.MustCompile(`(?i)^select\s+(count|min|max|sum|approx_count_distinct)\s*\(\s*(distinct\s+)?(\*|[\w.]+)\s*\)\s+from\s+(\w+)$`)
 	reHelp        = regexp.MustCompile(`(?i)^help$`)
+	reAnalyze     = regexp.MustCompile(`(?i)^analyze\s+(?:table\s+)?(\w+)$`)
+	reExplain     = regexp.MustCompile(`(?is)^explain\s+(.+)$`)
+	reFlushMeta   = regexp.MustCompile(`(?i)^flush\s+metadata$`)
+	reFlushTable  = regexp.MustCompile(`(?i)^flush\s+table\s+(\w+)$`)
+	reDebugBPM    = regexp.MustCompile(`(?i)^debug\s+bufferpool$`)
+	reVacuum      = regexp.MustCompile(`(?i)^vacuum\s+(\w+)$`)
+	reCheckPages  = regexp.MustCompile(`(?i)^check\s+freelist$`)
+	reCheckTable  = regexp.MustCompile(`(?i)^check\s+table\s+(\w+)$`)
+	reCopy        = regexp.MustCompile(`(?i)^copy\s+(?:into\s+)?(\w+)\s+from\s+stdin$`)
+	reHistory     = regexp.MustCompile(`(?i)^history$`)
+	reRecall      = regexp.MustCompile(`^\\g(?:\s+(\d+))?$`)
+	reWarnings    = regexp.MustCompile(`(?i)^show\s+warnings$`)
+	reSetVar      = regexp.MustCompile(`(?i)^set\s+(\w+)\s*=\s*(\w+)$`)
+	reBegin       = regexp.MustCompile(`(?i)^(?:begin|start\s+transaction)$`)
+	reCommit      = regexp.MustCompile(`(?i)^commit$`)
+	reRollback    = regexp.MustCompile(`(?i)^rollback$`)
+	rePrepare     = regexp.MustCompile(`(?is)^prepare\s+(\w+)\s+from\s+(?:'((?:[^']|'')*)'|"((?:[^"]|"")*)")$`)
+	reExecute     = regexp.MustCompile(`(?is)^execute\s+(\w+)(?:\s+using\s+(.+))?$`)
+	reDeallocate  = regexp.MustCompile(`(?i)^(?:deallocate|drop)\s+prepare\s+(\w+)$`)
 )
 
-// ParseAndExecute 解析输入的 SQL 字符串并执行相应逻辑
+// ParseAndExecute 执行一条语句，并按会话的 output_format 把结果输出到 Output
 func (p *SQLParser) ParseAndExecute(sql string) error {
+	rs, err := p.run(sql)
+	p.WriteResult(rs)
+	return err
+}
+
+// Execute 执行一条语句并返回它的结果，不向 Output 输出；输出由调用方负责，见 WriteResult
+func (p *SQLParser) Execute(sql string) (*ResultSet, error) {
+	rs, err := p.run(sql)
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// run 执行一条语句，处理函数写到 Output 的文本收集到结果的 Message 中；出错时也返回已经产生的部分结果
+func (p *SQLParser) run(sql string) (*ResultSet, error) {
+	if p.result != nil {
+		// \g 重新执行历史中的语句，结果属于外层语句
+		return p.result, p.execute(sql)
+	}
+	var msg strings.Builder
+	out := p.Output
+	p.Output, p.result = &msg, &ResultSet{}
+	defer func() { p.Output, p.result = out, nil }()
+	err := p.execute(sql)
+	rs := p.result
+	rs.Message = strings.TrimSuffix(msg.String(), "\n")
+	return rs, err
+}
+
+// execute 解析输入的 SQL 字符串并执行相应逻辑
+func (p *SQLParser) execute(sql string) error {
+	if p.copy != nil {
+		_, err := p.CopyData(sql)
+		return err
+	}
 	sql = strings.TrimSpace(sql)
 	sql = strings.TrimSuffix(sql, ";")
 
+	switch {
+	case reHistory.MatchString(sql):
+		p.printHistory()
+		return nil
+
+	case reRecall.MatchString(sql):
+		matches := reRecall.FindStringSubmatch(sql)
+		return p.handleRecall(matches[1])
+	}
+
+	p.recordHistory(sql)
+
+	// 警告只属于上一条语句，show warnings 本身不清空
+	if reWarnings.MatchString(sql) {
+		return p.handleShowWarnings()
+	}
+	p.Engine.ClearWarnings()
+
 	switch {
 	case reHelp.MatchString(sql):
 		p.printHelp()
@@ -47,11 +148,7 @@ func (p *SQLParser) ParseAndExecute(sql string) error {
 
 	case reCreateDB.MatchString(sql):
 		matches := reCreateDB.FindStringSubmatch(sql)
-		if err := p.Engine.CreateDatabase(matches[1]); err != nil {
-			return err
-		}
-		fmt.Fprintln(p.Output, "Database created.")
-		return nil
+		return p.handleCreateDB(matches[1], matches[2], matches[3], matches[4])
 
 	case reDropDB.MatchString(sql):
 		matches := reDropDB.FindStringSubmatch(sql)
@@ -68,9 +165,122 @@ func (p *SQLParser) ParseAndExecute(sql string) error {
 	case reShowTables.MatchString(sql):
 		return p.handleShowTables()
 
+	case reTableStatus.MatchString(sql):
+		return p.handleTableStatus()
+
+	case reShowTree.MatchString(sql):
+		matches := reShowTree.FindStringSubmatch(sql)
+		return p.handleShowTree(matches[1], matches[2], matches[3])
+
+	case reAnalyze.MatchString(sql):
+		matches := reAnalyze.FindStringSubmatch(sql)
+		return p.handleAnalyze(matches[1])
+
+	case reExplain.MatchString(sql):
+		matches := reExplain.FindStringSubmatch(sql)
+		return p.handleExplain(matches[1])
+
+	case reFlushMeta.MatchString(sql):
+		if err := p.Engine.FlushMetadata(); err != nil {
+			return err
+		}
+		fmt.Fprintln(p.Output, "Metadata flushed.")
+		return nil
+
+	case reBegin.MatchString(sql):
+		if err := p.Engine.Begin(); err != nil {
+			return err
+		}
+		fmt.Fprintln(p.Output, "Transaction started.")
+		return nil
+
+	case reCommit.MatchString(sql):
+		res, err := p.Engine.Commit()
+		if err != nil {
+			return err
+		}
+		p.result.Affected = int64(res.Rows)
+		if res.Rows == 1 {
+			fmt.Fprintln(p.Output, "Commit OK, 1 row written.")
+		} else {
+			fmt.Fprintf(p.Output, "Commit OK, %d rows written.\n", res.Rows)
+		}
+		return nil
+
+	case reRollback.MatchString(sql):
+		n, err := p.Engine.Rollback()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.Output, "Rollback OK, %d buffered changes discarded.\n", n)
+		return nil
+
+	case reFlushTable.MatchString(sql):
+		matches := reFlushTable.FindStringSubmatch(sql)
+		evicted, skipped, err := p.Engine.EvictTable(matches[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.Output, "Evicted %d pages of table '%s' from the buffer pool", evicted, matches[1])
+		if skipped > 0 {
+			fmt.Fprintf(p.Output, " (%d pinned pages skipped)", skipped)
+		}
+		fmt.Fprintln(p.Output)
+		return nil
+
+	case reVacuum.MatchString(sql):
+		matches := reVacuum.FindStringSubmatch(sql)
+		res, err := p.Engine.Vacuum(matches[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.Output, "Vacuumed table '%s': %d pages -> %d pages", matches[1], res.OldPages, res.NewPages)
+		if res.Deferred > 0 {
+			fmt.Fprintf(p.Output, " (%d old pages freed after running queries finish)", res.Deferred)
+		}
+		fmt.Fprintln(p.Output)
+		return nil
+
+	case reCheckPages.MatchString(sql):
+		return p.handleCheckPages()
+
+	case reCheckTable.MatchString(sql):
+		matches := reCheckTable.FindStringSubmatch(sql)
+		return p.handleCheckTable(matches[1])
+
+	case reDebugBPM.MatchString(sql):
+		return p.handleDebugBufferPool()
+
+	case reSetVar.MatchString(sql):
+		matches := reSetVar.FindStringSubmatch(sql)
+		return p.handleSetVar(matches[1], matches[2])
+
+	case rePrepare.MatchString(sql):
+		matches := rePrepare.FindStringSubmatch(sql)
+		if matches[3] != "" {
+			return p.handlePrepare(matches[1], strings.ReplaceAll(matches[3], `""`, `"`))
+		}
+		return p.handlePrepare(matches[1], strings.ReplaceAll(matches[2], "''", "'"))
+
+	case reExecute.MatchString(sql):
+		matches := reExecute.FindStringSubmatch(sql)
+		return p.handleExecute(matches[1], matches[2])
+
+	case reDeallocate.MatchString(sql):
+		matches := reDeallocate.FindStringSubmatch(sql)
+		return p.handleDeallocate(matches[1])
+
+	case reCreateIndex.MatchString(sql):
+		matches := reCreateIndex.FindStringSubmatch(sql)
+		if err := p.Engine.CreateIndex(matches[2], matches[1], matches[3]); err != nil {
+			return err
+		}
+		fmt.Fprintln(p.Output, "Query OK, 0 rows affected.")
+		return nil
+
 	case reCreateTable.MatchString(sql):
 		matches := reCreateTable.FindStringSubmatch(sql)
-		return p.handleCreateTable(matches[1], matches[2])
+		return p.handleCreateTable(matches[3], matches[4], matches[2] != "", matches[1] != "", matches[5], matches[6])
 
 	case reDescribe.MatchString(sql):
 		matches := reDescribe.FindStringSubmatch(sql)
@@ -83,23 +293,45 @@ func (p *SQLParser) ParseAndExecute(sql string) error {
 
 	case reDropTable.MatchString(sql):
 		matches := reDropTable.FindStringSubmatch(sql)
-		return p.handleDropTable(matches[1])
+		return p.handleDropTable(matches[2], matches[1] != "")
+
+	case reCopy.MatchString(sql):
+		matches := reCopy.FindStringSubmatch(sql)
+		return p.handleCopy(matches[1])
+
+	case reDelete.MatchString(sql):
+		matches := reDelete.FindStringSubmatch(sql)
+		return p.handleDelete(matches[1], matches[2])
 
 	case reInsert.MatchString(sql):
 		matches := reInsert.FindStringSubmatch(sql)
 		return p.handleInsert(matches[1], matches[2])
 
+	case reGroupBy.MatchString(sql):
+		matches := reGroupBy.FindStringSubmatch(sql)
+		return p.handleGroupBy(matches[1], matches[2], matches[3], matches[4])
+
+	case reAggregate.MatchString(sql):
+		matches := reAggregate.FindStringSubmatch(sql)
+		return p.handleAggregate(matches[1], matches[3], matches[4], matches[2] != "")
+
 	case reSelect.MatchString(sql):
 		matches := reSelect.FindStringSubmatch(sql)
-		tableName := matches[1]
-		condition := ""
-		if len(matches) > 2 {
-			condition = matches[2]
+		ref, err := p.resolveTableRef(matches[2], matches[3])
+		if err != nil {
+			return err
+		}
+		if IsSystemTable(ref.Name) {
+			return p.handleSystemSelect(ref, matches[1], matches[4], matches[5], matches[6], matches[7])
 		}
-		return p.handleSelect(tableName, condition)
+		order, err := p.parseSelectOrder(ref, matches[5], matches[6], matches[7])
+		if err != nil {
+			return err
+		}
+		return p.handleSelect(ref, matches[1], matches[4], order)
 
 	default:
-		return fmt.Errorf("syntax error or unknown command: %s", sql)
+		return errorf(ErrSyntax, "syntax error or unknown command: %s", sql)
 	}
 }
 
@@ -108,25 +340,278 @@ func (p *SQLParser) ParseAndExecute(sql string) error {
 func (p *SQLParser) printHelp() {
 	fmt.Fprintln(p.Output, "--- MiniDB Help ---")
 	fmt.Fprintln(p.Output, "1.  show databases;")
-	fmt.Fprintln(p.Output, "2.  create database <name>;")
+	fmt.Fprintln(p.Output, "2.  create database <name> [page_size <bytes>] [tablespaces <n>] [with (page_size = <bytes>, tablespaces = <n>, compression = none|flate, durability = async|sync)];  (saved in the database's config.json)")
 	fmt.Fprintln(p.Output, "3.  drop database <name>;")
 	fmt.Fprintln(p.Output, "4.  use <name>;")
 	fmt.Fprintln(p.Output, "5.  show tables;")
-	fmt.Fprintln(p.Output, "6.  create table <name> (<col> <type>, ...);")
+	fmt.Fprintln(p.Output, "6.  create [temporary] table [if not exists] <name> (<col> <type> [primary key] [auto_increment], ...) [tablespace <n>] [with (on_conflict = error|replace|ignore, value_encoding = text|binary, compression = none|flate)];  (temporary: visible to this connection only, dropped when it closes)")
+	fmt.Fprintln(p.Output, "    varchar primary key: create table <name> (<col> varchar, ...);  (keys up to 32 bytes; supports insert, copy, select [where <key col> = '<val>'] [limit <n>], describe, drop)")
+	fmt.Fprintln(p.Output, "    create index <name> on <table>(<col>);  (secondary index on a non-key column of a table with an integer key; used by select ... where <col> = <val>)")
 	fmt.Fprintln(p.Output, "7.  describe <table>;")
-	fmt.Fprintln(p.Output, "8.  insert into <table> values (<id>, <data...>);")
-	fmt.Fprintln(p.Output, "9.  select * from <table> [where id = <val>];")
-	fmt.Fprintln(p.Output, "10. drop table <table>;")
+	fmt.Fprintln(p.Output, "8.  insert into <table> values (<id>|null, <data...>)[, (...)];  (null: next id of an auto_increment key)")
+	fmt.Fprintln(p.Output, "    prepare <name> from '<statement with ? placeholders>';  execute <name> [using <val>, ...];  deallocate prepare <name>  (per connection; a prepared insert skips re-parsing)")
+	fmt.Fprintln(p.Output, "    delete from <table> where id = <n>;")
+	fmt.Fprintln(p.Output, "    copy into <table> from stdin;  then one <id>,<data...> per line, end with \\.  (bulk load, written in batches)")
+	fmt.Fprintln(p.Output, "9.  select {*|<col>|case when <col> <op> <val> then <val> [...] [else <val>] end [as <alias>], ...} from <table> [where id {=|!=|<>|<|<=|>|>=} {<val>|(<scalar subquery>)} | where <col> [not] like '<pattern>' | where value {<op> <val>|[not] like '<pattern>'}] [order by <col> [asc|desc]] [limit <n>];  (_page, _slot: row location; value: the whole stored value, compared as numbers when both sides are numeric)")
+	fmt.Fprintln(p.Output, "    conjunctions: select * from <table> where <cond> and <cond> [and ...];  (one condition on id or an indexed column picks the rows, the others filter them: <col> <op> <val>, <col> is [not] null, <col> [not] like, <col> between; no or)")
+	fmt.Fprintln(p.Output, "    ranges: select * from <table> where id between <low> and <high>;  (both ends inclusive, low > high matches nothing)")
+	fmt.Fprintln(p.Output, "    paging: select * from <table> where id > <last seen id> order by id limit <n>;  (order by id desc limit <n> without where scans backwards)")
+	fmt.Fprintln(p.Output, "    key expressions: where <expr> <op> <expr> using id, integers, + - * / %, abs(), mod()  (id alone vs a constant uses the index; id inside an expression scans the whole table)")
+	fmt.Fprintln(p.Output, "    explain select ...;  (show the access path without running the query)")
+	fmt.Fprintln(p.Output, "    catalog: select * from information_schema.tables | information_schema.columns [where <col> <op> <val>];")
+	fmt.Fprintln(p.Output, "10. drop table [if exists] <table>;")
+	fmt.Fprintln(p.Output, "11. show table status;  show tree <table> [limit <n>] [offset <n>]  (B+ tree nodes level by level: page, type, keys)")
+	fmt.Fprintln(p.Output, "12. analyze <table>;  vacuum <table>  (rebuild the table's tree with full leaves)")
+	fmt.Fprintln(p.Output, "    check freelist;  (pages allocated in the data files vs pages reachable from the tables)")
+	fmt.Fprintln(p.Output, "    check table <table>;  (verify the table's tree: key order, separator ranges, parent pointers, leaf chain)")
+	fmt.Fprintln(p.Output, "13. flush metadata;  flush table <table>  (write back and evict the table's pages from the buffer pool)")
+	fmt.Fprintln(p.Output, "14. history;  \\g [n]  (list / re-run the last or n-th statement)")
+	fmt.Fprintln(p.Output, "15. set output_format = plain|table|json;")
+	fmt.Fprintln(p.Output, "16. show warnings;")
+	fmt.Fprintln(p.Output, "17. set sync_on_commit = on|off;  set durable_writes = on|off  (fsync after every page write, shared by all sessions);  set query_memory = <bytes>  (0: default; sorts spill to disk beyond it);  set timing = on|off  (elapsed time after each statement)")
+	fmt.Fprintln(p.Output, "    several statements in one message: <stmt>; <stmt>; ...  (set on_error = stop|continue)")
+	fmt.Fprintln(p.Output, "18. select count(*)|count(distinct <col>)|approx_count_distinct(<col>)|min(id)|max(id)|sum(id) from <table>;")
+	fmt.Fprintln(p.Output, "19. select <col>, <agg>(<col>|*), ... from <table> group by <col> [having <agg>(...) <op> <n> [and ...]];")
+	fmt.Fprintln(p.Output, "20. begin;  commit;  rollback;  (inserts are buffered until commit, tables written in the transaction cannot be queried before it ends; first committer wins)")
+	if p.Debug {
+		fmt.Fprintln(p.Output, "21. debug bufferpool;  (frame, page, pin count, dirty, LRU position; lru 0 is evicted next)")
+	}
+}
+
+func (p *SQLParser) recordHistory(sql string) {
+	p.history = append(p.history, sql)
+	if len(p.history) > MaxHistory {
+		p.history = p.history[len(p.history)-MaxHistory:]
+	}
+}
+
+func (p *SQLParser) printHistory() {
+	for i, h := range p.history {
+		fmt.Fprintf(p.Output, "%3d  %s\n", i+1, h)
+	}
+}
+
+// handleRecall 重新执行历史中的语句，不指定序号时执行最后一条
+func (p *SQLParser) handleRecall(indexStr string) error {
+	if len(p.history) == 0 {
+		return errorf(ErrInvalidValue, "history is empty")
+	}
+	idx := len(p.history)
+	if indexStr != "" {
+		n, err := strconv.Atoi(indexStr)
+		if err != nil || n < 1 || n > len(p.history) {
+			return errorf(ErrInvalidValue, "no such history entry: %s", indexStr)
+		}
+		idx = n
+	}
+	sql := p.history[idx-1]
+	fmt.Fprintln(p.Output, sql)
+	return p.execute(sql)
+}
+
+// handleDebugBufferPool 列出缓冲池每个 Frame 的状态，用于排查页面为什么被淘汰或一直被 Pin 住
+func (p *SQLParser) handleDebugBufferPool() error {
+	if !p.Debug {
+		return errorf(ErrUnsupported, "debug commands are disabled, start the server with -debug")
+	}
+	if err := p.Engine.EnsureDBSelected(); err != nil {
+		return err
+	}
+	headers := []string{"frame", "page_id", "pin_count", "dirty", "lru"}
+	var rows [][]string
+	for _, f := range p.Engine.BPM.Frames() {
+		row := []string{strconv.Itoa(f.Frame), "-", "-", "-", "-"}
+		if !f.Free {
+			row[1] = strconv.Itoa(int(f.PageID))
+			row[2] = strconv.Itoa(int(f.PinCount))
+			row[3] = strconv.FormatBool(f.Dirty)
+		}
+		if f.LRU >= 0 {
+			row[4] = strconv.Itoa(f.LRU)
+		}
+		rows = append(rows, row)
+	}
+	return p.printCells(headers, rows)
+}
+
+// handleSetVar 设置会话变量
+func (p *SQLParser) handleSetVar(name, value string) error {
+	switch strings.ToLower(name) {
+	case "output_format":
+		return p.handleSetFormat(value)
+	case "sync_on_commit":
+		on, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		p.Engine.SyncOnCommit = on
+		state := "off"
+		if on {
+			state = "on"
+		}
+		fmt.Fprintf(p.Output, "sync_on_commit set to '%s'.\n", state)
+		return nil
+	case "durable_writes":
+		on, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		if err := p.Engine.SetDurableWrites(on); err != nil {
+			return err
+		}
+		state := "off"
+		if on {
+			state = "on"
+		}
+		fmt.Fprintf(p.Output, "durable_writes set to '%s'.\n", state)
+		return nil
+	case "query_memory":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return errorf(ErrInvalidValue, "query_memory must be a non-negative number of bytes")
+		}
+		p.Engine.QueryMemory = n
+		fmt.Fprintf(p.Output, "query_memory set to %d.\n", n)
+		return nil
+	case "timing":
+		on, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		p.noTiming = !on
+		state := "off"
+		if on {
+			state = "on"
+		}
+		fmt.Fprintf(p.Output, "timing set to '%s'.\n", state)
+		return nil
+	case "on_error":
+		switch strings.ToLower(value) {
+		case "stop":
+			p.continueOnError = false
+		case "continue":
+			p.continueOnError = true
+		default:
+			return errorf(ErrInvalidValue, "invalid on_error '%s' (expected stop or continue)", value)
+		}
+		fmt.Fprintf(p.Output, "on_error set to '%s'.\n", strings.ToLower(value))
+		return nil
+	}
+	return errorf(ErrInvalidValue, "unknown session variable '%s'", name)
+}
+
+// parseSwitch 解析 on/off 形式的开关值
+func parseSwitch(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, errorf(ErrInvalidValue, "invalid value '%s' (expected on or off)", value)
+}
+
+func (p *SQLParser) handleSetFormat(format string) error {
+	format = strings.ToLower(format)
+	switch format {
+	case OutputPlain, OutputTable, OutputJSON:
+		p.outputFormat = format
+	default:
+		return errorf(ErrInvalidValue, "unknown output format '%s' (expected plain, table or json)", format)
+	}
+	fmt.Fprintf(p.Output, "Output format set to '%s'.\n", format)
+	return nil
+}
+
+func (p *SQLParser) handleShowWarnings() error {
+	warnings := p.Engine.Warnings()
+	rows := make([][]string, 0, len(warnings))
+	for _, w := range warnings {
+		rows = append(rows, []string{w.Level, w.Message})
+	}
+	p.setTable([]string{"Level", "Message"}, rows)
+	return nil
 }
 
 func (p *SQLParser) handleShowDB() error {
-	dbs, err := p.Engine.ShowDatabases()
+	dbs, err := p.Engine.ListDatabases()
 	if err != nil {
 		return err
 	}
-	fmt.Fprintln(p.Output, "Databases:")
+	rows := make([][]string, 0, len(dbs))
 	for _, d := range dbs {
-		fmt.Fprintln(p.Output, "- "+d)
+		created := ""
+		if !d.CreatedAt.IsZero() {
+			created = d.CreatedAt.Format("2006-01-02 15:04:05")
+		}
+		tablespaces := d.Tablespaces
+		if tablespaces < 1 {
+			tablespaces = 1
+		}
+		rows = append(rows, []string{d.Name, strconv.Itoa(d.PageSize), strconv.Itoa(tablespaces), created})
+	}
+	p.setTable([]string{"Database", "Page_size", "Tablespaces", "Created"}, rows)
+	return nil
+}
+
+func (p *SQLParser) handleCreateDB(name, pageSizeStr, tablespacesStr, withStr string) error {
+	var opts DatabaseOptions
+	if withStr != "" {
+		if err := parseDatabaseOptions(withStr, &opts); err != nil {
+			return err
+		}
+	}
+	if pageSizeStr != "" {
+		size, err := strconv.Atoi(pageSizeStr)
+		if err != nil {
+			return errorf(ErrSyntax, "invalid page size: %v", err)
+		}
+		opts.PageSize = size
+	}
+	if tablespacesStr != "" {
+		n, err := strconv.Atoi(tablespacesStr)
+		if err != nil || n < 1 {
+			return errorf(ErrSyntax, "invalid tablespace count: %s", tablespacesStr)
+		}
+		opts.Tablespaces = n
+	}
+	if err := p.Engine.CreateDatabaseWithOptions(name, opts); err != nil {
+		return err
+	}
+	fmt.Fprintln(p.Output, "Database created.")
+	return nil
+}
+
+// parseDatabaseOptions 解析 create database ... with (name = value, ...) 中的库选项
+func parseDatabaseOptions(withStr string, opts *DatabaseOptions) error {
+	for _, part := range strings.Split(withStr, ",") {
+		name, value, found := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), "'\"")
+		if !found || name == "" || value == "" {
+			return errorf(ErrSyntax, "invalid database option: %s", strings.TrimSpace(part))
+		}
+		var err error
+		switch name {
+		case "page_size":
+			if opts.PageSize, err = strconv.Atoi(value); err != nil {
+				return errorf(ErrSyntax, "invalid page size: %s", value)
+			}
+		case "tablespaces":
+			if opts.Tablespaces, err = strconv.Atoi(value); err != nil || opts.Tablespaces < 1 {
+				return errorf(ErrSyntax, "invalid tablespace count: %s", value)
+			}
+		case "compression":
+			if opts.Compression, err = ParseCompression(value); err != nil {
+				return err
+			}
+		case "durability":
+			if opts.Durability, err = ParseDurability(value); err != nil {
+				return err
+			}
+		default:
+			return errorf(ErrSyntax, "unknown database option '%s'", name)
+		}
 	}
 	return nil
 }
@@ -140,102 +625,860 @@ func (p *SQLParser) handleUseDB(name string) error {
 }
 
 func (p *SQLParser) handleShowTables() error {
-	if err := p.Engine.EnsureDBSelected(); err != nil {
+	tables, err := p.Engine.ShowTables()
+	if err != nil {
 		return err
 	}
-	tables := p.Engine.Catalog.ListTables()
-	fmt.Fprintf(p.Output, "Tables_in_%s:\n", p.Engine.CurrentDB)
+	// 文本输出保持列表的样子，结果集只供 Execute 的调用方读取
+	header := "Tables_in_" + p.Engine.CurrentDB
+	fmt.Fprintf(p.Output, "%s:\n", header)
+	rows := make([][]string, 0, len(tables))
 	for _, t := range tables {
 		fmt.Fprintln(p.Output, "- "+t)
+		rows = append(rows, []string{t})
+	}
+	p.result.Columns, p.result.Rows, p.result.layout = []string{header}, rows, layoutMessage
+	return nil
+}
+
+// ShowTreeLimit 是 show tree 不带 limit 时最多输出的节点数
+const ShowTreeLimit = 100
+
+// handleShowTree 按层输出表的 B+ 树：每个节点一行，按深度缩进，列出页号、类型和 Key
+// 节点多时分页输出，最后一行给出取下一页的语句
+func (p *SQLParser) handleShowTree(tableName, limitStr, offsetStr string) error {
+	limit, offset := ShowTreeLimit, 0
+	if limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 {
+			return errorf(ErrInvalidValue, "invalid limit '%s'", limitStr)
+		}
+		limit = n
+	}
+	if offsetStr != "" {
+		n, err := strconv.Atoi(offsetStr)
+		if err != nil {
+			return errorf(ErrInvalidValue, "invalid offset '%s'", offsetStr)
+		}
+		offset = n
+	}
+	nodes, more, err := p.Engine.TreeNodes(tableName, offset, limit)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		fmt.Fprintf(p.Output, "Table '%s': no nodes to show\n", tableName)
+		return nil
+	}
+	fmt.Fprintf(p.Output, "Table '%s': nodes %d-%d, level by level\n", tableName, offset+1, offset+len(nodes))
+	for _, n := range nodes {
+		kind := "internal"
+		if n.Leaf {
+			kind = "leaf"
+		}
+		keys := make([]string, len(n.Keys))
+		for i, k := range n.Keys {
+			keys[i] = strconv.FormatInt(k, 10)
+		}
+		fmt.Fprintf(p.Output, "%spage %d %s [%s]\n", strings.Repeat("  ", n.Depth), n.PageID, kind, strings.Join(keys, " "))
+	}
+	if more {
+		fmt.Fprintf(p.Output, "... more nodes: show tree %s limit %d offset %d\n", tableName, limit, offset+len(nodes))
+	}
+	return nil
+}
+
+func (p *SQLParser) handleTableStatus() error {
+	statuses, err := p.Engine.TableStatus()
+	if err != nil {
+		return err
+	}
+	headers := []string{"Name", "Rows", "Pages", "Data_size", "Height", "Avg_fill"}
+	rows := make([][]string, 0, len(statuses))
+	for _, s := range statuses {
+		rows = append(rows, []string{
+			s.Name,
+			strconv.FormatInt(s.Rows, 10),
+			strconv.Itoa(s.Pages),
+			strconv.FormatInt(s.DataSize, 10),
+			strconv.Itoa(s.Height),
+			fmt.Sprintf("%.1f%%", s.AvgFill*100),
+		})
+	}
+	p.setTable(headers, rows)
+	return nil
+}
+
+func (p *SQLParser) handleAnalyze(tableName string) error {
+	stats, err := p.Engine.Analyze(tableName)
+	if err != nil {
+		return err
+	}
+	headers := []string{"Bucket", "Upper_key", "Rows"}
+	rows := make([][]string, 0, len(stats.Buckets))
+	for i, b := range stats.Buckets {
+		rows = append(rows, []string{strconv.Itoa(i), strconv.FormatInt(b.UpperKey, 10), strconv.FormatInt(b.Rows, 10)})
 	}
+	fmt.Fprintf(p.Output, "Table '%s': %d rows, key range [%d, %d]\n", tableName, stats.RowCount, stats.MinKey, stats.MaxKey)
+	fmt.Fprintf(p.Output, "B+ tree: height %d, %d leaf pages, %d internal pages, %d keys\n",
+		stats.Tree.Height, stats.Tree.LeafPages, stats.Tree.InternalPages, stats.Tree.KeyCount)
+	p.setTable(headers, rows)
 	return nil
 }
 
-func (p *SQLParser) handleCreateTable(tableName, colsDef string) error {
-	if err := p.Engine.CreateTable(tableName, colsDef); err != nil {
+func (p *SQLParser) handleCreateTable(tableName, colsDef string, ifNotExists, temporary bool, tablespaceStr, withStr string) error {
+	columns, err := ParseSchema(colsDef)
+	if err != nil {
+		return err
+	}
+	opts := TableOptions{IfNotExists: ifNotExists, Temporary: temporary}
+	if tablespaceStr != "" {
+		if opts.Tablespace, err = strconv.Atoi(tablespaceStr); err != nil {
+			return errorf(ErrSyntax, "invalid tablespace: %s", tablespaceStr)
+		}
+	}
+	if withStr != "" {
+		if err := parseWithOptions(withStr, &opts); err != nil {
+			return err
+		}
+	}
+	if err := p.Engine.CreateTableSchema(tableName, columns, opts); err != nil {
 		return err
 	}
 	fmt.Fprintln(p.Output, "Query OK, 0 rows affected.")
 	return nil
 }
 
-func (p *SQLParser) handleDropTable(tableName string) error {
-	if err := p.Engine.EnsureDBSelected(); err != nil {
+// parseWithOptions 解析 create table ... with (name = 'value', ...) 中的表选项
+func parseWithOptions(withStr string, opts *TableOptions) error {
+	for _, part := range strings.Split(withStr, ",") {
+		name, value, found := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), "'\"")
+		if !found || name == "" || value == "" {
+			return errorf(ErrSyntax, "invalid table option: %s", strings.TrimSpace(part))
+		}
+		switch name {
+		case "on_conflict":
+			policy, err := ParseConflictPolicy(value)
+			if err != nil {
+				return err
+			}
+			opts.OnConflict = policy
+		case "value_encoding":
+			enc, err := ParseValueEncoding(value)
+			if err != nil {
+				return err
+			}
+			opts.Encoding = enc
+		case "compression":
+			c, err := ParseCompression(value)
+			if err != nil {
+				return err
+			}
+			opts.Compression = c
+		default:
+			return errorf(ErrSyntax, "unknown table option '%s'", name)
+		}
+	}
+	return nil
+}
+
+func (p *SQLParser) handleDropTable(tableName string, ifExists bool) error {
+	if ifExists {
+		exists, err := p.Engine.TableExists(tableName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			fmt.Fprintln(p.Output, "Query OK, 0 rows affected.")
+			return nil
+		}
+	}
+	if err := p.Engine.DropTable(tableName); err != nil {
 		return err
 	}
-	p.Engine.Catalog.DropTable(tableName)
 	fmt.Fprintln(p.Output, "Query OK, 0 rows affected.")
 	return nil
 }
 
+// reTupleSep 分隔多行 VALUES 中相邻的元组，例如 (1, 'a'), (2, 'b')
+var reTupleSep = regexp.MustCompile(`\)\s*,\s*\(`)
+
 func (p *SQLParser) handleInsert(tableName, valuesStr string) error {
-	parts := strings.Split(valuesStr, ",")
-	if len(parts) < 1 {
-		return fmt.Errorf("insert values cannot be empty")
+	return p.insertTuples(tableName, reTupleSep.Split(valuesStr, -1))
+}
+
+// insertTuples 插入多个 VALUES 元组（不带括号），全有或全无
+func (p *SQLParser) insertTuples(tableName string, tuples []string) error {
+	var rows []Row
+	strKey := p.Engine.hasStringKey(tableName)
+	for _, tuple := range tuples {
+		if strKey {
+			row, err := parseStrInsertTuple(tuple)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+			continue
+		}
+		row, auto, err := parseInsertTuple(tuple)
+		if err != nil {
+			return err
+		}
+		if auto {
+			if row.Key, err = p.Engine.NextAutoId(tableName); err != nil {
+				return err
+			}
+		}
+		rows = append(rows, row)
 	}
 
-	keyStr := strings.TrimSpace(parts[0])
+	affected, err := p.Engine.InsertRows(tableName, rows)
+	if err != nil {
+		return err
+	}
+	p.result.Affected = int64(affected)
+	msg := "Query OK, 1 row affected"
+	if affected != 1 {
+		msg = fmt.Sprintf("Query OK, %d rows affected", affected)
+	}
+	switch n := len(p.Engine.Warnings()); n {
+	case 0:
+	case 1:
+		msg += ", 1 warning"
+	default:
+		msg += fmt.Sprintf(", %d warnings", n)
+	}
+	fmt.Fprintln(p.Output, msg+".")
+	return nil
+}
+
+func (p *SQLParser) handleDelete(tableName, keyStr string) error {
 	key, err := strconv.ParseInt(keyStr, 10, 64)
 	if err != nil {
-		return fmt.Errorf("primary key (first value) must be an integer: %v", err)
+		return errorf(ErrInvalidValue, "id must be integer")
+	}
+	deleted, err := p.Engine.Delete(tableName, key)
+	if err != nil {
+		return err
 	}
+	if deleted {
+		p.result.Affected = 1
+		fmt.Fprintln(p.Output, "Query OK, 1 row affected.")
+	} else {
+		fmt.Fprintln(p.Output, "Query OK, 0 rows affected.")
+	}
+	return nil
+}
 
+// parseInsertTuple 解析一个 VALUES 元组（不含括号），第一个值为主键
+// 主键写成 null 或 default 时 auto 为 true，由调用方分配自增主键
+func parseInsertTuple(valuesStr string) (row Row, auto bool, err error) {
+	parts := strings.Split(valuesStr, ",")
+
+	keyStr := strings.TrimSpace(parts[0])
+	var key int64
+	switch strings.ToLower(keyStr) {
+	case "null", "default":
+		auto = true
+	default:
+		if key, err = strconv.ParseInt(keyStr, 10, 64); err != nil {
+			return Row{}, false, errorf(ErrInvalidValue, "primary key (first value) must be an integer: %v", err)
+		}
+	}
+
+	return Row{Key: key, Value: joinInsertValues(parts[1:])}, auto, nil
+}
+
+// joinInsertValues 去掉主键以外各个值的引号，拼接成存储的值；只有主键时用一个空格占位
+func joinInsertValues(parts []string) string {
 	var valParts []string
-	for _, v := range parts[1:] {
+	for _, v := range parts {
 		cleanVal := strings.Trim(strings.TrimSpace(v), "'\"")
 		valParts = append(valParts, cleanVal)
 	}
-	valStr := strings.Join(valParts, ",")
 	if len(valParts) == 0 {
-		valStr = " "
+		return " "
 	}
+	return strings.Join(valParts, ",")
+}
+
+// tableRef 是 FROM 子句中的表引用，Alias 为空表示没有别名
+type tableRef struct {
+	Name  string
+	Alias string
+}
 
-	if err := p.Engine.Insert(tableName, int64(key), valStr); err != nil {
+// resolveTableRef 校验别名：别名不能与库中其他真实表重名
+func (p *SQLParser) resolveTableRef(name, alias string) (tableRef, error) {
+	if alias != "" {
+		if err := checkIdentifier("table alias", alias); err != nil {
+			return tableRef{}, err
+		}
+	}
+	if alias != "" && !strings.EqualFold(alias, name) {
+		exists, err := p.Engine.TableExists(alias)
+		if err != nil {
+			return tableRef{}, err
+		}
+		if exists {
+			return tableRef{}, errorf(ErrSyntax, "alias '%s' conflicts with an existing table", alias)
+		}
+	}
+	return tableRef{Name: name, Alias: alias}, nil
+}
+
+// resolveColumn 把 u.id / users.id / id 这类列引用解析为列名
+func (r tableRef) resolveColumn(ref string) (string, error) {
+	qualifier, col, ok := strings.Cut(ref, ".")
+	if !ok {
+		return ref, nil
+	}
+	// 有别名时只能用别名限定，和 SQL 标准一致
+	if (r.Alias == "" && strings.EqualFold(qualifier, r.Name)) || (r.Alias != "" && strings.EqualFold(qualifier, r.Alias)) {
+		return col, nil
+	}
+	return "", errorf(ErrColumnNotFound, "unknown table '%s' in column reference '%s'", qualifier, ref)
+}
+
+// reWhere 匹配 WHERE 中的单个比较条件：列、运算符、值
+var reWhere = regexp.MustCompile(`(?i)^([\w.]+)\s*(!=|<>|<=|>=|=|<|>)\s*(.+)$`)
+
+// reBetween 匹配 WHERE 中的 <列> between <下界> and <上界>
+var reBetween = regexp.MustCompile(`(?i)^([\w.]+)\s+between\s+(\S+)\s+and\s+(\S+)$`)
+
+// selectOrder 是 SELECT 的 ORDER BY / LIMIT
+type selectOrder struct {
+	Column string // 排序列，空表示按主键升序（行本来的顺序）
+	Desc   bool
+	Limit  int // 最多输出的行数，-1 表示不限
+
+	// Reverse 表示 order by <主键> desc：没有 WHERE 时反向扫描主键，取够 Limit 行就停止，不需要排序
+	Reverse bool
+}
+
+// parseSelectOrder 解析 ORDER BY / LIMIT
+// 行本来就按主键升序产生，order by id [asc] 不需要排序，
+// 配合 where id > :last_seen 就是键集分页，扫描在取够 limit 行后立即停止；
+// order by id desc 没有 WHERE 时反向扫描，同样取够 limit 行就停止；
+// 其他排序先取出全部结果再做外部排序，见 Engine.sortRows
+func (p *SQLParser) parseSelectOrder(ref tableRef, orderCol, dir, limit string) (selectOrder, error) {
+	order := selectOrder{Limit: -1}
+	if orderCol != "" {
+		name, err := ref.resolveColumn(orderCol)
+		if err != nil {
+			return order, err
+		}
+		columns, idx, err := p.Engine.lookupColumn(ref.Name, name)
+		if err != nil {
+			return order, err
+		}
+		order.Desc = strings.EqualFold(dir, "desc")
+		if idx != 0 || order.Desc {
+			order.Column = columns[idx].Name
+		}
+		order.Reverse = idx == 0 && order.Desc
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return order, errorf(ErrInvalidValue, "invalid limit '%s'", limit)
+		}
+		order.Limit = n
+	}
+	return order, nil
+}
+
+func (p *SQLParser) handleSelect(ref tableRef, columns, condition string, order selectOrder) error {
+	rows, err := p.querySelect(ref, condition, order)
+	if err != nil {
 		return err
 	}
-	fmt.Fprintln(p.Output, "Query OK, 1 row affected.")
-	return nil
+	headers, cells, err := p.projectRows(ref, columns, rows)
+	if err != nil {
+		return err
+	}
+	return p.printCells(headers, cells)
 }
 
-func (p *SQLParser) handleSelect(tableName, condition string) error {
-	if condition == "" {
-		rows, err := p.Engine.SelectAll(tableName)
+// querySelect 执行 select * 并按 order 排序、截断
+// 没有 WHERE 时边扫描边送进排序，内存中只保留 QueryMemory 以内的行
+func (p *SQLParser) querySelect(ref tableRef, condition string, order selectOrder) ([]Row, error) {
+	if order.Column == "" {
+		return p.runSelect(ref, condition, order.Limit)
+	}
+	if p.Engine.hasStringKey(ref.Name) {
+		return nil, errorf(ErrUnsupported, "order by on table '%s' with a varchar primary key is not supported", ref.Name)
+	}
+	if order.Reverse && condition == "" {
+		return p.scanRowsDesc(ref.Name, order.Limit)
+	}
+	return p.Engine.sortRows(ref.Name, order.Column, order.Desc, order.Limit, func(add func(Row) error) error {
+		if condition != "" {
+			rows, err := p.runSelect(ref, condition, -1)
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				if err := add(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		it, err := p.Engine.ScanRange(ref.Name, math.MinInt64, math.MaxInt64)
 		if err != nil {
 			return err
 		}
+		defer it.Close()
+		for it.Next() {
+			if err := add(it.Row()); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	})
+}
 
-		fmt.Fprintf(p.Output, "--- %s ---\n", tableName)
-		for _, r := range rows {
-			fmt.Fprintln(p.Output, r)
+// runSelect 执行 select * 并返回结果行，limit >= 0 时最多返回 limit 行
+func (p *SQLParser) runSelect(ref tableRef, condition string, limit int) ([]Row, error) {
+	tableName := ref.Name
+	if p.Engine.hasStringKey(tableName) {
+		return p.runStrSelect(ref, condition, limit)
+	}
+	if condition == "" {
+		return p.scanRows(tableName, nil, math.MinInt64, math.MaxInt64, limit)
+	}
+	if conds := splitConjuncts(condition); len(conds) > 1 {
+		return p.runConjunction(ref, conds, limit)
+	}
+
+	if m := reLike.FindStringSubmatch(strings.TrimSpace(condition)); m != nil {
+		if p.isValueColumn(ref, m[1]) {
+			op := "like"
+			if m[2] != "" {
+				op = "not like"
+			}
+			return p.runValueFilter(ref, op, m[3], limit)
 		}
-		fmt.Fprintf(p.Output, "(%d rows)\n", len(rows))
-		return nil
+		rows, err := p.runLike(ref, m[1], m[2] != "", m[3])
+		if limit >= 0 && len(rows) > limit {
+			rows = rows[:limit]
+		}
+		return rows, err
+	}
+
+	if ranges, ok, err := parseBetween(ref, condition); ok || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return p.scanKeyRanges(tableName, ranges, limit)
+	}
+
+	// 主键上的算术比较：主键列本身和常量比较时走索引，被表达式包住时全表扫描逐行求值
+	if pred := p.parseKeyPredicate(ref, condition); pred != nil {
+		if !pred.sargable() {
+			return p.runKeyFilter(ref, pred, limit)
+		}
+		op, key, ok := pred.bound()
+		if !ok {
+			return nil, nil
+		}
+		return p.scanKeyRanges(tableName, keyRanges(op, key), limit)
 	}
 
-	reWhere := regexp.MustCompile(`(?i)(\w+)\s*=\s*(.+)`)
-	matches := reWhere.FindStringSubmatch(condition)
-	if len(matches) < 3 {
-		return fmt.Errorf("unsupported where clause")
+	matches := reWhere.FindStringSubmatch(strings.TrimSpace(condition))
+	if len(matches) < 4 {
+		return nil, errorf(ErrSyntax, "unsupported where clause")
 	}
 
-	colName := matches[1]
-	valStr := strings.TrimSpace(matches[2])
+	colName, err := ref.resolveColumn(matches[1])
+	if err != nil {
+		return nil, err
+	}
+	op := matches[2]
+	valStr := strings.TrimSpace(matches[3])
 
-	if strings.ToLower(colName) == "id" {
-		key, err := strconv.ParseInt(valStr, 10, 64)
+	if p.isValueColumn(ref, colName) {
+		return p.runValueFilter(ref, op, valStr, limit)
+	}
+	if indexName, literal, isNull, ok := p.indexedEquality(ref, colName, op, valStr); ok {
+		if isNull {
+			return nil, nil
+		}
+		return p.Engine.lookupIndex(tableName, indexName, literal, limit)
+	}
+	if strings.ToLower(colName) != "id" {
+		return nil, errorf(ErrUnsupported, "currently only supports filtering by ID or by '=' on an indexed column")
+	}
+
+	// 标量子查询：先求出内层的值，再代入外层条件
+	if strings.HasPrefix(valStr, "(") && strings.HasSuffix(valStr, ")") {
+		val, isNull, err := p.evalScalar(strings.TrimSpace(valStr[1 : len(valStr)-1]))
 		if err != nil {
-			return fmt.Errorf("id must be integer")
+			return nil, err
 		}
-		val, found := p.Engine.SelectById(tableName, key)
-		if !found {
-			fmt.Fprintln(p.Output, "Empty set.")
-		} else {
-			fmt.Fprintf(p.Output, "--- %s ---\n", tableName)
-			fmt.Fprintf(p.Output, "[%d] %s\n", key, val)
-			fmt.Fprintln(p.Output, "(1 row)")
+		if isNull {
+			// 与 NULL 比较的结果是未知，不匹配任何行
+			return nil, nil
 		}
-		return nil
+		valStr = val
+	}
+
+	key, err := strconv.ParseInt(valStr, 10, 64)
+	if err != nil {
+		return nil, errorf(ErrInvalidValue, "id must be integer")
+	}
+
+	return p.scanKeyRanges(tableName, keyRanges(op, key), limit)
+}
+
+// keyRange 是主键上的闭区间 [low, high]
+type keyRange struct {
+	low, high int64
+}
+
+// keyRanges 把 id <op> key 转换成要扫描的主键区间，条件不可能成立时返回空
+// = 也走单点范围扫描而不是 SelectById，这样结果行带有 RID
+func keyRanges(op string, key int64) []keyRange {
+	switch op {
+	case "=":
+		return []keyRange{{key, key}}
+	case "!=", "<>":
+		// 拆成 [min, key-1] 和 [key+1, max] 两段，注意 key 在边界上时不能溢出
+		var ranges []keyRange
+		if key > math.MinInt64 {
+			ranges = append(ranges, keyRange{math.MinInt64, key - 1})
+		}
+		if key < math.MaxInt64 {
+			ranges = append(ranges, keyRange{key + 1, math.MaxInt64})
+		}
+		return ranges
+	case ">":
+		if key == math.MaxInt64 {
+			return nil
+		}
+		return []keyRange{{key + 1, math.MaxInt64}}
+	case ">=":
+		return []keyRange{{key, math.MaxInt64}}
+	case "<":
+		if key == math.MinInt64 {
+			return nil
+		}
+		return []keyRange{{math.MinInt64, key - 1}}
+	case "<=":
+		return []keyRange{{math.MinInt64, key}}
+	}
+	return nil
+}
+
+// parseBetween 把 id between low and high 转换成主键区间，两端都包含；low > high 时区间为空，不是错误
+// 条件不是 between 时 ok 为 false
+func parseBetween(ref tableRef, condition string) (ranges []keyRange, ok bool, err error) {
+	m := reBetween.FindStringSubmatch(strings.TrimSpace(condition))
+	if m == nil {
+		return nil, false, nil
+	}
+	colName, err := ref.resolveColumn(m[1])
+	if err != nil {
+		return nil, true, err
+	}
+	if strings.ToLower(colName) != "id" {
+		return nil, true, errorf(ErrUnsupported, "between currently only supports the id column")
+	}
+	low, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return nil, true, errorf(ErrInvalidValue, "id must be integer")
+	}
+	high, err := strconv.ParseInt(m[3], 10, 64)
+	if err != nil {
+		return nil, true, errorf(ErrInvalidValue, "id must be integer")
+	}
+	if low > high {
+		return nil, true, nil
+	}
+	return []keyRange{{low, high}}, true, nil
+}
+
+// scanKeyRanges 依次扫描各个主键区间，limit >= 0 时最多返回 limit 行
+func (p *SQLParser) scanKeyRanges(tableName string, ranges []keyRange, limit int) ([]Row, error) {
+	var rows []Row
+	for _, r := range ranges {
+		var err error
+		if rows, err = p.scanRows(tableName, rows, r.low, r.high, limit); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// evalScalar 执行标量子查询，结果必须是至多一行一列；没有行时返回 NULL
+func (p *SQLParser) evalScalar(sql string) (value string, isNull bool, err error) {
+	if matches := reAggregate.FindStringSubmatch(sql); matches != nil {
+		return p.runAggregate(matches[1], matches[3], matches[4], matches[2] != "")
+	}
+
+	matches := reSelect.FindStringSubmatch(sql)
+	if matches == nil {
+		return "", false, errorf(ErrUnsupported, "unsupported subquery: %s", sql)
 	}
+	ref, err := p.resolveTableRef(matches[2], matches[3])
+	if err != nil {
+		return "", false, err
+	}
+	order, err := p.parseSelectOrder(ref, matches[5], matches[6], matches[7])
+	if err != nil {
+		return "", false, err
+	}
+	rows, err := p.querySelect(ref, matches[4], order)
+	if err != nil {
+		return "", false, err
+	}
+	headers, cells, err := p.projectRows(ref, matches[1], rows)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case len(headers) != 1:
+		return "", false, errorf(ErrSubquery, "subquery must return exactly one column, got %d", len(headers))
+	case len(cells) == 0:
+		return "", true, nil
+	case len(cells) > 1:
+		return "", false, errorf(ErrSubquery, "subquery returns more than one row")
+	}
+	return cells[0][0], false, nil
+}
+
+func (p *SQLParser) handleAggregate(fn, col, tableName string, distinct bool) error {
+	val, isNull, err := p.runAggregate(fn, col, tableName, distinct)
+	if err != nil {
+		return err
+	}
+	if isNull {
+		val = "NULL"
+	}
+	if distinct {
+		col = "distinct " + col
+	}
+	header := fmt.Sprintf("%s(%s)", strings.ToLower(fn), col)
+	return p.printCells([]string{header}, [][]string{{val}})
+}
+
+// runAggregate 计算 fn(col)，目前只支持主键列、count(*)、count(distinct col) 和 approx_count_distinct(col)
+func (p *SQLParser) runAggregate(fn, col, tableName string, distinct bool) (value string, isNull bool, err error) {
+	ref := tableRef{Name: tableName}
+	var name string
+	if col != "*" {
+		if name, err = ref.resolveColumn(col); err != nil {
+			return "", false, err
+		}
+	}
+
+	if strings.ToLower(fn) == "approx_count_distinct" {
+		switch {
+		case col == "*":
+			return "", false, errorf(ErrSyntax, "%s(*) is not valid", fn)
+		case distinct:
+			return "", false, errorf(ErrSyntax, "%s(distinct ...) is not valid", fn)
+		}
+		n, err := p.Engine.ApproxCountDistinct(tableName, name)
+		if err != nil {
+			return "", false, err
+		}
+		return strconv.FormatInt(n, 10), false, nil
+	}
+
+	if distinct {
+		switch {
+		case col == "*":
+			return "", false, errorf(ErrSyntax, "%s(distinct *) is not valid", fn)
+		case strings.ToLower(fn) != "count":
+			return "", false, errorf(ErrUnsupported, "%s(distinct ...) is not supported", fn)
+		}
+		n, err := p.Engine.CountDistinct(tableName, name)
+		if err != nil {
+			return "", false, err
+		}
+		return strconv.FormatInt(n, 10), false, nil
+	}
+
+	if col != "*" {
+		if strings.ToLower(name) != "id" {
+			return "", false, errorf(ErrUnsupported, "aggregates currently only support the id column")
+		}
+	} else if strings.ToLower(fn) != "count" {
+		return "", false, errorf(ErrUnsupported, "%s(*) is not supported", fn)
+	}
+
+	result, valid, err := p.Engine.AggregateKey(tableName, fn)
+	if err != nil {
+		return "", false, err
+	}
+	if !valid {
+		return "", true, nil
+	}
+	return strconv.FormatInt(result, 10), false, nil
+}
+
+// scanRows 把 [low, high] 范围内的行追加到 rows 后返回，limit >= 0 时 rows 达到 limit 行就停止扫描
+func (p *SQLParser) scanRows(tableName string, rows []Row, low, high int64, limit int) ([]Row, error) {
+	it, err := p.Engine.ScanRange(tableName, low, high)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	for (limit < 0 || len(rows) < limit) && it.Next() {
+		rows = append(rows, it.Row())
+	}
+	return rows, it.Err()
+}
+
+// scanRowsDesc 按主键从大到小读取整张表，limit >= 0 时最多读取 limit 行
+func (p *SQLParser) scanRowsDesc(tableName string, limit int) ([]Row, error) {
+	it, err := p.Engine.ScanRangeDesc(tableName, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var rows []Row
+	for (limit < 0 || len(rows) < limit) && it.Next() {
+		rows = append(rows, it.Row())
+	}
+	return rows, it.Err()
+}
+
+// 伪列：行的物理位置，不属于表结构，只能显式选择
+const (
+	pseudoColPage = "_page"
+	pseudoColSlot = "_slot"
+)
+
+// projectRows 把结果行转换成输出用的表头和单元格
+// columns 为 "*" 时输出表结构中的所有列，否则按逗号分隔的列名（可带表名/别名限定）选择
+func (p *SQLParser) projectRows(ref tableRef, columns string, rows []Row) ([]string, [][]string, error) {
+	schemaCols, err := p.Engine.TableColumns(ref.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		all = append(all, r.Cells())
+	}
+	// 存量数据的列数可能多于表结构声明的列
+	for _, c := range all {
+		for len(schemaCols) < len(c) {
+			schemaCols = append(schemaCols, fmt.Sprintf("col%d", len(schemaCols)+1))
+		}
+	}
+	if strings.TrimSpace(columns) == "*" {
+		return schemaCols, all, nil
+	}
+
+	// 每个输出列对应 schemaCols 中的下标，伪列用负数表示，CASE 表达式见 cases
+	const pageIdx, slotIdx, caseIdx = -1, -2, -4
+	var headers []string
+	var indexes []int
+	cases := make(map[int]*caseExpr)
+	for _, raw := range splitSelectList(columns) {
+		raw = strings.TrimSpace(raw)
+		if reCaseItem.MatchString(raw) {
+			expr, err := p.parseCase(ref, raw)
+			if err != nil {
+				return nil, nil, err
+			}
+			cases[len(indexes)] = expr
+			headers = append(headers, expr.header())
+			indexes = append(indexes, caseIdx)
+			continue
+		}
+		name, err := ref.resolveColumn(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		idx := -3
+		switch strings.ToLower(name) {
+		case pseudoColPage:
+			idx = pageIdx
+		case pseudoColSlot:
+			idx = slotIdx
+		default:
+			for i, c := range schemaCols {
+				if strings.EqualFold(c, name) {
+					idx = i
+					break
+				}
+			}
+		}
+		if idx == -3 {
+			return nil, nil, errorf(ErrColumnNotFound, "unknown column '%s' in table '%s'", name, ref.Name)
+		}
+		headers = append(headers, name)
+		indexes = append(indexes, idx)
+	}
+
+	cells := make([][]string, 0, len(rows))
+	for i, r := range rows {
+		out := make([]string, len(indexes))
+		for j, idx := range indexes {
+			switch {
+			case idx == pageIdx:
+				out[j] = strconv.FormatInt(int64(r.RID.Page), 10)
+			case idx == slotIdx:
+				out[j] = strconv.FormatInt(int64(r.RID.Slot), 10)
+			case idx == caseIdx:
+				val, ok := cases[j].eval(all[i])
+				if !ok {
+					val = "NULL"
+				}
+				out[j] = val
+			case idx < len(all[i]):
+				out[j] = all[i][idx]
+			}
+		}
+		cells = append(cells, out)
+	}
+	return headers, cells, nil
+}
+
+// ReportError 按会话的 output_format 输出执行失败的错误
+// JSON 模式下输出 {"error": ..., "code": ...}，其余模式只输出给人看的描述
+func (p *SQLParser) ReportError(err error) {
+	if p.outputFormat == OutputJSON {
+		fmt.Fprintln(p.Output, formatJSONError(err))
+		return
+	}
+	fmt.Fprintf(p.Output, "Error: %v\n", err)
+}
+
+// StopOnError 报告一条消息中的语句出错后是否应当跳过后面的语句，见 set on_error
+func (p *SQLParser) StopOnError() bool {
+	return !p.continueOnError
+}
+
+// ReportSuccess 在语句执行成功后输出耗时，set timing = off 时什么都不输出
+// JSON 模式下输出 {"elapsed_sec": ...}，其余模式输出 (0.0023 sec)
+func (p *SQLParser) ReportSuccess(elapsed time.Duration) {
+	if p.noTiming {
+		return
+	}
+	if p.outputFormat == OutputJSON {
+		fmt.Fprintln(p.Output, formatJSONTiming(elapsed))
+		return
+	}
+	fmt.Fprintf(p.Output, "(%.4f sec)\n", elapsed.Seconds())
+}
+
+// printCells 把结果集记入当前语句的结果，由 WriteResult 按会话的 output_format 输出
+func (p *SQLParser) printCells(headers []string, rows [][]string) error {
+	p.result.Columns, p.result.Rows, p.result.layout = headers, rows, layoutFormat
+	return nil
+}
 
-	return fmt.Errorf("currently only supports filtering by ID")
+// setTable 与 printCells 相同，但结果集总是按表格输出，不受 output_format 影响
+func (p *SQLParser) setTable(headers []string, rows [][]string) {
+	p.result.Columns, p.result.Rows, p.result.layout = headers, rows, layoutTable
 }
@@ -0,0 +1,1369 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"minidb/pkg/storage/page"
+)
+
+// queryKeys 以 JSON 格式执行 SELECT，返回结果中的主键
+func queryKeys(t *testing.T, p *SQLParser, sql string) []int64 {
+	t.Helper()
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := p.ParseAndExecute(sql); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+
+	var rows []map[string]string
+	if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+		t.Fatalf("%s: bad JSON output %q: %v", sql, out.String(), err)
+	}
+	keys := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		k, _ := strconv.ParseInt(r["id"], 10, 64)
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestSelectNotEqual(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 100; i++ {
+		if err := e.Insert("t", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+
+	for _, sql := range []string{
+		"select * from t where id != 50",
+		"select * from t where id <> 50",
+		"select * from t where id<>50",
+	} {
+		keys := queryKeys(t, p, sql)
+		if len(keys) != 99 {
+			t.Fatalf("%s: got %d rows, want 99", sql, len(keys))
+		}
+		for i, k := range keys {
+			want := int64(i + 1)
+			if want >= 50 {
+				want++
+			}
+			if k != want {
+				t.Fatalf("%s: row %d has key %d, want %d", sql, i, k, want)
+			}
+		}
+	}
+
+	// 不存在的 Key 返回全部行，边界值也不能溢出
+	for _, sql := range []string{
+		"select * from t where id != 1000",
+		"select * from t where id != -9223372036854775808",
+		"select * from t where id != 9223372036854775807",
+	} {
+		if keys := queryKeys(t, p, sql); len(keys) != 100 {
+			t.Errorf("%s: got %d rows, want 100", sql, len(keys))
+		}
+	}
+
+	if keys := queryKeys(t, p, "select * from t where id = 7"); len(keys) != 1 || keys[0] != 7 {
+		t.Errorf("id = 7 returned %v", keys)
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{
+		"create table users (id int, name varchar, age int)",
+		"insert into users values (1, 'alice', 30), (2, 'bob')",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	rows, err := p.querySelect(tableRef{Name: "users"}, "", selectOrder{Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按列名取出存储值中对应的字段，顺序以 select 列表为准，缺失的列为空
+	headers, cells, err := p.projectRows(tableRef{Name: "users"}, "age, name", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(headers, cells); got != "[age name] [[30 alice] [ bob]]" {
+		t.Errorf("select age, name = %s", got)
+	}
+	if headers, _, _ := p.projectRows(tableRef{Name: "users"}, "*", rows); fmt.Sprint(headers) != "[id name age]" {
+		t.Errorf("select * headers = %v", headers)
+	}
+	if err := p.ParseAndExecute("select name, nope from users"); !errors.Is(err, ErrColumnNotFound) {
+		t.Errorf("unknown column: got %v, want ErrColumnNotFound", err)
+	}
+}
+
+func TestSelectBetween(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 300; i++ {
+		if err := e.Insert("t", i*2, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, io.Discard)
+	for _, tc := range []struct {
+		sql  string
+		want string
+	}{
+		{"select * from t where id between 10 and 16", "[10 12 14 16]"}, // 两端都包含
+		{"SELECT * FROM t WHERE id BETWEEN 11 AND 15", "[12 14]"},
+		{"select * from t where id between -5 and 3", "[2]"},
+		{"select * from t where id between 599 and 1000", "[600]"},
+		{"select * from t where id between 16 and 10", "[]"}, // 下界大于上界是空结果
+		{"select * from t where id between 7 and 7", "[]"},
+	} {
+		if keys := queryKeys(t, p, tc.sql); fmt.Sprint(keys) != tc.want {
+			t.Errorf("%s: got %v, want %s", tc.sql, keys, tc.want)
+		}
+	}
+	p.ParseAndExecute("set output_format = plain")
+	if err := p.ParseAndExecute("select * from t where id between a and 5"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("non-integer bound: got %v, want ErrInvalidValue", err)
+	}
+
+	rows, err := e.SelectRange("t", 100, 104)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rows, ","); got != "[100] v,[102] v,[104] v" {
+		t.Errorf("SelectRange = %q", got)
+	}
+	if rows, err := e.SelectRange("t", 104, 100); err != nil || len(rows) != 0 {
+		t.Errorf("SelectRange with low > high = %v, %v", rows, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	// 足够多的行，删除时会发生合并和借位，树高也会降低
+	const n = 400
+	for i := int64(1); i <= n; i++ {
+		if err := e.Insert("t", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+	var out strings.Builder
+	p.Output = &out
+	exec := func(sql string) string {
+		t.Helper()
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return out.String()
+	}
+
+	if got := exec("delete from t where id = 7"); got != "Query OK, 1 row affected.\n" {
+		t.Errorf("delete existing key: %q", got)
+	}
+	if got := exec("DELETE FROM t WHERE id = 7"); got != "Query OK, 0 rows affected.\n" {
+		t.Errorf("delete missing key: %q", got)
+	}
+	if _, found := e.SelectById("t", 7); found {
+		t.Error("deleted row is still visible")
+	}
+	if keys := queryKeys(t, p, "select * from t where id <= 8"); fmt.Sprint(keys) != "[1 2 3 4 5 6 8]" {
+		t.Errorf("rows after delete: %v", keys)
+	}
+	p.ParseAndExecute("set output_format = plain")
+
+	// 删光所有行：根变为 InvalidPageID 并写入元数据，之后还能插入
+	for i := int64(1); i <= n; i++ {
+		if i != 7 {
+			exec(fmt.Sprintf("delete from t where id = %d", i))
+		}
+	}
+	meta, _ := e.Catalog.GetTable("t")
+	if page.PageID(meta.RootPageId) != page.InvalidPageID {
+		t.Errorf("root after deleting every row = %d, want InvalidPageID", meta.RootPageId)
+	}
+	if meta.RowCount != 0 {
+		t.Errorf("row count after deleting every row = %d", meta.RowCount)
+	}
+	exec("insert into t values (42, 'again')")
+	if keys := queryKeys(t, p, "select * from t"); fmt.Sprint(keys) != "[42]" {
+		t.Errorf("rows after re-insert: %v", keys)
+	}
+
+	for _, sql := range []string{
+		"delete from nope where id = 1",
+		"delete from t where id = abc",
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+	if err := e.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Delete("t", 42); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("delete in a transaction: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestScalarSubquery(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("orders", "id int,item string")
+	e.CreateTable("empty", "id int")
+	e.CreateTable("ids", "id int")
+	for i := int64(1); i <= 20; i++ {
+		e.Insert("orders", i*10, "x")
+	}
+	e.Insert("ids", 70, " ")
+	p := NewSQLParser(e, nil)
+
+	cases := map[string][]int64{
+		"select * from orders where id = (select max(id) from orders)":  {200},
+		"select * from orders where id = (select min(id) from orders)":  {10},
+		"select * from orders where id = (select count(*) from orders)": {20},
+		"select * from orders where id = (select * from ids)":           {70},
+		"select * from orders where id = (select max(id) from empty)":   {},
+		"select * from orders where id != (select max(id) from empty)":  {},
+	}
+	for sql, want := range cases {
+		got := queryKeys(t, p, sql)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", sql, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", sql, got, want)
+			}
+		}
+	}
+
+	for _, sql := range []string{
+		"select * from orders where id = (select * from orders)",               // 多行
+		"select * from orders where id = (select * from orders where id = 10)", // 多列
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestSelectRowLocation(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 200; i++ {
+		if err := e.Insert("t", i, "v"+strconv.FormatInt(i, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := p.ParseAndExecute("select id, _page, _slot from t"); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]string
+	if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+		t.Fatalf("bad JSON output %q: %v", out.String(), err)
+	}
+	if len(rows) != 200 {
+		t.Fatalf("got %d rows, want 200", len(rows))
+	}
+	pages := make(map[string]bool)
+	for _, r := range rows {
+		if len(r) != 3 {
+			t.Fatalf("row %v: want exactly id, _page, _slot", r)
+		}
+		pid, _ := strconv.Atoi(r["_page"])
+		slot, _ := strconv.Atoi(r["_slot"])
+		pages[r["_page"]] = true
+
+		// RID 必须指向叶子页中存放这个 Key 的槽位
+		pg := e.BPM.FetchPage(page.PageID(pid))
+		if pg == nil {
+			t.Fatalf("row %v: page not found", r)
+		}
+		key := page.NewBPlusTreePage(pg).GetKey(int32(slot))
+		e.BPM.UnpinPage(page.PageID(pid), false)
+		if strconv.FormatInt(key, 10) != r["id"] {
+			t.Fatalf("row %v: slot holds key %d", r, key)
+		}
+	}
+	if len(pages) < 2 {
+		t.Errorf("200 rows should span several leaves, got %d", len(pages))
+	}
+
+	// 点查同样带有位置，普通列也可以投影
+	out.Reset()
+	if err := p.ParseAndExecute("select t.name, _slot from t where id = 7"); err != nil {
+		t.Fatal(err)
+	}
+	rows = nil
+	if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+		t.Fatalf("bad JSON output %q: %v", out.String(), err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "v7" || rows[0]["_slot"] == "" {
+		t.Errorf("point lookup returned %v", rows)
+	}
+
+	out.Reset()
+	if err := p.ParseAndExecute("select nope from t"); err == nil {
+		t.Error("expected error for unknown column")
+	}
+}
+
+func TestSelectKeysetPaging(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 20; i++ {
+		if err := e.Insert("t", i*10, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+
+	for sql, want := range map[string]string{
+		"select * from t where id > 50 order by id limit 3":                "[60 70 80]",
+		"select id from t as x where x.id >= 50 order by x.id asc limit 2": "[50 60]",
+		"select * from t where id >= 150":                                  "[150 160 170 180 190 200]",
+		"select * from t where id < 35":                                    "[10 20 30]",
+		"select * from t where id <= 30 limit 2":                           "[10 20]",
+		"select * from t where id > 9223372036854775807":                   "[]",
+		"select * from t where id != 10 limit 2":                           "[20 30]",
+		"select * from t order by id limit 0":                              "[]",
+		"select * from t limit 1":                                          "[10]",
+	} {
+		if got := fmt.Sprint(queryKeys(t, p, sql)); got != want {
+			t.Errorf("%s: got %s, want %s", sql, got, want)
+		}
+	}
+
+	// 按页翻完整张表
+	var all []int64
+	last := int64(0)
+	for {
+		keys := queryKeys(t, p, fmt.Sprintf("select * from t where id > %d order by id limit 6", last))
+		all = append(all, keys...)
+		if len(keys) < 6 {
+			break
+		}
+		last = keys[len(keys)-1]
+	}
+	if len(all) != 20 || all[19] != 200 {
+		t.Fatalf("paged keys: %v", all)
+	}
+
+	if err := p.ParseAndExecute("select * from t order by nope"); !errors.Is(err, ErrColumnNotFound) {
+		t.Errorf("order by unknown column: got %v, want ErrColumnNotFound", err)
+	}
+}
+
+func TestSelectOrderBy(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,score int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	// score 有重复和 NULL（id 5 没有 score），name 按字符串比较
+	for _, v := range []struct {
+		id    int64
+		value string
+	}{
+		{1, "30,c"}, {2, "5,a"}, {3, "100,e"}, {4, "30,b"}, {5, " "}, {6, "7,d"},
+	} {
+		if err := e.Insert("t", v.id, v.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, io.Discard)
+	// 预算小到每加入一行就溢出一次，排序全部走外部归并
+	if err := p.ParseAndExecute("set query_memory = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for sql, want := range map[string]string{
+		"select * from t order by score":                      "[5 2 6 1 4 3]",
+		"select * from t order by score desc":                 "[3 1 4 6 2 5]",
+		"select * from t order by name limit 3":               "[5 2 4]",
+		"select * from t where id > 1 order by score limit 2": "[5 2]",
+		"select * from t order by id desc limit 2":            "[6 5]",
+	} {
+		if got := fmt.Sprint(queryKeys(t, p, sql)); got != want {
+			t.Errorf("%s: got %s, want %s", sql, got, want)
+		}
+	}
+
+	if err := p.ParseAndExecute("set query_memory = lots"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("bad query_memory: got %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestSelectOrderByIdDesc(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, v int"); err != nil {
+		t.Fatal(err)
+	}
+	// 行数超过一批，反向扫描要跨批次、跨叶子
+	var rows []Row
+	for i := int64(1); i <= 500; i++ {
+		rows = append(rows, Row{Key: i * 2, Value: "1"})
+	}
+	if err := e.InsertBatch("t", rows); err != nil {
+		t.Fatal(err)
+	}
+	p := NewSQLParser(e, io.Discard)
+	if got := fmt.Sprint(queryKeys(t, p, "select * from t order by id desc limit 3")); got != "[1000 998 996]" {
+		t.Errorf("order by id desc limit 3: got %s", got)
+	}
+	keys := queryKeys(t, p, "select * from t order by t.id DESC")
+	if len(keys) != 500 || keys[0] != 1000 || keys[499] != 2 {
+		t.Errorf("order by id desc: got %d rows, %v ... %v", len(keys), keys[:1], keys[len(keys)-1:])
+	}
+
+	it, err := e.ScanRangeDesc("t", 101, 399)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []int64
+	for it.Next() {
+		got = append(got, it.Row().Key)
+	}
+	if it.Err() != nil || len(got) != 149 || got[0] != 398 || got[148] != 102 {
+		t.Errorf("ScanRangeDesc(101, 399): %d rows, err %v", len(got), it.Err())
+	}
+
+	var out strings.Builder
+	p.Output = &out
+	p.ParseAndExecute("set output_format = plain")
+	if err := p.ParseAndExecute("explain select * from t order by id desc limit 3"); err != nil {
+		t.Fatal(err)
+	}
+	if plan := out.String(); !strings.Contains(plan, "reverse scan on t") || strings.Contains(plan, "sort by") {
+		t.Errorf("explain should use a reverse scan without sorting:\n%s", plan)
+	}
+}
+
+func TestCountDistinct(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("items", "id int, category string, qty int"); err != nil {
+		t.Fatal(err)
+	}
+	rows := []Row{
+		{Key: 1, Value: "book,1"},
+		{Key: 2, Value: "pen,01"},
+		{Key: 3, Value: "book,2"},
+		{Key: 4, Value: "lamp,1"},
+		{Key: 5, Value: "pen"}, // qty 缺失，视为 NULL
+	}
+	if err := e.InsertBatch("items", rows); err != nil {
+		t.Fatal(err)
+	}
+	p := NewSQLParser(e, nil)
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+
+	for sql, want := range map[string]string{
+		"select count(distinct category) from items":                                  "3",
+		"select count(DISTINCT items.qty) from items":                                 "2", // "1" 和 "01" 是同一个 int
+		"select count(distinct id) from items":                                        "5",
+		"select * from items where id = (select count(distinct category) from items)": "",
+	} {
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var res []map[string]string
+		if err := json.Unmarshal([]byte(out.String()), &res); err != nil {
+			t.Fatalf("%s: bad JSON output %q: %v", sql, out.String(), err)
+		}
+		if want == "" {
+			if len(res) != 1 || res[0]["category"] != "book" {
+				t.Errorf("%s: got %v", sql, res)
+			}
+			continue
+		}
+		if len(res) != 1 || len(res[0]) != 1 {
+			t.Fatalf("%s: got %v", sql, res)
+		}
+		for _, v := range res[0] {
+			if v != want {
+				t.Errorf("%s = %s, want %s", sql, v, want)
+			}
+		}
+	}
+
+	// 显式写的 null（带不带引号都一样）和空值也是 NULL，不计入
+	for _, sql := range []string{
+		"create table tags (id int, name varchar)",
+		"insert into tags values (1, 'a'), (2, null), (3, 'null'), (4, ''), (5, 'NULL'), (6, 'a')",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for _, fn := range []string{"count(distinct name)", "approx_count_distinct(name)"} {
+		if n, _, err := p.evalScalar("select " + fn + " from tags"); err != nil || n != "1" {
+			t.Errorf("%s with NULL values = %s, %v; want 1", fn, n, err)
+		}
+	}
+
+	for _, sql := range []string{
+		"select count(distinct nope) from items",
+		"select count(distinct *) from items",
+		"select sum(distinct id) from items",
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestApproxCountDistinct(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("items", "id int, category string, tag string"); err != nil {
+		t.Fatal(err)
+	}
+	// category 有 12000 个不同值，每个出现两次；tag 只有 3 个
+	const distinct = 12000
+	rows := make([]Row, 0, 2*distinct)
+	for i := 0; i < 2*distinct; i++ {
+		rows = append(rows, Row{Key: int64(i + 1), Value: fmt.Sprintf("cat-%d,t%d", i%distinct, i%3)})
+	}
+	if err := e.InsertBatch("items", rows); err != nil {
+		t.Fatal(err)
+	}
+	p := NewSQLParser(e, nil)
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+	query := func(sql string) int64 {
+		t.Helper()
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var res []map[string]string
+		if err := json.Unmarshal([]byte(out.String()), &res); err != nil || len(res) != 1 || len(res[0]) != 1 {
+			t.Fatalf("%s: bad output %q: %v", sql, out.String(), err)
+		}
+		for _, v := range res[0] {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				t.Fatalf("%s: %v", sql, err)
+			}
+			return n
+		}
+		return 0
+	}
+
+	// p = 14 时标准误差约 0.8%，允许 4 倍标准误差
+	got := query("select approx_count_distinct(category) from items")
+	if diff := math.Abs(float64(got-distinct)) / distinct; diff > 0.033 {
+		t.Errorf("approx_count_distinct(category) = %d, want %d within 3.3%%", got, distinct)
+	}
+	// 不同值很少时线性计数给出精确值
+	if got := query("select approx_count_distinct(tag) from items"); got != 3 {
+		t.Errorf("approx_count_distinct(tag) = %d, want 3", got)
+	}
+	if got := query("select approx_count_distinct(id) from items"); got != 2*distinct {
+		t.Errorf("approx_count_distinct(id) = %d, want %d", got, 2*distinct)
+	}
+
+	for _, sql := range []string{
+		"select approx_count_distinct(*) from items",
+		"select approx_count_distinct(distinct tag) from items",
+		"select approx_count_distinct(nope) from items",
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestGroupByHaving(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("items", "id int, category string, qty int"); err != nil {
+		t.Fatal(err)
+	}
+	rows := []Row{
+		{Key: 1, Value: "book,1"},
+		{Key: 2, Value: "pen,3"},
+		{Key: 3, Value: "book,2"},
+		{Key: 4, Value: "lamp,7"},
+		{Key: 5, Value: "pen"}, // qty 为 NULL
+		{Key: 6, Value: "book,4"},
+		{Key: 7, Value: ""}, // category 为 NULL
+	}
+	if err := e.InsertBatch("items", rows); err != nil {
+		t.Fatal(err)
+	}
+	p := NewSQLParser(e, nil)
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(sql string) []map[string]string {
+		t.Helper()
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var res []map[string]string
+		if err := json.Unmarshal([]byte(out.String()), &res); err != nil {
+			t.Fatalf("%s: bad JSON output %q: %v", sql, out.String(), err)
+		}
+		return res
+	}
+
+	all := query("select category, count(*), count(qty), sum(qty), max(qty) from items group by category")
+	want := []map[string]string{
+		{"category": "NULL", "count(*)": "1", "count(qty)": "0", "sum(qty)": "NULL", "max(qty)": "NULL"},
+		{"category": "book", "count(*)": "3", "count(qty)": "3", "sum(qty)": "7", "max(qty)": "4"},
+		{"category": "lamp", "count(*)": "1", "count(qty)": "1", "sum(qty)": "7", "max(qty)": "7"},
+		{"category": "pen", "count(*)": "2", "count(qty)": "1", "sum(qty)": "3", "max(qty)": "3"},
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Fatalf("group by = %v, want %v", all, want)
+	}
+
+	for sql, cats := range map[string][]string{
+		"select category, count(*) from items group by category having count(*) > 1":             {"book", "pen"},
+		"select category from items group by category having sum(qty) >= 7 and count(*) = 1":     {"lamp"},
+		"select category from items group by category having min(qty) <> 1":                      {"lamp", "pen"}, // NULL 组不满足任何条件
+		"select category, count(*) from items group by items.category HAVING COUNT( * ) >= 1000": nil,
+	} {
+		var got []string
+		for _, r := range query(sql) {
+			got = append(got, r["category"])
+		}
+		if !reflect.DeepEqual(got, cats) {
+			t.Errorf("%s: got %v, want %v", sql, got, cats)
+		}
+	}
+
+	for _, sql := range []string{
+		"select qty from items group by category",
+		"select category from items group by nope",
+		"select category from items group by category having count(*) like 3",
+		"select category, sum(category) from items group by category",
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestSelectLike(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"abc", "abd", "xabc", "ab", "50%_off", "50 off", "a_c", "ABC"} {
+		if err := e.Insert("t", int64(i+1), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Insert("t", 100, " "); err != nil { // name 缺失，视为 NULL
+		t.Fatal(err)
+	}
+	p := NewSQLParser(e, nil)
+
+	for sql, want := range map[string][]int64{
+		`select * from t where name like 'abc%'`:     {1},
+		`select * from t where name like 'ab%'`:      {1, 2, 4},
+		`select * from t where name like '%abc'`:     {1, 3},
+		`select * from t where name like 'a_c'`:      {1, 7},
+		`select * from t where name like 'a\_c'`:     {7},
+		`select * from t where name like '50\%%'`:    {5},
+		`select * from t where t.name like '%'`:      {1, 2, 3, 4, 5, 6, 7, 8},
+		`select * from t where name not like 'ab%'`:  {3, 5, 6, 7, 8},
+		`select * from t where id like '1%'`:         {1, 100},
+		`select * from t where name like 'nothing%'`: {},
+	} {
+		got := queryKeys(t, p, sql)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, want %v", sql, got, want)
+		}
+	}
+
+	if err := p.ParseAndExecute(`select * from t where nope like 'a%'`); err == nil {
+		t.Error("expected error for unknown column")
+	}
+
+	// name 上建索引后，有字面量前缀的 LIKE 只扫描索引中的一段；存成哈希的长值也要查得到
+	if err := e.Insert("t", 200, "ab"+strings.Repeat("x", page.SizeOfStrKey)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateIndex("t", "idx_name", "name"); err != nil {
+		t.Fatal(err)
+	}
+	for sql, want := range map[string][]int64{
+		`select * from t where name like 'abc%'`:           {1},
+		`select * from t where name like 'ab%'`:            {1, 2, 4, 200},
+		`select * from t where name like 'abx%'`:           {200},
+		`select * from t where name like 'a_c'`:            {1, 7},
+		`select * from t where name like '50\%%'`:          {5},
+		`select * from t where name like 'ABC'`:            {8},
+		`select * from t where name not like 'ab%'`:        {3, 5, 6, 7, 8},
+		`select * from t where name like 'ab%' limit 2`:    {1, 2},
+		`select * from t where name like 'nothing%'`:       {},
+		`select * from t where name like '%c' and id > 1`:  {3, 7},
+		`select * from t where name like 'ab%' and id > 3`: {4, 200},
+	} {
+		got := queryKeys(t, p, sql)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("with index: %s: got %v, want %v", sql, got, want)
+		}
+	}
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = plain"); err != nil {
+		t.Fatal(err)
+	}
+	for sql, want := range map[string]string{
+		`explain select * from t where name like 'ab%'`:     "index range scan on t using idx_name: name >= 'ab' and name < 'ac'",
+		`explain select * from t where name like '%b'`:      "full scan on t",
+		`explain select * from t where name not like 'ab%'`: "full scan on t",
+	} {
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%s: plan %s, want %q", sql, out.String(), want)
+		}
+	}
+}
+
+func TestSelectValueFilter(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []string{"apple", "banana", "9", "10", "error: disk full", "2.5", "fatal error"} {
+		if err := e.Insert("t", int64(i+1), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+
+	for sql, want := range map[string][]int64{
+		// 两边都是数字时按数值比较
+		`select * from t where value > 5`:     {1, 2, 3, 4, 5, 7},
+		`select * from t where value < 9.5`:   {3, 6},
+		`select * from t where value = 10.0`:  {4},
+		`select * from t where value >= '10'`: {1, 2, 4, 5, 7},
+		`select * from t where value <> 9`:    {1, 2, 4, 5, 6, 7},
+		// 否则按字符串的字节序比较
+		`select * from t where value < 'b'`:                  {1, 3, 4, 6},
+		`select * from t where value > 'banana'`:             {5, 7},
+		`select * from t where value = 'apple'`:              {1},
+		`select * from t where t.value like '%error%'`:       {5, 7},
+		`select * from t where value not like '%e%'`:         {2, 3, 4, 6},
+		`select * from t where value like '%error%' limit 1`: {5},
+	} {
+		got := queryKeys(t, p, sql)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, want %v", sql, got, want)
+		}
+	}
+
+	// 表里有名为 value 的真实列时按真实列过滤
+	if err := e.CreateTable("kv", "id int, value string, note string"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Insert("kv", 1, "x,error"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryKeys(t, p, `select * from kv where value like '%error%'`); len(got) != 0 {
+		t.Errorf("real column 'value': got %v, want no rows", got)
+	}
+}
+
+func TestSelectAnd(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, name string, age int"); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []string{"bob,30", "alice,25", "bob,41", "carol", "bob and alice,30", "alice,41"} {
+		if err := e.Insert("t", int64(i+1), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+	// 显式写的 null 和空值与缺失的列一样是 NULL
+	if err := NewSQLParser(e, io.Discard).ParseAndExecute("insert into t values (7, null, 20), (8, '', 20)"); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() {
+		t.Helper()
+		for sql, want := range map[string][]int64{
+			`select * from t where id = 3 and name = 'bob'`:                      {3},
+			`select * from t where id = 2 and name = 'bob'`:                      {},
+			`select * from t where name = 'bob' and age > 35`:                    {3},
+			`select * from t where t.age >= 30 AND id between 2 and 6`:           {3, 5, 6},
+			`select * from t where id between 1 and 5 and age between 26 and 41`: {1, 3, 5},
+			`select * from t where name like 'bob%' and id < 5 and age = 30`:     {1},
+			`select * from t where name = 'bob and alice' and age = 30`:          {5},
+			`select * from t where age is null and id > 0`:                       {4},
+			`select * from t where id > 0 and name is null`:                      {7, 8},
+			`select * from t where age = 20 and name is not null`:                {},
+			`select * from t where name is not null and id > 5`:                  {6},
+			`select * from t where id % 2 = 1 and age = 41`:                      {3},
+			`select * from t where age = 41 and name = 'alice'`:                  {6},
+			`select * from t where age = 41 and name != 'x' limit 1`:             {3},
+		} {
+			if got := queryKeys(t, p, sql); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s: got %v, want %v", sql, got, want)
+			}
+		}
+	}
+	run()
+	// 有二级索引时 name = 的条件走索引，结果不变
+	if err := e.CreateIndex("t", "idx_name", "name"); err != nil {
+		t.Fatal(err)
+	}
+	run()
+
+	for _, sql := range []string{
+		`select * from t where id = 1 and nosuch = 2`,
+		`select * from t where name = 'bob' and`,
+		`select * from t where id = 1 and name = 'a' or id = 2`,
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+	if err := p.ParseAndExecute(`select * from t where id = 1 and nosuch = 2`); !errors.Is(err, ErrColumnNotFound) {
+		t.Errorf("unknown column: %v, want ErrColumnNotFound", err)
+	}
+}
+
+func TestSelectKeyExpression(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 12; i++ {
+		if err := e.Insert("t", i, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewSQLParser(e, nil)
+
+	for sql, want := range map[string][]int64{
+		`select * from t where id % 4 = 0`:                          {4, 8, 12},
+		`select * from t where id + 1 = 6`:                          {5},
+		`select * from t where abs(id - 10) <= 1`:                   {9, 10, 11},
+		`select * from t where mod(id, 5) = 1 limit 2`:              {1, 6},
+		`select * from t where (id - 1) * 2 > 18`:                   {11, 12},
+		`select * from t where id / 0 = 1`:                          {},
+		`select * from t where id = 2 * 3`:                          {6},
+		`select * from t where 10 < id`:                             {11, 12},
+		`select * from t where t.id >= -3 + 11 - 1`:                 {7, 8, 9, 10, 11, 12},
+		`select * from t where id % 2 = 1 order by id desc limit 2`: {11, 9},
+	} {
+		got := queryKeys(t, p, sql)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, want %v", sql, got, want)
+		}
+	}
+
+	// id 单独和常量比较走索引，被表达式包住时全表扫描
+	var out strings.Builder
+	p.Output = &out
+	if err := p.ParseAndExecute("set output_format = plain"); err != nil {
+		t.Fatal(err)
+	}
+	for sql, want := range map[string]string{
+		`explain select * from t where id = 5`:          "index range scan on t: id = 5",
+		`explain select * from t where 7 > id`:          "index range scan on t: id <= 6",
+		`explain select * from t where id = 2 * 3`:      "index range scan on t: id = 6",
+		`explain select * from t where id + 1 = 6`:      "full scan on t",
+		`explain select * from t where id % 2 = 0`:      "full scan on t",
+		`explain select * from t where name like 'x%'`:  "full scan on t",
+		`explain select * from t order by name limit 3`: "sort by name",
+		`explain select * from t where id != 3`:         "index range scan on t: id >= 4",
+	} {
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%s: plan %s, want %q", sql, out.String(), want)
+		}
+	}
+	if err := p.ParseAndExecute(`explain insert into t values (13, 'x')`); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("explain insert: got %v", err)
+	}
+	// 主键以外的列仍然不支持表达式
+	if err := p.ParseAndExecute(`select * from t where name + 1 = 2`); err == nil {
+		t.Errorf("expression on a non-key column: expected an error")
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	for pattern, prefix := range map[string]string{
+		"abc%":    "abc",
+		"%abc":    "",
+		"a_c":     "a",
+		`50\%%`:   "50%",
+		`a\\b%`:   `a\b`,
+		"literal": "literal",
+	} {
+		if got := compileLike(pattern).prefix; got != prefix {
+			t.Errorf("prefix of %q = %q, want %q", pattern, got, prefix)
+		}
+	}
+	for prefix, want := range map[string]string{
+		"abc":      "abd",
+		"a\xff":    "b",
+		"a\xfe":    "a\xff",
+		"\xff\xff": "",
+		"":         "",
+	} {
+		if got, ok := prefixUpperBound(prefix); got != want || ok != (want != "") {
+			t.Errorf("upper bound of %q = %q, %v; want %q", prefix, got, ok, want)
+		}
+	}
+}
+
+func TestDebugBufferPool(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	if err := p.ParseAndExecute("debug bufferpool"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("without Debug: got %v, want ErrUnsupported", err)
+	}
+
+	p.Debug = true
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := p.ParseAndExecute("debug bufferpool"); err != nil {
+		t.Fatal(err)
+	}
+	var frames []map[string]string
+	if err := json.Unmarshal([]byte(out.String()), &frames); err != nil {
+		t.Fatalf("bad JSON output %q: %v", out.String(), err)
+	}
+	if len(frames) != e.BPM.PoolSize() {
+		t.Fatalf("got %d frames, want %d", len(frames), e.BPM.PoolSize())
+	}
+	// 建表分配的根页在缓冲池里，没有被 Pin 住
+	meta, _ := e.Catalog.GetTable("t")
+	root := strconv.Itoa(int(meta.RootPageId))
+	for _, f := range frames {
+		if f["page_id"] == root {
+			if f["pin_count"] != "0" || f["lru"] == "-" {
+				t.Errorf("root frame: %v", f)
+			}
+			return
+		}
+	}
+	t.Errorf("root page %s not resident: %v", root, frames)
+}
+
+func TestSelectCase(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,score int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		id    int64
+		value string
+	}{
+		{7, "-3,it's"}, {50, "9,ann"}, {100, " "}, {150, "100,bob"},
+	} {
+		if err := e.Insert("t", v.id, v.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+	query := func(sql string) []map[string]string {
+		t.Helper()
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var rows []map[string]string
+		if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+			t.Fatalf("%s: bad JSON output %q: %v", sql, out.String(), err)
+		}
+		return rows
+	}
+	column := func(rows []map[string]string, col string) string {
+		var vals []string
+		for _, r := range rows {
+			vals = append(vals, r[col])
+		}
+		return strings.Join(vals, " ")
+	}
+
+	// 第一个成立的 WHEN、ELSE 分支、整数按数值比较
+	rows := query("select id, case when id > 100 then 'big' when id >= 50 then 'mid' else 'small' end from t")
+	if got := column(rows, "case"); got != "small mid mid big" {
+		t.Errorf("searched case: %s", got)
+	}
+	// 没有 ELSE 时为 NULL，NULL 列的比较不成立，字符串里的逗号和引号不影响拆分
+	rows = query("select case when score < 10 then 'low, really' end as grade, name, case when score is null then 'n/a' else score end as s from t")
+	if got := column(rows, "grade"); got != "low, really low, really NULL NULL" {
+		t.Errorf("no else: %s", got)
+	}
+	if got := column(rows, "s"); got != "-3 9 n/a 100" {
+		t.Errorf("is null / column value: %s", got)
+	}
+	rows = query("select case when x.name = 'it''s' then x.id end as hit from t as x where id < 100")
+	if got := column(rows, "hit"); got != "7 NULL" {
+		t.Errorf("quoted literal: %s", got)
+	}
+
+	for _, sql := range []string{
+		"select case when nope = 1 then 'a' end from t",
+		"select case when id then 'a' end from t",
+		"select case else 'a' end from t",
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestInformationSchema(t *testing.T) {
+	e := newTestEngine(t)
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	for _, sql := range []string{
+		"create table users (id int primary key auto_increment, name varchar, age int)",
+		"create table logs (id bigint, msg text) with (on_conflict = ignore)",
+		"insert into users values (null, 'ann', 30), (null, 'bob', 40)",
+		"set output_format = json",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	query := func(sql string) []map[string]string {
+		t.Helper()
+		out.Reset()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var rows []map[string]string
+		if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+			t.Fatalf("%s: bad JSON output %q: %v", sql, out.String(), err)
+		}
+		return rows
+	}
+
+	rows := query("select * from information_schema.tables")
+	if len(rows) != 2 || rows[0]["table_name"] != "logs" || rows[1]["table_name"] != "users" {
+		t.Fatalf("tables: %v", rows)
+	}
+	if rows[0]["on_conflict"] != "ignore" || rows[0]["auto_increment"] != "NULL" {
+		t.Errorf("logs: %v", rows[0])
+	}
+	if rows[1]["table_rows"] != "2" || rows[1]["auto_increment"] == "NULL" {
+		t.Errorf("users: %v", rows[1])
+	}
+
+	rows = query("select column_name, data_type, column_key, extra from information_schema.columns as c where c.table_name = 'users' order by ordinal_position desc limit 2")
+	if len(rows) != 2 || rows[0]["column_name"] != "age" || rows[1]["data_type"] != "varchar" || len(rows[0]) != 4 {
+		t.Fatalf("columns: %v", rows)
+	}
+	rows = query("select column_name, extra from information_schema.columns where column_key = 'PRI'")
+	if len(rows) != 2 || rows[1]["extra"] != "auto_increment" || rows[0]["extra"] != "" {
+		t.Errorf("primary keys: %v", rows)
+	}
+	rows = query("select table_name from INFORMATION_SCHEMA.TABLES where table_rows >= 2")
+	if len(rows) != 1 || rows[0]["table_name"] != "users" {
+		t.Errorf("numeric filter: %v", rows)
+	}
+
+	for sql, want := range map[string]error{
+		"select * from information_schema.nope":                 ErrTableNotFound,
+		"select nope from information_schema.tables":            ErrColumnNotFound,
+		"select * from information_schema.tables order by nope": ErrColumnNotFound,
+	} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %v", sql, err, want)
+		}
+	}
+}
+
+func TestShowTree(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	const n = 1000
+	rows := make([]Row, n)
+	for i := range rows {
+		rows[i] = Row{Key: int64(i), Value: fmt.Sprintf("name-%010d", i)}
+	}
+	if err := e.InsertBatch("t", rows); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+
+	// 逐页取完整棵树：根在第一行且不缩进，叶子缩进最深，所有叶子的 Key 连起来是 0..n-1
+	var lines []string
+	next := "show tree t limit 3"
+	for pages := 0; next != ""; pages++ {
+		if pages > n {
+			t.Fatal("paging does not terminate")
+		}
+		out.Reset()
+		if err := p.ParseAndExecute(next); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		next = ""
+		if last := got[len(got)-1]; strings.HasPrefix(last, "... more nodes: ") {
+			next = strings.TrimPrefix(last, "... more nodes: ")
+			got = got[:len(got)-1]
+		}
+		lines = append(lines, got[1:]...)
+	}
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "page ") || !strings.Contains(lines[0], " internal [") {
+		t.Fatalf("root line = %q, want an unindented internal node", lines[0])
+	}
+	var keys []string
+	leafIndent := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if !strings.Contains(trimmed, " leaf [") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); leafIndent == -1 {
+			leafIndent = indent
+		} else if indent != leafIndent {
+			t.Fatalf("leaf %q indented %d, other leaves %d", line, indent, leafIndent)
+		}
+		_, list, _ := strings.Cut(trimmed, "[")
+		keys = append(keys, strings.Fields(strings.TrimSuffix(list, "]"))...)
+	}
+	if leafIndent <= 0 || len(keys) != n {
+		t.Fatalf("leaf indent %d, %d keys; want indented leaves holding %d keys", leafIndent, len(keys), n)
+	}
+	for i, k := range keys {
+		if k != strconv.Itoa(i) {
+			t.Fatalf("leaf key #%d = %s, want %d", i, k, i)
+		}
+	}
+
+	if err := p.ParseAndExecute("show tree missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("missing table: got %v, want ErrTableNotFound", err)
+	}
+}
+
+func TestReportSuccessTiming(t *testing.T) {
+	e := newTestEngine(t)
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	report := func() string {
+		out.Reset()
+		p.ReportSuccess(2300 * time.Microsecond)
+		return out.String()
+	}
+
+	if got := report(); got != "(0.0023 sec)\n" {
+		t.Errorf("plain timing = %q", got)
+	}
+	if err := p.ParseAndExecute("set output_format = json"); err != nil {
+		t.Fatal(err)
+	}
+	var timing struct {
+		Elapsed *float64 `json:"elapsed_sec"`
+	}
+	if got := report(); json.Unmarshal([]byte(got), &timing) != nil || timing.Elapsed == nil || *timing.Elapsed != 0.0023 {
+		t.Errorf("JSON timing = %q", got)
+	}
+
+	for _, format := range []string{"json", "plain"} {
+		for _, sql := range []string{"set timing = off", "set output_format = " + format} {
+			if err := p.ParseAndExecute(sql); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := report(); got != "" {
+			t.Errorf("%s output with timing off = %q, want nothing", format, got)
+		}
+	}
+	if err := p.ParseAndExecute("set timing = maybe"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("set timing = maybe: got %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestEngineExecute(t *testing.T) {
+	e := newTestEngine(t)
+	exec := func(sql string) *ResultSet {
+		t.Helper()
+		rs, err := e.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return rs
+	}
+
+	exec("create table t (id int, name varchar)")
+	if rs := exec("insert into t values (1, 'a'), (2, 'b'), (3, 'c')"); rs.Affected != 3 || rs.Columns != nil {
+		t.Errorf("insert: %+v", rs)
+	}
+	rs := exec("select id, name from t where id >= 2")
+	want := [][]string{{"2", "b"}, {"3", "c"}}
+	if !reflect.DeepEqual(rs.Columns, []string{"id", "name"}) || !reflect.DeepEqual(rs.Rows, want) || rs.Message != "" {
+		t.Errorf("select: %+v", rs)
+	}
+	if rs := exec("delete from t where id = 1"); rs.Affected != 1 || rs.Message != "Query OK, 1 row affected." {
+		t.Errorf("delete: %+v", rs)
+	}
+	if rs := exec("show tables"); !reflect.DeepEqual(rs.Rows, [][]string{{"t"}}) {
+		t.Errorf("show tables: %+v", rs)
+	}
+	if rs, err := e.Execute("select * from missing"); rs != nil || !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("select from a missing table: %+v, %v", rs, err)
+	}
+	if _, err := e.Execute("copy t from stdin"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("copy from stdin: %v, want ErrUnsupported", err)
+	}
+
+	// ParseAndExecute 按 output_format 格式化同一个结果
+	var out strings.Builder
+	p := NewSQLParser(e, &out)
+	if err := p.ParseAndExecute("select * from t where id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, " b") || !strings.HasSuffix(got, "(1 row)\n") {
+		t.Errorf("formatted select:\n%s", got)
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	run := func(sql string) {
+		t.Helper()
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	run("create table t (id int, name varchar, age int)")
+	run("prepare ins from 'insert into t values (?, ?, ?)'")
+	for i := 1; i <= 50; i++ {
+		run(fmt.Sprintf("execute ins using %d, 'user%d', %d", i, i, 20+i%10))
+	}
+	run("execute ins using 51, 'o''brien', null")
+	if val, _ := e.SelectById("t", 51); val != "o'brien,null" {
+		t.Errorf("row 51 = %q", val)
+	}
+	if val, _ := e.SelectById("t", 7); val != "user7,27" {
+		t.Errorf("row 7 = %q", val)
+	}
+
+	// 不是 insert 的语句把参数填回语句中执行；多元组的 insert 按顺序填入各个元组
+	run(`prepare sel from "select * from t where id >= ? and name like 'user%' limit ?"`)
+	if got := queryKeys(t, p, "execute sel using 48, 5"); !reflect.DeepEqual(got, []int64{48, 49, 50}) {
+		t.Errorf("execute sel = %v", got)
+	}
+	run("prepare pair from 'insert into t values (?, ''a'', 1), (?, ''b'', 2)'")
+	run("execute pair using 60, 61")
+	if val, _ := e.SelectById("t", 61); val != "b,2" {
+		t.Errorf("row 61 = %q", val)
+	}
+
+	for sql, want := range map[string]*Error{
+		"execute ins using 1, 'a'":           ErrInvalidValue,
+		"execute ins using 70, 'a,b', 1":     ErrInvalidValue,
+		"execute ins using 70, bob, 1":       ErrSyntax,
+		"execute ins using 1, 'dup', 1":      ErrDuplicateKey,
+		"execute nosuch":                     ErrStmtNotFound,
+		"prepare p2 from 'execute ins'":      ErrUnsupported,
+		"deallocate prepare nosuch":          ErrStmtNotFound,
+		"execute ins using 70, 'unclosed, 1": ErrSyntax,
+		"prepare empty from ''":              ErrSyntax,
+	} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %s", sql, err, want.Code)
+		}
+	}
+
+	// 预处理语句属于连接，删除后不能再执行
+	if err := NewSQLParser(e, io.Discard).ParseAndExecute("execute ins using 80, 'x', 1"); !errors.Is(err, ErrStmtNotFound) {
+		t.Errorf("another connection executing ins: %v", err)
+	}
+	run("deallocate prepare ins")
+	if err := p.ParseAndExecute("execute ins using 80, 'x', 1"); !errors.Is(err, ErrStmtNotFound) {
+		t.Errorf("execute after deallocate: %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	for input, want := range map[string][]string{
+		"select * from t":                    {"select * from t"},
+		"use mydb; show tables;":             {"use mydb", "show tables"},
+		" ; ;select 1;; ":                    {"select 1"},
+		`insert into t values (1, 'a;b')`:    {`insert into t values (1, 'a;b')`},
+		`insert into t values (1, "x;'y")`:   {`insert into t values (1, "x;'y")`},
+		`insert into t values (1, 'it\'s;')`: {`insert into t values (1, 'it\'s;')`},
+		"select 'open; select 2":             {"select 'open; select 2"},
+	} {
+		if got := SplitStatements(input); !reflect.DeepEqual(got, want) {
+			t.Errorf("SplitStatements(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// WHERE 中用 AND 连接的多个条件：where <cond> and <cond> [and ...]，不支持 OR。
+// 先挑出一个能走索引的条件（主键上的条件优先，其次是建有二级索引的列上的 =），按单个条件的路径取出候选行，
+// 再用剩下的条件在内存中逐行过滤；没有能走索引的条件时全表扫描，所有条件都在内存中求值。
+//
+// 内存中求值的条件（predicate）支持：
+//
+//	<col> <op> <value|col>       与 CASE 的 WHEN 相同（caseCond），int 列两边都是整数时按数值比较
+//	<col> is [not] null
+//	<col> [not] like '<pattern>'
+//	<col> between <low> and <high>
+//	主键的算术表达式，例如 id % 2 = 0（keyPredicate）
+//
+// 列不在表结构中时报错；与 NULL 比较、列缺失的行都不匹配
+
+// predicate 是 AND 中的一个条件，cells 是 row.Cells() 的结果
+type predicate func(row Row, cells []string) bool
+
+// splitConjuncts 按顶层的 AND 拆分 WHERE 条件；引号和括号内的 and 不拆，between <low> and <high> 中的 and 也不拆
+func splitConjuncts(condition string) []string {
+	var conds []string
+	var quote byte // 当前所在引号，0 表示不在引号内
+	depth, start := 0, 0
+	between := false // 当前条件中出现了 between，下一个 and 属于它
+	isWord := func(c byte) bool { return c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) }
+	for i := 0; i < len(condition); i++ {
+		c := condition[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && isWord(c) && (i == 0 || !isWord(condition[i-1])):
+			j := i
+			for j < len(condition) && isWord(condition[j]) {
+				j++
+			}
+			switch strings.ToLower(condition[i:j]) {
+			case "between":
+				between = true
+			case "and":
+				if between {
+					between = false
+					break
+				}
+				conds = append(conds, strings.TrimSpace(condition[start:i]))
+				start = j
+			}
+			i = j - 1
+		}
+	}
+	return append(conds, strings.TrimSpace(condition[start:]))
+}
+
+// compilePredicate 把单个条件编译成 predicate
+func (p *SQLParser) compilePredicate(ref tableRef, condition string) (predicate, error) {
+	resolve := func(name string) (int, ColumnType, error) {
+		name, err := ref.resolveColumn(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		columns, idx, err := p.Engine.lookupColumn(ref.Name, name)
+		if err != nil {
+			return 0, 0, err
+		}
+		return idx, columns[idx].Type, nil
+	}
+
+	if m := reLike.FindStringSubmatch(condition); m != nil {
+		idx, _, err := resolve(m[1])
+		if err != nil {
+			return nil, err
+		}
+		lp, negate := compileLike(m[3]), m[2] != ""
+		return func(_ Row, cells []string) bool {
+			return idx < len(cells) && lp.Match(cells[idx]) != negate
+		}, nil
+	}
+	if m := reBetween.FindStringSubmatch(condition); m != nil {
+		low, err := p.compilePredicate(ref, m[1]+" >= "+m[2])
+		if err != nil {
+			return nil, err
+		}
+		high, err := p.compilePredicate(ref, m[1]+" <= "+m[3])
+		if err != nil {
+			return nil, err
+		}
+		return func(row Row, cells []string) bool { return low(row, cells) && high(row, cells) }, nil
+	}
+	if pred := p.parseKeyPredicate(ref, condition); pred != nil {
+		return func(row Row, _ []string) bool { return pred.match(row.Key) }, nil
+	}
+
+	unsupported := errorf(ErrSyntax, "unsupported condition '%s' in where clause", condition)
+	tokens, err := tokenizeCase(condition)
+	if err != nil {
+		return nil, unsupported
+	}
+	cp := &caseParser{tokens: tokens, text: condition, resolve: resolve}
+	cond, err := cp.parseCond()
+	switch {
+	case errors.Is(err, ErrColumnNotFound):
+		return nil, err
+	case err != nil || cp.pos < len(cp.tokens):
+		return nil, unsupported
+	}
+	return func(_ Row, cells []string) bool { return cond.match(cells) }, nil
+}
+
+// keyCondition 报告条件能否按主键范围扫描
+func (p *SQLParser) keyCondition(ref tableRef, condition string) bool {
+	if _, ok, err := parseBetween(ref, condition); ok {
+		return err == nil
+	}
+	if pred := p.parseKeyPredicate(ref, condition); pred != nil {
+		return pred.sargable()
+	}
+	m := reWhere.FindStringSubmatch(condition)
+	if m == nil || p.isValueColumn(ref, m[1]) {
+		return false
+	}
+	col, err := ref.resolveColumn(m[1])
+	return err == nil && strings.EqualFold(col, "id")
+}
+
+// planConjunction 从 AND 连接的条件中选出走索引的一个，返回它的下标，没有时返回 -1
+func (p *SQLParser) planConjunction(ref tableRef, conds []string) int {
+	for i, cond := range conds {
+		if p.keyCondition(ref, cond) {
+			return i
+		}
+	}
+	for i, cond := range conds {
+		if m := reWhere.FindStringSubmatch(cond); m != nil {
+			col, err := ref.resolveColumn(m[1])
+			if _, _, _, ok := p.indexedEquality(ref, col, m[2], m[3]); err == nil && ok {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// runConjunction 执行 AND 连接的多个条件，limit >= 0 时最多返回 limit 行
+func (p *SQLParser) runConjunction(ref tableRef, conds []string, limit int) ([]Row, error) {
+	for _, cond := range conds {
+		if cond == "" {
+			return nil, errorf(ErrSyntax, "empty condition around AND in where clause")
+		}
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+	driver := p.planConjunction(ref, conds)
+	var filters []predicate
+	for i, cond := range conds {
+		if i == driver {
+			continue
+		}
+		pred, err := p.compilePredicate(ref, cond)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, pred)
+	}
+
+	var rows []Row
+	add := func(row Row) bool {
+		cells := row.Cells()
+		for _, match := range filters {
+			if !match(row, cells) {
+				return true
+			}
+		}
+		rows = append(rows, row)
+		return limit < 0 || len(rows) < limit
+	}
+
+	if driver >= 0 {
+		candidates, err := p.runSelect(ref, conds[driver], -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range candidates {
+			if !add(row) {
+				break
+			}
+		}
+		return rows, nil
+	}
+
+	it, err := p.Engine.ScanRange(ref.Name, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for it.Next() {
+		if !add(it.Row()) {
+			break
+		}
+	}
+	return rows, it.Err()
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 预处理语句，每个连接（SQLParser）各自保存，连接关闭后消失：
+//
+//	prepare <name> from '<statement>'   语句中引号之外的 ? 是参数，语句本身中的单引号写两次
+//	execute <name> [using <val>, ...]   参数个数必须与 ? 的个数相同，值是整数、小数、带引号的字符串或 null
+//	deallocate prepare <name>
+//
+// insert into <table> values (...) 在 prepare 时就拆好元组，execute 时直接把参数填进元组，
+// 不再按正则匹配和拆分整条语句；参数整个作为一个值，不能包含逗号（值按逗号分隔存储）。
+// 其他语句在 execute 时把参数按原样（字符串带引号）填回语句中，再像普通语句一样执行
+
+// MaxPreparedStatements 是一个连接最多保存的预处理语句个数
+const MaxPreparedStatements = 100
+
+// preparedStmt 是一条预处理语句
+type preparedStmt struct {
+	sql    string
+	params int
+	parts  []string // sql 按 ? 拆开的片段，len(parts) == params+1
+
+	// 预处理的 insert：table 非空，tuples 是每个元组按 ? 拆开的片段，参数按顺序依次填入各个元组
+	table  string
+	tuples [][]string
+}
+
+// stmtArg 是 execute 的一个参数
+type stmtArg struct {
+	literal string // 语句中写的样子，填回语句时使用
+	value   string // 去掉引号后的值，填入 insert 的元组时使用；null 为 "null"
+}
+
+// splitPlaceholders 按引号之外的 ? 拆分 sql
+func splitPlaceholders(sql string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			parts = append(parts, sql[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, sql[start:])
+}
+
+// handlePrepare 保存预处理语句，同名的语句被替换
+func (p *SQLParser) handlePrepare(name, sql string) error {
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	if sql == "" {
+		return errorf(ErrSyntax, "prepare %s: empty statement", name)
+	}
+	if rePrepare.MatchString(sql) || reExecute.MatchString(sql) || reDeallocate.MatchString(sql) {
+		return errorf(ErrUnsupported, "prepare %s: cannot prepare prepare, execute or deallocate", name)
+	}
+	key := strings.ToLower(name)
+	if _, ok := p.prepared[key]; !ok && len(p.prepared) >= MaxPreparedStatements {
+		return errorf(ErrUnsupported, "too many prepared statements (at most %d per connection), deallocate some first", MaxPreparedStatements)
+	}
+
+	stmt := &preparedStmt{sql: sql, parts: splitPlaceholders(sql)}
+	stmt.params = len(stmt.parts) - 1
+	if m := reInsert.FindStringSubmatch(sql); m != nil {
+		stmt.table = m[1]
+		for _, tuple := range reTupleSep.Split(m[2], -1) {
+			stmt.tuples = append(stmt.tuples, splitPlaceholders(tuple))
+		}
+	}
+	if p.prepared == nil {
+		p.prepared = make(map[string]*preparedStmt)
+	}
+	p.prepared[key] = stmt
+	fmt.Fprintln(p.Output, "Statement prepared.")
+	return nil
+}
+
+// handleExecute 用参数执行预处理语句
+func (p *SQLParser) handleExecute(name, argsStr string) error {
+	stmt, ok := p.prepared[strings.ToLower(name)]
+	if !ok {
+		return errorf(ErrStmtNotFound, "unknown prepared statement '%s'", name)
+	}
+	args, err := parseStmtArgs(argsStr)
+	if err != nil {
+		return err
+	}
+	if len(args) != stmt.params {
+		return errorf(ErrInvalidValue, "prepared statement '%s' takes %d parameter(s), got %d", name, stmt.params, len(args))
+	}
+
+	if stmt.table != "" {
+		tuples := make([]string, 0, len(stmt.tuples))
+		next := 0
+		for _, parts := range stmt.tuples {
+			var b strings.Builder
+			for i, part := range parts {
+				if i > 0 {
+					arg := args[next]
+					next++
+					if strings.Contains(arg.value, ",") {
+						return errorf(ErrInvalidValue, "parameter %d of an insert cannot contain ','", next)
+					}
+					b.WriteString(arg.value)
+				}
+				b.WriteString(part)
+			}
+			tuples = append(tuples, b.String())
+		}
+		return p.insertTuples(stmt.table, tuples)
+	}
+
+	var b strings.Builder
+	for i, part := range stmt.parts {
+		if i > 0 {
+			b.WriteString(args[i-1].literal)
+		}
+		b.WriteString(part)
+	}
+	return p.execute(b.String())
+}
+
+// handleDeallocate 删除预处理语句
+func (p *SQLParser) handleDeallocate(name string) error {
+	key := strings.ToLower(name)
+	if _, ok := p.prepared[key]; !ok {
+		return errorf(ErrStmtNotFound, "unknown prepared statement '%s'", name)
+	}
+	delete(p.prepared, key)
+	fmt.Fprintln(p.Output, "Query OK, 0 rows affected.")
+	return nil
+}
+
+// parseStmtArgs 解析 execute ... using 后面逗号分隔的参数，引号中的逗号不拆
+func parseStmtArgs(argsStr string) ([]stmtArg, error) {
+	if strings.TrimSpace(argsStr) == "" {
+		return nil, nil
+	}
+	var raw []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(argsStr); i++ {
+		c := argsStr[i]
+		switch {
+		case quote != 0 && c == quote:
+			if i+1 < len(argsStr) && argsStr[i+1] == quote {
+				i++ // 两个引号表示引号本身
+				break
+			}
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			raw = append(raw, argsStr[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, errorf(ErrSyntax, "unterminated string in execute parameters")
+	}
+	raw = append(raw, argsStr[start:])
+
+	args := make([]stmtArg, 0, len(raw))
+	for i, s := range raw {
+		s = strings.TrimSpace(s)
+		switch {
+		case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+			q := string(s[0])
+			args = append(args, stmtArg{literal: s, value: strings.ReplaceAll(s[1:len(s)-1], q+q, q)})
+		case strings.EqualFold(s, "null"):
+			args = append(args, stmtArg{literal: "null", value: "null"})
+		default:
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return nil, errorf(ErrSyntax, "parameter %d must be a number, a quoted string or null, got '%s'", i+1, s)
+			}
+			args = append(args, stmtArg{literal: s, value: s})
+		}
+	}
+	return args, nil
+}
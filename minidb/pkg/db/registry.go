@@ -0,0 +1,155 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RegistryFileName 是 DataRoot 下记录所有数据库的文件
+const RegistryFileName = "databases.json"
+
+// registryVersion 数据库注册表的格式版本
+const registryVersion = 1
+
+// DatabaseInfo 是注册表中的一个数据库
+type DatabaseInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	PageSize  int       `json:"page_size"`
+	// Tablespaces 数据文件个数，旧数据库为 0，按 1 处理
+	Tablespaces int `json:"tablespaces,omitempty"`
+}
+
+// registryFile 是 databases.json 的磁盘格式
+type registryFile struct {
+	Version   int            `json:"version"`
+	Databases []DatabaseInfo `json:"databases"`
+}
+
+// registryMu 串行化对注册表的读改写，多个会话可能同时建库/删库
+var registryMu sync.Mutex
+
+// loadRegistry 读取注册表；文件不存在时从现有目录迁移生成一份
+func loadRegistry(dataRoot string) (map[string]DatabaseInfo, error) {
+	path := filepath.Join(dataRoot, RegistryFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		dbs, err := discoverDatabases(dataRoot)
+		if err != nil {
+			return nil, err
+		}
+		return dbs, saveRegistry(dataRoot, dbs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rf registryFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("corrupt %s: %v", RegistryFileName, err)
+	}
+	dbs := make(map[string]DatabaseInfo, len(rf.Databases))
+	for _, info := range rf.Databases {
+		dbs[info.Name] = info
+	}
+	return dbs, nil
+}
+
+// discoverDatabases 把旧版本留下的、含有元数据或数据文件的目录登记为数据库
+// 其余目录（建到一半的、外来的）不算数据库
+func discoverDatabases(dataRoot string) (map[string]DatabaseInfo, error) {
+	dbs := make(map[string]DatabaseInfo)
+	entries, err := os.ReadDir(dataRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(dataRoot, entry.Name())
+		if !fileExists(filepath.Join(dir, MetaFileName)) && !fileExists(filepath.Join(dir, DataFileName)) {
+			continue
+		}
+		info := DatabaseInfo{
+			Name:        entry.Name(),
+			PageSize:    ReadCatalogPageSize(filepath.Join(dir, MetaFileName)),
+			Tablespaces: ReadCatalogTablespaces(filepath.Join(dir, MetaFileName)),
+		}
+		if fi, err := entry.Info(); err == nil {
+			info.CreatedAt = fi.ModTime()
+		}
+		dbs[info.Name] = info
+	}
+	return dbs, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// saveRegistry 与 Catalog 一样先写临时文件再 rename，保证注册表不会写坏
+func saveRegistry(dataRoot string, dbs map[string]DatabaseInfo) error {
+	rf := registryFile{Version: registryVersion, Databases: sortedDatabases(dbs)}
+	data, err := json.MarshalIndent(rf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dataRoot, RegistryFileName)
+	tmpFile := path + ".tmp"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
+func sortedDatabases(dbs map[string]DatabaseInfo) []DatabaseInfo {
+	list := make([]DatabaseInfo, 0, len(dbs))
+	for _, info := range dbs {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ListDatabases 返回注册表中的所有数据库，按名称排序
+func (e *Engine) ListDatabases() ([]DatabaseInfo, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	dbs, err := loadRegistry(e.DataRoot)
+	if err != nil {
+		return nil, err
+	}
+	return sortedDatabases(dbs), nil
+}
+
+// HasDatabase 报告数据库是否已注册
+func (e *Engine) HasDatabase(name string) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	dbs, err := loadRegistry(e.DataRoot)
+	if err != nil {
+		return false
+	}
+	_, ok := dbs[name]
+	return ok
+}
@@ -0,0 +1,292 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"minidb/pkg/storage/page"
+)
+
+func TestDatabaseRegistry(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+
+	if err := e.CreateDatabaseWithPageSize("big", 8192); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateDatabase("small"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateDatabase("small"); err == nil {
+		t.Error("duplicate database should be rejected")
+	}
+	// 不是通过 CreateDatabase 建的目录不算数据库
+	os.Mkdir(filepath.Join(root, "junk"), 0755)
+
+	dbs, err := e.ListDatabases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dbs) != 2 || dbs[0].Name != "big" || dbs[0].PageSize != 8192 || dbs[1].Name != "small" {
+		t.Fatalf("unexpected databases: %+v", dbs)
+	}
+	if dbs[0].CreatedAt.IsZero() {
+		t.Error("creation time not recorded")
+	}
+	if err := e.UseDatabase("junk"); err == nil {
+		t.Error("use of an unregistered directory should fail")
+	}
+
+	if err := e.DropDatabase("big"); err != nil {
+		t.Fatal(err)
+	}
+	if e.HasDatabase("big") || fileExists(filepath.Join(root, "big")) {
+		t.Error("dropped database still present")
+	}
+	if err := e.DropDatabase("junk"); err == nil {
+		t.Error("dropping an unregistered directory should fail")
+	}
+}
+
+func TestDatabaseRegistryMigration(t *testing.T) {
+	root := t.TempDir()
+	// 旧版本的数据目录：没有 databases.json，库目录里有 meta.json 或 data.db
+	os.MkdirAll(filepath.Join(root, "withmeta"), 0755)
+	InitCatalogFile(filepath.Join(root, "withmeta", MetaFileName), 16384)
+	os.MkdirAll(filepath.Join(root, "withdata"), 0755)
+	os.WriteFile(filepath.Join(root, "withdata", DataFileName), nil, 0644)
+	os.MkdirAll(filepath.Join(root, "empty"), 0755)
+
+	e := NewEngine(root)
+	names, err := e.ShowDatabases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "withdata" || names[1] != "withmeta" {
+		t.Fatalf("migrated databases = %v", names)
+	}
+	dbs, _ := e.ListDatabases()
+	if dbs[1].PageSize != 16384 {
+		t.Errorf("page size not migrated: %+v", dbs[1])
+	}
+	if !fileExists(filepath.Join(root, RegistryFileName)) {
+		t.Error("registry file not written after migration")
+	}
+}
+
+func TestDatabaseConfig(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+	e.Defaults = DatabaseOptions{Durability: DurabilitySync}
+
+	p := NewSQLParser(e, io.Discard)
+	if err := p.ParseAndExecute("create database a with (page_size = 8192, compression = flate)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateDatabase("b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"create database c with (durability = later)",
+		"create database c with (compression = zstd)",
+		"create database c with (page_size = 1000)",
+		"create database c with (color = blue)",
+	} {
+		if err := p.ParseAndExecute(sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+	if e.HasDatabase("c") {
+		t.Error("database created despite invalid options")
+	}
+
+	// 服务器默认值在建库时写进配置，之后修改默认值不影响已有的库
+	e = NewEngine(root)
+	e.Defaults = DatabaseOptions{Compression: CompressionFlate}
+	want := map[string]DatabaseConfig{
+		"a": {PageSize: 8192, Tablespaces: 1, Compression: CompressionFlate, Durability: DurabilitySync},
+		"b": {PageSize: page.PageSize, Tablespaces: 1, Compression: CompressionNone, Durability: DurabilitySync},
+	}
+	for name, cfg := range want {
+		if err := e.UseDatabase(name); err != nil {
+			t.Fatal(err)
+		}
+		if got := e.DatabaseConfig(); got != cfg {
+			t.Errorf("%s: config %+v, want %+v", name, got, cfg)
+		}
+		if !e.SyncOnCommit {
+			t.Errorf("%s: durability = sync should turn on sync_on_commit", name)
+		}
+	}
+
+	// 没有 config.json 的旧数据库：页大小取自 meta.json，其余取当前的默认值
+	os.Remove(filepath.Join(root, "a", ConfigFileName))
+	cfg, err := ReadDatabaseConfig(filepath.Join(root, "a"), e.Defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PageSize != 8192 || cfg.Compression != CompressionFlate || cfg.Durability != DurabilityAsync {
+		t.Errorf("config of a database without config.json: %+v", cfg)
+	}
+}
+
+// 建表时没有指定 compression 的表按库的配置压缩，二进制编码的表不受影响
+func TestDatabaseDefaultCompression(t *testing.T) {
+	e := newTestEngine(t)
+	e.config.Compression = CompressionFlate
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{
+		"create table plain (id int, name string)",
+		"create table raw (id int, name string) with (compression = none)",
+		"create table nums (id int, n int) with (value_encoding = binary)",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for name, want := range map[string]string{"plain": "flate", "raw": "", "nums": ""} {
+		if meta, _ := e.Catalog.GetTable(name); meta.Compression != want {
+			t.Errorf("%s: compression %q, want %q", name, meta.Compression, want)
+		}
+	}
+}
+
+func TestUseDatabaseRefCount(t *testing.T) {
+	e := NewEngine(t.TempDir())
+	defer e.Close()
+	for _, name := range []string{"db1", "db2"} {
+		if err := e.CreateDatabase(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 两个会话同时使用不同的库，各自的同名表互不影响
+	s1, s2 := e.NewSession(), e.NewSession()
+	var wg sync.WaitGroup
+	for i, s := range []*Engine{s1, s2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("db%d", i+1)
+			if err := s.UseDatabase(name); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := s.CreateTable("t", "id int,name string"); err != nil {
+				t.Error(err)
+				return
+			}
+			for k := int64(0); k < 200; k++ {
+				if err := s.Insert("t", k, name); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s1.BPM == s2.BPM {
+		t.Fatal("sessions on different databases share a buffer pool")
+	}
+	for i, s := range []*Engine{s1, s2} {
+		if val, _ := s.SelectById("t", 7); val != fmt.Sprintf("db%d", i+1) {
+			t.Errorf("session %d read %q", i+1, val)
+		}
+	}
+
+	// 再次 use 同一个库不会重新打开，另一个会话 use 它时共享同一份资源
+	bpm := s1.BPM
+	if err := s1.UseDatabase("db1"); err != nil || s1.BPM != bpm {
+		t.Fatalf("use of the current database reopened it: %v", err)
+	}
+	s3 := e.NewSession()
+	if err := s3.UseDatabase("db1"); err != nil || s3.BPM != bpm {
+		t.Fatalf("second session opened db1 again: %v", err)
+	}
+
+	// 有会话在用的库不能删除，最后一个会话离开后才能删
+	if err := e.DropDatabase("db1"); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("drop of a database in use: %v, want ErrDatabaseInUse", err)
+	}
+	if err := s1.UseDatabase("db2"); err != nil || s1.BPM != s2.BPM {
+		t.Fatalf("switch to db2: %v", err)
+	}
+	if err := e.DropDatabase("db1"); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("drop of a database in use by one session: %v, want ErrDatabaseInUse", err)
+	}
+	s3.Close()
+	if err := e.DropDatabase("db1"); err != nil {
+		t.Fatalf("drop after the last session left: %v", err)
+	}
+
+	// 事务中不能切换库
+	if err := e.CreateDatabase("db3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.UseDatabase("db3"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("switch inside a transaction: %v, want ErrUnsupported", err)
+	}
+	s2.Rollback()
+
+	// 最后一个会话关闭时数据已经写回，重新打开后还在
+	s1.Close()
+	s2.Close()
+	s4 := e.NewSession()
+	defer s4.Close()
+	if err := s4.UseDatabase("db2"); err != nil {
+		t.Fatal(err)
+	}
+	if val, found := s4.SelectById("t", 199); !found || val != "db2" {
+		t.Errorf("db2 after reopening: %q, %v", val, found)
+	}
+}
+
+func TestSessionTablesIsolated(t *testing.T) {
+	e := NewEngine(t.TempDir())
+	defer e.Close()
+	for _, name := range []string{"db1", "db2"} {
+		if err := e.CreateDatabase(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s1, s2 := e.NewSession(), e.NewSession()
+	defer s1.Close()
+	defer s2.Close()
+	if _, err := s1.ShowTables(); !errors.Is(err, ErrNoDatabase) {
+		t.Fatalf("show tables before use: %v, want ErrNoDatabase", err)
+	}
+	if err := s1.UseDatabase("db1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.UseDatabase("db2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"b", "a"} {
+		if err := s1.CreateTable(table, "id int,name string"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s2.CreateTable("c", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个会话只看到自己所选库中的表
+	for s, want := range map[*Engine][]string{s1: {"a", "b"}, s2: {"c"}} {
+		tables, err := s.ShowTables()
+		if err != nil || !slices.Equal(tables, want) {
+			t.Errorf("%s: show tables = %v, %v, want %v", s.CurrentDB, tables, err, want)
+		}
+	}
+	if err := s2.Insert("a", 1, "x"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("db2 session writing to db1's table: %v, want ErrTableNotFound", err)
+	}
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ResultSet 是一条语句的执行结果。SQLParser.Execute 和 Engine.Execute 返回它，由调用方决定怎样输出：
+// 网络层用 SQLParser.WriteResult 按会话的 output_format 格式化成文本，测试和嵌入使用时直接读取字段
+type ResultSet struct {
+	Columns  []string   // 结果集的列名，没有结果集的语句（insert、use 等）为 nil
+	Rows     [][]string // 结果集的行，NULL 为 "NULL"
+	Affected int64      // insert、delete、commit 写入的行数
+	// Message 是给人看的执行结果，例如 "Database changed to 'mydb'."，可以有多行；文本输出时在结果集之前
+	Message string
+
+	layout resultLayout // 文本输出时结果集的格式
+}
+
+// resultLayout 是结果集输出成文本时的格式
+type resultLayout int
+
+const (
+	layoutFormat  resultLayout = iota // 按会话的 output_format
+	layoutTable                       // 总是表格（show databases 等），带行数
+	layoutMessage                     // Message 中已经包含了结果集（show tables），不再输出
+)
+
+// WriteResult 把 Execute 返回的结果输出到 Output：先输出 Message，再输出结果集
+// JSON 格式供程序读取，不附加行数提示
+func (p *SQLParser) WriteResult(rs *ResultSet) {
+	if rs == nil {
+		return
+	}
+	if rs.Message != "" {
+		fmt.Fprintln(p.Output, rs.Message)
+	}
+	if rs.Columns == nil || rs.layout == layoutMessage {
+		return
+	}
+	format := p.outputFormat
+	if rs.layout == layoutTable {
+		format = OutputTable
+	}
+	switch format {
+	case OutputJSON:
+		fmt.Fprintln(p.Output, formatJSON(rs.Columns, rs.Rows))
+		return
+	case OutputTable:
+		fmt.Fprintln(p.Output, formatTable(rs.Columns, rs.Rows))
+	default:
+		fmt.Fprintln(p.Output, formatPlain(rs.Columns, rs.Rows))
+	}
+	if len(rs.Rows) == 1 {
+		fmt.Fprintln(p.Output, "(1 row)")
+	} else {
+		fmt.Fprintf(p.Output, "(%d rows)\n", len(rs.Rows))
+	}
+}
+
+// Execute 在本引擎（会话）上执行一条语句并返回结果，供测试和嵌入使用
+// 每次调用用一个新的 SQLParser，history、output_format 等解析器的设置不会保留，事务和当前库保存在引擎中，会保留；
+// copy ... from stdin 需要之后的输入，不支持
+func (e *Engine) Execute(sql string) (*ResultSet, error) {
+	if reCopy.MatchString(strings.TrimSuffix(strings.TrimSpace(sql), ";")) {
+		return nil, errorf(ErrUnsupported, "copy from stdin needs a client connection, use insert instead")
+	}
+	return NewSQLParser(e, io.Discard).Execute(sql)
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rowCache 缓存点查（SelectById）的结果：主键 -> 解码后的值，不存在的主键也缓存
+// 缓冲池命中时点查仍要从根走到叶子，热点 Key 反复查询时直接从这里返回。
+// 每张表一个 LRU，写入（插入、覆盖、回滚）后按 Key 失效，删表时整表清空；
+// TTL 限制条目最长能用多久，兜底那些不经过引擎的修改。由同一引擎派生的所有会话共享
+type rowCache struct {
+	mu     sync.Mutex
+	size   int           // 每张表最多缓存的 Key 数，0 表示关闭
+	ttl    time.Duration // 条目的有效期，0 表示不过期
+	now    func() time.Time
+	tables map[string]*tableCache
+
+	hits, misses int64 // 关闭时每次点查都计为 miss
+}
+
+// tableCache 是一张表的 LRU，gen 在每次失效时增加：
+// 查询未命中后读树期间如果发生了写入，读到的值可能已经过时，不能再放进缓存
+type tableCache struct {
+	gen   uint64
+	lru   *list.List // 头部是最近使用
+	items map[int64]*list.Element
+}
+
+type cacheEntry struct {
+	key     int64
+	value   string
+	found   bool
+	expires time.Time
+}
+
+func newRowCache() *rowCache {
+	return &rowCache{now: time.Now, tables: make(map[string]*tableCache)}
+}
+
+// EnableRowCache 打开点查结果缓存，每张表最多 size 个 Key，条目 ttl 后过期（0 表示不过期）
+// size <= 0 时关闭并清空缓存，对所有会话生效
+func (e *Engine) EnableRowCache(size int, ttl time.Duration) {
+	c := e.rowCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = max(size, 0)
+	c.ttl = ttl
+	c.tables = make(map[string]*tableCache)
+}
+
+// RowCacheStats 返回点查缓存的命中和未命中次数；未命中的点查都要查找 B+ 树
+func (e *Engine) RowCacheStats() (hits, misses int64) {
+	c := e.rowCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+func (c *rowCache) table(name string) *tableCache {
+	t, ok := c.tables[name]
+	if !ok {
+		t = &tableCache{lru: list.New(), items: make(map[int64]*list.Element)}
+		c.tables[name] = t
+	}
+	return t
+}
+
+// get 查询缓存，ok 为 false 表示未命中；gen 在未命中后调用 put 时传回
+func (c *rowCache) get(tableName string, key int64) (value string, found, ok bool, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		c.misses++
+		return "", false, false, 0
+	}
+	t := c.table(tableName)
+	if elem, hit := t.items[key]; hit {
+		entry := elem.Value.(*cacheEntry)
+		if c.ttl == 0 || c.now().Before(entry.expires) {
+			t.lru.MoveToFront(elem)
+			c.hits++
+			return entry.value, entry.found, true, t.gen
+		}
+		t.lru.Remove(elem)
+		delete(t.items, key)
+	}
+	c.misses++
+	return "", false, false, t.gen
+}
+
+// put 放入一次树查找的结果；gen 与 get 时不同说明期间有写入，丢弃结果
+func (c *rowCache) put(tableName string, gen uint64, key int64, value string, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return
+	}
+	t := c.table(tableName)
+	if t.gen != gen {
+		return
+	}
+	entry := &cacheEntry{key: key, value: value, found: found, expires: c.now().Add(c.ttl)}
+	if elem, ok := t.items[key]; ok {
+		elem.Value = entry
+		t.lru.MoveToFront(elem)
+		return
+	}
+	t.items[key] = t.lru.PushFront(entry)
+	for t.lru.Len() > c.size {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate 在写入表之后调用，丢弃这些 Key 的缓存
+func (c *rowCache) invalidate(tableName string, keys ...int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[tableName]
+	if !ok {
+		return
+	}
+	t.gen++
+	for _, key := range keys {
+		if elem, ok := t.items[key]; ok {
+			t.lru.Remove(elem)
+			delete(t.items, key)
+		}
+	}
+}
+
+// drop 在删表时清空整张表的缓存，避免同名新表读到旧数据
+func (c *rowCache) drop(tableName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tables[tableName]; ok {
+		t.clear()
+	}
+}
+
+// dropDatabase 在删库时清空库中所有表的缓存，避免同名新库读到旧数据
+func (c *rowCache) dropDatabase(db string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, t := range c.tables {
+		if strings.HasPrefix(name, db+".") {
+			t.clear()
+		}
+	}
+}
+
+func (t *tableCache) clear() {
+	t.gen++
+	t.lru.Init()
+	t.items = make(map[int64]*list.Element)
+}
+
+// cacheName 是表在缓存中的名字，带上库名，切换数据库后不会读到另一个库的同名表
+func (e *Engine) cacheName(tableName string) string {
+	return e.CurrentDB + "." + tableName
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRowCache(t *testing.T) {
+	e := newTestEngine(t)
+	columns, err := ParseSchema("id int primary key, name varchar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTableSchema("t", columns, TableOptions{OnConflict: ConflictReplace}); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := e.Insert("t", i, "v"+strconv.FormatInt(i, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Unix(0, 0)
+	e.EnableRowCache(2, time.Second)
+	e.rowCache.now = func() time.Time { return now }
+
+	lookup := func(key int64, want string, wantFound bool) {
+		t.Helper()
+		got, found := e.SelectById("t", key)
+		if got != want || found != wantFound {
+			t.Fatalf("SelectById(%d) = %q, %v; want %q, %v", key, got, found, want, wantFound)
+		}
+	}
+	misses := func(want int64) {
+		t.Helper()
+		if _, got := e.RowCacheStats(); got != want {
+			t.Fatalf("misses = %d, want %d", got, want)
+		}
+	}
+
+	lookup(1, "v1", true)
+	lookup(1, "v1", true)
+	misses(1)
+
+	// 不存在的 Key 也缓存；其他会话共享同一份缓存
+	s := e.NewSession()
+	s.CurrentDB = e.CurrentDB
+	lookup(9, "", false)
+	if _, found := s.SelectById("t", 9); found {
+		t.Fatal("key 9 should not exist")
+	}
+	misses(2)
+
+	// 写入使缓存失效：另一个会话覆盖 1、插入 9
+	if err := s.Insert("t", 1, "w1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertRows("t", []Row{{Key: 9, Value: "v9"}}); err != nil {
+		t.Fatal(err)
+	}
+	lookup(1, "w1", true)
+	lookup(9, "v9", true)
+	misses(4)
+
+	// 容量 2：访问 3 后淘汰最久未用的 1
+	lookup(3, "v3", true)
+	lookup(9, "v9", true)
+	lookup(1, "w1", true)
+	misses(6)
+
+	// 过期后重新查树
+	now = now.Add(2 * time.Second)
+	lookup(1, "w1", true)
+	misses(7)
+
+	// 删表后同名新表不会读到旧值
+	if err := e.DropTable("t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	lookup(1, "", false)
+}
+
+// 偏斜的点查：少数热点 Key 占了大部分查询，报告每次点查平均查找 B+ 树的次数
+func benchmarkPointLookupZipf(b *testing.B, cacheSize int) {
+	const rows = 10000
+	e := newTestEngine(b)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		b.Fatal(err)
+	}
+	batch := make([]Row, rows)
+	for i := range batch {
+		batch[i] = Row{Key: int64(i), Value: "name-" + strconv.Itoa(i)}
+	}
+	if err := e.InsertBatch("t", batch); err != nil {
+		b.Fatal(err)
+	}
+	e.EnableRowCache(cacheSize, time.Minute)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, rows-1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, found := e.SelectById("t", int64(zipf.Uint64())); !found {
+			b.Fatal("key not found")
+		}
+	}
+	b.StopTimer()
+	_, misses := e.RowCacheStats()
+	b.ReportMetric(float64(misses)/float64(b.N), "descents/op")
+}
+
+func BenchmarkPointLookupZipfNoCache(b *testing.B)  { benchmarkPointLookupZipf(b, 0) }
+func BenchmarkPointLookupZipfRowCache(b *testing.B) { benchmarkPointLookupZipf(b, 256) }
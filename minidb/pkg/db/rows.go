@@ -0,0 +1,250 @@
+package db
+
+import (
+	"errors"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/index"
+	"minidb/pkg/storage/page"
+	"strconv"
+	"strings"
+)
+
+// Row 是一行解码后的数据：主键 + 其余列（逗号拼接的字符串）
+type Row struct {
+	Key    int64
+	StrKey string // 字符串主键的表的主键，此时 Key 不用，见 strkey.go
+	Value  string
+	RID    RID // 读取时行所在的位置，点查得到的行为零值
+}
+
+// RID 是行的物理位置：叶子页号 + 页内槽位
+// 只反映读取那一刻的位置，之后的插入/分裂可能把行移走
+type RID struct {
+	Page page.PageID
+	Slot int32
+}
+
+// Cells 把一行拆成各列的文本：主键在前，其余列按逗号拆开
+func (r Row) Cells() []string {
+	cells := []string{strconv.FormatInt(r.Key, 10)}
+	if r.StrKey != "" {
+		cells[0] = r.StrKey
+	}
+	// 只有主键的行在存储时用一个空格占位
+	if strings.TrimSpace(r.Value) == "" {
+		return cells
+	}
+	return append(cells, strings.Split(r.Value, ",")...)
+}
+
+// ScanBatchSize 行迭代器每次从树中读取的行数
+// 读完一批就释放页面，下一批从上次的位置重新定位，慢速消费者不会长期占住缓冲池
+const ScanBatchSize = 128
+
+// RowIterator 是供嵌入方使用的行迭代器
+// 用法：
+//
+//	it, err := engine.ScanRange("t", 1, 100)
+//	defer it.Close()
+//	for it.Next() {
+//		row := it.Row()
+//	}
+//
+// 行按批读取：读取一批时短暂 Pin 住叶子页，两次 Next 之间不持有任何页面，
+// 所以消费端（比如写慢速的 socket）再慢也不会饿死缓冲池。
+// 代价是批与批之间没有快照隔离，期间提交的插入/删除可能会被看到。
+// 提前放弃迭代时仍应调用 Close 释放已缓存的行；Next 返回 false 后用 Err 检查是否因出错而结束
+type RowIterator struct {
+	engine    *Engine
+	table     string
+	next      int64 // 下一批的起始 Key（检查点）；desc 时是下一批的最大 Key
+	low       int64
+	high      int64
+	desc      bool // 按主键从大到小，见 ScanRangeDesc
+	batchSize int
+
+	batch []Row
+	pos   int
+	done  bool // 树中已没有更多的行
+	row   Row
+	err   error
+}
+
+// Next 移动到下一行，没有更多行时返回 false
+func (r *RowIterator) Next() bool {
+	if r.pos >= len(r.batch) {
+		if r.done {
+			return false
+		}
+		if err := r.fill(); err != nil || len(r.batch) == 0 {
+			r.err = err
+			r.done = true
+			return false
+		}
+	}
+	r.row = r.batch[r.pos]
+	r.pos++
+	return true
+}
+
+// fill 从检查点重新定位并读取下一批行，返回前释放所有页面
+// 每批都从 Catalog 取最新的根页，两批之间树分裂导致根变化也能继续
+func (r *RowIterator) fill() error {
+	r.batch = r.batch[:0]
+	r.pos = 0
+
+	meta, ok := r.engine.Catalog.GetTable(r.table)
+	if !ok {
+		return errorf(ErrTableNotFound, "table '%s' not found", r.table)
+	}
+	defer r.engine.readTable(r.table)()
+	defer r.engine.enterRead()()
+	tree := index.NewBPlusTree(r.engine.Catalog.TableRoot(meta), r.engine.BPM)
+	var it treeCursor
+	if r.desc {
+		if rit := tree.ReverseScan(r.low, r.next); rit != nil {
+			it = rit
+		}
+	} else if fit := tree.Scan(r.next, r.high); fit != nil {
+		it = fit
+	}
+	if it == nil {
+		r.done = true
+		return treeError(r.table, tree.Err())
+	}
+	defer it.Close()
+
+	for {
+		r.batch = append(r.batch, Row{
+			Key:   it.Key(),
+			Value: decodeValue(meta, it.ValueRef()),
+			RID:   RID{Page: it.PageID(), Slot: it.Slot()},
+		})
+		if len(r.batch) >= r.batchSize {
+			break
+		}
+		if !it.Next() {
+			r.done = true
+			return treeError(r.table, it.Err())
+		}
+	}
+
+	last := r.batch[len(r.batch)-1].Key
+	switch {
+	case r.desc && last <= r.low, !r.desc && last >= r.high:
+		r.done = true
+	case r.desc:
+		r.next = last - 1
+	default:
+		r.next = last + 1
+	}
+	return nil
+}
+
+// treeCursor 是 fill 用到的 index.TreeIterator 和 index.ReverseIterator 的公共方法
+type treeCursor interface {
+	Key() int64
+	ValueRef() []byte
+	PageID() page.PageID
+	Slot() int32
+	Next() bool
+	Err() error
+	Close()
+}
+
+// Err 返回迭代过程中的错误，正常读完所有行时为 nil
+func (r *RowIterator) Err() error {
+	return r.err
+}
+
+// treeError 把遍历树时发现的结构错误和页面校验和错误转换成带错误码的错误，err 为 nil 时返回 nil
+func treeError(tableName string, err error) error {
+	switch {
+	case errors.Is(err, index.ErrTreeCorrupt):
+		return errorf(ErrTreeCorrupt, "table '%s': %v", tableName, err)
+	case errors.Is(err, disk.ErrChecksumMismatch):
+		return errorf(ErrPageCorrupt, "table '%s': %v", tableName, err)
+	}
+	return err
+}
+
+// Row 返回当前行，需在 Next 返回 true 之后调用
+func (r *RowIterator) Row() Row {
+	return r.row
+}
+
+// Close 结束迭代并丢弃缓存的行，可重复调用
+func (r *RowIterator) Close() {
+	r.done = true
+	r.batch = nil
+	r.pos = 0
+}
+
+// ScanRange 返回主键在 [low, high] 内的行迭代器，调用方负责 Close
+func (e *Engine) ScanRange(tableName string, low, high int64) (*RowIterator, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, err
+	}
+	if err := e.checkTxRead(tableName); err != nil {
+		return nil, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return nil, err
+	}
+	// 单个 Key 的范围就是点查，可以先问布隆过滤器
+	empty := low > high
+	if !empty && low == high {
+		unlock := e.readTable(tableName)
+		empty = !e.bloomMayContain(tableName, meta, low)
+		unlock()
+	}
+	return &RowIterator{
+		engine:    e,
+		table:     tableName,
+		next:      low,
+		high:      high,
+		batchSize: ScanBatchSize,
+		done:      empty,
+	}, nil
+}
+
+// ScanRangeDesc 与 ScanRange 相同，但按主键从大到小返回行，见 index.ReverseIterator
+func (e *Engine) ScanRangeDesc(tableName string, low, high int64) (*RowIterator, error) {
+	it, err := e.ScanRange(tableName, low, high)
+	if err != nil {
+		return nil, err
+	}
+	it.desc = true
+	it.low, it.next = low, high
+	return it, nil
+}
+
+// scanUnordered 按物理页序扫描整张表，对每一行调用 fn，fn 返回 false 时停止
+// 行序与主键无关，供聚合等不关心顺序的查询使用，见 BPlusTree.ScanPhysical。
+// 扫描期间一次 Pin 住一个叶子页，fn 应当很快返回
+func (e *Engine) scanUnordered(tableName string, fn func(Row) bool) error {
+	if err := e.EnsureDBSelected(); err != nil {
+		return err
+	}
+	if err := e.checkTxRead(tableName); err != nil {
+		return err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return err
+	}
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	err := tree.ScanPhysical(func(key int64, value []byte) bool {
+		return fn(Row{Key: key, Value: decodeValue(meta, value)})
+	})
+	return treeError(tableName, err)
+}
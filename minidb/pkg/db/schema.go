@@ -0,0 +1,272 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ColumnType 是列的声明类型
+type ColumnType int
+
+const (
+	TypeInt     ColumnType = iota // 32 位整数
+	TypeBigInt                    // 64 位整数
+	TypeVarchar                   // 字符串
+	TypeBool
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case TypeInt:
+		return "int"
+	case TypeBigInt:
+		return "bigint"
+	case TypeVarchar:
+		return "varchar"
+	case TypeBool:
+		return "bool"
+	}
+	return fmt.Sprintf("ColumnType(%d)", int(t))
+}
+
+// IsInteger 报告该类型是否为整数
+func (t ColumnType) IsInteger() bool {
+	return t == TypeInt || t == TypeBigInt
+}
+
+// CanBeKey 报告该类型能否作为主键：整数主键存在 BPlusTree 中，varchar 主键存在 BPlusTreeStr 中
+func (t ColumnType) CanBeKey() bool {
+	return t.IsInteger() || t == TypeVarchar
+}
+
+// columnTypeNames 把 SQL 中的类型名（含常见别名）映射到 ColumnType
+var columnTypeNames = map[string]ColumnType{
+	"int":     TypeInt,
+	"integer": TypeInt,
+	"bigint":  TypeBigInt,
+	"varchar": TypeVarchar,
+	"string":  TypeVarchar,
+	"text":    TypeVarchar,
+	"bool":    TypeBool,
+	"boolean": TypeBool,
+}
+
+// ParseColumnType 解析类型名，不区分大小写
+func ParseColumnType(name string) (ColumnType, error) {
+	t, ok := columnTypeNames[strings.ToLower(name)]
+	if !ok {
+		return 0, errorf(ErrInvalidSchema, "unknown column type '%s'", name)
+	}
+	return t, nil
+}
+
+// Column 描述表中的一列
+type Column struct {
+	Name          string
+	Type          ColumnType
+	PrimaryKey    bool
+	AutoIncrement bool // 插入时主键写 null 或 default，由表自动分配
+}
+
+// TableOptions 是建表时的附加选项
+type TableOptions struct {
+	IfNotExists bool           // 表已存在时不报错
+	Tablespace  int            // 表的页面存放在哪个数据文件，必须小于建库时的表空间个数
+	OnConflict  ConflictPolicy // 插入重复主键时的默认行为，空值等同于 ConflictError
+	Encoding    ValueEncoding  // 值列的存储格式，空值等同于 EncodingText
+	Compression Compression    // 值的压缩方式，空值等同于 CompressionNone
+	Temporary   bool           // 临时表，只对当前会话可见，会话结束时删除，见 temptable.go
+}
+
+// ConflictPolicy 是表级的主键冲突策略，记录在表的元数据中
+type ConflictPolicy string
+
+const (
+	ConflictError   ConflictPolicy = "error"   // 报错，批量插入整体回滚
+	ConflictReplace ConflictPolicy = "replace" // 用新值覆盖已有的行
+	ConflictIgnore  ConflictPolicy = "ignore"  // 跳过这一行
+)
+
+// ParseConflictPolicy 解析 on_conflict 选项的值，不区分大小写
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch c := ConflictPolicy(strings.ToLower(s)); c {
+	case ConflictError, ConflictReplace, ConflictIgnore:
+		return c, nil
+	}
+	return "", errorf(ErrInvalidValue, "invalid on_conflict '%s' (expected error, replace or ignore)", s)
+}
+
+// ValueEncoding 是叶子槽位中值的存储格式，记录在表的元数据中
+type ValueEncoding string
+
+const (
+	EncodingText   ValueEncoding = "text"   // 非主键列按逗号拼接成字符串
+	EncodingBinary ValueEncoding = "binary" // 唯一的 int 值列存成定长二进制，见 encodeBinaryValue
+)
+
+// ParseValueEncoding 解析 value_encoding 选项的值，不区分大小写
+func ParseValueEncoding(s string) (ValueEncoding, error) {
+	switch v := ValueEncoding(strings.ToLower(s)); v {
+	case EncodingText, EncodingBinary:
+		return v, nil
+	}
+	return "", errorf(ErrInvalidValue, "invalid value_encoding '%s' (expected text or binary)", s)
+}
+
+// ParseSchema 解析 create table 括号中的列定义，例如 "id int primary key, name varchar"
+// 没有显式声明主键时，第一列作为主键
+func ParseSchema(def string) ([]Column, error) {
+	var columns []Column
+	for _, part := range strings.Split(def, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			return nil, errorf(ErrInvalidSchema, "empty column definition in '%s'", def)
+		}
+		if len(fields) < 2 {
+			return nil, errorf(ErrInvalidSchema, "column '%s' has no type", fields[0])
+		}
+		typ, err := ParseColumnType(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		col := Column{Name: fields[0], Type: typ}
+
+		switch rest := strings.ToLower(strings.Join(fields[2:], " ")); rest {
+		case "":
+		case "primary key":
+			col.PrimaryKey = true
+		case "auto_increment":
+			col.AutoIncrement = true
+		case "primary key auto_increment", "auto_increment primary key":
+			col.PrimaryKey = true
+			col.AutoIncrement = true
+		default:
+			return nil, errorf(ErrInvalidSchema, "unsupported column option '%s' on column '%s'", strings.Join(fields[2:], " "), col.Name)
+		}
+		columns = append(columns, col)
+	}
+
+	hasPK := false
+	for _, c := range columns {
+		hasPK = hasPK || c.PrimaryKey
+	}
+	if !hasPK && len(columns) > 0 {
+		columns[0].PrimaryKey = true
+	}
+	return columns, nil
+}
+
+// FormatSchema 把列定义还原成 Catalog 中保存的规范文本形式
+func FormatSchema(columns []Column) string {
+	defs := make([]string, 0, len(columns))
+	for _, c := range columns {
+		def := c.Name + " " + c.Type.String()
+		if c.PrimaryKey {
+			def += " primary key"
+		}
+		if c.AutoIncrement {
+			def += " auto_increment"
+		}
+		defs = append(defs, def)
+	}
+	return strings.Join(defs, ", ")
+}
+
+// Columns 返回解析后的列定义，第一次调用时解析 Schema 并缓存（建表之后 Schema 不再改变）
+// 旧版本建的表可能是解析不了的自由格式 Schema，此时返回 nil，插入时不做类型检查
+func (m *TableMeta) Columns() []Column {
+	m.columnsOnce.Do(func() {
+		if columns, err := ParseSchema(m.Schema); err == nil {
+			m.columns = columns
+		}
+	})
+	return m.columns
+}
+
+// checkKeyRange 检查主键值能否放进声明的整数类型：int 为 32 位，bigint 为 64 位
+// columns 为 nil（自由格式 Schema）时不做检查
+func checkKeyRange(columns []Column, key int64) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	pk := columns[0]
+	if pk.Type == TypeInt && (key < math.MinInt32 || key > math.MaxInt32) {
+		return errorf(ErrInvalidValue, "key %d out of range for int column '%s'", key, pk.Name)
+	}
+	return nil
+}
+
+// isNullValue 判断一个单元格是不是 NULL：空值和 null（不区分大小写）都是 NULL
+func isNullValue(v string) bool {
+	v = strings.TrimSpace(v)
+	return v == "" || strings.EqualFold(v, "null")
+}
+
+// checkRowValues 检查逗号拼接的非主键列的值与列定义是否相符：值的个数不能多于列数，每个值要能按列类型解析
+// 少写的末尾列和空值、null 都是 NULL，不做检查；columns 为 nil（自由格式 Schema）时不做检查
+func checkRowValues(columns []Column, value string) error {
+	if len(columns) == 0 || strings.TrimSpace(value) == "" {
+		return nil
+	}
+	fields := strings.Split(value, ",")
+	if len(fields) > len(columns)-1 {
+		return errorf(ErrInvalidValue, "table has %d columns, got %d values", len(columns), len(fields)+1)
+	}
+	for i, field := range fields {
+		col, v := columns[i+1], strings.TrimSpace(field)
+		if isNullValue(v) {
+			continue
+		}
+		var err error
+		switch col.Type {
+		case TypeInt:
+			_, err = strconv.ParseInt(v, 10, 32)
+		case TypeBigInt:
+			_, err = strconv.ParseInt(v, 10, 64)
+		case TypeBool:
+			_, err = strconv.ParseBool(v)
+		}
+		if err != nil {
+			return errorf(ErrInvalidValue, "column '%s' expects %s, got '%s'", col.Name, col.Type, v)
+		}
+	}
+	return nil
+}
+
+// validateColumns 检查列定义能否落到存储上：
+// 主键必须是唯一的一列、位于第一列（插入时第一个值作为 Key），且为整数或 varchar
+func validateColumns(columns []Column) error {
+	if len(columns) == 0 {
+		return errorf(ErrInvalidSchema, "table must have at least one column")
+	}
+	seen := make(map[string]bool, len(columns))
+	for i, c := range columns {
+		if err := checkIdentifier("column name", c.Name); err != nil {
+			return err
+		}
+		lower := strings.ToLower(c.Name)
+		if seen[lower] {
+			return errorf(ErrInvalidSchema, "duplicate column name '%s'", c.Name)
+		}
+		seen[lower] = true
+
+		if c.PrimaryKey && i != 0 {
+			return errorf(ErrInvalidSchema, "primary key column '%s' must be the first column", c.Name)
+		}
+		if c.AutoIncrement && !c.PrimaryKey {
+			return errorf(ErrInvalidSchema, "auto_increment column '%s' must be the primary key", c.Name)
+		}
+	}
+	if !columns[0].PrimaryKey {
+		return errorf(ErrInvalidSchema, "first column '%s' must be the primary key", columns[0].Name)
+	}
+	if !columns[0].Type.CanBeKey() {
+		return errorf(ErrInvalidSchema, "primary key column '%s' must be int, bigint or varchar, got %s", columns[0].Name, columns[0].Type)
+	}
+	if columns[0].AutoIncrement && !columns[0].Type.IsInteger() {
+		return errorf(ErrInvalidSchema, "auto_increment column '%s' must be int or bigint", columns[0].Name)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	cols, err := ParseSchema("id BIGINT, name string, active bool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{Name: "id", Type: TypeBigInt, PrimaryKey: true},
+		{Name: "name", Type: TypeVarchar},
+		{Name: "active", Type: TypeBool},
+	}
+	if len(cols) != len(want) {
+		t.Fatalf("got %d columns, want %d", len(cols), len(want))
+	}
+	for i := range want {
+		if cols[i] != want[i] {
+			t.Errorf("column %d = %+v, want %+v", i, cols[i], want[i])
+		}
+	}
+	if s := FormatSchema(cols); s != "id bigint primary key, name varchar, active bool" {
+		t.Errorf("FormatSchema = %q", s)
+	}
+
+	for _, bad := range []string{"id", "id float", "id int, , name varchar", "id int unique"} {
+		if _, err := ParseSchema(bad); err == nil {
+			t.Errorf("ParseSchema(%q) should fail", bad)
+		}
+	}
+}
+
+func TestCreateTableSchema(t *testing.T) {
+	e := newTestEngine(t)
+
+	cols := []Column{
+		{Name: "id", Type: TypeInt, PrimaryKey: true},
+		{Name: "name", Type: TypeVarchar},
+	}
+	if err := e.CreateTableSchema("users", cols, TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTableSchema("users", cols, TableOptions{}); err == nil {
+		t.Error("creating an existing table should fail")
+	}
+	if err := e.CreateTableSchema("users", cols, TableOptions{IfNotExists: true}); err != nil {
+		t.Errorf("IfNotExists: %v", err)
+	}
+	names, err := e.TableColumns("users")
+	if err != nil || strings.Join(names, ",") != "id,name" {
+		t.Errorf("TableColumns = %v, %v", names, err)
+	}
+
+	for name, bad := range map[string][]Column{
+		"empty":     nil,
+		"no_pk":     {{Name: "id", Type: TypeInt}},
+		"pk_bool":   {{Name: "id", Type: TypeBool, PrimaryKey: true}},
+		"auto_str":  {{Name: "id", Type: TypeVarchar, PrimaryKey: true, AutoIncrement: true}},
+		"pk_second": {{Name: "name", Type: TypeVarchar}, {Name: "id", Type: TypeInt, PrimaryKey: true}},
+		"dup_col":   {{Name: "id", Type: TypeInt, PrimaryKey: true}, {Name: "ID", Type: TypeInt}},
+	} {
+		if err := e.CreateTableSchema(name, bad, TableOptions{}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestInsertKeyRange(t *testing.T) {
+	e := newTestEngine(t)
+	e.CreateTable("small", "id int, name varchar")
+	e.CreateTable("big", "id bigint, name varchar")
+
+	for _, key := range []int64{math.MaxInt32, math.MinInt32} {
+		if err := e.Insert("small", key, "v"); err != nil {
+			t.Errorf("int key %d: %v", key, err)
+		}
+	}
+	for _, key := range []int64{math.MaxInt32 + 1, math.MinInt32 - 1, math.MaxInt64} {
+		if err := e.Insert("small", key, "v"); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("int key %d: err = %v, want out of range", key, err)
+		}
+	}
+	if err := e.InsertBatch("small", []Row{{Key: 1, Value: "v"}, {Key: math.MaxInt32 + 1, Value: "v"}}); err == nil {
+		t.Error("batch with out-of-range key should fail")
+	}
+	if e.Contains("small", 1) {
+		t.Error("batch partially applied")
+	}
+
+	for _, key := range []int64{math.MaxInt64, math.MinInt64} {
+		if err := e.Insert("big", key, "v"); err != nil {
+			t.Errorf("bigint key %d: %v", key, err)
+		}
+	}
+}
+
+func TestConflictPolicy(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{
+		"create table e (id int, v string)",
+		"create table r (id int, v string) with (on_conflict = 'replace')",
+		"create table i (id int, v string) with (ON_CONFLICT = ignore)",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for _, table := range []string{"e", "r", "i"} {
+		if err := e.Insert(table, 1, "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.Insert("e", 1, "new"); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("error policy: got %v", err)
+	}
+	if err := e.Insert("r", 1, "new"); err != nil {
+		t.Errorf("replace policy: %v", err)
+	}
+	if err := e.Insert("i", 1, "new"); err != nil {
+		t.Errorf("ignore policy: %v", err)
+	}
+	for table, want := range map[string]string{"e": "old", "r": "new", "i": "old"} {
+		if got, _ := e.SelectById(table, 1); got != want {
+			t.Errorf("%s: value %q, want %q", table, got, want)
+		}
+	}
+
+	// 被忽略的行不计入影响行数，也不改变行数缓存
+	n, err := e.InsertRows("i", []Row{{Key: 1, Value: "x"}, {Key: 2, Value: "b"}})
+	if err != nil || n != 1 {
+		t.Errorf("ignore batch: affected %d, err %v", n, err)
+	}
+	if meta, _ := e.Catalog.GetTable("i"); meta.RowCount != 2 {
+		t.Errorf("ignore: row count %d, want 2", meta.RowCount)
+	}
+
+	if err := p.ParseAndExecute("create table x (id int) with (on_conflict = 'merge')"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("bad policy: got %v", err)
+	}
+	if err := p.ParseAndExecute("create table x (id int) with (colour = 'red')"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("unknown option: got %v", err)
+	}
+
+	// 策略保存在元数据中，重新打开后仍然生效
+	e.BPM.FlushAllPages()
+	re := crashAndReopen(t, e)
+	if err := re.Insert("r", 1, "again"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := re.SelectById("r", 1); got != "again" {
+		t.Errorf("after reopen: value %q, want %q", got, "again")
+	}
+}
+
+func TestBinaryValueEncoding(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	if err := p.ParseAndExecute("create table n (id int, v bigint) with (value_encoding = binary)"); err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[int64]string{
+		1: "0",
+		2: "-1",
+		3: "256", // 小端编码末尾是零字节，读出时会被去掉
+		4: "9223372036854775807",
+		5: "-9223372036854775808",
+		6: "", // NULL
+		7: " 042 ",
+	}
+	rows := make([]Row, 0, len(values))
+	for k, v := range values {
+		rows = append(rows, Row{Key: k, Value: v})
+	}
+	if err := e.InsertBatch("n", rows); err != nil {
+		t.Fatal(err)
+	}
+	values[7] = "42"
+
+	check := func(e *Engine) {
+		t.Helper()
+		for k, want := range values {
+			if got, found := e.SelectById("n", k); !found || got != want {
+				t.Errorf("key %d: got %q, want %q", k, got, want)
+			}
+		}
+		it, err := e.ScanRange("n", math.MinInt64, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		for it.Next() {
+			if row := it.Row(); row.Value != values[row.Key] {
+				t.Errorf("scan key %d: got %q, want %q", row.Key, row.Value, values[row.Key])
+			}
+		}
+	}
+	check(e)
+
+	// 不是整数的值整批拒绝
+	if err := e.InsertBatch("n", []Row{{Key: 10, Value: "1"}, {Key: 11, Value: "abc"}}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("non-integer value: got %v", err)
+	}
+	if e.Contains("n", 10) {
+		t.Error("batch with an invalid value was partially written")
+	}
+
+	for _, sql := range []string{
+		"create table s (id int, v string) with (value_encoding = binary)",
+		"create table w (id int, a int, b int) with (value_encoding = binary)",
+	} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: got %v", sql, err)
+		}
+	}
+	if err := p.ParseAndExecute("create table x (id int, v int) with (value_encoding = packed)"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("bad encoding: got %v", err)
+	}
+
+	if desc, _ := e.DescribeTable("n"); !strings.Contains(desc, "binary") {
+		t.Errorf("describe does not show the encoding:\n%s", desc)
+	}
+
+	// 编码方式保存在元数据中，重新打开后仍能解码
+	e.BPM.FlushAllPages()
+	check(crashAndReopen(t, e))
+}
+
+func TestInsertTypeCheck(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	if err := p.ParseAndExecute("create table users (id int, age int, name varchar, active bool)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for sql, want := range map[string]string{
+		"insert into users values (1, 'abc', 'alice', true)":       "column 'age' expects int, got 'abc'",
+		"insert into users values (1, 3000000000, 'alice', true)":  "column 'age' expects int, got '3000000000'",
+		"insert into users values (1, 30, 'alice', maybe)":         "column 'active' expects bool, got 'maybe'",
+		"insert into users values (1, 30, 'alice', true, 'extra')": "table has 4 columns, got 5 values",
+	} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %q", sql, err, want)
+		}
+	}
+	if err := e.Insert("users", 1, "x"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Engine.Insert with a non-integer age: %v", err)
+	}
+	if e.Contains("users", 1) {
+		t.Error("rejected row was written")
+	}
+
+	// 缺少的末尾列和 null 都是 NULL
+	for _, sql := range []string{
+		"insert into users values (1, 30, 'alice', false)",
+		"insert into users values (2, null, 'bob')",
+		"insert into users values (3)",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Errorf("%s: %v", sql, err)
+		}
+	}
+
+	desc, err := e.DescribeTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"| id             | int PRI", "| age            | int", "| active         | bool"} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("describe is missing %q:\n%s", want, desc)
+		}
+	}
+}
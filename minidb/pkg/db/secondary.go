@@ -0,0 +1,483 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/index"
+	"minidb/pkg/storage/page"
+)
+
+// 二级索引（create index <name> on <table>(<col>)）把一列的值映射到主键，存放在一棵 index.BPlusTreeStr 中：
+// Key 是 indexKey(列值)，Value 是这个 Key 下所有行的主键，每个 8 字节、升序，行多时存进溢出页。
+// 索引登记在 TableMeta.Indexes，根页号随元数据落盘；写表的路径（Insert、applyRows、Delete）通过 indexWriter 同步维护。
+// BPlusTreeStr 不支持删除，Key 下的主键删光后留下一个空的 Value，查询时什么都查不到。
+// 值为 NULL（列缺失）的行不进索引；目前只支持整数主键的表，用于 where <col> = <val>，以及 varchar 列上有字面量前缀的 LIKE
+
+// IndexMeta 是表上一个二级索引的元数据
+type IndexMeta struct {
+	Column     string // 建索引的列名
+	RootPageId int32  // 索引树的根页号，空表上为 InvalidPageID
+}
+
+// indexKey 把规范化后的列值映射成索引树的 Key
+// BPlusTreeStr 的 Key 定长、不能为空、不能含 0 字节，所以值前面加上 '='；放不下或含 0 字节的值换成 '#' 加哈希。
+// 不同的值可能映射到同一个 Key，查询时按行的实际值再比较一次
+func indexKey(val string) string {
+	if len(val) < page.SizeOfStrKey && strings.IndexByte(val, 0) < 0 {
+		return "=" + val
+	}
+	h := fnv.New64a()
+	h.Write([]byte(val))
+	return fmt.Sprintf("#%016x", h.Sum64())
+}
+
+func encodeIndexKeys(keys []int64) []byte {
+	buf := make([]byte, 8*len(keys))
+	for i, k := range keys {
+		binary.LittleEndian.PutUint64(buf[8*i:], uint64(k))
+	}
+	return buf
+}
+
+func decodeIndexKeys(raw []byte) []int64 {
+	keys := make([]int64, len(raw)/8)
+	for i := range keys {
+		keys[i] = int64(binary.LittleEndian.Uint64(raw[8*i:]))
+	}
+	return keys
+}
+
+// indexColumn 是索引列在表结构中的位置（主键为 0）和类型
+type indexColumn struct {
+	pos int
+	typ ColumnType
+}
+
+// resolveIndexColumn 在表结构中查找索引列
+func (e *Engine) resolveIndexColumn(tableName, column string) (indexColumn, error) {
+	columns, pos, err := e.lookupColumn(tableName, column)
+	if err != nil {
+		return indexColumn{}, err
+	}
+	return indexColumn{pos: pos, typ: columns[pos].Type}, nil
+}
+
+// key 返回行在这一列上的索引 Key，列为 NULL 时返回 false
+func (c indexColumn) key(row Row) (string, bool) {
+	v, ok := rowColumn(row, c.pos)
+	if !ok {
+		return "", false
+	}
+	return indexKey(normalizeValue(c.typ, v)), true
+}
+
+// TableIndexes 返回表上二级索引的拷贝，按索引名
+func (c *Catalog) TableIndexes(meta *TableMeta) map[string]IndexMeta {
+	if r := c.route(meta.Name); r != c {
+		return r.TableIndexes(meta)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	indexes := make(map[string]IndexMeta, len(meta.Indexes))
+	for name, idx := range meta.Indexes {
+		indexes[name] = idx
+	}
+	return indexes
+}
+
+// AddIndex 在表上登记二级索引，表不存在或已有同名的索引时返回 false
+func (c *Catalog) AddIndex(tableName, name string, idx IndexMeta) bool {
+	if r := c.route(tableName); r != c {
+		return r.AddIndex(tableName, name, idx)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	table, ok := c.Tables[tableName]
+	if !ok {
+		return false
+	}
+	if _, exists := table.Indexes[name]; exists {
+		return false
+	}
+	if table.Indexes == nil {
+		table.Indexes = make(map[string]IndexMeta)
+	}
+	table.Indexes[name] = idx
+	c.SaveMeta()
+	return true
+}
+
+// UpdateIndexRoot 记录索引树的新根页号
+func (c *Catalog) UpdateIndexRoot(tableName, name string, newRootId page.PageID) {
+	if r := c.route(tableName); r != c {
+		r.UpdateIndexRoot(tableName, name, newRootId)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if table, ok := c.Tables[tableName]; ok {
+		if idx, ok := table.Indexes[name]; ok {
+			idx.RootPageId = int32(newRootId)
+			table.Indexes[name] = idx
+			c.SaveMeta()
+		}
+	}
+}
+
+// CreateIndex 在表的一列上建二级索引，建好之后的写入同步维护它
+func (e *Engine) CreateIndex(tableName, indexName, column string) error {
+	if err := e.EnsureDBSelected(); err != nil {
+		return err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return err
+	}
+	col, err := e.resolveIndexColumn(tableName, column)
+	if err != nil {
+		return err
+	}
+	if col.pos == 0 {
+		return errorf(ErrInvalidSchema, "column '%s' is the primary key, which is already indexed", column)
+	}
+
+	defer e.writeTable(tableName)()
+	if _, exists := e.Catalog.TableIndexes(meta)[indexName]; exists {
+		return errorf(ErrIndexExists, "index '%s' already exists on table '%s'", indexName, tableName)
+	}
+	root, err := buildIndex(meta, col, e.openTree(meta), e.BPM, meta.Tablespace)
+	if err != nil {
+		return treeError(tableName, err)
+	}
+	if !e.Catalog.AddIndex(tableName, indexName, IndexMeta{Column: column, RootPageId: int32(root)}) {
+		return errorf(ErrIndexExists, "index '%s' already exists on table '%s'", indexName, tableName)
+	}
+	return e.commit()
+}
+
+// buildIndex 读出 src 中的所有行，在 bpm 上建一棵 col 列的索引树，返回根页号；没有可索引的行时返回 InvalidPageID
+// 先在内存中按 Key 收集主键，再按 Key 的顺序插入，每个 Key 只写一次
+func buildIndex(meta *TableMeta, col indexColumn, src *index.BPlusTree, bpm *buffer.BufferPoolManager, space int) (page.PageID, error) {
+	groups := make(map[string][]int64)
+	if it := src.Begin(); it != nil {
+		for {
+			if key, ok := col.key(Row{Key: it.Key(), Value: decodeValue(meta, it.ValueRef())}); ok {
+				groups[key] = append(groups[key], it.Key())
+			}
+			if !it.Next() {
+				break
+			}
+		}
+		it.Close()
+		if err := it.Err(); err != nil {
+			return page.InvalidPageID, err
+		}
+	} else if err := src.Err(); err != nil {
+		return page.InvalidPageID, err
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tree := index.NewBPlusTreeStr(page.InvalidPageID, bpm)
+	tree.SetTablespace(space)
+	for _, key := range keys {
+		if !tree.Insert(key, encodeIndexKeys(groups[key])) {
+			return page.InvalidPageID, fmt.Errorf("insert of index key %q failed", key)
+		}
+	}
+	return tree.GetRootPageId(), nil
+}
+
+// indexOn 返回建在 column 列上的索引名，有多个时取名字最小的一个
+func (e *Engine) indexOn(tableName, column string) (string, bool) {
+	if e.EnsureDBSelected() != nil {
+		return "", false
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok || meta.hasStringKey() {
+		return "", false
+	}
+	var names []string
+	for name, idx := range e.Catalog.TableIndexes(meta) {
+		if strings.EqualFold(idx.Column, column) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	return slices.Min(names), true
+}
+
+// lookupIndex 通过索引 indexName 查出索引列等于 value 的行，按主键排序，limit >= 0 时最多返回 limit 行
+func (e *Engine) lookupIndex(tableName, indexName, value string, limit int) ([]Row, error) {
+	if err := e.checkTxRead(tableName); err != nil {
+		return nil, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	idx := e.Catalog.TableIndexes(meta)[indexName]
+	col, err := e.resolveIndexColumn(tableName, idx.Column)
+	if err != nil {
+		return nil, err
+	}
+	want := normalizeValue(col.typ, value)
+
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	raw, found := index.NewBPlusTreeStr(page.PageID(idx.RootPageId), e.BPM).GetValue(indexKey(want))
+	if !found {
+		return nil, nil
+	}
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	var rows []Row
+	for _, key := range decodeIndexKeys(raw) {
+		if limit >= 0 && len(rows) == limit {
+			break
+		}
+		val, ok := tree.GetValue(key)
+		if !ok {
+			continue
+		}
+		row := Row{Key: key, Value: decodeValue(meta, val)}
+		if v, ok := rowColumn(row, col.pos); ok && normalizeValue(col.typ, v) == want {
+			rows = append(rows, row)
+		}
+	}
+	return rows, treeError(tableName, tree.Err())
+}
+
+// scanIndexPrefix 通过索引 indexName 查出索引列以 prefix 开头并且 match 的行，按主键排序
+// 短的值在索引中的 Key 是 '=' 加值，以 prefix 开头的值都在 ['='+prefix, 上界) 这一段 Key 下，见 prefixUpperBound；
+// 放不下而换成哈希的长值都在 '#' 开头的 Key 下，无法按前缀定位，这一段整个取出，和前一段一样按行的实际值再过滤
+func (e *Engine) scanIndexPrefix(tableName, indexName, prefix string, match func(string) bool) ([]Row, error) {
+	if err := e.checkTxRead(tableName); err != nil {
+		return nil, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	idx := e.Catalog.TableIndexes(meta)[indexName]
+	col, err := e.resolveIndexColumn(tableName, idx.Column)
+	if err != nil {
+		return nil, err
+	}
+
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	itree := index.NewBPlusTreeStr(page.PageID(idx.RootPageId), e.BPM)
+	keys := make(map[int64]struct{})
+	for _, low := range []string{"=" + prefix, "#"} {
+		if err := collectIndexRange(itree, low, keys); err != nil {
+			return nil, treeError(tableName, err)
+		}
+	}
+	sorted := make([]int64, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	slices.Sort(sorted)
+
+	tree := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM)
+	var rows []Row
+	for _, key := range sorted {
+		val, ok := tree.GetValue(key)
+		if !ok {
+			continue
+		}
+		row := Row{Key: key, Value: decodeValue(meta, val)}
+		if v, ok := rowColumn(row, col.pos); ok && match(v) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, treeError(tableName, tree.Err())
+}
+
+// collectIndexRange 把索引中以 low 开头的 Key 下的全部主键加入 keys
+func collectIndexRange(itree *index.BPlusTreeStr, low string, keys map[int64]struct{}) error {
+	high, bounded := prefixUpperBound(low)
+	it := itree.Seek(low)
+	if it == nil {
+		return nil
+	}
+	defer it.Close()
+	for !bounded || it.Key() < high {
+		for _, key := range decodeIndexKeys(it.Value()) {
+			keys[key] = struct{}{}
+		}
+		if !it.Next() {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// indexWriter 在写表的同时维护表上的二级索引，调用方持有表的写锁
+// 表上没有索引时 openIndexes 返回 nil，nil 上的方法什么都不做
+type indexWriter struct {
+	e       *Engine
+	table   string
+	meta    *TableMeta
+	indexes []openIndex
+	err     error // 第一次写索引失败的原因
+}
+
+type openIndex struct {
+	name string
+	col  indexColumn
+	root page.PageID // 打开时的根页号，用于判断是否需要更新元数据
+	tree *index.BPlusTreeStr
+}
+
+// openIndexes 打开表上的全部二级索引
+func (e *Engine) openIndexes(tableName string, meta *TableMeta) *indexWriter {
+	indexes := e.Catalog.TableIndexes(meta)
+	if len(indexes) == 0 {
+		return nil
+	}
+	w := &indexWriter{e: e, table: tableName, meta: meta}
+	for name, idx := range indexes {
+		col, err := e.resolveIndexColumn(tableName, idx.Column)
+		if err != nil {
+			w.fail(name, err)
+			continue
+		}
+		tree := index.NewBPlusTreeStr(page.PageID(idx.RootPageId), e.BPM)
+		tree.SetTablespace(meta.Tablespace)
+		w.indexes = append(w.indexes, openIndex{name: name, col: col, root: page.PageID(idx.RootPageId), tree: tree})
+	}
+	return w
+}
+
+func (w *indexWriter) fail(name string, err error) {
+	if w.err == nil {
+		w.err = fmt.Errorf("index '%s' on table '%s' is out of date: %v", name, w.table, err)
+	}
+}
+
+// add 把新写入的行加入索引，value 是解码后的值
+func (w *indexWriter) add(key int64, value string) {
+	w.update(key, value, func(keys []int64) []int64 {
+		i, found := slices.BinarySearch(keys, key)
+		if found {
+			return keys
+		}
+		return slices.Insert(keys, i, key)
+	})
+}
+
+// remove 把被删除或覆盖的行从索引中去掉，value 是行原来的值（解码后）
+func (w *indexWriter) remove(key int64, value string) {
+	w.update(key, value, func(keys []int64) []int64 {
+		if i, found := slices.BinarySearch(keys, key); found {
+			return slices.Delete(keys, i, i+1)
+		}
+		return keys
+	})
+}
+
+// applied 在 applyInsert 写入一行之后更新索引：新增的行加入索引，覆盖的行先按原来的值去掉
+func (w *indexWriter) applied(key int64, inserted bool, old, value []byte) {
+	if w == nil || !inserted && old == nil {
+		return
+	}
+	if old != nil {
+		w.remove(key, decodeValue(w.meta, old))
+	}
+	w.add(key, decodeValue(w.meta, value))
+}
+
+// removeCurrent 按树中当前的值把行从索引中去掉，在删除或撤销这一行之前调用
+func (w *indexWriter) removeCurrent(tree *index.BPlusTree, key int64) {
+	if w == nil {
+		return
+	}
+	if raw, ok := tree.GetValue(key); ok {
+		w.remove(key, decodeValue(w.meta, raw))
+	}
+}
+
+// update 对行在每个索引中所在 Key 下的主键列表应用 change
+func (w *indexWriter) update(key int64, value string, change func([]int64) []int64) {
+	if w == nil {
+		return
+	}
+	row := Row{Key: key, Value: value}
+	for _, idx := range w.indexes {
+		k, ok := idx.col.key(row)
+		if !ok {
+			continue
+		}
+		raw, found := idx.tree.GetValue(k)
+		next := encodeIndexKeys(change(decodeIndexKeys(raw)))
+		switch {
+		case found && idx.tree.Update(k, next):
+		case !found && idx.tree.Insert(k, next):
+		default:
+			w.fail(idx.name, fmt.Errorf("write of index key %q failed", k))
+		}
+	}
+}
+
+// finish 把根页号有变化的索引写回元数据，返回维护索引时的第一个错误；可以多次调用
+func (w *indexWriter) finish() error {
+	if w == nil {
+		return nil
+	}
+	for i := range w.indexes {
+		idx := &w.indexes[i]
+		if root := idx.tree.GetRootPageId(); root != idx.root {
+			w.e.Catalog.UpdateIndexRoot(w.table, idx.name, root)
+			idx.root = root
+		}
+	}
+	return w.err
+}
+
+// indexPages 返回表上所有索引树占用的页
+func (e *Engine) indexPages(meta *TableMeta) ([]page.PageID, error) {
+	var pages []page.PageID
+	for _, idx := range e.Catalog.TableIndexes(meta) {
+		ids, err := index.NewBPlusTreeStr(page.PageID(idx.RootPageId), e.BPM).Pages()
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, ids...)
+	}
+	return pages, nil
+}
+
+// indexedEquality 判断 where <col> <op> <val> 能否用二级索引：op 为 '=' 且 col 上建有索引时返回索引名和去掉引号的值
+// 不带引号的 null 与任何值都不相等，isNull 为 true，调用方直接返回空结果
+func (p *SQLParser) indexedEquality(ref tableRef, column, op, operand string) (indexName, literal string, isNull, ok bool) {
+	if op != "=" {
+		return "", "", false, false
+	}
+	indexName, ok = p.Engine.indexOn(ref.Name, column)
+	if !ok {
+		return "", "", false, false
+	}
+	literal = strings.TrimSpace(operand)
+	if strings.EqualFold(literal, "null") {
+		return indexName, "", true, true
+	}
+	if len(literal) >= 2 && (literal[0] == '\'' || literal[0] == '"') && literal[len(literal)-1] == literal[0] {
+		literal = literal[1 : len(literal)-1]
+	}
+	return indexName, literal, false, true
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"minidb/pkg/storage/page"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// DefaultQueryMemory 是单个查询中排序等算子缓存行可用的默认内存上限（字节）
+const DefaultQueryMemory = 64 << 20
+
+// rowOverhead 估算一行除 Value 以外占用的内存：Key、RID 和字符串头
+const rowOverhead = 40
+
+// rowSorter 是带内存上限的外部排序：缓存的行超过 budget 时，排好序写成一个临时文件（一路），
+// 最后把各路归并输出；内存中同时只有一路缓存加上每路一行。
+// 排序是稳定的：相等的行按加入的顺序输出
+type rowSorter struct {
+	budget int64
+	less   func(a, b Row) bool
+
+	buf      []Row
+	bufBytes int64
+	runs     []*os.File // 已溢出的有序段，按溢出顺序
+
+	// 输出阶段
+	merge *runMerger
+	pos   int
+	row   Row
+	err   error
+}
+
+func newRowSorter(budget int64, less func(a, b Row) bool) *rowSorter {
+	if budget <= 0 {
+		budget = DefaultQueryMemory
+	}
+	return &rowSorter{budget: budget, less: less}
+}
+
+// Add 加入一行，缓存超过内存上限时溢出到磁盘
+func (s *rowSorter) Add(row Row) error {
+	s.buf = append(s.buf, row)
+	s.bufBytes += int64(len(row.Value)) + rowOverhead
+	if s.bufBytes > s.budget {
+		return s.spill()
+	}
+	return nil
+}
+
+// Spills 返回溢出到磁盘的段数
+func (s *rowSorter) Spills() int {
+	return len(s.runs)
+}
+
+// spill 把缓存排序后写入一个临时文件
+func (s *rowSorter) spill() error {
+	sort.SliceStable(s.buf, func(i, j int) bool { return s.less(s.buf[i], s.buf[j]) })
+	f, err := os.CreateTemp("", "minidb-sort-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+
+	w := bufio.NewWriter(f)
+	var hdr [20]byte
+	for _, r := range s.buf {
+		binary.LittleEndian.PutUint64(hdr[0:], uint64(r.Key))
+		binary.LittleEndian.PutUint32(hdr[8:], uint32(r.RID.Page))
+		binary.LittleEndian.PutUint32(hdr[12:], uint32(r.RID.Slot))
+		binary.LittleEndian.PutUint32(hdr[16:], uint32(len(r.Value)))
+		w.Write(hdr[:])
+		w.WriteString(r.Value)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	s.bufBytes = 0
+	return nil
+}
+
+// Sort 结束输入，之后用 Next / Row 按顺序读取
+func (s *rowSorter) Sort() error {
+	if len(s.runs) == 0 {
+		sort.SliceStable(s.buf, func(i, j int) bool { return s.less(s.buf[i], s.buf[j]) })
+		return nil
+	}
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	s.buf = nil
+	m := &runMerger{less: s.less}
+	for i, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r := &runReader{r: bufio.NewReader(f), index: i}
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			m.readers = append(m.readers, r)
+		}
+	}
+	heap.Init(m)
+	s.merge = m
+	return nil
+}
+
+// Next 移动到下一行，读完或出错时返回 false，出错时 Err 返回错误
+func (s *rowSorter) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.merge == nil {
+		if s.pos >= len(s.buf) {
+			return false
+		}
+		s.row = s.buf[s.pos]
+		s.pos++
+		return true
+	}
+	if s.merge.Len() == 0 {
+		return false
+	}
+	r := s.merge.readers[0]
+	s.row = r.row
+	ok, err := r.next()
+	switch {
+	case err != nil:
+		s.err = err
+		return false
+	case ok:
+		heap.Fix(s.merge, 0)
+	default:
+		heap.Pop(s.merge)
+	}
+	return true
+}
+
+func (s *rowSorter) Row() Row {
+	return s.row
+}
+
+func (s *rowSorter) Err() error {
+	return s.err
+}
+
+// Close 删除所有临时文件，可重复调用
+func (s *rowSorter) Close() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+	s.buf = nil
+	s.merge = nil
+}
+
+// runReader 顺序读取一个有序段
+type runReader struct {
+	r     *bufio.Reader
+	index int // 段的序号，比较相等时序号小的先输出，保证稳定
+	row   Row
+}
+
+// next 读入下一行，段读完时返回 false
+func (r *runReader) next() (bool, error) {
+	var hdr [20]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	value := make([]byte, binary.LittleEndian.Uint32(hdr[16:]))
+	if _, err := io.ReadFull(r.r, value); err != nil {
+		return false, err
+	}
+	r.row = Row{
+		Key:   int64(binary.LittleEndian.Uint64(hdr[0:])),
+		Value: string(value),
+		RID:   RID{Page: page.PageID(binary.LittleEndian.Uint32(hdr[8:])), Slot: int32(binary.LittleEndian.Uint32(hdr[12:]))},
+	}
+	return true, nil
+}
+
+// runMerger 是各段当前行组成的最小堆
+type runMerger struct {
+	readers []*runReader
+	less    func(a, b Row) bool
+}
+
+func (m *runMerger) Len() int { return len(m.readers) }
+func (m *runMerger) Less(i, j int) bool {
+	a, b := m.readers[i], m.readers[j]
+	if m.less(a.row, b.row) {
+		return true
+	}
+	if m.less(b.row, a.row) {
+		return false
+	}
+	return a.index < b.index
+}
+func (m *runMerger) Swap(i, j int) { m.readers[i], m.readers[j] = m.readers[j], m.readers[i] }
+func (m *runMerger) Push(x any)    { m.readers = append(m.readers, x.(*runReader)) }
+func (m *runMerger) Pop() any {
+	r := m.readers[len(m.readers)-1]
+	m.readers = m.readers[:len(m.readers)-1]
+	return r
+}
+
+// columnLess 返回按第 idx 列（主键为 0）比较两行的函数
+// int 列按数值比较，其余按字符串；NULL 最小，desc 时整体反转
+func columnLess(col Column, idx int, desc bool) func(a, b Row) bool {
+	numeric := col.Type == TypeInt || col.Type == TypeBigInt
+	compare := func(a, b Row) int {
+		x, okX := rowColumn(a, idx)
+		y, okY := rowColumn(b, idx)
+		switch {
+		case !okX || !okY:
+			return boolInt(okX) - boolInt(okY)
+		case numeric:
+			m, errM := strconv.ParseInt(x, 10, 64)
+			n, errN := strconv.ParseInt(y, 10, 64)
+			if errM == nil && errN == nil {
+				return cmp.Compare(m, n)
+			}
+		}
+		return cmp.Compare(x, y)
+	}
+	if desc {
+		return func(a, b Row) bool { return compare(a, b) > 0 }
+	}
+	return func(a, b Row) bool { return compare(a, b) < 0 }
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortRows 按 column 排序 feed 产出的行，返回排在前面的 limit 行（limit < 0 表示全部）
+// feed 对每一行调用 add；缓存的行超过 QueryMemory 时溢出到临时文件，返回前删除
+func (e *Engine) sortRows(tableName, column string, desc bool, limit int, feed func(add func(Row) error) error) ([]Row, error) {
+	columns, idx, err := e.lookupColumn(tableName, column)
+	if err != nil {
+		return nil, err
+	}
+	s := newRowSorter(e.QueryMemory, columnLess(columns[idx], idx, desc))
+	defer s.Close()
+	if err := feed(s.Add); err != nil {
+		return nil, err
+	}
+	if err := s.Sort(); err != nil {
+		return nil, err
+	}
+	var rows []Row
+	for (limit < 0 || len(rows) < limit) && s.Next() {
+		rows = append(rows, s.Row())
+	}
+	return rows, s.Err()
+}
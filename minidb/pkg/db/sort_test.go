@@ -0,0 +1,73 @@
+package db
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestRowSorterSpill(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// 按 Value 排序，Value 有大量重复，检查溢出后的归并仍然稳定
+	rnd := rand.New(rand.NewSource(1))
+	var rows []Row
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, Row{Key: int64(i), Value: string(rune('a' + rnd.Intn(10)))})
+	}
+	less := func(a, b Row) bool { return a.Value < b.Value }
+
+	s := newRowSorter(4096, less)
+	defer s.Close()
+	for _, r := range rows {
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Spills() < 2 {
+		t.Fatalf("expected several spills with a 4KB budget, got %d", s.Spills())
+	}
+	if err := s.Sort(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append([]Row(nil), rows...)
+	sort.SliceStable(want, func(i, j int) bool { return less(want[i], want[j]) })
+	var got []Row
+	for s.Next() {
+		got = append(got, s.Row())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("row %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Close 删除临时文件
+	s.Close()
+	if files, _ := filepath.Glob(filepath.Join(tmp, "minidb-sort-*")); len(files) != 0 {
+		t.Errorf("temp files left behind: %v", files)
+	}
+
+	// 没超出预算时不碰磁盘
+	small := newRowSorter(0, less)
+	defer small.Close()
+	for _, r := range rows[:10] {
+		small.Add(r)
+	}
+	if small.Spills() != 0 {
+		t.Errorf("default budget spilled %d runs", small.Spills())
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("unexpected temp files: %v", entries)
+	}
+}
@@ -0,0 +1,34 @@
+package db
+
+import "strings"
+
+// SplitStatements 把一条消息按分号拆成多条语句，去掉首尾空白并跳过空语句
+// 单引号和双引号内的分号不拆分，引号内的反斜杠转义下一个字符；
+// 引号没有闭合时，剩下的部分作为最后一条语句，交给解析器报错
+func SplitStatements(input string) []string {
+	var stmts []string
+	var quote byte // 当前所在引号，0 表示不在引号内
+	start := 0
+	add := func(end int) {
+		if stmt := strings.TrimSpace(input[start:end]); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';':
+			add(i)
+		}
+	}
+	add(len(input))
+	return stmts
+}
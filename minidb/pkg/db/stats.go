@@ -0,0 +1,157 @@
+package db
+
+import (
+	"minidb/pkg/storage/index"
+	"time"
+)
+
+// AnalyzeBuckets 是 ANALYZE 生成的等深直方图桶数
+const AnalyzeBuckets = 10
+
+// Bucket 是等深直方图的一个桶，覆盖 (上一个桶的 UpperKey, UpperKey]
+type Bucket struct {
+	UpperKey int64
+	Rows     int64
+}
+
+// TableStats 是 ANALYZE 收集的统计信息，保存在 Catalog 中供优化器估算选择率
+type TableStats struct {
+	RowCount   int64
+	MinKey     int64
+	MaxKey     int64
+	Buckets    []Bucket
+	AnalyzedAt time.Time
+	Tree       index.TreeStats // 收集时主键 B+ 树的形状：树高、叶子页数、内部节点页数
+}
+
+// EstimateRange 估算主键落在 [low, high] 内的行数
+// 桶内按均匀分布做线性插值
+func (s *TableStats) EstimateRange(low, high int64) int64 {
+	if s.RowCount == 0 || low > high || high < s.MinKey || low > s.MaxKey {
+		return 0
+	}
+
+	var estimate float64
+	lower := s.MinKey
+	for _, b := range s.Buckets {
+		lo, hi := max(low, lower), min(high, b.UpperKey)
+		if lo <= hi {
+			width := float64(b.UpperKey-lower) + 1
+			estimate += float64(b.Rows) * (float64(hi-lo) + 1) / width
+		}
+		lower = b.UpperKey + 1
+	}
+	return int64(estimate + 0.5)
+}
+
+// collectTableStats 扫描一遍整棵树，按位置切分出等深的桶，树损坏时返回错误
+func collectTableStats(tree *index.BPlusTree, buckets int) (*TableStats, error) {
+	stats := &TableStats{AnalyzedAt: time.Now()}
+
+	stats.Tree = tree.Stats()
+	n := stats.Tree.KeyCount
+	it := tree.Begin()
+	if it == nil || n == 0 {
+		if it != nil {
+			it.Close()
+		}
+		return stats, tree.Err()
+	}
+	defer it.Close()
+
+	perBucket := (n + int64(buckets) - 1) / int64(buckets)
+	var inBucket int64
+	stats.MinKey = it.Key()
+	for {
+		key := it.Key()
+		stats.RowCount++
+		inBucket++
+		stats.MaxKey = key
+
+		if inBucket == perBucket {
+			stats.Buckets = append(stats.Buckets, Bucket{UpperKey: key, Rows: inBucket})
+			inBucket = 0
+		}
+		if !it.Next() {
+			break
+		}
+	}
+	if inBucket > 0 {
+		stats.Buckets = append(stats.Buckets, Bucket{UpperKey: stats.MaxKey, Rows: inBucket})
+	}
+	return stats, it.Err()
+}
+
+// Analyze 扫描整张表收集统计信息并写入 Catalog，同时校正行数缓存
+func (e *Engine) Analyze(tableName string) (*TableStats, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return nil, err
+	}
+
+	unlock := e.readTable(tableName)
+	exit := e.enterRead()
+	stats, err := collectTableStats(index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM), AnalyzeBuckets)
+	exit()
+	unlock()
+	// 树损坏时扫描提前结束，不完整的统计不能写入 Catalog
+	if err != nil {
+		return nil, treeError(tableName, err)
+	}
+	e.Catalog.SetTableStats(tableName, stats)
+	return stats, nil
+}
+
+// TreeNodes 按层返回表的 B+ 树节点，跳过前 offset 个后最多 limit 个，见 index.BPlusTree.Nodes
+func (e *Engine) TreeNodes(tableName string, offset, limit int) ([]index.TreeNode, bool, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, false, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, false, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return nil, false, err
+	}
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	nodes, more, err := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Nodes(offset, limit)
+	return nodes, more, treeError(tableName, err)
+}
+
+// EstimateRows 估算主键范围 [low, high] 命中的行数
+// 有 ANALYZE 统计时使用直方图，否则按经典的 1/3 选择率估算
+func (e *Engine) EstimateRows(tableName string, low, high int64) (int64, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return 0, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return 0, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if meta.Stats != nil {
+		return meta.Stats.EstimateRange(low, high), nil
+	}
+	if low > high {
+		return 0, nil
+	}
+	e.warnf("table '%s' has no statistics, using default estimate; run ANALYZE", tableName)
+	return e.tableRowCount(tableName, meta) / 3, nil
+}
+
+// tableRowCount 返回行数缓存；旧版元数据缺失行数时先扫描重算
+func (e *Engine) tableRowCount(tableName string, meta *TableMeta) int64 {
+	if e.Catalog.RowCountMissing(tableName) {
+		exit := e.enterRead()
+		e.Catalog.SetRowCount(tableName, index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Stats().KeyCount)
+		exit()
+	}
+	return meta.RowCount
+}
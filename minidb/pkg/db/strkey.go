@@ -0,0 +1,313 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/index"
+	"minidb/pkg/storage/page"
+)
+
+// 主键声明为 varchar 的表存放在 index.BPlusTreeStr 中，根页号记在 TableMeta.StrRootPageId；
+// TableMeta.RootPageId 保持 InvalidPageID，按整数主键读写的代码看到的是一张空表，不会把字符串树的页当成整数树来读。
+// 目前支持 insert、select（全表、where <主键> = '<值>' 或 where <列> [not] like '<模式>'）、describe 和 drop table；
+// 其余依赖整数主键的操作（范围扫描、聚合、delete、vacuum、analyze 等）返回 ErrUnsupported，见 requireIntKey
+
+// KeyTypeVarchar 是 TableMeta.KeyType 的取值，表示主键为字符串
+const KeyTypeVarchar = "varchar"
+
+// hasStringKey 报告表的主键是否为字符串
+func (m *TableMeta) hasStringKey() bool {
+	return m.KeyType == KeyTypeVarchar
+}
+
+// requireIntKey 拒绝在字符串主键的表上执行只支持整数主键的操作
+func requireIntKey(meta *TableMeta) error {
+	if meta.hasStringKey() {
+		return errorf(ErrUnsupported, "table '%s' has a varchar primary key, this operation needs an integer key", meta.Name)
+	}
+	return nil
+}
+
+// checkStrKey 检查字符串主键能否放进定长的 Key 槽位：非空，不超过 page.SizeOfStrKey 字节，不含 0 字节
+func checkStrKey(key string) error {
+	switch {
+	case key == "":
+		return errorf(ErrInvalidValue, "varchar primary key must not be empty")
+	case len(key) > page.SizeOfStrKey:
+		return errorf(ErrInvalidValue, "varchar primary key '%s' is longer than %d bytes", key, page.SizeOfStrKey)
+	case strings.IndexByte(key, 0) >= 0:
+		return errorf(ErrInvalidValue, "varchar primary key must not contain NUL bytes")
+	}
+	return nil
+}
+
+func (c *Catalog) TableStrRoot(meta *TableMeta) page.PageID {
+	if r := c.route(meta.Name); r != c {
+		return r.TableStrRoot(meta)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return page.PageID(meta.StrRootPageId)
+}
+
+func (c *Catalog) UpdateTableStrRoot(name string, newRootId page.PageID) {
+	if r := c.route(name); r != c {
+		r.UpdateTableStrRoot(name, newRootId)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if table, ok := c.Tables[name]; ok {
+		table.StrRootPageId = int32(newRootId)
+		c.SaveMeta()
+	}
+}
+
+// openStrTree 打开字符串主键的表的 B+ 树，写入时新页分配在表所在的表空间
+func (e *Engine) openStrTree(meta *TableMeta) *index.BPlusTreeStr {
+	tree := index.NewBPlusTreeStr(e.Catalog.TableStrRoot(meta), e.BPM)
+	tree.SetTablespace(meta.Tablespace)
+	return tree
+}
+
+// hasStringKey 报告当前库中的表 tableName 是否以字符串为主键，表不存在时返回 false
+func (e *Engine) hasStringKey(tableName string) bool {
+	if e.EnsureDBSelected() != nil {
+		return false
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	return ok && meta.hasStringKey()
+}
+
+// insertStrRows 把 prepareRows 检查过的一批行写入字符串主键的表
+// BPlusTreeStr 不支持删除，没法像 applyRows 那样写到一半再撤销，所以先在写锁下检查整批的冲突，再全部写入
+func (e *Engine) insertStrRows(tableName string, meta *TableMeta, rows []Row, values [][]byte) (int, error) {
+	if e.tx != nil {
+		return 0, errorf(ErrUnsupported, "inserting into table '%s' with a varchar primary key inside a transaction is not supported", tableName)
+	}
+	defer e.writeTable(tableName)()
+	tree := e.openStrTree(meta)
+
+	policy := ConflictPolicy(meta.OnConflict)
+	last := make(map[string]int, len(rows)) // 每个 Key 在本批次中最终生效的行
+	for i, r := range rows {
+		_, exists := tree.GetValue(r.StrKey)
+		_, repeated := last[r.StrKey]
+		switch {
+		case (exists || repeated) && policy == ConflictIgnore:
+			continue
+		case (exists || repeated) && policy != ConflictReplace:
+			return 0, errorf(ErrDuplicateKey, "insert failed at key '%s' (duplicate key), batch rolled back", r.StrKey)
+		}
+		last[r.StrKey] = i
+	}
+
+	affected, inserted := 0, 0
+	for i, r := range rows {
+		if j, ok := last[r.StrKey]; !ok || j != i {
+			continue
+		}
+		switch {
+		case tree.Update(r.StrKey, values[i]):
+		case tree.Insert(r.StrKey, values[i]):
+			inserted++
+		default:
+			return affected, fmt.Errorf("insert of key '%s' into table '%s' failed", r.StrKey, tableName)
+		}
+		affected++
+	}
+	e.Catalog.AddRowCount(tableName, int64(inserted))
+	if newRoot := tree.GetRootPageId(); newRoot != page.PageID(meta.StrRootPageId) {
+		e.Catalog.UpdateTableStrRoot(tableName, newRoot)
+	}
+	return affected, e.commit()
+}
+
+// scanStrRows 按主键顺序返回字符串主键的表中的行，limit >= 0 时最多返回 limit 行
+func (e *Engine) scanStrRows(tableName string, limit int) ([]Row, error) {
+	return e.scanStrPrefix(tableName, "", nil, limit)
+}
+
+// scanStrPrefix 按主键顺序返回主键以 prefix 开头、并且 keep 为 nil 或返回 true 的行，limit >= 0 时最多返回 limit 行
+// 从第一个 >= prefix 的主键开始，走到 prefixUpperBound 给出的上界为止；prefix 为空时扫描整张表
+func (e *Engine) scanStrPrefix(tableName, prefix string, keep func(Row) bool, limit int) ([]Row, error) {
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return nil, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	high, bounded := prefixUpperBound(prefix)
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	it := e.openStrTree(meta).Seek(prefix)
+	if it == nil {
+		return nil, nil
+	}
+	defer it.Close()
+
+	var rows []Row
+	for (limit < 0 || len(rows) < limit) && (!bounded || it.Key() < high) {
+		row := Row{
+			StrKey: it.Key(),
+			Value:  decodeValue(meta, it.Value()),
+			RID:    RID{Page: it.PageID(), Slot: it.Slot()},
+		}
+		if keep == nil || keep(row) {
+			rows = append(rows, row)
+		}
+		if !it.Next() {
+			break
+		}
+	}
+	return rows, treeError(tableName, it.Err())
+}
+
+// lookupStrKey 按字符串主键点查一行
+func (e *Engine) lookupStrKey(tableName, key string) (Row, bool, error) {
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return Row{}, false, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	defer e.readTable(tableName)()
+	defer e.enterRead()()
+	value, found := e.openStrTree(meta).GetValue(key)
+	if !found {
+		return Row{}, false, nil
+	}
+	return Row{StrKey: key, Value: decodeValue(meta, value)}, true, nil
+}
+
+// copyStrTable 把字符串主键的表按顺序插入到 bpm 上的一棵新树，返回新树的根页号，见 copyTable
+func (e *Engine) copyStrTable(meta *TableMeta, bpm *buffer.BufferPoolManager) (page.PageID, error) {
+	tree := index.NewBPlusTreeStr(page.InvalidPageID, bpm)
+	tree.StartNewTree()
+	it := e.openStrTree(meta).Begin()
+	if it == nil {
+		return tree.GetRootPageId(), nil
+	}
+	defer it.Close()
+	for {
+		if !tree.Insert(it.Key(), it.Value()) {
+			return page.InvalidPageID, fmt.Errorf("insert of key '%s' failed", it.Key())
+		}
+		if !it.Next() {
+			break
+		}
+	}
+	return tree.GetRootPageId(), it.Err()
+}
+
+// tablePages 返回表的 B+ 树占用的全部页，包括二级索引的页；字符串主键的表还包括字符串树的页
+func (e *Engine) tablePages(meta *TableMeta) ([]page.PageID, error) {
+	pages, err := e.openTree(meta).Pages()
+	if err != nil {
+		return nil, err
+	}
+	indexPages, err := e.indexPages(meta)
+	if err != nil {
+		return nil, err
+	}
+	pages = append(pages, indexPages...)
+	if !meta.hasStringKey() {
+		return pages, nil
+	}
+	strPages, err := e.openStrTree(meta).Pages()
+	return append(pages, strPages...), err
+}
+
+// parseStrInsertTuple 与 parseInsertTuple 相同，但第一个值是字符串主键，可以带引号
+func parseStrInsertTuple(valuesStr string) (Row, error) {
+	parts := strings.Split(valuesStr, ",")
+	keyStr := strings.TrimSpace(parts[0])
+	switch strings.ToLower(keyStr) {
+	case "null", "default":
+		return Row{}, errorf(ErrInvalidValue, "varchar primary key cannot be %s", strings.ToLower(keyStr))
+	}
+	return Row{StrKey: strings.Trim(keyStr, "'\""), Value: joinInsertValues(parts[1:])}, nil
+}
+
+// runStrSelect 是 runSelect 在字符串主键的表上的版本，只支持没有条件、<主键> = '<值>' 和 <列> [NOT] LIKE '<模式>'
+func (p *SQLParser) runStrSelect(ref tableRef, condition string, limit int) ([]Row, error) {
+	if condition == "" {
+		return p.Engine.scanStrRows(ref.Name, limit)
+	}
+	if m := reLike.FindStringSubmatch(strings.TrimSpace(condition)); m != nil {
+		return p.runStrLike(ref, m[1], m[2] != "", m[3], limit)
+	}
+	key, err := p.strKeyCondition(ref, condition)
+	if err != nil {
+		return nil, err
+	}
+	row, found, err := p.Engine.lookupStrKey(ref.Name, key)
+	if err != nil || !found || limit == 0 {
+		return nil, err
+	}
+	return []Row{row}, nil
+}
+
+// strLikeColumn 解析字符串主键的表上 LIKE 的列，返回列在表结构中的位置（主键为 0）
+func (p *SQLParser) strLikeColumn(ref tableRef, column string) (string, int, error) {
+	name, err := ref.resolveColumn(column)
+	if err != nil {
+		return "", 0, err
+	}
+	_, idx, err := p.Engine.lookupColumn(ref.Name, name)
+	return name, idx, err
+}
+
+// runStrLike 在字符串主键的表上执行 col [NOT] LIKE 'pattern'
+// LIKE 的列是主键、模式有字面量前缀时只扫描主键树中 [前缀, 上界) 这一段，否则扫描整张表；两种情况都逐行检查完整的模式
+func (p *SQLParser) runStrLike(ref tableRef, column string, negate bool, pattern string, limit int) ([]Row, error) {
+	_, idx, err := p.strLikeColumn(ref, column)
+	if err != nil {
+		return nil, err
+	}
+	lp := compileLike(pattern)
+	keep := func(row Row) bool {
+		val, ok := row.StrKey, true
+		if idx > 0 {
+			val, ok = decodeColumn(row.Value, idx-1)
+		}
+		return ok && lp.Match(val) != negate
+	}
+	prefix := ""
+	if idx == 0 && !negate {
+		prefix = lp.prefix
+	}
+	return p.Engine.scanStrPrefix(ref.Name, prefix, keep, limit)
+}
+
+// explainStrLike 描述 runStrLike 的访问路径
+func (p *SQLParser) explainStrLike(ref tableRef, condition, column string, negate bool, pattern string) ([]string, error) {
+	name, idx, err := p.strLikeColumn(ref, column)
+	if err != nil {
+		return nil, err
+	}
+	filter := "filter: " + condition
+	if prefix := compileLike(pattern).prefix; idx == 0 && !negate && prefix != "" {
+		return []string{fmt.Sprintf("index range scan on %s: %s", ref.Name, prefixRange(name, prefix)), filter}, nil
+	}
+	return []string{fmt.Sprintf("full scan on %s", ref.Name), filter}, nil
+}
+
+// strKeyCondition 从 <主键> = '<值>' 中取出主键的值
+func (p *SQLParser) strKeyCondition(ref tableRef, condition string) (string, error) {
+	unsupported := errorf(ErrUnsupported, "table '%s' has a varchar primary key, where only supports <key column> = '<value>' and like", ref.Name)
+	m := reWhere.FindStringSubmatch(strings.TrimSpace(condition))
+	if m == nil || m[2] != "=" {
+		return "", unsupported
+	}
+	col, err := ref.resolveColumn(m[1])
+	if err != nil {
+		return "", err
+	}
+	columns, err := p.Engine.TableColumns(ref.Name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(col, columns[0]) {
+		return "", unsupported
+	}
+	return strings.Trim(strings.TrimSpace(m[3]), "'\""), nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+)
+
+func TestVarcharPrimaryKey(t *testing.T) {
+	root := t.TempDir()
+	e := NewEngine(root)
+	if err := e.CreateDatabase("testdb"); err != nil {
+		t.Fatal(err)
+	}
+	open := func() *Engine {
+		dm, err := disk.NewDiskManager(filepath.Join(root, "testdb", DataFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewEngine(root)
+		e.DiskManager = dm
+		e.BPM = buffer.NewBufferPoolManager(dm, 64)
+		e.Catalog = NewCatalog(e.BPM, filepath.Join(root, "testdb", MetaFileName))
+		e.CurrentDB = "testdb"
+		return e
+	}
+
+	e = open()
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{
+		"create table users (name varchar, age int)",
+		"insert into users values ('alice', 30)",
+		"insert into users values ('bob', 25), (\"carol\", 41)",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	// 足够多的行，叶子和内部节点都会分裂
+	var rows []Row
+	for i := 0; i < 600; i++ {
+		rows = append(rows, Row{StrKey: fmt.Sprintf("user%03d", i), Value: fmt.Sprint(i)})
+	}
+	if _, err := e.InsertRows("users", rows); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := p.querySelect(tableRef{Name: "users"}, "name = 'alice'", selectOrder{Limit: -1})
+	if err != nil || len(got) != 1 || strings.Join(got[0].Cells(), ",") != "alice,30" {
+		t.Errorf("point lookup = %v, %v", got, err)
+	}
+	if got, _ := p.querySelect(tableRef{Name: "users"}, "name = 'dave'", selectOrder{Limit: -1}); len(got) != 0 {
+		t.Errorf("missing key returned %v", got)
+	}
+	if got, _ := p.querySelect(tableRef{Name: "users"}, "", selectOrder{Limit: 4}); fmt.Sprint(rowKeys(got)) != "[alice bob carol user000]" {
+		t.Errorf("rows should come back in key order: %v", rowKeys(got))
+	}
+
+	// 主键上有前缀的 LIKE 只扫描主键树的一段，其余 LIKE 扫描整张表后过滤
+	for cond, want := range map[string]string{
+		"name like 'user01%'":   "[user010 user011 user012 user013 user014 user015 user016 user017 user018 user019]",
+		"name like 'user59_'":   "[user590 user591 user592 user593 user594 user595 user596 user597 user598 user599]",
+		"users.name like 'b%'":  "[bob]",
+		"name like '%o%'":       "[bob carol]",
+		"name not like 'user%'": "[alice bob carol]",
+		"age like '4_'":         "[carol user040 user041 user042 user043 user044 user045 user046 user047 user048 user049]",
+		"name like 'zz%'":       "[]",
+		"name like 'user\\_%'":  "[]",
+		"name like 'alice'":     "[alice]",
+		"name like 'user00%'":   "[user000 user001 user002 user003 user004 user005 user006 user007 user008 user009]",
+	} {
+		got, err := p.querySelect(tableRef{Name: "users"}, cond, selectOrder{Limit: -1})
+		if err != nil || fmt.Sprint(rowKeys(got)) != want {
+			t.Errorf("where %s = %v, %v; want %s", cond, rowKeys(got), err, want)
+		}
+	}
+	if got, _ := p.querySelect(tableRef{Name: "users"}, "name like 'user%'", selectOrder{Limit: 3}); fmt.Sprint(rowKeys(got)) != "[user000 user001 user002]" {
+		t.Errorf("like with limit: %v", rowKeys(got))
+	}
+	var plan strings.Builder
+	p.Output = &plan
+	if err := p.ParseAndExecute("set output_format = plain"); err != nil {
+		t.Fatal(err)
+	}
+	for sql, want := range map[string]string{
+		"explain select * from users where name like 'user1%'": "index range scan on users: name >= 'user1' and name < 'user2'",
+		"explain select * from users where age like '4%'":      "full scan on users",
+	} {
+		plan.Reset()
+		if err := p.ParseAndExecute(sql); err != nil || !strings.Contains(plan.String(), want) {
+			t.Errorf("%s: plan %s, %v; want %q", sql, plan.String(), err, want)
+		}
+	}
+	p.Output = io.Discard
+
+	for sql, want := range map[string]*Error{
+		"insert into users values ('bob', 1)":                             ErrDuplicateKey,
+		"insert into users values ('x', 1), ('x', 2)":                     ErrDuplicateKey,
+		"insert into users values ('" + strings.Repeat("k", 33) + "', 1)": ErrInvalidValue,
+		"insert into users values (null, 1)":                              ErrInvalidValue,
+		"select * from users where name > 'a'":                            ErrUnsupported,
+		"select * from users order by age":                                ErrUnsupported,
+		"select sum(age) from users":                                      ErrUnsupported,
+		"vacuum users":                                                    ErrUnsupported,
+		"create table bad (name varchar auto_increment)":                  ErrInvalidSchema,
+	} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %s", sql, err, want.Code)
+		}
+	}
+	if _, err := e.Delete("users", 1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Delete on a varchar key: %v", err)
+	}
+	if res, err := e.CheckPages(); err != nil || len(res.Unreachable) != 0 || !res.OK() {
+		t.Errorf("check freelist = %+v, %v", res, err)
+	}
+
+	// 重启和压缩数据文件之后数据还在
+	e.Close()
+	e = open()
+	e.CompactOnClose = true
+	e.Close()
+	e = open()
+	defer e.Close()
+	lines, err := e.SelectAll("users")
+	if err != nil || len(lines) != 603 || lines[0] != "[alice] 30" || lines[602] != "[user599] 599" {
+		t.Fatalf("after reopen: %d rows, first %q, %v", len(lines), lines[:min(1, len(lines))], err)
+	}
+	if err := NewSQLParser(e, io.Discard).ParseAndExecute("insert into users values ('zed', 1)"); err != nil {
+		t.Errorf("insert after reopen: %v", err)
+	}
+}
+
+func rowKeys(rows []Row) []string {
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		keys[i] = r.Cells()[0]
+	}
+	return keys
+}
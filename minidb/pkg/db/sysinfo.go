@@ -0,0 +1,185 @@
+package db
+
+import (
+	"cmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 系统表：按表名前缀识别，结果直接由 Catalog 生成，不经过 B+ 树
+const (
+	SystemSchema       = "information_schema"
+	SystemTableTables  = SystemSchema + ".tables"
+	SystemTableColumns = SystemSchema + ".columns"
+)
+
+// IsSystemTable 报告 name 是否是 information_schema 下的系统表
+func IsSystemTable(name string) bool {
+	schema, _, ok := strings.Cut(name, ".")
+	return ok && strings.EqualFold(schema, SystemSchema)
+}
+
+// SystemTable 返回系统表的列名和当前库中的所有行，行按表名（和列序号）排序
+//
+//	information_schema.tables:  table_name, table_rows, root_page, tablespace, on_conflict, value_encoding, auto_increment
+//	information_schema.columns: table_name, column_name, ordinal_position, data_type, column_key, extra
+//
+// auto_increment 是已经预留到的自增主键上限，没有自增主键的表为 NULL
+func (e *Engine) SystemTable(name string) ([]string, [][]string, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return nil, nil, err
+	}
+	names := e.Catalog.ListTables()
+	sort.Strings(names)
+
+	switch strings.ToLower(name) {
+	case SystemTableTables:
+		headers := []string{"table_name", "table_rows", "root_page", "tablespace", "on_conflict", "value_encoding", "auto_increment"}
+		var rows [][]string
+		for _, table := range names {
+			meta, ok := e.Catalog.GetTable(table)
+			if !ok {
+				continue
+			}
+			conflict := cmp.Or(meta.OnConflict, string(ConflictError))
+			encoding := cmp.Or(meta.Encoding, string(EncodingText))
+			autoId := "NULL"
+			if meta.AutoIncrement {
+				autoId = strconv.FormatInt(meta.NextAutoId, 10)
+			}
+			rows = append(rows, []string{
+				table,
+				strconv.FormatInt(meta.RowCount, 10),
+				strconv.Itoa(int(meta.RootPageId)),
+				strconv.Itoa(meta.Tablespace),
+				conflict,
+				encoding,
+				autoId,
+			})
+		}
+		return headers, rows, nil
+
+	case SystemTableColumns:
+		headers := []string{"table_name", "column_name", "ordinal_position", "data_type", "column_key", "extra"}
+		var rows [][]string
+		for _, table := range names {
+			meta, ok := e.Catalog.GetTable(table)
+			if !ok {
+				continue
+			}
+			columns := meta.Columns()
+			if columns == nil {
+				// 旧版本的自由格式 Schema：只知道列名
+				cols, _ := e.TableColumns(table)
+				for _, c := range cols {
+					columns = append(columns, Column{Name: c, Type: TypeVarchar})
+				}
+			}
+			for i, c := range columns {
+				key, extra := "", ""
+				if c.PrimaryKey {
+					key = "PRI"
+				}
+				if c.AutoIncrement {
+					extra = "auto_increment"
+				}
+				rows = append(rows, []string{table, c.Name, strconv.Itoa(i + 1), c.Type.String(), key, extra})
+			}
+		}
+		return headers, rows, nil
+	}
+	return nil, nil, errorf(ErrTableNotFound, "unknown system table '%s'", name)
+}
+
+// handleSystemSelect 对系统表执行 SELECT
+// 支持列投影、单个比较条件（两边都是整数时按数值比较）、ORDER BY 任意列和 LIMIT
+func (p *SQLParser) handleSystemSelect(ref tableRef, columns, condition, orderCol, dir, limit string) error {
+	headers, rows, err := p.Engine.SystemTable(ref.Name)
+	if err != nil {
+		return err
+	}
+	column := func(raw string) (int, error) {
+		name, err := ref.resolveColumn(strings.TrimSpace(raw))
+		if err != nil {
+			return 0, err
+		}
+		for i, h := range headers {
+			if strings.EqualFold(h, name) {
+				return i, nil
+			}
+		}
+		return 0, errorf(ErrColumnNotFound, "unknown column '%s' in table '%s'", name, ref.Name)
+	}
+
+	if condition != "" {
+		m := reWhere.FindStringSubmatch(strings.TrimSpace(condition))
+		if m == nil {
+			return errorf(ErrSyntax, "unsupported where clause")
+		}
+		idx, err := column(m[1])
+		if err != nil {
+			return err
+		}
+		value := strings.Trim(strings.TrimSpace(m[3]), "'\"")
+		cond := caseCond{col: idx, numeric: true, op: m[2], value: caseOperand{col: -1, lit: value}}
+		filtered := rows[:0]
+		for _, r := range rows {
+			if cond.match(r) {
+				filtered = append(filtered, r)
+			}
+		}
+		rows = filtered
+	}
+
+	if orderCol != "" {
+		idx, err := column(orderCol)
+		if err != nil {
+			return err
+		}
+		desc := strings.EqualFold(dir, "desc")
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := rows[i][idx], rows[j][idx]
+			order := cmp.Compare(a, b)
+			x, errX := strconv.ParseInt(a, 10, 64)
+			y, errY := strconv.ParseInt(b, 10, 64)
+			if errX == nil && errY == nil {
+				order = cmp.Compare(x, y)
+			}
+			if desc {
+				return order > 0
+			}
+			return order < 0
+		})
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return errorf(ErrInvalidValue, "invalid limit '%s'", limit)
+		}
+		rows = rows[:min(n, len(rows))]
+	}
+
+	if strings.TrimSpace(columns) == "*" {
+		return p.printCells(headers, rows)
+	}
+	var indexes []int
+	var projected []string
+	for _, raw := range splitSelectList(columns) {
+		idx, err := column(raw)
+		if err != nil {
+			return err
+		}
+		indexes = append(indexes, idx)
+		projected = append(projected, headers[idx])
+	}
+	cells := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		out := make([]string, len(indexes))
+		for j, idx := range indexes {
+			out[j] = r[idx]
+		}
+		cells = append(cells, out)
+	}
+	return p.printCells(projected, cells)
+}
@@ -0,0 +1,113 @@
+package db
+
+import "sync"
+
+// tableLocks 是每张表的读写锁，由同一引擎派生的所有会话共享
+// B+ 树自带的锁只在同一个 BPlusTree 实例内有效，而引擎每次操作都新建实例，
+// 所以由这里保证：写入（插入、覆盖、回滚）独占整张表；读者在读的这段时间里
+// 树不会分裂或合并，迭代器沿 NextPageID 走到的叶子不会过时。
+// RowIterator 每批重新定位一次，只在读一批的时候持有读锁，长扫描不会一直挡住写入。
+// 写者之间另有一把锁：VACUUM 边读旧树边建新树，只排斥其他写者，不挡读者（包括它自己的扫描）。
+//
+// 点查（SelectById）比扫描宽松：树按闩蟹行加页闩（见 BPlusTree.GetValue），所以只要树不分裂或合并，
+// 就可以与只改一个叶子的写入（InsertInLeaf、RemoveInLeaf）并发。这样的写者用 writeLeaf 排斥扫描和其他写者、
+// 与点查共享 rw；要分裂、合并或覆盖时再 escalate 成独占
+type tableLocks struct {
+	mu    sync.Mutex
+	locks map[string]*tableLock
+}
+
+// tableLock 是一张表的锁，按 writers、scan、rw 的顺序取：
+// 扫描等读者共享 scan 和 rw，点查只共享 rw；写者独占 writers 和 scan，改树的结构时再独占 rw
+type tableLock struct {
+	writers sync.Mutex
+	scan    sync.RWMutex
+	rw      sync.RWMutex
+}
+
+func (l *tableLocks) get(name string) *tableLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = &tableLock{}
+		l.locks[name] = lock
+	}
+	return lock
+}
+
+// readTable 取得表的读锁，返回解锁函数；持有期间不能再对同一张表加锁
+func (e *Engine) readTable(tableName string) func() {
+	lock := e.locks.get(e.cacheName(tableName))
+	lock.scan.RLock()
+	lock.rw.RLock()
+	return func() {
+		lock.rw.RUnlock()
+		lock.scan.RUnlock()
+	}
+}
+
+// lookupTable 取得点查用的读锁，返回解锁函数：只挡改树结构的写入，持有期间只能按 Key 用 GetValue 读主键树
+func (e *Engine) lookupTable(tableName string) func() {
+	lock := e.locks.get(e.cacheName(tableName))
+	lock.rw.RLock()
+	return lock.rw.RUnlock
+}
+
+// writeTable 取得表的写锁，返回解锁函数；持有期间不能再对同一张表加锁
+func (e *Engine) writeTable(tableName string) func() {
+	lock := e.locks.get(e.cacheName(tableName))
+	lock.writers.Lock()
+	lock.scan.Lock()
+	lock.rw.Lock()
+	return func() {
+		lock.rw.Unlock()
+		lock.scan.Unlock()
+		lock.writers.Unlock()
+	}
+}
+
+// leafWriter 是 writeLeaf 取得的写锁：先与点查共享 rw，escalate 之后与 writeTable 相同
+type leafWriter struct {
+	lock      *tableLock
+	exclusive bool
+}
+
+// writeLeaf 取得只改叶子的写锁，持有期间可以用 InsertInLeaf、RemoveInLeaf 写主键树，
+// 主键树的其他改动（TryInsert、Remove、Update）之前要先 escalate；点查不读二级索引，写二级索引不受限制
+func (e *Engine) writeLeaf(tableName string) *leafWriter {
+	lock := e.locks.get(e.cacheName(tableName))
+	lock.writers.Lock()
+	lock.scan.Lock()
+	lock.rw.RLock()
+	return &leafWriter{lock: lock}
+}
+
+// escalate 等正在进行的点查结束后独占整张表；已经独占时什么也不做。
+// 放开 rw 的读锁到取得写锁之间其他写者进不来（仍持有 writers），树不会被改
+func (w *leafWriter) escalate() {
+	if w.exclusive {
+		return
+	}
+	w.lock.rw.RUnlock()
+	w.lock.rw.Lock()
+	w.exclusive = true
+}
+
+func (w *leafWriter) unlock() {
+	if w.exclusive {
+		w.lock.rw.Unlock()
+	} else {
+		w.lock.rw.RUnlock()
+	}
+	w.lock.scan.Unlock()
+	w.lock.writers.Unlock()
+}
+
+// excludeWriters 排斥同一张表的其他写者但不挡读者，返回解锁函数；
+// 持有期间可以读这张表（readTable），不能再取 writeTable
+func (e *Engine) excludeWriters(tableName string) func() {
+	lock := e.locks.get(e.cacheName(tableName))
+	lock.writers.Lock()
+	return lock.writers.Unlock
+}
@@ -0,0 +1,132 @@
+package db
+
+// 临时表（create temporary table）只对创建它的会话可见，不写入 meta.json，会话结束时删除并释放页面
+//
+// 每个会话建第一张临时表时，Engine.Catalog 换成一个会话自己的 Catalog（shared 指向共享的 Catalog），
+// 临时表登记在它的 Tables 里，其余的表按表名转给共享的 Catalog，引擎里的其他代码不用区分。
+// 布隆过滤器、点查缓存和表锁都按表名索引、所有会话共享，所以临时表的表名也登记在共享 Catalog 的 temps 中，
+// 与普通表和其他会话的临时表都不能重名
+
+// route 返回管理表 name 的 Catalog：本会话的临时表由会话自己的 Catalog 管理，其余的转给共享的 Catalog
+func (c *Catalog) route(name string) *Catalog {
+	if c.shared == nil {
+		return c
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.Tables[name]; ok {
+		return c
+	}
+	return c.shared
+}
+
+// sharedCatalog 返回所有会话共享的 Catalog
+func (c *Catalog) sharedCatalog() *Catalog {
+	if c == nil || c.shared == nil {
+		return c
+	}
+	return c.shared
+}
+
+// newSessionCatalog 创建挂在共享 Catalog c 上的会话临时表目录
+func (c *Catalog) newSessionCatalog() *Catalog {
+	return &Catalog{
+		Tables:      make(map[string]*TableMeta),
+		PageSize:    c.PageSize,
+		Tablespaces: c.Tablespaces,
+		BPM:         c.BPM,
+		shared:      c,
+	}
+}
+
+// createTempTable 在会话的 Catalog 中登记临时表，表名与任何表（包括其他会话的临时表）重复时返回 false
+func (c *Catalog) createTempTable(meta *TableMeta) bool {
+	if !c.shared.reserveTempName(meta.Name) {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Tables[meta.Name] = meta
+	return true
+}
+
+func (c *Catalog) reserveTempName(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.Tables[name]; exists {
+		return false
+	}
+	if _, exists := c.temps[name]; exists {
+		return false
+	}
+	if c.temps == nil {
+		c.temps = make(map[string]struct{})
+	}
+	c.temps[name] = struct{}{}
+	return true
+}
+
+func (c *Catalog) releaseTempName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.temps, name)
+}
+
+// tempTables 返回本会话的临时表名
+func (c *Catalog) tempTables() []string {
+	if c.shared == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.Tables))
+	for name := range c.Tables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// IsTemporary 报告 name 是否是本会话的临时表
+func (e *Engine) IsTemporary(name string) bool {
+	return e.Catalog != nil && e.Catalog.shared != nil && e.Catalog.route(name) == e.Catalog
+}
+
+// sessionCatalog 返回本会话的临时表目录，第一次建临时表时创建
+func (e *Engine) sessionCatalog() *Catalog {
+	if e.Catalog.shared == nil {
+		e.Catalog = e.Catalog.newSessionCatalog()
+	}
+	return e.Catalog
+}
+
+// DropTemporaryTables 删除本会话的所有临时表并释放它们的页面，在连接断开时调用
+func (e *Engine) DropTemporaryTables() error {
+	if e.Catalog == nil || e.Catalog.shared == nil {
+		return nil
+	}
+	var firstErr error
+	for _, name := range e.Catalog.tempTables() {
+		if err := e.DropTable(name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	e.Catalog = e.Catalog.shared
+	return firstErr
+}
+
+// freeTablePages 释放表的全部页面（DROP TABLE、临时表随会话删除时），经过 epochRegistry：
+// 与 VACUUM 释放旧树的方式一致，已经开始读这张表的读者结束后才真正释放
+func (e *Engine) freeTablePages(meta *TableMeta) error {
+	pages, err := e.tablePages(meta)
+	if err != nil {
+		return err
+	}
+	if e.epochs == nil {
+		for _, id := range pages {
+			e.BPM.DeletePage(id)
+		}
+		return nil
+	}
+	e.epochs.retire(pages)
+	return nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTemporaryTable(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("orders", "id int,item string"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := e.NewSession()
+	s.CurrentDB = e.CurrentDB
+	p := NewSQLParser(s, io.Discard)
+	for _, sql := range []string{
+		"create temporary table tmp (id int, name string)",
+		"insert into tmp values (1, 'a'), (2, 'b')",
+		"insert into orders values (7, 'x')", // 普通表照常读写
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for i := int64(3); i <= 500; i++ {
+		if err := s.Insert("tmp", i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := queryKeys(t, p, "select * from tmp where id <= 2"); len(keys) != 2 {
+		t.Errorf("temporary table returned %v", keys)
+	}
+	if keys := queryKeys(t, p, "select * from orders"); len(keys) != 1 || keys[0] != 7 {
+		t.Errorf("orders returned %v", keys)
+	}
+	if !strings.Contains(strings.Join(s.Catalog.ListTables(), ","), "tmp") {
+		t.Errorf("show tables in the session should list tmp: %v", s.Catalog.ListTables())
+	}
+
+	// 其他会话看不到，也不能用同一个表名建表
+	other := e.NewSession()
+	other.CurrentDB = e.CurrentDB
+	if ok, _ := other.TableExists("tmp"); ok {
+		t.Error("temporary table is visible to another session")
+	}
+	if err := other.CreateTable("tmp", "id int"); !errors.Is(err, ErrTableExists) {
+		t.Errorf("create table with a temporary table's name: got %v, want ErrTableExists", err)
+	}
+	if err := NewSQLParser(other, io.Discard).ParseAndExecute("create temp table tmp (id int)"); !errors.Is(err, ErrTableExists) {
+		t.Errorf("create temporary table with another session's name: got %v, want ErrTableExists", err)
+	}
+
+	// 不写入 meta.json
+	if err := s.FlushMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(e.Catalog.MetaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"tmp"`) {
+		t.Errorf("temporary table was persisted: %s", data)
+	}
+	if !strings.Contains(string(data), `"orders"`) {
+		t.Errorf("orders missing from meta.json: %s", data)
+	}
+
+	// 会话结束：表被删除，页面释放，表名可以再用
+	if err := s.DropTemporaryTables(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.TableExists("tmp"); ok {
+		t.Error("temporary table still exists after the session closed")
+	}
+	if p := e.epochs.pending(); p != 0 {
+		t.Errorf("%d pages of the temporary table were not freed", p)
+	}
+	if err := other.CreateTable("tmp", "id int"); err != nil {
+		t.Errorf("name of a dropped temporary table should be free: %v", err)
+	}
+	if ok, _ := s.TableExists("orders"); !ok {
+		t.Error("orders disappeared with the temporary tables")
+	}
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 事务是乐观的：BEGIN 之后的插入只缓存在会话里，别的会话看不到；本会话也读不到，
+// 所以事务写过的表在提交或回滚之前不能查询（见 checkTxRead），免得结果悄悄漏掉缓存的行。
+// COMMIT 时先校验再一次性写入，先提交者胜出。DDL 不受事务控制，立即生效
+
+// ConflictKind 是提交失败的原因
+type ConflictKind string
+
+const (
+	ConflictWriteWrite   ConflictKind = "write-write"   // 事务开始后，别的会话提交了同一个主键
+	ConflictDuplicateKey ConflictKind = "duplicate-key" // 主键已存在（表的冲突策略为 error），或事务内写了两次
+)
+
+// Conflict 描述导致提交失败的那一行
+type Conflict struct {
+	Kind  ConflictKind
+	Table string
+	Key   int64
+}
+
+func (c *Conflict) String() string {
+	return fmt.Sprintf("%s conflict on %s key %d", c.Kind, c.Table, c.Key)
+}
+
+// CommitResult 是 COMMIT 的结果：成功时 Rows 为写入（新增或覆盖）的行数，失败时 Conflict 说明原因
+type CommitResult struct {
+	Committed bool
+	Rows      int
+	Conflict  *Conflict
+}
+
+// transaction 是一个会话中未提交的事务
+type transaction struct {
+	start  uint64    // 开始时的提交时钟，之后提交的写入都算冲突
+	writes []txWrite // 按执行顺序缓存的插入
+}
+
+type txWrite struct {
+	table string
+	row   Row
+}
+
+func (tx *transaction) add(table string, rows []Row) {
+	for _, r := range rows {
+		tx.writes = append(tx.writes, txWrite{table: table, row: r})
+	}
+}
+
+// wrote 报告事务是否缓存了对 table 的写入
+func (tx *transaction) wrote(table string) bool {
+	for _, w := range tx.writes {
+		if w.table == table {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTxRead 在读表之前调用：当前事务写过的表返回 ErrUnsupported。
+// 缓存的插入要到提交时才写入表，这时读到的结果会缺少它们
+func (e *Engine) checkTxRead(tableName string) error {
+	if e.tx != nil && e.tx.wrote(tableName) {
+		return errorf(ErrUnsupported, "cannot read table '%s' after writing it in the current transaction (its changes are not visible until commit), commit or rollback first", tableName)
+	}
+	return nil
+}
+
+// txnRegistry 记录每个主键最近一次提交的时钟，所有会话共享
+// 只有存在未结束的事务时才需要记录，最后一个事务结束后清空，自动提交的写入不会无限累积
+type txnRegistry struct {
+	mu     sync.Mutex // 同时串行化事务的提交
+	clock  uint64
+	active int
+	writes map[string]map[int64]uint64 // 表 -> 主键 -> 提交时钟
+}
+
+// record 在自动提交的写入之前调用，让进行中的事务在提交时能发现冲突
+func (r *txnRegistry) record(table string, keys []int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordLocked(table, keys)
+}
+
+func (r *txnRegistry) recordLocked(table string, keys []int64) {
+	r.clock++
+	if r.active == 0 {
+		return
+	}
+	if r.writes == nil {
+		r.writes = make(map[string]map[int64]uint64)
+	}
+	if r.writes[table] == nil {
+		r.writes[table] = make(map[int64]uint64)
+	}
+	for _, key := range keys {
+		r.writes[table][key] = r.clock
+	}
+}
+
+// endLocked 结束一个事务，最后一个事务结束时丢弃版本记录
+func (r *txnRegistry) endLocked() {
+	r.active--
+	if r.active == 0 {
+		r.writes = nil
+	}
+}
+
+// InTransaction 报告当前会话是否有未提交的事务
+func (e *Engine) InTransaction() bool {
+	return e.tx != nil
+}
+
+// Begin 开始一个事务，不支持嵌套
+func (e *Engine) Begin() error {
+	if err := e.EnsureDBSelected(); err != nil {
+		return err
+	}
+	if e.tx != nil {
+		return errorf(ErrUnsupported, "a transaction is already in progress (nested transactions are not supported)")
+	}
+	e.txns.mu.Lock()
+	defer e.txns.mu.Unlock()
+	e.txns.active++
+	e.tx = &transaction{start: e.txns.clock}
+	return nil
+}
+
+// Commit 校验并写入事务缓存的插入。发生冲突时什么都不写，事务被回滚，
+// 返回的 CommitResult 说明冲突的行，错误为 ErrTxConflict。
+// 校验之后的写入按表进行，写某张表失败时撤销之前已写入的表再返回错误，见 undoCommit
+func (e *Engine) Commit() (CommitResult, error) {
+	tx := e.tx
+	if tx == nil {
+		return CommitResult{}, errorf(ErrNoTransaction, "no transaction in progress")
+	}
+	e.tx = nil
+
+	r := e.txns
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.endLocked()
+
+	// 按表分组，保持每张表内的插入顺序
+	var tables []string
+	rows := make(map[string][]Row)
+	for _, w := range tx.writes {
+		if _, ok := rows[w.table]; !ok {
+			tables = append(tables, w.table)
+		}
+		rows[w.table] = append(rows[w.table], w.row)
+	}
+
+	// 先校验所有的行，任何冲突都让整个事务失败
+	for _, table := range tables {
+		meta, ok := e.Catalog.GetTable(table)
+		if !ok {
+			return CommitResult{}, errorf(ErrTableNotFound, "commit failed: table '%s' was dropped, transaction rolled back", table)
+		}
+		// 冲突策略为 replace / ignore 的表不会因为主键重复而失败
+		policy := ConflictPolicy(meta.OnConflict)
+		checkDup := policy != ConflictReplace && policy != ConflictIgnore
+		seen := make(map[int64]bool)
+		for _, row := range rows[table] {
+			if ts, ok := r.writes[table][row.Key]; ok && ts > tx.start {
+				return conflict(ConflictWriteWrite, table, row.Key)
+			}
+			if checkDup && (seen[row.Key] || e.Contains(table, row.Key)) {
+				return conflict(ConflictDuplicateKey, table, row.Key)
+			}
+			seen[row.Key] = true
+		}
+	}
+
+	res := CommitResult{Committed: true}
+	var applied []appliedTable
+	for _, table := range tables {
+		meta, values, err := e.prepareRows(table, rows[table])
+		if err != nil {
+			return CommitResult{}, e.undoCommit(applied, err)
+		}
+		n, undo, err := e.applyRows(table, meta, rows[table], values)
+		if undo != nil {
+			applied = append(applied, appliedTable{table: table, undo: undo})
+		}
+		if err != nil {
+			return CommitResult{}, e.undoCommit(applied, err)
+		}
+		res.Rows += n
+	}
+
+	// 全部写入之后才记录版本，撤销了的写入不会让别的事务误报冲突
+	for _, table := range tables {
+		keys := make([]int64, len(rows[table]))
+		for i, row := range rows[table] {
+			keys[i] = row.Key
+		}
+		r.recordLocked(table, keys)
+	}
+	return res, nil
+}
+
+// appliedTable 是提交时已经写入的一张表
+type appliedTable struct {
+	table string
+	undo  *rowUndo
+}
+
+// undoCommit 按相反的顺序撤销提交时已经写入的表，返回导致提交失败的错误；
+// 撤销本身也失败时一并报告，这时数据库里可能留下了事务的部分写入
+func (e *Engine) undoCommit(applied []appliedTable, cause error) error {
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := e.undoRows(applied[i].table, applied[i].undo); err != nil {
+			return fmt.Errorf("%w; undoing the rows already written to table '%s' failed, the transaction may be partially applied: %v", cause, applied[i].table, err)
+		}
+	}
+	return fmt.Errorf("%w, transaction rolled back", cause)
+}
+
+// conflict 构造提交失败的结果和错误
+func conflict(kind ConflictKind, table string, key int64) (CommitResult, error) {
+	c := &Conflict{Kind: kind, Table: table, Key: key}
+	return CommitResult{Conflict: c}, errorf(ErrTxConflict, "commit failed: %s, transaction rolled back", c)
+}
+
+// Rollback 丢弃事务缓存的插入，返回丢弃的行数
+func (e *Engine) Rollback() (int, error) {
+	if e.tx == nil {
+		return 0, errorf(ErrNoTransaction, "no transaction in progress")
+	}
+	n := len(e.tx.writes)
+	e.tx = nil
+	e.txns.mu.Lock()
+	defer e.txns.mu.Unlock()
+	e.txns.endLocked()
+	return n, nil
+}
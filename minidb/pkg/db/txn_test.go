@@ -0,0 +1,232 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestTransactionCommitRollback(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, v string"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Insert("t", 1, "existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Commit(); !errors.Is(err, ErrNoTransaction) {
+		t.Fatalf("commit without begin: %v", err)
+	}
+	if _, err := e.Rollback(); !errors.Is(err, ErrNoTransaction) {
+		t.Fatalf("rollback without begin: %v", err)
+	}
+
+	// 提交前缓存的插入不可见，提交后一次写入
+	if err := e.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Begin(); err == nil {
+		t.Fatal("nested begin should fail")
+	}
+	e.Insert("t", 2, "a")
+	if n, err := e.InsertRows("t", []Row{{Key: 3, Value: "b"}, {Key: 4, Value: "c"}}); err != nil || n != 2 {
+		t.Fatalf("buffered insert: %d, %v", n, err)
+	}
+	if e.Contains("t", 2) {
+		t.Fatal("uncommitted row is visible")
+	}
+	res, err := e.Commit()
+	if err != nil || !res.Committed || res.Rows != 3 {
+		t.Fatalf("commit: %+v, %v", res, err)
+	}
+	for _, k := range []int64{2, 3, 4} {
+		if !e.Contains("t", k) {
+			t.Errorf("key %d missing after commit", k)
+		}
+	}
+	if e.InTransaction() {
+		t.Fatal("transaction still open after commit")
+	}
+
+	// 回滚报告丢弃的行数
+	e.Begin()
+	e.InsertRows("t", []Row{{Key: 5, Value: "x"}, {Key: 6, Value: "y"}})
+	if n, err := e.Rollback(); err != nil || n != 2 {
+		t.Fatalf("rollback: %d, %v", n, err)
+	}
+	if e.Contains("t", 5) {
+		t.Fatal("rolled back row is visible")
+	}
+
+	// 主键冲突推迟到提交时发现，整个事务都不写入
+	e.Begin()
+	e.Insert("t", 7, "new")
+	e.Insert("t", 1, "dup")
+	res, err = e.Commit()
+	if !errors.Is(err, ErrTxConflict) || res.Committed || res.Conflict == nil ||
+		res.Conflict.Kind != ConflictDuplicateKey || res.Conflict.Key != 1 {
+		t.Fatalf("duplicate key commit: %+v, %v", res, err)
+	}
+	if e.Contains("t", 7) {
+		t.Fatal("failed commit wrote a row")
+	}
+
+	// 通过 SQL 使用事务
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{"begin", "insert into t values (8, 'z')", "commit", "start transaction", "insert into t values (9, 'z')", "rollback"} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	if !e.Contains("t", 8) || e.Contains("t", 9) {
+		t.Fatal("SQL transaction did not commit / roll back")
+	}
+}
+
+func TestTransactionConflict(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int, v string"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多个会话写同一个主键并同时提交，只有一个成功
+	const sessions = 8
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	results := make([]CommitResult, sessions)
+	errs := make([]error, sessions)
+	for i := 0; i < sessions; i++ {
+		s := e.NewSession()
+		s.CurrentDB = e.CurrentDB
+		if err := s.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Insert("t", 42, fmt.Sprintf("s%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = s.Commit()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	committed := 0
+	for i := range results {
+		switch {
+		case errs[i] == nil && results[i].Committed:
+			committed++
+		case errors.Is(errs[i], ErrTxConflict) && results[i].Conflict.Kind == ConflictWriteWrite:
+		default:
+			t.Errorf("session %d: %+v, %v", i, results[i], errs[i])
+		}
+	}
+	if committed != 1 {
+		t.Fatalf("%d sessions committed, want 1", committed)
+	}
+
+	// 事务开始后别的会话自动提交了同一个主键
+	other := e.NewSession()
+	other.CurrentDB = e.CurrentDB
+	e.Begin()
+	e.Insert("t", 100, "tx")
+	e.Insert("t", 101, "tx")
+	if err := other.Insert("t", 101, "autocommit"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.Commit()
+	if !errors.Is(err, ErrTxConflict) || res.Conflict.Kind != ConflictWriteWrite || res.Conflict.Key != 101 {
+		t.Fatalf("autocommit conflict: %+v, %v", res, err)
+	}
+	if e.Contains("t", 100) {
+		t.Fatal("conflicting transaction wrote a row")
+	}
+	if len(e.txns.writes) != 0 {
+		t.Fatal("version records kept after the last transaction ended")
+	}
+}
+
+func TestTransactionReadOwnWrites(t *testing.T) {
+	e := newTestEngine(t)
+	for _, name := range []string{"t", "u"} {
+		if err := e.CreateTable(name, "id int, v string"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Insert("t", 1, "existing")
+	e.Insert("u", 1, "other")
+	p := NewSQLParser(e, io.Discard)
+
+	// 写过的表在提交之前不能读，没写过的表照常读
+	e.Begin()
+	e.Insert("t", 2, "buffered")
+	for _, sql := range []string{"select * from t", "select * from t where id = 2", "select count(*) from t", "select v, count(*) from t group by v"} {
+		if err := p.ParseAndExecute(sql); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s inside the transaction: %v", sql, err)
+		}
+	}
+	if _, err := e.SelectAll("t"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SelectAll inside the transaction: %v", err)
+	}
+	if err := p.ParseAndExecute("select * from u"); err != nil {
+		t.Fatalf("reading a table the transaction did not write: %v", err)
+	}
+	if _, err := e.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := e.SelectAll("t"); err != nil || len(rows) != 2 {
+		t.Fatalf("after commit: %v, %v", rows, err)
+	}
+}
+
+func TestTransactionCommitUndo(t *testing.T) {
+	e := newTestEngine(t)
+	p := NewSQLParser(e, io.Discard)
+	for _, sql := range []string{
+		"create table a (id int, v string) with (on_conflict = replace)",
+		"create table b (id int, v string)",
+		"insert into a values (1, 'before')",
+	} {
+		if err := p.ParseAndExecute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	e.Begin()
+	e.InsertRows("a", []Row{{Key: 1, Value: "after"}, {Key: 2, Value: "new"}})
+	e.Insert("b", 1, "text")
+
+	// 别的会话把 b 换成了 v 为 int 的表，a 写入之后 b 的行通不过检查
+	other := e.NewSession()
+	other.CurrentDB = e.CurrentDB
+	if err := other.DropTable("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.CreateTable("b", "id int, v int"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.Commit()
+	if err == nil || res.Committed {
+		t.Fatalf("commit with an invalid row: %+v, %v", res, err)
+	}
+
+	// a 恢复成事务之前的样子
+	if v, ok := e.SelectById("a", 1); !ok || v != "before" {
+		t.Errorf("replaced row after the failed commit: %q, %v", v, ok)
+	}
+	if e.Contains("a", 2) {
+		t.Error("inserted row kept after the failed commit")
+	}
+	if n, _, err := e.AggregateKey("a", "count"); err != nil || n != 1 {
+		t.Errorf("rows in a after the failed commit: %d, %v", n, err)
+	}
+	if len(e.txns.writes) != 0 {
+		t.Fatal("version records kept after the failed commit")
+	}
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"math"
+	"sync"
+
+	"minidb/pkg/storage/page"
+)
+
+// epochRegistry 推迟释放 VACUUM 换下来的旧页面，直到可能还在读旧树的读者都结束
+//
+// 读者在读表的根页之前调用 enter 登记当前纪元，读完调用返回的函数退出；
+// VACUUM 换根之后把旧页面登记在当前纪元下，再把纪元加一。
+// 之后进入的读者拿到的一定是新根，所以只要纪元不大于旧页面纪元的读者都退出了，
+// 旧页面就不会再被访问，可以从缓冲池删除。所有会话共享
+type epochRegistry struct {
+	mu      sync.Mutex
+	epoch   uint64
+	active  map[uint64]int // 纪元 -> 仍在读的读者数
+	retired []retiredPages
+	free    func(page.PageID) bool // 释放一个页面，页面仍被 Pin 住时返回 false，稍后重试
+}
+
+type retiredPages struct {
+	epoch uint64
+	pages []page.PageID
+}
+
+func newEpochRegistry(free func(page.PageID) bool) *epochRegistry {
+	return &epochRegistry{active: make(map[uint64]int), free: free}
+}
+
+// enter 登记一个读者，返回退出函数，必须调用且只能调用一次
+func (r *epochRegistry) enter() func() {
+	r.mu.Lock()
+	epoch := r.epoch
+	r.active[epoch]++
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.active[epoch]--; r.active[epoch] == 0 {
+			delete(r.active, epoch)
+		}
+		r.reclaimLocked()
+	}
+}
+
+// retire 登记换下来的旧页面，返回立即释放的页数，其余的等读者退出后释放
+func (r *epochRegistry) retire(pages []page.PageID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retired = append(r.retired, retiredPages{epoch: r.epoch, pages: pages})
+	r.epoch++
+	before := r.pendingLocked()
+	r.reclaimLocked()
+	return before - r.pendingLocked()
+}
+
+// pending 返回还没有释放的旧页面数
+func (r *epochRegistry) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pendingLocked()
+}
+
+func (r *epochRegistry) pendingLocked() int {
+	n := 0
+	for _, rp := range r.retired {
+		n += len(rp.pages)
+	}
+	return n
+}
+
+// reclaimLocked 释放所有不再有读者可能访问的旧页面
+func (r *epochRegistry) reclaimLocked() {
+	oldest := uint64(math.MaxUint64)
+	for epoch := range r.active {
+		oldest = min(oldest, epoch)
+	}
+	kept := r.retired[:0]
+	for _, rp := range r.retired {
+		if rp.epoch >= oldest {
+			kept = append(kept, rp)
+			continue
+		}
+		var busy []page.PageID
+		for _, id := range rp.pages {
+			if !r.free(id) {
+				busy = append(busy, id)
+			}
+		}
+		if len(busy) > 0 {
+			kept = append(kept, retiredPages{epoch: rp.epoch, pages: busy})
+		}
+	}
+	r.retired = kept
+}
+
+// enterRead 在读表的根页之前调用，返回的函数在读完后调用，见 epochRegistry
+func (e *Engine) enterRead() func() {
+	if e.epochs == nil {
+		return func() {}
+	}
+	return e.epochs.enter()
+}
+
+// VacuumResult 是一次 VACUUM 的结果
+type VacuumResult struct {
+	OldPages int // 重建前树占用的页数
+	NewPages int // 重建后树占用的页数
+	Freed    int // 已经从缓冲池释放的旧页面数
+	Deferred int // 仍有读者可能在访问、推迟释放的旧页面数
+}
+
+// Vacuum 把表按主键顺序重写到一棵新树上（叶子尽量填满），换根后释放旧树的页面
+// 换根之前开始的读者继续读旧树，旧页面等它们结束后才释放；之后的读者读新树。
+// 同一张表上的写入等 VACUUM 换根之后才进行，否则写进旧树的行会丢失
+func (e *Engine) Vacuum(tableName string) (VacuumResult, error) {
+	if err := e.EnsureDBSelected(); err != nil {
+		return VacuumResult{}, err
+	}
+	meta, ok := e.Catalog.GetTable(tableName)
+	if !ok {
+		return VacuumResult{}, errorf(ErrTableNotFound, "table '%s' not found", tableName)
+	}
+	if err := requireIntKey(meta); err != nil {
+		return VacuumResult{}, err
+	}
+	defer e.excludeWriters(tableName)()
+
+	oldPages, err := e.openTree(meta).Pages()
+	if err != nil {
+		return VacuumResult{}, err
+	}
+	root, err := e.copyTable(tableName, e.BPM)
+	if err != nil {
+		return VacuumResult{}, err
+	}
+	e.Catalog.UpdateTableRoot(tableName, root)
+
+	newPages, err := e.openTree(meta).Pages()
+	if err != nil {
+		return VacuumResult{}, err
+	}
+	res := VacuumResult{OldPages: len(oldPages), NewPages: len(newPages)}
+	if e.epochs == nil {
+		return res, e.commit()
+	}
+	res.Freed = e.epochs.retire(oldPages)
+	res.Deferred = res.OldPages - res.Freed
+	return res, e.commit()
+}
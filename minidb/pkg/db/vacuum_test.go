@@ -0,0 +1,181 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"minidb/pkg/storage/index"
+	"minidb/pkg/storage/page"
+)
+
+// newVacuumTable 建一张 n 行的表，按打乱的顺序插入，叶子大多半满
+func newVacuumTable(t *testing.T, n int64) *Engine {
+	t.Helper()
+	e := newTestEngine(t)
+	if err := e.CreateTable("t", "id int,name string"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < n; i++ {
+		if err := e.Insert("t", (i*7919)%n, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e
+}
+
+func TestVacuumDefersFreeingDuringScan(t *testing.T) {
+	const n = 2000
+	e := newVacuumTable(t, n)
+	meta, _ := e.Catalog.GetTable("t")
+	oldPages, err := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 扫描进行到一半时 VACUUM：旧页面不能释放，扫描读完旧树
+	var res VacuumResult
+	seen := 0
+	err = e.scanUnordered("t", func(Row) bool {
+		if seen++; seen == n/2 {
+			if res, err = e.Vacuum("t"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != n {
+		t.Fatalf("scan saw %d rows, want %d", seen, n)
+	}
+	if res.OldPages != len(oldPages) || res.Deferred != res.OldPages || res.Freed != 0 {
+		t.Errorf("vacuum during scan: %+v", res)
+	}
+	if res.NewPages >= res.OldPages {
+		t.Errorf("vacuum did not shrink the tree: %+v", res)
+	}
+
+	// 读者结束后旧页面全部从缓冲池删除
+	if p := e.epochs.pending(); p != 0 {
+		t.Errorf("%d old pages still pending after the scan finished", p)
+	}
+	old := make(map[page.PageID]bool)
+	for _, id := range oldPages {
+		old[id] = true
+	}
+	for _, f := range e.BPM.Frames() {
+		if !f.Free && old[f.PageID] {
+			t.Errorf("old page %d still resident", f.PageID)
+		}
+	}
+
+	// 没有读者时立即释放
+	if res, err = e.Vacuum("t"); err != nil || res.Deferred != 0 || res.Freed != res.OldPages {
+		t.Errorf("idle vacuum: %+v, %v", res, err)
+	}
+	if count, _, err := e.AggregateKey("t", "count"); err != nil || count != n {
+		t.Errorf("count after vacuum = %d, %v", count, err)
+	}
+	if v, ok := e.SelectById("t", 1234); !ok || v != "v" {
+		t.Errorf("lookup after vacuum = %q, %v", v, ok)
+	}
+}
+
+func TestVacuumConcurrentReaders(t *testing.T) {
+	const n = 1000
+	e := newVacuumTable(t, n)
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			session := e.NewSession()
+			session.CurrentDB = e.CurrentDB
+			for !stop.Load() {
+				count := 0
+				if r%2 == 0 {
+					it, err := session.ScanRange("t", math.MinInt64, math.MaxInt64)
+					if err != nil {
+						errs <- err
+						return
+					}
+					for it.Next() {
+						count++
+					}
+					it.Close()
+				} else if err := session.scanUnordered("t", func(Row) bool { count++; return true }); err != nil {
+					errs <- err
+					return
+				}
+				if count != n {
+					errs <- fmt.Errorf("reader %d saw %d rows, want %d", r, count, n)
+					return
+				}
+			}
+		}(r)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := e.Vacuum("t"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if p := e.epochs.pending(); p != 0 {
+		t.Errorf("%d old pages still pending after all readers finished", p)
+	}
+}
+
+func TestVacuumConcurrentWriters(t *testing.T) {
+	const n = 1000
+	e := newVacuumTable(t, n)
+
+	// 一个会话在 VACUUM 的同时写入新行，这些行不能随旧树一起丢掉
+	s := e.NewSession()
+	s.CurrentDB = e.CurrentDB
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for k := int64(n); k < 2*n; k++ {
+			if err := s.Insert("t", k, "new"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		if _, err := e.Vacuum("t"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	it, err := e.ScanRange("t", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 2*n {
+		t.Fatalf("%d rows after vacuum with a concurrent writer, want %d", count, 2*n)
+	}
+	meta, _ := e.Catalog.GetTable("t")
+	if err := index.NewBPlusTree(e.Catalog.TableRoot(meta), e.BPM).Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueColumn 是伪列名，代表行中主键以外的整个存储值（多列时是逗号拼接后的原始串）
+// 表里有同名的真实列时以真实列为准
+const ValueColumn = "value"
+
+// isValueColumn 报告 WHERE 中的列引用是否指向 value 伪列
+func (p *SQLParser) isValueColumn(ref tableRef, column string) bool {
+	name, err := ref.resolveColumn(column)
+	if err != nil || !strings.EqualFold(name, ValueColumn) {
+		return false
+	}
+	_, _, err = p.Engine.lookupColumn(ref.Name, name)
+	return errors.Is(err, ErrColumnNotFound)
+}
+
+// compareValues 比较两个值：两边都能解析为数字时按数值比较，否则按字节序比较字符串
+// 所以 '9' < '10'，但 'abc9' > 'abc10'
+func compareValues(a, b string) int {
+	x, errX := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	if errX == nil && errY == nil {
+		return cmp.Compare(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+// runValueFilter 按 value 伪列过滤，op 为比较运算符或 like / not like
+// 存储值没有索引，只能全表扫描后逐行比较
+func (p *SQLParser) runValueFilter(ref tableRef, op, operand string, limit int) ([]Row, error) {
+	var match func(string) bool
+	switch op {
+	case "like", "not like":
+		lp := compileLike(operand)
+		negate := op == "not like"
+		match = func(v string) bool { return lp.Match(v) != negate }
+	default:
+		literal := strings.TrimSpace(operand)
+		if len(literal) >= 2 && (literal[0] == '\'' || literal[0] == '"') && literal[len(literal)-1] == literal[0] {
+			literal = literal[1 : len(literal)-1]
+		}
+		match = func(v string) bool {
+			order := compareValues(v, literal)
+			switch op {
+			case "=":
+				return order == 0
+			case "!=", "<>":
+				return order != 0
+			case "<":
+				return order < 0
+			case "<=":
+				return order <= 0
+			case ">":
+				return order > 0
+			case ">=":
+				return order >= 0
+			}
+			return false
+		}
+	}
+
+	it, err := p.Engine.ScanRange(ref.Name, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var rows []Row
+	for it.Next() {
+		if limit >= 0 && len(rows) == limit {
+			break
+		}
+		if row := it.Row(); match(row.Value) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, it.Err()
+}
@@ -0,0 +1,24 @@
+package db
+
+import "fmt"
+
+// Warning 是语句执行成功但带有附加说明的情况，例如表没有统计信息、只能按默认选择率估算
+type Warning struct {
+	Level   string
+	Message string
+}
+
+// warnf 为当前语句记录一条警告
+func (e *Engine) warnf(format string, args ...interface{}) {
+	e.warnings = append(e.warnings, Warning{Level: "Warning", Message: fmt.Sprintf(format, args...)})
+}
+
+// Warnings 返回上一条语句产生的警告
+func (e *Engine) Warnings() []Warning {
+	return e.warnings
+}
+
+// ClearWarnings 在执行新语句前清空警告
+func (e *Engine) ClearWarnings() {
+	e.warnings = nil
+}
@@ -0,0 +1,66 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"minidb/pkg/storage/page"
+)
+
+// 每个页的 [page.OffsetChecksum, +4) 存放整页（不含这 4 个字节本身）的 CRC32。
+// WritePage 总是填写校验和；ReadPage 只在文件头标记了 headerFlagChecksums 时校验，
+// 旧版本写出的数据文件里这 4 个字节没有意义，读的时候不校验。
+// 全 0 的页没有校验和，只有空闲页和已分配范围之外的页才允许这样，见 verifyPage
+
+// ErrChecksumMismatch 表示从磁盘读到的页与写入时的校验和不符，页面已损坏（例如写了一半时掉电）
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// pageChecksum 计算页的 CRC32，跳过存放校验和的区域
+func pageChecksum(data []byte) uint32 {
+	sum := crc32.ChecksumIEEE(data[:page.OffsetChecksum])
+	return crc32.Update(sum, crc32.IEEETable, data[page.OffsetChecksum+page.SizeOfChecksum:])
+}
+
+// setChecksum 把校验和写入 data 的校验和区域
+func setChecksum(data []byte) {
+	binary.LittleEndian.PutUint32(data[page.OffsetChecksum:], pageChecksum(data))
+}
+
+// verifyChecksum 校验从磁盘读到的页，全 0 的页也算不符
+func verifyChecksum(pageID page.PageID, data []byte) error {
+	if binary.LittleEndian.Uint32(data[page.OffsetChecksum:]) == pageChecksum(data) {
+		return nil
+	}
+	return fmt.Errorf("page %d %w", pageID, ErrChecksumMismatch)
+}
+
+// verifyPage 与 verifyChecksum 相同，但全 0 的空闲页和已分配范围（nextPageID）之外的页是合法的：它们可能从未写过。
+// 正在使用的页全为 0 说明写入丢失，或者被撕裂的写覆盖成了 0，与校验和不符一样报告
+func (d *DiskManagerImpl) verifyPage(pageID page.PageID, data []byte) error {
+	err := verifyChecksum(pageID, data)
+	if err == nil || !isZeroPage(data) {
+		return err
+	}
+	d.allocMu.Lock()
+	defer d.allocMu.Unlock()
+	if pageID >= d.nextPageID || d.freeSet[pageID] {
+		return nil
+	}
+	return err
+}
+
+func isZeroPage(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Checksums 报告读页时是否校验校验和：新建的数据文件总是校验，旧版本的数据文件不校验
+func (d *DiskManagerImpl) Checksums() bool {
+	return d.checksums
+}
@@ -2,9 +2,12 @@ package disk
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"minidb/pkg/storage/page"
 )
@@ -15,17 +18,54 @@ type DiskManager interface {
 	WritePage(pageID page.PageID, p *page.Page) error
 	AllocatePage() page.PageID
 	DeallocatePage(pageID page.PageID) // 新增接口
+	PageSize() int                     // 该数据文件使用的页大小
+	Sync() error                       // 把已写入的页面持久化到磁盘
 	Close() error
 }
 
+// PageLister 由能列出已分配页号的 DiskManager 实现，用于检查有没有分配了却没人使用的页
+type PageLister interface {
+	AllocatedPages() []page.PageID // 正在使用的页，不含文件头和空闲页
+	FreePages() []page.PageID      // 空闲页链表中等待复用的页，见 freelist.go
+}
+
+// DurableWriter 由可以在每次写页后 fsync 的 DiskManager 实现，见 DiskManagerImpl.SetDurable
+type DurableWriter interface {
+	SetDurable(on bool)
+	Durable() bool
+}
+
+// ErrDatabaseLocked 数据文件已被另一个进程打开
+var ErrDatabaseLocked = errors.New("database is locked by another process")
+
 type DiskManagerImpl struct {
 	dbFile     *os.File
 	fileName   string
-	nextPageID page.PageID // 追踪下一个可用的 PageID
+	pageSize   int
+	nextPageID page.PageID        // 追踪下一个可用的 PageID
+	dwb        *doubleWriteBuffer // 双写缓冲区，nil 表示关闭
+	durable    atomic.Bool        // 每次 WritePage 之后 fsync，见 SetDurable
+	checksums  bool               // ReadPage 校验页的校验和，见 checksum.go
+	wbuf       []byte             // WritePage 填写校验和用的缓冲区，写者由调用方串行化
+
+	// 空闲页链表，见 freelist.go；allocMu 保护它和 nextPageID
+	allocMu   sync.Mutex
+	hasHeader bool // 0 号页是文件头；旧版本的数据文件没有
+	free      []page.PageID
+	freeSet   map[page.PageID]bool
 }
 
-// NewDiskManager 启动时打开或创建数据库文件
+// NewDiskManager 启动时打开或创建数据库文件，使用默认页大小
 func NewDiskManager(dbFileName string) (*DiskManagerImpl, error) {
+	return NewDiskManagerWithPageSize(dbFileName, page.PageSize)
+}
+
+// NewDiskManagerWithPageSize 以指定的页大小打开或创建数据库文件
+func NewDiskManagerWithPageSize(dbFileName string, pageSize int) (*DiskManagerImpl, error) {
+	if !page.ValidPageSize(pageSize) {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+
 	// 确保目录存在
 	dir := filepath.Dir(dbFileName)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -40,79 +80,153 @@ func NewDiskManager(dbFileName string) (*DiskManagerImpl, error) {
 		return nil, err
 	}
 
+	// 两个进程同时读写同一个数据文件会互相覆盖页面，用建议锁拒绝第二个
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	d := &DiskManagerImpl{
+		dbFile:   file,
+		fileName: dbFileName,
+		pageSize: pageSize,
+		wbuf:     make([]byte, pageSize),
+	}
+
+	// 上次崩溃可能留下写坏的页，先用双写缓冲区恢复
+	if err := d.recoverDoubleWrite(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
 	// 计算当前文件大小，从而确定 nextPageID
 	// 比如文件大小是 8192 (2页)，那么下一个 ID 就是 2 (0, 1 已存在)
 	fileInfo, err := file.Stat()
 	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	d.nextPageID = page.PageID(fileInfo.Size() / int64(pageSize))
+	if err := d.initHeader(fileInfo.Size()); err != nil {
+		file.Close()
 		return nil, err
 	}
+	return d, nil
+}
 
-	nPID := page.PageID(fileInfo.Size() / page.PageSize)
+// PageSize 返回该数据文件的页大小
+func (d *DiskManagerImpl) PageSize() int {
+	return d.pageSize
+}
 
-	return &DiskManagerImpl{
-		dbFile:     file,
-		fileName:   dbFileName,
-		nextPageID: nPID,
-	}, nil
+// Sync 对数据文件执行 fsync
+func (d *DiskManagerImpl) Sync() error {
+	return d.dbFile.Sync()
 }
 
-// Close 关闭文件句柄
+// Close 释放文件锁并关闭文件句柄
 func (d *DiskManagerImpl) Close() error {
+	if d.dwb != nil {
+		d.dwb.close()
+		d.dwb = nil
+	}
+	unlockFile(d.dbFile)
 	return d.dbFile.Close()
 }
 
 // ReadPage 从磁盘读取指定页的数据到内存中
+// 读写都用带偏移量的 ReadAt/WriteAt，不依赖共享的文件指针，
+// 所以缓冲池的后台刷盘可以和前台读页同时进行
 func (d *DiskManagerImpl) ReadPage(pageID page.PageID, p *page.Page) error {
-	offset := int64(pageID) * int64(page.PageSize)
-
-	// 1. 移动文件指针
-	_, err := d.dbFile.Seek(offset, io.SeekStart)
-	if err != nil {
-		return err
-	}
+	offset := int64(pageID) * int64(d.pageSize)
 
-	// 2. 读取数据填充到 Page 的 Data 数组中
 	// 注意：这里直接读入 p.Data 切片
-	bytesRead, err := d.dbFile.Read(p.Data[:])
-	if err != nil {
-		return err
-	}
-
-	if bytesRead < page.PageSize {
+	bytesRead, err := d.dbFile.ReadAt(p.Data[:d.pageSize], offset)
+	if bytesRead < d.pageSize {
+		if err != nil && (bytesRead == 0 || err != io.EOF) {
+			return err
+		}
 		// 这种情况通常意味着文件损坏或读取越界
 		return errors.New("read less than a full page")
 	}
 
+	if d.checksums {
+		return d.verifyPage(pageID, p.Data[:d.pageSize])
+	}
 	return nil
 }
 
-// WritePage 将内存中的页数据写入磁盘
+// WritePage 将内存中的页数据写入磁盘，写入前填写页的校验和
+// 同一时刻只能有一个写者（双写缓冲区和 wbuf 都只有一份），由调用方保证
+// 校验和写在 wbuf 中的副本上，不修改 p：其他线程可能正持有 Pin 读这一页
 func (d *DiskManagerImpl) WritePage(pageID page.PageID, p *page.Page) error {
-	offset := int64(pageID) * int64(page.PageSize)
+	offset := int64(pageID) * int64(d.pageSize)
+	data := d.wbuf
+	copy(data, p.Data[:d.pageSize])
+	setChecksum(data)
+
+	// 开启双写时先把完整页落到缓冲区
+	if d.dwb != nil {
+		if err := d.dwb.write(pageID, data); err != nil {
+			return err
+		}
+	}
 
-	_, err := d.dbFile.Seek(offset, io.SeekStart)
-	if err != nil {
+	if _, err := d.dbFile.WriteAt(data, offset); err != nil {
 		return err
 	}
 
-	_, err = d.dbFile.Write(p.Data[:])
-	if err != nil {
-		return err
+	// 双写模式下数据页必须先落盘，缓冲区槽位才能被下一次写覆盖
+	if d.dwb != nil || d.durable.Load() {
+		return d.dbFile.Sync()
 	}
 
-	// 在高可靠性场景下，这里应该调用 d.dbFile.Sync() 确保刷盘
-	// 但为了性能，通常由 Checkpoint 机制批量 Sync
+	// 默认不逐页 Sync：为了性能，由 FlushAndSync（sync_on_commit）或关闭时批量 Sync
 	return nil
 }
 
-// AllocatePage 分配一个新的页 ID (简单的追加策略)
+// SetDurable 开启或关闭逐页 fsync：开启后 WritePage 返回时页面已经落盘，掉电也不会丢失已写出的页，
+// 代价是每次写页都要等一次 fsync。默认关闭。可以和正在进行的写页并发调用
+func (d *DiskManagerImpl) SetDurable(on bool) {
+	d.durable.Store(on)
+}
+
+// Durable 报告是否开启了逐页 fsync
+func (d *DiskManagerImpl) Durable() bool {
+	return d.durable.Load()
+}
+
+// AllocatePage 分配一个页：优先复用空闲页链表中的页，链表为空时在文件末尾追加
 func (d *DiskManagerImpl) AllocatePage() page.PageID {
-	// 这是一个原子操作的简易版
+	d.allocMu.Lock()
+	defer d.allocMu.Unlock()
+	if id, ok := d.popFree(); ok {
+		return id
+	}
 	ret := d.nextPageID
 	d.nextPageID++
 	return ret
 }
+
+// AllocatedPages 返回正在使用的页号：[0, nextPageID) 去掉文件头和空闲页
+func (d *DiskManagerImpl) AllocatedPages() []page.PageID {
+	d.allocMu.Lock()
+	defer d.allocMu.Unlock()
+	ids := make([]page.PageID, 0, int(d.nextPageID)-len(d.free))
+	for id := page.PageID(0); id < d.nextPageID; id++ {
+		if d.freeSet[id] || (d.hasHeader && id == headerPageID) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// DeallocatePage 把页放回空闲页链表，之后的 AllocatePage 会复用它
+// 调用方要保证这一页不再被引用，且已经从缓冲池中移除（见 BufferPoolManager.DeletePage）
 func (d *DiskManagerImpl) DeallocatePage(pageID page.PageID) {
-	// 在简单的实现中，我们不回收磁盘空间，只是在元数据中标记。
-	// 这是一个空操作，防止编译报错。
+	d.allocMu.Lock()
+	defer d.allocMu.Unlock()
+	d.pushFree(pageID)
 }
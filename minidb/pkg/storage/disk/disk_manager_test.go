@@ -1,8 +1,10 @@
 package disk
 
 import (
+	"errors"
 	"minidb/pkg/storage/page"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -17,16 +19,16 @@ func TestDiskManager(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// 1. 分配 Page 0
+	// 1. 分配 Page 1（0 号页是文件头）
 	pid := dm.AllocatePage()
-	if pid != 0 {
-		t.Fatalf("Expected page ID 0, got %d", pid)
+	if pid != 1 {
+		t.Fatalf("Expected page ID 1, got %d", pid)
 	}
 
-	// 2. 创建数据并写入
-	p := &page.Page{}
+	// 2. 创建数据并写入（页头之后，页头中有 WritePage 填写的校验和）
+	p := page.NewPage(page.PageSize)
 	data := []byte("Hello Database World!")
-	copy(p.Data[:], data) // 模拟写入数据
+	copy(p.Data[page.HeaderSize:], data) // 模拟写入数据
 	
 	err = dm.WritePage(pid, p)
 	if err != nil {
@@ -34,16 +36,377 @@ func TestDiskManager(t *testing.T) {
 	}
 
 	// 3. 重新读取并验证
-	p2 := &page.Page{}
+	p2 := page.NewPage(page.PageSize)
 	err = dm.ReadPage(pid, p2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	readData := string(p2.Data[:len(data)])
+	readData := string(p2.Data[page.HeaderSize : page.HeaderSize+len(data)])
 	if readData != "Hello Database World!" {
 		t.Fatalf("Data mismatch: expected %s, got %s", "Hello Database World!", readData)
 	}
     
     dm.Close()
-}
\ No newline at end of file
+}
+func TestDiskManagerPageSize(t *testing.T) {
+	dbFile := "test_pagesize.db"
+	os.Remove(dbFile)
+	defer os.Remove(dbFile)
+
+	if _, err := NewDiskManagerWithPageSize(dbFile, 1000); err == nil {
+		t.Fatal("Expected error for invalid page size")
+	}
+
+	dm, err := NewDiskManagerWithPageSize(dbFile, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid0 := dm.AllocatePage()
+	pid1 := dm.AllocatePage()
+
+	p := page.NewPage(8192)
+	p.Data[8191] = 0x7f // 写到页的最后一个字节
+	if err := dm.WritePage(pid1, p); err != nil {
+		t.Fatal(err)
+	}
+	dm.WritePage(pid0, page.NewPage(8192))
+	dm.Close()
+
+	// 文件头记录了页大小，换一个页大小打开会被拒绝
+	for _, size := range []int{4096, 16384} {
+		if _, err := NewDiskManagerWithPageSize(dbFile, size); !errors.Is(err, ErrPageSizeMismatch) {
+			t.Fatalf("opening an 8K file with %d-byte pages: %v", size, err)
+		}
+	}
+	// 只有文件头的 4K 文件比一个 8K 页还短，也不能被当成空文件重写
+	small := filepath.Join(t.TempDir(), "small.db")
+	dm, err = NewDiskManager(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+	if _, err := NewDiskManagerWithPageSize(small, 8192); !errors.Is(err, ErrPageSizeMismatch) {
+		t.Fatalf("opening a 4K header-only file with 8K pages: %v", err)
+	}
+
+	// 重新打开，nextPageID 应该按 8K 页计算
+	dm, err = NewDiskManagerWithPageSize(dbFile, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	if pid := dm.AllocatePage(); pid != 3 {
+		t.Fatalf("Expected page ID 3, got %d", pid)
+	}
+
+	p2 := page.NewPage(8192)
+	if err := dm.ReadPage(pid1, p2); err != nil {
+		t.Fatal(err)
+	}
+	if p2.Data[8191] != 0x7f {
+		t.Fatalf("Last byte of 8K page lost")
+	}
+}
+
+func TestDoubleWriteRecovery(t *testing.T) {
+	dbFile := "test_dwb.db"
+	os.Remove(dbFile)
+	os.Remove(dbFile + dwbSuffix)
+	defer os.Remove(dbFile)
+	defer os.Remove(dbFile + dwbSuffix)
+
+	dm, err := NewDiskManager(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.SetDoubleWrite(true); err != nil {
+		t.Fatal(err)
+	}
+
+	pid := dm.AllocatePage()
+	p := page.NewPage(page.PageSize)
+	for i := range p.Bytes() {
+		p.Data[i] = 0xAB
+	}
+	if err := dm.WritePage(pid, p); err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+
+	// 模拟写数据文件时崩溃：页的后半部分是旧数据
+	f, _ := os.OpenFile(dbFile, os.O_RDWR, 0664)
+	f.WriteAt(make([]byte, page.PageSize/2), int64(pid)*page.PageSize+page.PageSize/2)
+	f.Close()
+
+	// 重新打开时应从双写缓冲区恢复完整页
+	dm, err = NewDiskManager(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	p2 := page.NewPage(page.PageSize)
+	if err := dm.ReadPage(pid, p2); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range p2.Bytes() {
+		// 校验和区域由 WritePage 填写
+		if i >= page.OffsetChecksum && i < page.OffsetChecksum+page.SizeOfChecksum {
+			continue
+		}
+		if b != 0xAB {
+			t.Fatalf("Torn page not recovered at byte %d", i)
+		}
+	}
+}
+
+func TestTablespaces(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := dir + "/data.db"
+	if name := TablespaceFileName(dataFile, 2); name != dir+"/data.2.db" {
+		t.Fatalf("TablespaceFileName = %s", name)
+	}
+
+	m, err := OpenTablespaces(dataFile, 3, page.PageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个表空间从 1 开始各自分配（0 号页是文件头），编码后的页号互不冲突
+	ids := map[page.PageID]int{}
+	for space := 0; space < 3; space++ {
+		for i := 0; i < 2; i++ {
+			id, err := m.AllocatePageIn(space)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s, local := SplitPageID(id); s != space || local != page.PageID(i+1) {
+				t.Fatalf("page %d decodes to (%d, %d), want (%d, %d)", id, s, local, space, i+1)
+			}
+			ids[id] = space
+
+			p := page.NewPage(page.PageSize)
+			p.Data[0] = byte(space)
+			p.Data[1] = byte(i + 1)
+			if err := m.WritePage(id, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := m.AllocatePageIn(3); err == nil {
+		t.Error("allocation in an unknown tablespace should fail")
+	}
+	m.Close()
+
+	m, err = OpenTablespaces(dataFile, 3, page.PageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for id, space := range ids {
+		p := page.NewPage(page.PageSize)
+		if err := m.ReadPage(id, p); err != nil {
+			t.Fatal(err)
+		}
+		_, local := SplitPageID(id)
+		if p.Data[0] != byte(space) || p.Data[1] != byte(local) {
+			t.Errorf("page %d read back wrong data", id)
+		}
+	}
+	for space := 0; space < 3; space++ {
+		fi, err := os.Stat(TablespaceFileName(dataFile, space))
+		if err != nil || fi.Size() != 3*page.PageSize {
+			t.Errorf("tablespace %d file: %v, %v", space, fi, err)
+		}
+	}
+	// 0 号表空间的页号与单文件数据库一致
+	if id := m.AllocatePage(); id != 3 {
+		t.Errorf("AllocatePage = %d, want 3", id)
+	}
+}
+
+func TestDiskManagerLock(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "lock.db")
+
+	first, err := NewDiskManager(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flock 锁的是打开的文件描述，同一进程内第二次打开同样会冲突
+	if _, err := NewDiskManager(dbFile); !errors.Is(err, ErrDatabaseLocked) {
+		first.Close()
+		t.Fatalf("second open: got %v, want %v", err, ErrDatabaseLocked)
+	}
+
+	// 关闭后锁释放，可以重新打开
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewDiskManager(dbFile)
+	if err != nil {
+		t.Fatalf("reopen after close: %v", err)
+	}
+	second.Close()
+}
+
+func TestFreeList(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "free.db")
+	dm, err := NewDiskManager(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := dm.WritePage(dm.AllocatePage(), page.NewPage(page.PageSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dm.DeallocatePage(2)
+	dm.DeallocatePage(4)
+	dm.DeallocatePage(4) // 重复释放被忽略
+	dm.DeallocatePage(0) // 文件头不能释放
+	dm.DeallocatePage(99)
+	if got := dm.FreePages(); len(got) != 2 || got[0] != 2 || got[1] != 4 {
+		t.Fatalf("free pages = %v, want [2 4]", got)
+	}
+	// 后释放的先复用
+	if pid := dm.AllocatePage(); pid != 4 {
+		t.Fatalf("expected page 4 to be reused, got %d", pid)
+	}
+	dm.Close()
+
+	// 重新打开后链表还在
+	if dm, err = NewDiskManager(dbFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := dm.FreePages(); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("free pages after reopen = %v, want [2]", got)
+	}
+	if pid := dm.AllocatePage(); pid != 2 {
+		t.Fatalf("expected page 2 to be reused, got %d", pid)
+	}
+	if pid := dm.AllocatePage(); pid != 6 {
+		t.Fatalf("expected the file to grow to page 6, got %d", pid)
+	} else if err := dm.WritePage(pid, page.NewPage(page.PageSize)); err != nil {
+		t.Fatal(err)
+	}
+	if got := dm.AllocatedPages(); len(got) != 6 {
+		t.Fatalf("allocated pages = %v, want 1..6", got)
+	}
+
+	// 链表中的页被覆盖：丢弃链表，之后正常分配
+	dm.DeallocatePage(3)
+	if err := dm.WritePage(3, page.NewPage(page.PageSize)); err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+	if dm, err = NewDiskManager(dbFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := dm.FreePages(); len(got) != 0 {
+		t.Fatalf("corrupt free list should be dropped, got %v", got)
+	}
+	if pid := dm.AllocatePage(); pid != 7 {
+		t.Fatalf("expected page 7, got %d", pid)
+	}
+	dm.Close()
+
+	// 没有文件头的旧数据文件：0 号页是数据，释放的页只在内存中复用
+	legacy := filepath.Join(t.TempDir(), "legacy.db")
+	if err := os.WriteFile(legacy, make([]byte, 3*page.PageSize), 0664); err != nil {
+		t.Fatal(err)
+	}
+	if dm, err = NewDiskManager(legacy); err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	if got := dm.AllocatedPages(); len(got) != 3 || got[0] != 0 {
+		t.Fatalf("legacy allocated pages = %v, want [0 1 2]", got)
+	}
+	dm.DeallocatePage(0)
+	if pid := dm.AllocatePage(); pid != 0 {
+		t.Fatalf("expected page 0 to be reused in a legacy file, got %d", pid)
+	}
+}
+
+func TestPageChecksum(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "crc.db")
+	dm, err := NewDiskManager(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dm.Checksums() {
+		t.Fatal("new data files should verify checksums")
+	}
+	p := page.NewPage(page.PageSize)
+	copy(p.Data[page.HeaderSize:], "checksummed")
+	first, hole, last := dm.AllocatePage(), dm.AllocatePage(), dm.AllocatePage()
+	for _, pid := range []page.PageID{first, last} {
+		if err := dm.WritePage(pid, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已分配却全是 0 的页说明写入丢失，不能当成空页
+	if err := dm.ReadPage(hole, page.NewPage(page.PageSize)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("reading an allocated all-zero page: got %v", err)
+	}
+	dm.Close()
+
+	// 在磁盘上改掉一个字节
+	f, _ := os.OpenFile(dbFile, os.O_RDWR, 0664)
+	f.WriteAt([]byte{'X'}, int64(last)*page.PageSize+page.HeaderSize)
+	f.Close()
+
+	if dm, err = NewDiskManager(dbFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.ReadPage(first, page.NewPage(page.PageSize)); err != nil {
+		t.Fatalf("intact page: %v", err)
+	}
+	err = dm.ReadPage(last, page.NewPage(page.PageSize))
+	if !errors.Is(err, ErrChecksumMismatch) || err.Error() != "page 3 checksum mismatch" {
+		t.Fatalf("corrupted page: got %v", err)
+	}
+
+	// 撕裂的写把正在使用的页覆盖成了 0
+	f, _ = os.OpenFile(dbFile, os.O_RDWR, 0664)
+	f.WriteAt(make([]byte, page.PageSize), int64(first)*page.PageSize)
+	f.Close()
+	err = dm.ReadPage(first, page.NewPage(page.PageSize))
+	if !errors.Is(err, ErrChecksumMismatch) || err.Error() != "page 1 checksum mismatch" {
+		t.Fatalf("zeroed page: got %v", err)
+	}
+
+	// 文件头写坏时丢弃空闲页链表，数据文件照常打开
+	dm.DeallocatePage(first)
+	dm.Close()
+	f, _ = os.OpenFile(dbFile, os.O_RDWR, 0664)
+	f.WriteAt([]byte{'X'}, page.PageSize-1)
+	f.Close()
+	if dm, err = NewDiskManager(dbFile); err != nil {
+		t.Fatalf("torn header: %v", err)
+	}
+	if free := dm.FreePages(); len(free) != 0 {
+		t.Fatalf("free list from a torn header: %v", free)
+	}
+	dm.Close()
+
+	// 没有文件头的旧数据文件不校验
+	legacy := filepath.Join(t.TempDir(), "legacy.db")
+	junk := make([]byte, page.PageSize)
+	copy(junk, "legacy data")
+	if err := os.WriteFile(legacy, junk, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if dm, err = NewDiskManager(legacy); err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	if dm.Checksums() {
+		t.Fatal("legacy data files have no checksums")
+	}
+	if err := dm.ReadPage(0, page.NewPage(page.PageSize)); err != nil {
+		t.Fatalf("legacy page: %v", err)
+	}
+}
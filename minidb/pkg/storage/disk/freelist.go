@@ -0,0 +1,176 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"minidb/pkg/storage/page"
+)
+
+// 数据文件的 0 号页是文件头，记录页大小和空闲页链表：
+//
+//	[0, 8)   headerMagic
+//	[8, 12)  空闲页个数
+//	[12, 16) 链表头的页号，0 表示链表为空（0 号页是文件头，不会是空闲页）
+//	[16, 20) 标志位，见 headerFlagChecksums
+//	[20, 24) 文件头自己的校验和，与其他页相同（page.OffsetChecksum）
+//	[24, 28) 创建文件时的页大小，0 表示没有记录（记录页大小之前的版本写出的文件）
+//
+// 每个空闲页的开头是 freePageMagic 和链表中下一个空闲页的页号。
+// DeallocatePage 把页压到链表头，AllocatePage 先从链表头弹出，链表为空时才扩展文件；
+// 链表在内存中也有一份（free），修改时先写空闲页、再写文件头。
+//
+// 旧版本的数据文件没有文件头，0 号页就是数据，无法持久化空闲页：
+// 这些文件上释放的页只在本次运行中复用，重启后和以前一样留在文件里；CompactOnClose 重写出的新文件带文件头
+var (
+	headerMagic   = []byte("MDBHEAD1")
+	freePageMagic = []byte("MDBFREE1")
+)
+
+const headerPageID page.PageID = 0
+
+// headerFlagChecksums 表示文件中的每个页都带有校验和，读页时要校验，见 checksum.go
+// 只有没有这个标志的文件（包括没有文件头的旧文件）才跳过校验，所以新文件从创建起就设置它
+const headerFlagChecksums = 1
+
+// headerFixedSize 是文件头中与页大小无关的部分，打开文件时先按字节读出它
+const headerFixedSize = 28
+
+// ErrPageSizeMismatch 数据文件创建时的页大小与打开时指定的不同
+// 按错误的页大小读写会把页错位读出、写坏相邻的页，所以拒绝打开
+var ErrPageSizeMismatch = errors.New("page size mismatch")
+
+// initHeader 在打开数据文件时调用，size 是文件的字节数：新文件写入文件头，已有文件检查页大小并读出空闲页链表
+// 链表损坏（越界、成环、个数不符）时丢弃它并写回空的文件头：这些页不再复用，只浪费空间，不会丢数据
+// 没有文件头的旧文件没有记录页大小，无法检查
+func (d *DiskManagerImpl) initHeader(size int64) error {
+	d.freeSet = make(map[page.PageID]bool)
+	if size == 0 {
+		d.hasHeader = true
+		d.checksums = true
+		d.nextPageID = 1
+		return d.writeHeader()
+	}
+
+	// 页大小不符时按页读会读错位置（文件比一页还短时甚至会被当成空文件），所以先按字节读出固定部分
+	var fixed [headerFixedSize]byte
+	if n, _ := d.dbFile.ReadAt(fixed[:], 0); n < len(fixed) || !bytes.Equal(fixed[:len(headerMagic)], headerMagic) {
+		return nil
+	}
+	if created := int(binary.LittleEndian.Uint32(fixed[24:])); created != 0 && created != d.pageSize {
+		return fmt.Errorf("%w: %s was created with %d-byte pages, cannot open it with %d-byte pages",
+			ErrPageSizeMismatch, d.fileName, created, d.pageSize)
+	}
+
+	p := page.NewPage(d.pageSize)
+	if err := d.ReadPage(headerPageID, p); err != nil {
+		return err
+	}
+	d.hasHeader = true
+	d.checksums = binary.LittleEndian.Uint32(p.Data[16:])&headerFlagChecksums != 0
+	// 文件头写坏时和链表损坏一样处理：丢弃链表，重写文件头
+	if d.checksums && verifyChecksum(headerPageID, p.Data[:d.pageSize]) != nil {
+		return d.writeHeader()
+	}
+	count := int(binary.LittleEndian.Uint32(p.Data[8:]))
+	chain, ok := d.readFreeChain(page.PageID(binary.LittleEndian.Uint32(p.Data[12:])), count)
+	if !ok {
+		return d.writeHeader()
+	}
+	// chain[0] 是链表头，内存中的栈顶在末尾
+	slices.Reverse(chain)
+	d.free = chain
+	for _, id := range chain {
+		d.freeSet[id] = true
+	}
+	return nil
+}
+
+// readFreeChain 从 head 开始沿链表读出 count 个空闲页，链表不合法时返回 false
+func (d *DiskManagerImpl) readFreeChain(head page.PageID, count int) ([]page.PageID, bool) {
+	chain := make([]page.PageID, 0, count)
+	seen := make(map[page.PageID]bool, count)
+	p := page.NewPage(d.pageSize)
+	for id := head; id != 0; {
+		if id >= d.nextPageID || seen[id] || len(chain) == count {
+			return nil, false
+		}
+		if d.ReadPage(id, p) != nil || !bytes.Equal(p.Data[:len(freePageMagic)], freePageMagic) {
+			return nil, false
+		}
+		seen[id] = true
+		chain = append(chain, id)
+		id = page.PageID(binary.LittleEndian.Uint32(p.Data[len(freePageMagic):]))
+	}
+	return chain, len(chain) == count
+}
+
+// freeHead 返回链表头的页号，链表为空时返回 0
+func (d *DiskManagerImpl) freeHead() page.PageID {
+	if len(d.free) == 0 {
+		return 0
+	}
+	return d.free[len(d.free)-1]
+}
+
+func (d *DiskManagerImpl) writeHeader() error {
+	p := page.NewPage(d.pageSize)
+	copy(p.Data[:], headerMagic)
+	binary.LittleEndian.PutUint32(p.Data[8:], uint32(len(d.free)))
+	binary.LittleEndian.PutUint32(p.Data[12:], uint32(d.freeHead()))
+	if d.checksums {
+		binary.LittleEndian.PutUint32(p.Data[16:], headerFlagChecksums)
+	}
+	binary.LittleEndian.PutUint32(p.Data[24:], uint32(d.pageSize))
+	return d.WritePage(headerPageID, p)
+}
+
+// popFree 从链表头取出一个空闲页，链表为空或文件头写入失败时返回 false
+// 文件头写不进去时不能复用这一页：重启后它还在磁盘上的链表里，会被分配第二次
+func (d *DiskManagerImpl) popFree() (page.PageID, bool) {
+	n := len(d.free)
+	if n == 0 {
+		return 0, false
+	}
+	id := d.free[n-1]
+	d.free = d.free[:n-1]
+	if d.hasHeader && d.writeHeader() != nil {
+		d.free = append(d.free, id)
+		return 0, false
+	}
+	delete(d.freeSet, id)
+	return id, true
+}
+
+// pushFree 把页压到链表头；页号不合法、已经空闲或写盘失败时忽略，这一页只是不再复用
+func (d *DiskManagerImpl) pushFree(id page.PageID) {
+	if id >= d.nextPageID || d.freeSet[id] || (d.hasHeader && id == headerPageID) {
+		return
+	}
+	if d.hasHeader {
+		p := page.NewPage(d.pageSize)
+		copy(p.Data[:], freePageMagic)
+		binary.LittleEndian.PutUint32(p.Data[len(freePageMagic):], uint32(d.freeHead()))
+		if d.WritePage(id, p) != nil {
+			return
+		}
+	}
+	d.free = append(d.free, id)
+	if d.hasHeader && d.writeHeader() != nil {
+		d.free = d.free[:len(d.free)-1]
+		return
+	}
+	d.freeSet[id] = true
+}
+
+// FreePages 返回空闲页链表中的页号，按页号排序
+func (d *DiskManagerImpl) FreePages() []page.PageID {
+	d.allocMu.Lock()
+	defer d.allocMu.Unlock()
+	ids := slices.Clone(d.free)
+	slices.Sort(ids)
+	return ids
+}
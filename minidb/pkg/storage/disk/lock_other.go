@@ -0,0 +1,10 @@
+//go:build !unix
+
+package disk
+
+import "os"
+
+// 非 Unix 平台没有 flock，不做多进程保护
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
@@ -0,0 +1,185 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+
+	"minidb/pkg/storage/page"
+)
+
+// 页号编码：bit 28~30 为表空间（数据文件）编号，低 28 位为文件内的页号。
+// bit 31 不用，保证 InvalidPageID (-1) 不会和合法页号冲突；
+// 表空间 0 的页号与单文件时完全相同，旧数据库无需迁移
+const (
+	TablespaceBits = 3
+	MaxTablespaces = 1 << TablespaceBits
+	localPageBits  = 28
+	localPageMask  = 1<<localPageBits - 1
+)
+
+// MakePageID 把表空间编号和文件内页号编码成全局页号
+func MakePageID(space int, local page.PageID) page.PageID {
+	return page.PageID(space<<localPageBits) | local&localPageMask
+}
+
+// SplitPageID 把全局页号拆成表空间编号和文件内页号
+func SplitPageID(id page.PageID) (space int, local page.PageID) {
+	return int(id >> localPageBits), id & localPageMask
+}
+
+// TablespaceAllocator 由支持多个数据文件的 DiskManager 实现，用于在指定表空间分配页
+type TablespaceAllocator interface {
+	AllocatePageIn(space int) (page.PageID, error)
+}
+
+// TablespaceFileName 返回表空间对应的文件名：0 号就是 dataFile 本身，其余为 data.1.db 这样的形式
+func TablespaceFileName(dataFile string, space int) string {
+	if space == 0 {
+		return dataFile
+	}
+	if i := strings.LastIndex(dataFile, "."); i > strings.LastIndexAny(dataFile, `/\`) {
+		return fmt.Sprintf("%s.%d%s", dataFile[:i], space, dataFile[i:])
+	}
+	return fmt.Sprintf("%s.%d", dataFile, space)
+}
+
+// TablespaceManager 把页请求按页号中的表空间编号路由到对应的数据文件
+type TablespaceManager struct {
+	files []*DiskManagerImpl
+}
+
+// OpenTablespaces 打开（或创建）一个数据库的 count 个数据文件，页大小相同
+func OpenTablespaces(dataFile string, count, pageSize int) (*TablespaceManager, error) {
+	if count < 1 || count > MaxTablespaces {
+		return nil, fmt.Errorf("tablespace count %d out of range [1, %d]", count, MaxTablespaces)
+	}
+	m := &TablespaceManager{}
+	for space := 0; space < count; space++ {
+		d, err := NewDiskManagerWithPageSize(TablespaceFileName(dataFile, space), pageSize)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.files = append(m.files, d)
+	}
+	return m, nil
+}
+
+// Tablespaces 返回数据文件的个数
+func (m *TablespaceManager) Tablespaces() int {
+	return len(m.files)
+}
+
+func (m *TablespaceManager) route(id page.PageID) (*DiskManagerImpl, page.PageID, error) {
+	space, local := SplitPageID(id)
+	if id < 0 || space >= len(m.files) {
+		return nil, 0, fmt.Errorf("page %d refers to unknown tablespace %d", id, space)
+	}
+	return m.files[space], local, nil
+}
+
+func (m *TablespaceManager) ReadPage(pageID page.PageID, p *page.Page) error {
+	d, local, err := m.route(pageID)
+	if err != nil {
+		return err
+	}
+	return d.ReadPage(local, p)
+}
+
+func (m *TablespaceManager) WritePage(pageID page.PageID, p *page.Page) error {
+	d, local, err := m.route(pageID)
+	if err != nil {
+		return err
+	}
+	return d.WritePage(local, p)
+}
+
+// AllocatePage 在 0 号表空间分配页
+func (m *TablespaceManager) AllocatePage() page.PageID {
+	return MakePageID(0, m.files[0].AllocatePage())
+}
+
+// AllocatePageIn 在指定表空间分配页
+func (m *TablespaceManager) AllocatePageIn(space int) (page.PageID, error) {
+	if space < 0 || space >= len(m.files) {
+		return page.InvalidPageID, fmt.Errorf("unknown tablespace %d", space)
+	}
+	local := m.files[space].AllocatePage()
+	if local > localPageMask {
+		return page.InvalidPageID, fmt.Errorf("tablespace %d is full", space)
+	}
+	return MakePageID(space, local), nil
+}
+
+func (m *TablespaceManager) DeallocatePage(pageID page.PageID) {
+	if d, local, err := m.route(pageID); err == nil {
+		d.DeallocatePage(local)
+	}
+}
+
+// FreePages 返回所有数据文件的空闲页（全局页号）
+func (m *TablespaceManager) FreePages() []page.PageID {
+	var ids []page.PageID
+	for space, d := range m.files {
+		for _, local := range d.FreePages() {
+			ids = append(ids, MakePageID(space, local))
+		}
+	}
+	return ids
+}
+
+// AllocatedPages 返回所有数据文件中已分配的页号（全局页号）
+func (m *TablespaceManager) AllocatedPages() []page.PageID {
+	var ids []page.PageID
+	for space, d := range m.files {
+		for _, local := range d.AllocatedPages() {
+			ids = append(ids, MakePageID(space, local))
+		}
+	}
+	return ids
+}
+
+func (m *TablespaceManager) PageSize() int {
+	return m.files[0].PageSize()
+}
+
+// SetDoubleWrite 为每个数据文件分别打开或关闭双写缓冲区
+func (m *TablespaceManager) SetDoubleWrite(enabled bool) error {
+	for _, d := range m.files {
+		if err := d.SetDoubleWrite(enabled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDurable 为每个数据文件分别开启或关闭逐页 fsync
+func (m *TablespaceManager) SetDurable(on bool) {
+	for _, d := range m.files {
+		d.SetDurable(on)
+	}
+}
+
+// Durable 报告是否开启了逐页 fsync，所有数据文件的设置总是相同
+func (m *TablespaceManager) Durable() bool {
+	return m.files[0].Durable()
+}
+
+func (m *TablespaceManager) Sync() error {
+	for _, d := range m.files {
+		if err := d.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *TablespaceManager) Close() error {
+	var firstErr error
+	for _, d := range m.files {
+		if err := d.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -2,6 +2,7 @@ package index
 
 import (
 	"bytes"
+	"errors"
 	"minidb/pkg/buffer"
 	"minidb/pkg/storage/page"
 	"sync"
@@ -10,7 +11,11 @@ import (
 type BPlusTree struct {
 	bpm        *buffer.BufferPoolManager
 	rootPageId page.PageID
+	space      int // 新页分配到哪个表空间（数据文件）
 	mu         sync.RWMutex
+
+	errMu sync.Mutex
+	err   error // 遍历中发现的结构错误，见 Err
 }
 
 func NewBPlusTree(rootPageId page.PageID, bpm *buffer.BufferPoolManager) *BPlusTree {
@@ -20,6 +25,16 @@ func NewBPlusTree(rootPageId page.PageID, bpm *buffer.BufferPoolManager) *BPlusT
 	}
 }
 
+// SetTablespace 指定之后分裂、建根时新页所在的表空间，默认为 0
+func (tree *BPlusTree) SetTablespace(space int) {
+	tree.space = space
+}
+
+// newPage 在树所属的表空间中分配新页
+func (tree *BPlusTree) newPage() *page.Page {
+	return tree.bpm.NewPageIn(tree.space)
+}
+
 func (tree *BPlusTree) GetRootPageId() page.PageID {
 	tree.mu.RLock()
 	defer tree.mu.RUnlock()
@@ -31,7 +46,7 @@ func (tree *BPlusTree) IsEmpty() bool {
 }
 
 func (tree *BPlusTree) StartNewTree() {
-	p := tree.bpm.NewPage()
+	p := tree.newPage()
 	if p == nil {
 		panic("failed to new page")
 	}
@@ -49,91 +64,310 @@ func (tree *BPlusTree) GetValue(key int64) ([]byte, bool) {
 		return nil, false
 	}
 
-	leafPage := tree.FindLeafPage(key)
+	// 点查可以与 InsertInLeaf、RemoveInLeaf 并发：闩住叶子直到值（包括溢出页）读完
+	leafPage := tree.findLeafLatched(key, false)
 	if leafPage == nil {
 		return nil, false
 	}
 	defer tree.bpm.UnpinPage(leafPage.ID(), false)
+	defer leafPage.RUnlatch()
 
 	leaf := page.NewBPlusTreePage(leafPage)
 	count := leaf.GetCount()
 	for i := int32(0); i < count; i++ {
 		if leaf.GetKey(i) == key {
-			return bytes.TrimRight(leaf.GetValue(i), "\x00"), true
+			val, err := readValue(tree.bpm, leaf.GetValueRef(i))
+			if err != nil {
+				tree.setErr(err)
+				return nil, false
+			}
+			return bytes.Clone(val), true
 		}
 	}
 	return nil, false
 }
 
+// Update 原地覆盖已存在的 Key 的值，Key 不存在或分配溢出页失败时返回 false
+// 旧值的溢出页在新值写入后释放
+func (tree *BPlusTree) Update(key int64, val []byte) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.IsEmpty() {
+		return false
+	}
+
+	leafPage := tree.FindLeafPage(key)
+	if leafPage == nil {
+		return false
+	}
+	leaf := page.NewBPlusTreePage(leafPage)
+	count := leaf.GetCount()
+	for i := int32(0); i < count; i++ {
+		if leaf.GetKey(i) == key {
+			slot, ok := encodeValue(tree.bpm, tree.newPage, val)
+			if !ok {
+				tree.bpm.UnpinPage(leafPage.ID(), false)
+				return false
+			}
+			old := leaf.GetValue(i)
+			leaf.SetValue(i, slot) // SetValue 先清空槽位，不会留下旧值的尾巴
+			tree.bpm.UnpinPage(leafPage.ID(), true)
+			freeValue(tree.bpm, old)
+			return true
+		}
+	}
+	tree.bpm.UnpinPage(leafPage.ID(), false)
+	return false
+}
+
 func (tree *BPlusTree) FindLeafPage(key int64) *page.Page {
 	if tree.rootPageId == page.InvalidPageID {
 		return nil
 	}
-	currPage := tree.bpm.FetchPage(tree.rootPageId)
+	currPage := tree.fetchPage(tree.rootPageId)
 	if currPage == nil {
 		return nil
 	}
 
-	for {
+	for depth := 1; ; depth++ {
 		node := page.NewBPlusTreePage(currPage)
 		if node.IsLeaf() {
 			return currPage
 		}
+		if tree.descentTooDeep(depth, currPage.ID()) {
+			tree.bpm.UnpinPage(currPage.ID(), false)
+			return nil
+		}
+
+		childPageId := childFor(node, key)
+		tree.bpm.UnpinPage(currPage.ID(), false)
+		currPage = tree.fetchPage(page.PageID(childPageId))
+		if currPage == nil {
+			return nil
+		}
+	}
+}
+
+// childFor 返回内部节点中 key 所在的孩子：最后一个分隔 Key <= key 的孩子，key 比所有分隔 Key 都小时走第一个孩子
+func childFor(node *page.BPlusTreePage, key int64) uint32 {
+	count := node.GetCount()
+	for i := count - 1; i >= 0; i-- {
+		if node.GetKey(i) <= key {
+			return node.GetValueAsPageID(i)
+		}
+	}
+	if count > 0 {
+		return node.GetValueAsPageID(0)
+	}
+	return 0
+}
 
-		count := node.GetCount()
-		childPageId := uint32(0)
-		found := false
+// findLeafLatched 与 FindLeafPage 相同，但沿途按闩蟹行（latch crabbing）：先给孩子加读闩，再释放父节点的闩，
+// 下降过程中任何时刻都至少闩着一个节点。返回的叶子已 Pin 住并持有读闩，write 为 true 时持有写闩。
+// 只有叶子加写闩：在父节点的读闩下把叶子的读闩换成写闩；调用方保证同一时刻只有一个写者，换闩的间隙叶子不会被改
+func (tree *BPlusTree) findLeafLatched(key int64, write bool) *page.Page {
+	if tree.rootPageId == page.InvalidPageID {
+		return nil
+	}
+	currPage := tree.fetchPage(tree.rootPageId)
+	if currPage == nil {
+		return nil
+	}
+	currPage.RLatch()
+	release := func(p *page.Page) {
+		p.RUnlatch()
+		tree.bpm.UnpinPage(p.ID(), false)
+	}
 
-		// Iterate keys to find the appropriate child pointer
-		for i := count - 1; i >= 0; i-- {
-			if node.GetKey(i) <= key {
-				childPageId = node.GetValueAsPageID(i)
-				found = true
-				break
+	for depth := 1; ; depth++ {
+		node := page.NewBPlusTreePage(currPage)
+		if node.IsLeaf() {
+			if write {
+				currPage.RUnlatch()
+				currPage.WLatch()
 			}
+			return currPage
 		}
-
-		// If key is smaller than all keys in this node, go to the first child
-		if !found && count > 0 {
-			childPageId = node.GetValueAsPageID(0)
+		if tree.descentTooDeep(depth, currPage.ID()) {
+			release(currPage)
+			return nil
 		}
 
-		tree.bpm.UnpinPage(currPage.ID(), false)
-		currPage = tree.bpm.FetchPage(page.PageID(childPageId))
-		if currPage == nil {
+		child := tree.fetchPage(page.PageID(childFor(node, key)))
+		if child == nil {
+			release(currPage)
 			return nil
 		}
+		child.RLatch()
+		if write && page.NewBPlusTreePage(child).IsLeaf() {
+			child.RUnlatch()
+			child.WLatch()
+			release(currPage)
+			return child
+		}
+		release(currPage)
+		currPage = child
 	}
 }
 
+// TryInsert 的错误：Key 已经存在，或者取不到、分配不到页面（缓冲池没有空闲 Frame 等）。
+// 调用方据此区分主键冲突和存储层的故障，后者不应报告成主键冲突
+var (
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrInsertFailed = errors.New("insert failed: cannot fetch or allocate a page")
+)
+
+// ErrNeedsRestructure 表示 InsertInLeaf / RemoveInLeaf 只改一个叶子做不到（需要分裂、合并或换根），树不变；
+// 调用方应排斥所有读者后改用 TryInsert / Remove
+var ErrNeedsRestructure = errors.New("change needs to restructure the tree")
+
+// Insert 插入一对 Key/Value，Key 已存在或分配页面失败时返回 false，需要区分两者时用 TryInsert
 func (tree *BPlusTree) Insert(key int64, val []byte) bool {
+	return tree.TryInsert(key, val) == nil
+}
+
+// TryInsert 插入一对 Key/Value，失败时返回 ErrDuplicateKey、ErrInsertFailed 或遍历中发现的 ErrTreeCorrupt，树不变
+// 放不进叶子槽位的值先写入溢出页，插入失败时释放，见 overflow.go
+func (tree *BPlusTree) TryInsert(key int64, val []byte) error {
 	tree.mu.Lock()
 	defer tree.mu.Unlock()
 
+	slot, ok := encodeValue(tree.bpm, tree.newPage, val)
+	if !ok {
+		return ErrInsertFailed
+	}
+	if err := tree.insert(key, slot); err != nil {
+		freeValue(tree.bpm, slot)
+		return err
+	}
+	return nil
+}
+
+// InsertInLeaf 只在 key 所在的叶子还有空位时插入：沿路径加读闩下降，只给叶子加写闩，
+// 所以可以与 GetValue 并发。叶子已满或树为空时返回 ErrNeedsRestructure，其余错误与 TryInsert 相同。
+// 调用方保证同一时刻只有一个写者，并且与改动树结构的操作（TryInsert、Remove 等）以及不加闩的读者（迭代器等）互斥
+func (tree *BPlusTree) InsertInLeaf(key int64, val []byte) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.IsEmpty() {
+		return ErrNeedsRestructure
+	}
+
+	slot, ok := encodeValue(tree.bpm, tree.newPage, val)
+	if !ok {
+		return ErrInsertFailed
+	}
+	err := tree.insertInLeaf(key, slot)
+	if err != nil {
+		freeValue(tree.bpm, slot)
+	}
+	return err
+}
+
+func (tree *BPlusTree) insertInLeaf(key int64, slot []byte) error {
+	leafRaw := tree.findLeafLatched(key, true)
+	if leafRaw == nil {
+		if err := tree.Err(); err != nil {
+			return err
+		}
+		return ErrInsertFailed
+	}
+	leaf := page.NewBPlusTreePage(leafRaw)
+	var err error
+	switch {
+	case leafContains(leaf, key):
+		err = ErrDuplicateKey
+	case leaf.IsFull():
+		err = ErrNeedsRestructure
+	default:
+		leaf.InsertLeaf(key, slot)
+	}
+	leafRaw.WUnlatch()
+	tree.bpm.UnpinPage(leafRaw.ID(), err == nil)
+	return err
+}
+
+// RemoveInLeaf 与 InsertInLeaf 相同，只在删除后叶子不会过少（不需要合并或借位）时删除，返回 Key 是否存在；
+// 需要调整树的结构时返回 ErrNeedsRestructure，树不变
+func (tree *BPlusTree) RemoveInLeaf(key int64) (bool, error) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.IsEmpty() {
+		return false, nil
+	}
+
+	leafRaw := tree.findLeafLatched(key, true)
+	if leafRaw == nil {
+		return false, tree.Err()
+	}
+	leaf := page.NewBPlusTreePage(leafRaw)
+	idx := int32(-1)
+	for i := int32(0); i < leaf.GetCount(); i++ {
+		if leaf.GetKey(i) == key {
+			idx = i
+			break
+		}
+	}
+	var err error
+	switch {
+	case idx < 0:
+	case leaf.GetPageID() == uint32(tree.rootPageId) && leaf.GetCount() == 1,
+		leaf.GetPageID() != uint32(tree.rootPageId) && leaf.GetCount()-1 < leaf.MinDegree():
+		err = ErrNeedsRestructure
+	default:
+		// 读者读值时闩着叶子，持有写闩时释放溢出页不会有人正在读它们
+		freeValue(tree.bpm, leaf.GetValueRef(idx))
+		leaf.Remove(idx)
+	}
+	leafRaw.WUnlatch()
+	tree.bpm.UnpinPage(leafRaw.ID(), idx >= 0 && err == nil)
+	return idx >= 0 && err == nil, err
+}
+
+// leafContains 报告叶子中是否已有 key
+func leafContains(leaf *page.BPlusTreePage, key int64) bool {
+	for i := int32(0); i < leaf.GetCount(); i++ {
+		if k := leaf.GetKey(i); k >= key {
+			return k == key
+		}
+	}
+	return false
+}
+
+// insert 把编码好的槽位内容插入叶子，调用方持有写锁
+func (tree *BPlusTree) insert(key int64, val []byte) error {
 	if tree.IsEmpty() {
 		tree.StartNewTree()
-		rootPage := tree.bpm.FetchPage(tree.rootPageId)
+		rootPage := tree.fetchPage(tree.rootPageId)
 		if rootPage == nil {
-			return false
+			return ErrInsertFailed
 		}
 		defer tree.bpm.UnpinPage(rootPage.ID(), true)
 
 		rootNode := page.NewBPlusTreePage(rootPage)
 		rootNode.InsertLeaf(key, val)
-		return true
+		return nil
 	}
 
 	leafPageRaw := tree.FindLeafPage(key)
 	if leafPageRaw == nil {
-		return false
+		if err := tree.Err(); err != nil {
+			return err
+		}
+		return ErrInsertFailed
 	}
 	leafNode := page.NewBPlusTreePage(leafPageRaw)
+	// 先查重再分裂：满的叶子里已有这个 Key 时不能分裂，否则树结构改了却没有插入
+	if leafContains(leafNode, key) {
+		tree.bpm.UnpinPage(leafPageRaw.ID(), false)
+		return ErrDuplicateKey
+	}
 
 	if leafNode.IsFull() {
-		newPageRaw := tree.bpm.NewPage()
+		newPageRaw := tree.newPage()
 		if newPageRaw == nil {
 			tree.bpm.UnpinPage(leafPageRaw.ID(), false)
-			return false
+			return ErrInsertFailed
 		}
 		siblingNode := page.NewBPlusTreePage(newPageRaw)
 		siblingNode.Init(uint32(newPageRaw.ID()), leafNode.GetPageType(), leafNode.GetParentID())
@@ -154,17 +388,17 @@ func (tree *BPlusTree) Insert(key int64, val []byte) bool {
 
 		tree.bpm.UnpinPage(newPageRaw.ID(), true)
 		tree.bpm.UnpinPage(leafPageRaw.ID(), true)
-		return true
+		return nil
 	} else {
-		success := leafNode.InsertLeaf(key, val)
+		leafNode.InsertLeaf(key, val)
 		tree.bpm.UnpinPage(leafPageRaw.ID(), true)
-		return success
+		return nil
 	}
 }
 
 func (tree *BPlusTree) InsertIntoParent(oldNode *page.BPlusTreePage, key int64, newNode *page.BPlusTreePage) {
 	if oldNode.GetPageID() == uint32(tree.rootPageId) {
-		newRootPageRaw := tree.bpm.NewPage()
+		newRootPageRaw := tree.newPage()
 		if newRootPageRaw == nil {
 			return
 		}
@@ -186,14 +420,14 @@ func (tree *BPlusTree) InsertIntoParent(oldNode *page.BPlusTreePage, key int64,
 	}
 
 	parentId := oldNode.GetParentID()
-	parentPageRaw := tree.bpm.FetchPage(page.PageID(parentId))
+	parentPageRaw := tree.fetchPage(page.PageID(parentId))
 	if parentPageRaw == nil {
 		return
 	}
 	parentNode := page.NewBPlusTreePage(parentPageRaw)
 
 	if parentNode.IsFull() {
-		newParentSiblingRaw := tree.bpm.NewPage()
+		newParentSiblingRaw := tree.newPage()
 		parentSibling := page.NewBPlusTreePage(newParentSiblingRaw)
 		parentSibling.Init(uint32(newParentSiblingRaw.ID()), page.KindInternal, parentNode.GetParentID())
 
@@ -207,7 +441,7 @@ func (tree *BPlusTree) InsertIntoParent(oldNode *page.BPlusTreePage, key int64,
 			parentSibling.SetValueAsPageID(i, parentNode.GetValueAsPageID(srcIdx))
 
 			childPageId := parentNode.GetValueAsPageID(srcIdx)
-			childPageRaw := tree.bpm.FetchPage(page.PageID(childPageId))
+			childPageRaw := tree.fetchPage(page.PageID(childPageId))
 			if childPageRaw != nil {
 				childNode := page.NewBPlusTreePage(childPageRaw)
 				childNode.SetParentID(parentSibling.GetPageID())
@@ -222,6 +456,7 @@ func (tree *BPlusTree) InsertIntoParent(oldNode *page.BPlusTreePage, key int64,
 			targetNode = parentSibling
 		}
 		tree.insertInternal(targetNode, key, newNode.GetPageID())
+		newNode.SetParentID(targetNode.GetPageID())
 
 		newSplitKey := parentSibling.GetKey(0)
 		tree.InsertIntoParent(parentNode, newSplitKey, parentSibling)
@@ -236,7 +471,8 @@ func (tree *BPlusTree) InsertIntoParent(oldNode *page.BPlusTreePage, key int64,
 func (tree *BPlusTree) insertInternal(node *page.BPlusTreePage, key int64, pageID uint32) {
 	count := node.GetCount()
 	insertIdx := count
-	for i := int32(0); i < count; i++ {
+	// Key[0] 只是最左孩子的下界（可能已过期），新分裂出的孩子总在某个孩子右侧，从 1 开始比较
+	for i := int32(1); i < count; i++ {
 		if node.GetKey(i) > key {
 			insertIdx = i
 			break
@@ -261,24 +497,79 @@ func (tree *BPlusTree) Begin() *TreeIterator {
 		return nil
 	}
 
-	pageRaw := tree.bpm.FetchPage(tree.rootPageId)
+	pageRaw := tree.leftmostLeaf()
 	if pageRaw == nil {
 		return nil
 	}
-	currNode := page.NewBPlusTreePage(pageRaw)
-
-	for !currNode.IsLeaf() {
-		childPageId := currNode.GetValueAsPageID(0)
-		tree.bpm.UnpinPage(page.PageID(currNode.GetPageID()), false)
-
-		pageRaw = tree.bpm.FetchPage(page.PageID(childPageId))
-		if pageRaw == nil {
+	leaf := page.NewBPlusTreePage(pageRaw)
+	it := NewTreeIterator(tree.bpm, leaf, 0)
+	// 最左叶子为空时从第一个非空叶子开始
+	if leaf.GetCount() == 0 {
+		it.currIdx = -1
+		if !it.Next() {
+			tree.setErr(it.Err())
 			return nil
 		}
-		currNode = page.NewBPlusTreePage(pageRaw)
 	}
+	return it
+}
 
-	return NewTreeIterator(tree.bpm, currNode, 0)
+// LowerBound 返回从第一个 >= key 的 Key 开始、一直遍历到最后的迭代器，没有这样的 Key 时返回 nil
+// （不叫 Seek：go vet 要求 Seek 方法符合 io.Seeker 的签名）
+func (tree *BPlusTree) LowerBound(key int64) *TreeIterator {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() {
+		return nil
+	}
+	return tree.seek(key)
+}
+
+// Scan 返回遍历 [low, high] 范围内 Key 的迭代器，范围为空时返回 nil
+func (tree *BPlusTree) Scan(low, high int64) *TreeIterator {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() || low > high {
+		return nil
+	}
+	it := tree.seek(low)
+	if it == nil {
+		return nil
+	}
+	it.bounded = true
+	it.endKey = high
+	if !it.checkBound() {
+		return nil
+	}
+	return it
+}
+
+// seek 下降到 key 所在的叶子，定位到第一个 >= key 的槽位，调用方持有读锁
+func (tree *BPlusTree) seek(key int64) *TreeIterator {
+	leafRaw := tree.FindLeafPage(key)
+	if leafRaw == nil {
+		return nil
+	}
+	leaf := page.NewBPlusTreePage(leafRaw)
+
+	idx := int32(0)
+	for idx < leaf.GetCount() && leaf.GetKey(idx) < key {
+		idx++
+	}
+	it := NewTreeIterator(tree.bpm, leaf, idx)
+	if idx < leaf.GetCount() {
+		return it
+	}
+
+	// key 比该叶子所有 Key 都大（或叶子为空）：停在最后一个槽位上，由 Next 沿链表走到下一个非空叶子的第一个槽位
+	it.currIdx = leaf.GetCount() - 1
+	if !it.Next() {
+		tree.setErr(it.Err())
+		return nil
+	}
+	return it
 }
 
 func (tree *BPlusTree) Remove(key int64) bool {
@@ -300,6 +591,7 @@ func (tree *BPlusTree) Remove(key int64) bool {
 	found := false
 	for i := int32(0); i < count; i++ {
 		if leafNode.GetKey(i) == key {
+			freeValue(tree.bpm, leafNode.GetValueRef(i))
 			leafNode.Remove(i)
 			found = true
 			break
@@ -333,6 +625,7 @@ func (tree *BPlusTree) Remove(key int64) bool {
 }
 
 // coalesceOrRedistribute 处理 Underflow 的核心逻辑
+// 约定：调用者持有 node 的一次 Pin，由本函数负责释放（Unpin 或随页面删除）
 func (tree *BPlusTree) coalesceOrRedistribute(node *page.BPlusTreePage) {
 	// 如果由于递归到了根节点
 	if node.GetPageID() == uint32(tree.rootPageId) {
@@ -342,7 +635,7 @@ func (tree *BPlusTree) coalesceOrRedistribute(node *page.BPlusTreePage) {
 
 	// 获取父节点
 	parentId := node.GetParentID()
-	parentPageRaw := tree.bpm.FetchPage(page.PageID(parentId))
+	parentPageRaw := tree.fetchPage(page.PageID(parentId))
 	parentNode := page.NewBPlusTreePage(parentPageRaw)
 
 	// 找到当前节点在父节点中的索引
@@ -362,11 +655,11 @@ func (tree *BPlusTree) coalesceOrRedistribute(node *page.BPlusTreePage) {
 
 	if idxInParent > 0 {
 		siblingIdx = idxInParent - 1
-		siblingPageRaw = tree.bpm.FetchPage(page.PageID(parentNode.GetValueAsPageID(siblingIdx)))
+		siblingPageRaw = tree.fetchPage(page.PageID(parentNode.GetValueAsPageID(siblingIdx)))
 		siblingNode = page.NewBPlusTreePage(siblingPageRaw)
 	} else {
 		siblingIdx = idxInParent + 1
-		siblingPageRaw = tree.bpm.FetchPage(page.PageID(parentNode.GetValueAsPageID(siblingIdx)))
+		siblingPageRaw = tree.fetchPage(page.PageID(parentNode.GetValueAsPageID(siblingIdx)))
 		siblingNode = page.NewBPlusTreePage(siblingPageRaw)
 	}
 
@@ -378,26 +671,20 @@ func (tree *BPlusTree) coalesceOrRedistribute(node *page.BPlusTreePage) {
 		// 借位完成后，所有涉及的页面都要 Unpin
 		tree.bpm.UnpinPage(siblingPageRaw.ID(), true)
 		tree.bpm.UnpinPage(parentPageRaw.ID(), true)
-		// 注意：node 已经在外部被 Fetch，这里需要在 coalesceOrRedistribute 结束时由调用链 Unpin，
-		// 但为了简单，我们在 Remove 里已经 Unpin 了吗？不，如果是 Underflow，Remove 把 Unpin 权交给了这里。
-		// 所以我们需要 Unpin node。但 node 是 BPlusTreePage 包装器，我们需要原始 PageID。
 		tree.bpm.UnpinPage(page.PageID(node.GetPageID()), true)
 	} else {
 		// 合并 (Coalesce)
 		// 确保将右边的合并到左边，方便逻辑处理
+		// coalesce 会释放 Right 和 Parent 的 Pin，Left 由这里释放
 		if siblingIdx < idxInParent {
 			// Sibling(Left) + Node(Right)
 			tree.coalesce(siblingNode, node, parentNode, idxInParent) // idxInParent 指向 Right
-			// Coalesce 内部会处理 node 的删除和 Unpin
 			tree.bpm.UnpinPage(siblingPageRaw.ID(), true)
 		} else {
 			// Node(Left) + Sibling(Right)
 			tree.coalesce(node, siblingNode, parentNode, siblingIdx) // siblingIdx 指向 Right
-			// Coalesce 内部会处理 sibling 的删除
 			tree.bpm.UnpinPage(page.PageID(node.GetPageID()), true)
 		}
-		// Parent 处理在递归中完成
-		tree.bpm.UnpinPage(parentPageRaw.ID(), true)
 	}
 }
 
@@ -419,7 +706,7 @@ func (tree *BPlusTree) redistribute(sibling *page.BPlusTreePage, node *page.BPlu
 		// 3. 如果是内部节点，移动过来的子节点需要更新 Parent 指针
 		if !node.IsLeaf() {
 			childId := node.GetValueAsPageID(0)
-			childPage := tree.bpm.FetchPage(page.PageID(childId))
+			childPage := tree.fetchPage(page.PageID(childId))
 			childNode := page.NewBPlusTreePage(childPage)
 			childNode.SetParentID(node.GetPageID())
 			tree.bpm.UnpinPage(childPage.ID(), true)
@@ -434,7 +721,7 @@ func (tree *BPlusTree) redistribute(sibling *page.BPlusTreePage, node *page.BPlu
 
 		if !node.IsLeaf() {
 			childId := node.GetValueAsPageID(node.GetCount() - 1)
-			childPage := tree.bpm.FetchPage(page.PageID(childId))
+			childPage := tree.fetchPage(page.PageID(childId))
 			childNode := page.NewBPlusTreePage(childPage)
 			childNode.SetParentID(node.GetPageID())
 			tree.bpm.UnpinPage(childPage.ID(), true)
@@ -443,10 +730,11 @@ func (tree *BPlusTree) redistribute(sibling *page.BPlusTreePage, node *page.BPlu
 }
 
 // coalesce 合并逻辑 (Left + Right -> Left)
+// 约定：三个页面都已被调用者 Pin 住；本函数释放 Right（删除）和 Parent 的 Pin，Left 仍由调用者释放
 func (tree *BPlusTree) coalesce(left *page.BPlusTreePage, right *page.BPlusTreePage, parent *page.BPlusTreePage, rightIdxInParent int32) {
 	// 1. 移动所有数据从 Right 到 Left
-	// 内部节点合并时比较复杂（需要把 Parent 的 Key 拉下来），这里简化为直接移动
-	right.MoveAllTo(left, 0)
+	// 内部节点合并时，Right 的第一个 Key 用父节点中的分隔 Key 代替（Right 的 Key[0] 可能已过期）
+	right.MoveAllTo(left, parent.GetKey(rightIdxInParent))
 
 	// 2. 如果是叶子，维护链表
 	if left.IsLeaf() {
@@ -456,7 +744,7 @@ func (tree *BPlusTree) coalesce(left *page.BPlusTreePage, right *page.BPlusTreeP
 		count := left.GetCount()
 		for i := int32(0); i < count; i++ {
 			childId := left.GetValueAsPageID(i)
-			childPage := tree.bpm.FetchPage(page.PageID(childId))
+			childPage := tree.fetchPage(page.PageID(childId))
 			childNode := page.NewBPlusTreePage(childPage)
 			if childNode.GetParentID() != left.GetPageID() {
 				childNode.SetParentID(left.GetPageID())
@@ -470,12 +758,16 @@ func (tree *BPlusTree) coalesce(left *page.BPlusTreePage, right *page.BPlusTreeP
 	// 3. 从父节点删除指向 Right 的指针
 	parent.Remove(rightIdxInParent)
 
-	// 4. 释放 Right 页面
-	tree.bpm.DeletePage(page.PageID(right.GetPageID()))
+	// 4. 释放 Right 页面（必须先 Unpin，否则 DeletePage 会失败）
+	rightId := page.PageID(right.GetPageID())
+	tree.bpm.UnpinPage(rightId, false)
+	tree.bpm.DeletePage(rightId)
 
-	// 5. 递归：如果父节点 Underflow，继续处理
+	// 5. 递归：如果父节点 Underflow，继续处理（Parent 的 Pin 交给递归释放）
 	if parent.GetCount() < parent.MinDegree() {
 		tree.coalesceOrRedistribute(parent)
+	} else {
+		tree.bpm.UnpinPage(page.PageID(parent.GetPageID()), true)
 	}
 }
 
@@ -484,6 +776,7 @@ func (tree *BPlusTree) adjustRoot(oldRoot *page.BPlusTreePage) {
 	// 情况 1: 根是叶子，且被清空了
 	if oldRoot.IsLeaf() && oldRoot.GetCount() == 0 {
 		tree.rootPageId = page.InvalidPageID
+		tree.bpm.UnpinPage(page.PageID(oldRoot.GetPageID()), false)
 		tree.bpm.DeletePage(page.PageID(oldRoot.GetPageID()))
 		return
 	}
@@ -493,13 +786,14 @@ func (tree *BPlusTree) adjustRoot(oldRoot *page.BPlusTreePage) {
 	// 如果根只剩 1 个孩子，这个孩子就变成新的根（树高度减 1）。
 	if !oldRoot.IsLeaf() && oldRoot.GetCount() == 1 {
 		childId := oldRoot.GetValueAsPageID(0)
-		childPage := tree.bpm.FetchPage(page.PageID(childId))
+		childPage := tree.fetchPage(page.PageID(childId))
 		childNode := page.NewBPlusTreePage(childPage)
 
 		childNode.SetParentID(0) // 新根没有父节点
 		tree.rootPageId = childPage.ID()
 
 		tree.bpm.UnpinPage(childPage.ID(), true)
+		tree.bpm.UnpinPage(page.PageID(oldRoot.GetPageID()), false)
 		tree.bpm.DeletePage(page.PageID(oldRoot.GetPageID()))
 	} else {
 		tree.bpm.UnpinPage(page.PageID(oldRoot.GetPageID()), true)
@@ -0,0 +1,161 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+
+	"minidb/pkg/storage/page"
+)
+
+// KV 是 BulkLoad 的一个键值对
+type KV struct {
+	Key   int64
+	Value []byte
+}
+
+// BulkLoad 用按 Key 严格递增的 pairs 自底向上建树：先把叶子依次填到接近满并串成链表，
+// 再逐层建内部节点，最后设置根。每个页面只写一次，不像逐个 Insert 那样从叶子往上不断分裂。
+// 每层按容量算出节点个数后均匀分配，最后一个节点不会只剩几个 Key。
+// 只能用于空树；Key 不严格递增时返回错误，树不变。分配页面失败时释放已经建好的页面，树仍为空
+func (tree *BPlusTree) BulkLoad(pairs []KV) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if !tree.IsEmpty() {
+		return errors.New("bulk load requires an empty tree")
+	}
+	for i := 1; i < len(pairs); i++ {
+		if pairs[i].Key <= pairs[i-1].Key {
+			return fmt.Errorf("bulk load: keys must be strictly increasing (key %d after %d)", pairs[i].Key, pairs[i-1].Key)
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	b := &bulkBuilder{tree: tree}
+	root, err := b.build(pairs)
+	if err != nil {
+		b.discard()
+		return err
+	}
+	tree.rootPageId = root
+	return nil
+}
+
+// bulkBuilder 记录建树过程中分配的页面和溢出值，失败时一起释放
+type bulkBuilder struct {
+	tree  *BPlusTree
+	pages []page.PageID
+	slots [][]byte
+}
+
+func (b *bulkBuilder) build(pairs []KV) (page.PageID, error) {
+	leaves, err := b.buildLeaves(pairs)
+	if err != nil {
+		return page.InvalidPageID, err
+	}
+	level := leaves
+	for len(level) > 1 {
+		if level, err = b.buildInternal(level); err != nil {
+			return page.InvalidPageID, err
+		}
+	}
+	return level[0].pageID, nil
+}
+
+// newNode 分配一个节点页，返回时仍被 Pin 住
+func (b *bulkBuilder) newNode(kind uint32) (*page.Page, *page.BPlusTreePage, error) {
+	raw := b.tree.newPage()
+	if raw == nil {
+		return nil, nil, ErrInsertFailed
+	}
+	b.pages = append(b.pages, raw.ID())
+	node := page.NewBPlusTreePage(raw)
+	node.Init(uint32(raw.ID()), kind, 0)
+	return raw, node, nil
+}
+
+// buildLeaves 建叶子层并串成链表，返回每个叶子及其最小 Key
+// 同时最多 Pin 住两个叶子：上一个叶子等下一个分配出来、填好 NextPageID 之后才释放
+func (b *bulkBuilder) buildLeaves(pairs []KV) ([]presplitEntry, error) {
+	capacity := int(page.MaxDegreeFor(b.tree.bpm.PageSize()) - 1)
+	groups := (len(pairs) + capacity - 1) / capacity
+	leaves := make([]presplitEntry, 0, groups)
+
+	var prevRaw *page.Page
+	var prev *page.BPlusTreePage
+	for g := 0; g < groups; g++ {
+		chunk := pairs[g*len(pairs)/groups : (g+1)*len(pairs)/groups]
+		raw, leaf, err := b.newNode(page.KindLeaf)
+		if err != nil {
+			if prevRaw != nil {
+				b.tree.bpm.UnpinPage(prevRaw.ID(), true)
+			}
+			return nil, err
+		}
+		for i, kv := range chunk {
+			slot, ok := encodeValue(b.tree.bpm, b.tree.newPage, kv.Value)
+			if !ok {
+				b.tree.bpm.UnpinPage(raw.ID(), true)
+				if prevRaw != nil {
+					b.tree.bpm.UnpinPage(prevRaw.ID(), true)
+				}
+				return nil, ErrInsertFailed
+			}
+			b.slots = append(b.slots, slot)
+			leaf.SetKey(int32(i), kv.Key)
+			leaf.SetValue(int32(i), slot)
+		}
+		leaf.SetCount(int32(len(chunk)))
+
+		if prevRaw != nil {
+			prev.SetNextPageID(uint32(raw.ID()))
+			b.tree.bpm.UnpinPage(prevRaw.ID(), true)
+		}
+		prevRaw, prev = raw, leaf
+		leaves = append(leaves, presplitEntry{pageID: raw.ID(), low: chunk[0].Key})
+	}
+	b.tree.bpm.UnpinPage(prevRaw.ID(), true)
+	return leaves, nil
+}
+
+// buildInternal 为下一层的节点建一层内部节点，并设置孩子的父指针
+func (b *bulkBuilder) buildInternal(level []presplitEntry) ([]presplitEntry, error) {
+	fanout := int(page.MaxDegreeFor(b.tree.bpm.PageSize()) - 1)
+	groups := (len(level) + fanout - 1) / fanout
+	parents := make([]presplitEntry, 0, groups)
+	for g := 0; g < groups; g++ {
+		children := level[g*len(level)/groups : (g+1)*len(level)/groups]
+		raw, node, err := b.newNode(page.KindInternal)
+		if err != nil {
+			return nil, err
+		}
+		for i, c := range children {
+			node.SetKey(int32(i), c.low)
+			node.SetValueAsPageID(int32(i), uint32(c.pageID))
+		}
+		node.SetCount(int32(len(children)))
+		b.tree.bpm.UnpinPage(raw.ID(), true)
+
+		for _, c := range children {
+			if !b.tree.updateNode(c.pageID, func(n *page.BPlusTreePage) {
+				n.SetParentID(uint32(raw.ID()))
+			}) {
+				return nil, ErrInsertFailed
+			}
+		}
+		parents = append(parents, presplitEntry{pageID: raw.ID(), low: children[0].low})
+	}
+	return parents, nil
+}
+
+// discard 释放建了一半的树的页面和溢出值
+func (b *bulkBuilder) discard() {
+	for _, slot := range b.slots {
+		freeValue(b.tree.bpm, slot)
+	}
+	for _, id := range b.pages {
+		b.tree.bpm.DeletePage(id)
+	}
+}
@@ -0,0 +1,98 @@
+package index
+
+import (
+	"minidb/pkg/storage/page"
+)
+
+// CompactLeaves 沿叶子链表把相邻且同父的叶子合并：只要两者的 Key 合起来放得进一个节点就合并
+// 合并复用删除路径的 coalesce，父节点分隔 Key 和 Underflow 都按删除的方式修正，不需要重建整棵树
+// 返回合并的次数
+func (tree *BPlusTree) CompactLeaves() int {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if tree.IsEmpty() {
+		return 0
+	}
+
+	merged := 0
+	leafRaw := tree.leftmostLeaf()
+	for leafRaw != nil {
+		leaf := page.NewBPlusTreePage(leafRaw)
+		nextId := leaf.GetNextPageID()
+		if nextId == 0 || leaf.GetPageID() == uint32(tree.rootPageId) {
+			tree.bpm.UnpinPage(leafRaw.ID(), false)
+			break
+		}
+
+		rightRaw := tree.fetchPage(page.PageID(nextId))
+		if rightRaw == nil {
+			tree.bpm.UnpinPage(leafRaw.ID(), false)
+			break
+		}
+		right := page.NewBPlusTreePage(rightRaw)
+
+		// 不同父节点的叶子之间合并需要调整上层结构，这里跳过
+		if leaf.GetParentID() != right.GetParentID() ||
+			leaf.GetCount()+right.GetCount() > leaf.MaxDegree()-1 {
+			tree.bpm.UnpinPage(leafRaw.ID(), false)
+			leafRaw = rightRaw
+			continue
+		}
+
+		parentRaw := tree.fetchPage(page.PageID(leaf.GetParentID()))
+		if parentRaw == nil {
+			tree.bpm.UnpinPage(rightRaw.ID(), false)
+			tree.bpm.UnpinPage(leafRaw.ID(), false)
+			break
+		}
+		parent := page.NewBPlusTreePage(parentRaw)
+
+		rightIdx := int32(-1)
+		for i := int32(0); i < parent.GetCount(); i++ {
+			if parent.GetValueAsPageID(i) == right.GetPageID() {
+				rightIdx = i
+				break
+			}
+		}
+		if rightIdx <= 0 {
+			tree.bpm.UnpinPage(parentRaw.ID(), false)
+			tree.bpm.UnpinPage(leafRaw.ID(), false)
+			leafRaw = rightRaw
+			continue
+		}
+
+		// coalesce 负责释放 Right 和 Parent，父节点 Underflow 时可能引起上层调整
+		firstKey := leaf.GetKey(0)
+		tree.coalesce(leaf, right, parent, rightIdx)
+		tree.bpm.UnpinPage(leafRaw.ID(), true)
+		merged++
+
+		// 上层调整可能移动了当前叶子，按 Key 重新定位后继续尝试与新的右邻居合并
+		leafRaw = tree.FindLeafPage(firstKey)
+	}
+	return merged
+}
+
+// leftmostLeaf 返回最左侧叶子（已 Pin），调用者负责 Unpin
+func (tree *BPlusTree) leftmostLeaf() *page.Page {
+	pageRaw := tree.fetchPage(tree.rootPageId)
+	if pageRaw == nil {
+		return nil
+	}
+	node := page.NewBPlusTreePage(pageRaw)
+	for depth := 1; !node.IsLeaf(); depth++ {
+		if tree.descentTooDeep(depth, pageRaw.ID()) {
+			tree.bpm.UnpinPage(pageRaw.ID(), false)
+			return nil
+		}
+		childId := page.PageID(node.GetValueAsPageID(0))
+		tree.bpm.UnpinPage(pageRaw.ID(), false)
+		pageRaw = tree.fetchPage(childId)
+		if pageRaw == nil {
+			return nil
+		}
+		node = page.NewBPlusTreePage(pageRaw)
+	}
+	return pageRaw
+}
@@ -0,0 +1,78 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/page"
+)
+
+// ErrTreeCorrupt 表示沿孩子指针或叶子链表走回了已经走过的页，继续走会永远转圈
+var ErrTreeCorrupt = errors.New("tree appears corrupt (cycle detected)")
+
+// MaxTreeDepth 是合法的树可能达到的最大层数
+// 页号是 32 位的，每个内部节点至少有两个孩子，所以树不会超过 32 层；
+// 从根往下走超过这个层数，说明孩子指针绕成了环
+const MaxTreeDepth = 32
+
+func corruptf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrTreeCorrupt}, args...)...)
+}
+
+// Err 返回这棵树在遍历中发现过的结构错误或页面校验和错误，树损坏后一直保留
+// FindLeafPage、Begin、Scan 遇到损坏的树时返回 nil，调用方用 Err 区分“没有数据”和“树已损坏”
+func (tree *BPlusTree) Err() error {
+	tree.errMu.Lock()
+	defer tree.errMu.Unlock()
+	return tree.err
+}
+
+// setErr 记录遍历中发现的结构错误，err 为 nil 时不做任何事；读操作只持有读锁，所以单独加锁
+func (tree *BPlusTree) setErr(err error) {
+	if err == nil {
+		return
+	}
+	tree.errMu.Lock()
+	defer tree.errMu.Unlock()
+	tree.err = err
+}
+
+// descentTooDeep 在从根往下走到第 depth 层（根为第 1 层）时检查是否已经超过 MaxTreeDepth
+func (tree *BPlusTree) descentTooDeep(depth int, pid page.PageID) bool {
+	if depth <= MaxTreeDepth {
+		return false
+	}
+	tree.setErr(tree.tooDeep(pid))
+	return true
+}
+
+func (tree *BPlusTree) tooDeep(pid page.PageID) error {
+	return corruptf("descent from root %d reached page %d below depth %d", tree.rootPageId, pid, MaxTreeDepth)
+}
+
+// fetchPage 从缓冲池取页，页面校验和不符时返回 disk.ErrChecksumMismatch
+// 其他原因（例如缓冲池已满）取不到页时与 FetchPage 一样只返回 nil，不算树的错误
+func fetchPage(bpm *buffer.BufferPoolManager, pid page.PageID) (*page.Page, error) {
+	p, err := bpm.FetchPageErr(pid)
+	if errors.Is(err, disk.ErrChecksumMismatch) {
+		return nil, err
+	}
+	return p, nil
+}
+
+// fetchPage 从缓冲池取页，页面校验和不符时把错误记到 Err 中
+func (tree *BPlusTree) fetchPage(pid page.PageID) *page.Page {
+	p, err := fetchPage(tree.bpm, pid)
+	tree.setErr(err)
+	return p
+}
+
+// fetchFailed 描述 fetchPage 取不到页的原因：页面校验和不符时返回该错误
+func fetchFailed(kind string, pid page.PageID, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s %d: fetch failed", kind, pid)
+}
@@ -0,0 +1,91 @@
+package index
+
+import "minidb/pkg/storage/page"
+
+// TreeNode 是 Nodes 返回的一个节点
+type TreeNode struct {
+	PageID page.PageID
+	Depth  int // 根为 0
+	Leaf   bool
+	Keys   []int64 // 叶子的全部主键；内部节点的分隔键（不含无效的第 0 个槽）
+}
+
+// Nodes 按层（广度优先）遍历树，跳过前 offset 个节点后最多返回 limit 个，more 表示后面还有节点
+// 同一层的节点按从左到右的顺序排列；跳过的叶子不会被读入缓冲池
+func (tree *BPlusTree) Nodes(offset, limit int) (nodes []TreeNode, more bool, err error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() || limit <= 0 {
+		return nil, !tree.IsEmpty(), nil
+	}
+
+	// 所有叶子深度相同，先沿最左路径求出叶子所在的层
+	leafDepth := 0
+	for pid := tree.rootPageId; ; leafDepth++ {
+		raw, err := fetchPage(tree.bpm, pid)
+		if raw == nil {
+			return nil, false, fetchFailed("page", pid, err)
+		}
+		node := page.NewBPlusTreePage(raw)
+		leaf := node.IsLeaf()
+		next := page.PageID(node.GetValueAsPageID(0))
+		tree.bpm.UnpinPage(pid, false)
+		if leaf {
+			break
+		}
+		if leafDepth >= MaxTreeDepth {
+			return nil, false, tree.tooDeep(pid)
+		}
+		pid = next
+	}
+
+	type queued struct {
+		id    page.PageID
+		depth int
+	}
+	queue := []queued{{tree.rootPageId, 0}}
+	seen := map[page.PageID]bool{tree.rootPageId: true}
+	for i := 0; i < len(queue); i++ {
+		if len(nodes) == limit {
+			return nodes, true, nil
+		}
+		q := queue[i]
+		// 叶子没有孩子要入队，跳过时不必读
+		if i < offset && q.depth == leafDepth {
+			continue
+		}
+		raw, err := fetchPage(tree.bpm, q.id)
+		if raw == nil {
+			return nil, false, fetchFailed("page", q.id, err)
+		}
+		node := page.NewBPlusTreePage(raw)
+		count := node.GetCount()
+		n := TreeNode{PageID: q.id, Depth: q.depth, Leaf: node.IsLeaf()}
+		if n.Leaf {
+			n.Keys = make([]int64, 0, count)
+			for j := int32(0); j < count; j++ {
+				n.Keys = append(n.Keys, node.GetKey(j))
+			}
+		} else {
+			n.Keys = make([]int64, 0, max(count-1, 0))
+			for j := int32(0); j < count; j++ {
+				if j > 0 {
+					n.Keys = append(n.Keys, node.GetKey(j))
+				}
+				child := page.PageID(node.GetValueAsPageID(j))
+				if seen[child] {
+					tree.bpm.UnpinPage(q.id, false)
+					return nil, false, corruptf("page %d is a child of more than one node", child)
+				}
+				seen[child] = true
+				queue = append(queue, queued{child, q.depth + 1})
+			}
+		}
+		tree.bpm.UnpinPage(q.id, false)
+		if i >= offset {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, false, nil
+}
@@ -1,6 +1,8 @@
 package index
 
 import (
+	"bytes"
+
 	"minidb/pkg/buffer"
 	"minidb/pkg/storage/page"
 )
@@ -10,15 +12,42 @@ type TreeIterator struct {
 	bpm      *buffer.BufferPoolManager
 	currPage *page.BPlusTreePage // 当前被 Pin 住的页
 	currIdx  int32               // 当前页内的 Slot Index
+	bounded  bool                // 是否有上界
+	endKey   int64               // 上界（包含），越过后迭代结束
+
+	// 叶子链表的环检测：合法的链表上 Key 严格递增，走到的非空叶子的首个 Key 必须大于已经走过的 Key；
+	// 空叶子没有 Key 可比，记下自上一个非空叶子以来经过的空叶子，重复经过即为环
+	lastKey int64
+	hasLast bool
+	empties map[page.PageID]bool
+	err     error
 }
 
 // NewTreeIterator 创建一个新的迭代器 (通常由 BPlusTree 调用)
 func NewTreeIterator(bpm *buffer.BufferPoolManager, page *page.BPlusTreePage, idx int32) *TreeIterator {
-	return &TreeIterator{
+	it := &TreeIterator{
 		bpm:      bpm,
 		currPage: page,
 		currIdx:  idx,
 	}
+	it.prefetchNext()
+	return it
+}
+
+// prefetchNext 处理当前叶子的同时在后台预读链表上的下一个叶子，见 BufferPoolManager.Prefetch
+// 有上界并且当前叶子已经越过上界时不会走到下一个叶子，不预读
+func (it *TreeIterator) prefetchNext() {
+	if it.currPage == nil {
+		return
+	}
+	next := it.currPage.GetNextPageID()
+	if next == 0 {
+		return
+	}
+	if n := it.currPage.GetCount(); it.bounded && n > 0 && it.currPage.GetKey(n-1) >= it.endKey {
+		return
+	}
+	it.bpm.Prefetch(page.PageID(next))
 }
 
 // Key 返回当前游标位置的 Key
@@ -31,51 +60,123 @@ func (it *TreeIterator) Key() int64 {
 	return it.currPage.GetKey(it.currIdx)
 }
 
-// Value 返回当前游标位置的 Value
+// Value 返回当前游标位置的 Value 的拷贝
 func (it *TreeIterator) Value() []byte {
+	return bytes.Clone(it.ValueRef())
+}
+
+// PageID 返回当前行所在的叶子页号
+func (it *TreeIterator) PageID() page.PageID {
+	if it.currPage == nil {
+		return page.InvalidPageID
+	}
+	return page.PageID(it.currPage.GetPageID())
+}
+
+// Slot 返回当前行在叶子页内的槽位下标
+func (it *TreeIterator) Slot() int32 {
+	return it.currIdx
+}
+
+// ValueRef 返回当前 Value 的只读视图，直接引用被 Pin 住的页缓冲区，不分配内存（溢出的长值除外，见 overflow.go）
+// 切片只在下一次 Next() 或 Close() 之前有效，之后页面可能被换出复用；
+// 需要保留数据时请拷贝或改用 Value()。溢出页损坏时返回 nil，错误见 Err，下一次 Next 返回 false
+func (it *TreeIterator) ValueRef() []byte {
 	if it.currPage == nil {
 		return nil
 	}
-	return it.currPage.GetValue(it.currIdx)
+	val, err := readValue(it.bpm, it.currPage.GetValueRef(it.currIdx))
+	if err != nil {
+		it.err = err
+	}
+	return val
 }
 
 func (it *TreeIterator) Next() bool {
 	if it.currPage == nil {
 		return false
 	}
+	if it.err != nil {
+		it.Close()
+		return false
+	}
 
 	it.currIdx++
 
-	if it.currIdx < it.currPage.GetCount() {
-		return true
-	}
+	// 当前叶子读完后沿链表前进，跳过空叶子（预分裂出的叶子在写入前是空的）
+	for it.currIdx >= it.currPage.GetCount() {
+		nextPageId := it.currPage.GetNextPageID()
+		if err := it.leave(); err != nil {
+			it.err = err
+			it.Close()
+			return false
+		}
 
-	nextPageId := it.currPage.GetNextPageID()
-	
-	// 修复 1: 显式类型转换
-	it.bpm.UnpinPage(page.PageID(it.currPage.GetPageID()), false)
+		// 修复 1: 显式类型转换
+		it.bpm.UnpinPage(page.PageID(it.currPage.GetPageID()), false)
 
-	if nextPageId == 0 { 
-		it.currPage = nil
-		return false
+		if nextPageId == 0 {
+			it.currPage = nil
+			return false
+		}
+
+		rawPage, err := fetchPage(it.bpm, page.PageID(nextPageId))
+		if rawPage == nil {
+			it.err = err
+			it.currPage = nil
+			return false
+		}
+
+		it.currPage = page.NewBPlusTreePage(rawPage)
+		it.currIdx = 0
+		it.prefetchNext()
+		if it.currPage.GetCount() > 0 && it.hasLast && it.currPage.GetKey(0) <= it.lastKey {
+			it.err = corruptf("leaf %d follows a leaf ending at key %d but starts at key %d",
+				it.currPage.GetPageID(), it.lastKey, it.currPage.GetKey(0))
+			it.Close()
+			return false
+		}
 	}
 
-	rawPage := it.bpm.FetchPage(page.PageID(nextPageId))
-	if rawPage == nil {
-		it.currPage = nil
-		return false
+	return it.checkBound()
+}
+
+// leave 在离开当前叶子之前记录环检测需要的信息，当前叶子是重复经过的空叶子时返回错误
+func (it *TreeIterator) leave() error {
+	if n := it.currPage.GetCount(); n > 0 {
+		it.lastKey, it.hasLast = it.currPage.GetKey(n-1), true
+		it.empties = nil
+		return nil
+	}
+	id := page.PageID(it.currPage.GetPageID())
+	if it.empties[id] {
+		return corruptf("empty leaf %d reached twice through next pointers", id)
 	}
+	if it.empties == nil {
+		it.empties = make(map[page.PageID]bool)
+	}
+	it.empties[id] = true
+	return nil
+}
 
-	it.currPage = page.NewBPlusTreePage(rawPage)
-	it.currIdx = 0 
+// Err 返回迭代过程中发现的结构错误或页面校验和错误，Next 返回 false 后调用；正常走到末尾时为 nil
+func (it *TreeIterator) Err() error {
+	return it.err
+}
 
+// checkBound 当前 Key 超过上界时结束迭代并释放页面
+func (it *TreeIterator) checkBound() bool {
+	if it.bounded && it.Key() > it.endKey {
+		it.Close()
+		return false
+	}
 	return true
 }
 
 // Close 关闭迭代器
 func (it *TreeIterator) Close() {
 	if it.currPage != nil {
-        // 修复 2: 显式类型转换
+		// 修复 2: 显式类型转换
 		it.bpm.UnpinPage(page.PageID(it.currPage.GetPageID()), false)
 		it.currPage = nil
 	}
@@ -84,4 +185,4 @@ func (it *TreeIterator) Close() {
 // IsValid 检查迭代器当前是否指向有效数据
 func (it *TreeIterator) IsValid() bool {
 	return it.currPage != nil
-}
\ No newline at end of file
+}
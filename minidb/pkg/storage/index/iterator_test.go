@@ -2,6 +2,8 @@ package index
 
 import (
 	"encoding/binary"
+	"errors"
+	"math"
 	"math/rand"
 	"minidb/pkg/buffer"
 	"minidb/pkg/storage/disk"
@@ -75,3 +77,536 @@ func TestBPlusTreeIterator(t *testing.T) {
 	assert.Equal(t, n, count, "Iterator did not visit all records")
 	t.Logf("Successfully iterated over %d records.", count)
 }
+
+func TestBPlusTreeScan(t *testing.T) {
+	file := "test_scan.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	diskManager, err := disk.NewDiskManager(file)
+	assert.Nil(t, err)
+	bpm := buffer.NewBufferPoolManager(diskManager, 50)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+
+	// 只插入偶数，覆盖 low 落在叶子末尾之后、落在两个 Key 之间等情况
+	n := 300
+	for i := 0; i < n; i += 2 {
+		tree.Insert(int64(i), []byte("v"))
+	}
+
+	for low := -1; low <= n; low++ {
+		high := int64(low + 20)
+		it := tree.Scan(int64(low), high)
+
+		expected := int64(low)
+		if expected < 0 {
+			expected = 0
+		}
+		if expected%2 != 0 {
+			expected++
+		}
+		if expected >= int64(n) || expected > high {
+			assert.Nil(t, it, "scan from %d should be empty", low)
+			continue
+		}
+
+		assert.NotNil(t, it)
+		for {
+			assert.Equal(t, expected, it.Key())
+			expected += 2
+			if !it.Next() {
+				break
+			}
+		}
+		assert.True(t, expected > high || expected >= int64(n), "scan from %d stopped early at %d", low, expected)
+	}
+}
+
+func TestBPlusTreeLowerBound(t *testing.T) {
+	file := "test_seek.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	diskManager, err := disk.NewDiskManager(file)
+	assert.Nil(t, err)
+	bpm := buffer.NewBufferPoolManager(diskManager, 50)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+	assert.Nil(t, tree.LowerBound(0), "lower bound on an empty tree")
+
+	// 只插入偶数，奇数的目标落在两个 Key 之间，跨过叶子末尾时要走到下一个叶子
+	n := 600
+	for i := 0; i < n; i += 2 {
+		tree.Insert(int64(i), []byte("v"))
+	}
+
+	for key := -1; key <= n; key++ {
+		it := tree.LowerBound(int64(key))
+		expected := int64(max(key, 0))
+		if expected%2 != 0 {
+			expected++
+		}
+		if expected >= int64(n) {
+			assert.Nil(t, it, "lower bound of %d should find nothing", key)
+			continue
+		}
+
+		assert.NotNil(t, it)
+		// 不设上界，一直走到最后一个 Key
+		for {
+			assert.Equal(t, expected, it.Key())
+			expected += 2
+			if !it.Next() {
+				break
+			}
+		}
+		assert.Nil(t, it.Err())
+		assert.Equal(t, int64(n), expected, "lower bound of %d stopped early", key)
+	}
+}
+
+func TestBPlusTreeReverseScan(t *testing.T) {
+	file := "test_reverse.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	diskManager, err := disk.NewDiskManager(file)
+	assert.Nil(t, err)
+	bpm := buffer.NewBufferPoolManager(diskManager, 50)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+	assert.Nil(t, tree.ReverseScan(math.MinInt64, math.MaxInt64), "reverse scan on an empty tree")
+
+	// 只保留偶数，再删掉一段连续的 Key，让回退时经过整片被删空的区间
+	n := 2000
+	for i := 0; i < n; i += 2 {
+		tree.Insert(int64(i), []byte("v"))
+	}
+	for i := 600; i < 1400; i += 2 {
+		tree.Remove(int64(i))
+	}
+	var want []int64
+	for i := n - 2; i >= 0; i -= 2 {
+		if i < 600 || i >= 1400 {
+			want = append(want, int64(i))
+		}
+	}
+
+	collect := func(low, high int64) []int64 {
+		it := tree.ReverseScan(low, high)
+		if it == nil {
+			return nil
+		}
+		var keys []int64
+		for {
+			keys = append(keys, it.Key())
+			if !it.Next() {
+				break
+			}
+		}
+		assert.Nil(t, it.Err())
+		return keys
+	}
+	assert.Equal(t, want, collect(math.MinInt64, math.MaxInt64))
+	assert.Equal(t, []int64{1404, 1402, 1400, 598, 596}, collect(595, 1405))
+	assert.Equal(t, []int64{598}, collect(598, 1000), "high falls into the deleted range")
+	assert.Nil(t, collect(600, 1399))
+	assert.Nil(t, collect(10, 5))
+
+	// 提前结束也要释放页面
+	it := tree.ReverseScan(0, 1000)
+	it.Next()
+	it.Close()
+	for _, f := range bpm.Frames() {
+		assert.Zero(t, f.PinCount, "page %d is still pinned", f.PageID)
+	}
+}
+
+// benchmarkFullScan 对 n 个 Key 做全表扫描，read 决定如何读取 Value
+func benchmarkFullScan(b *testing.B, read func(it *TreeIterator) []byte) {
+	file := "bench_scan.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	diskManager, err := disk.NewDiskManager(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer diskManager.Close()
+	bpm := buffer.NewBufferPoolManager(diskManager, 200)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+	for i := 0; i < 2000; i++ {
+		tree.Insert(int64(i), []byte("value"))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var sink byte
+	for i := 0; i < b.N; i++ {
+		it := tree.Begin()
+		for it != nil {
+			sink += read(it)[0]
+			if !it.Next() {
+				break
+			}
+		}
+	}
+	_ = sink
+}
+
+func BenchmarkScanValue(b *testing.B) {
+	benchmarkFullScan(b, func(it *TreeIterator) []byte { return it.Value() })
+}
+
+func BenchmarkScanValueRef(b *testing.B) {
+	benchmarkFullScan(b, func(it *TreeIterator) []byte { return it.ValueRef() })
+}
+
+func TestBPlusTreeScanPhysical(t *testing.T) {
+	file := "test_physical.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	diskManager, err := disk.NewDiskManager(file)
+	assert.Nil(t, err)
+	defer diskManager.Close()
+	bpm := buffer.NewBufferPoolManager(diskManager, 50)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+
+	// 空树
+	assert.Nil(t, tree.ScanPhysical(func(int64, []byte) bool {
+		t.Fatal("empty tree yielded a row")
+		return false
+	}))
+
+	// 乱序插入让叶子在文件中不连续
+	const n = 3000
+	for _, k := range rand.New(rand.NewSource(1)).Perm(n) {
+		tree.Insert(int64(k), []byte("v"))
+	}
+	seen := make(map[int64]bool)
+	assert.Nil(t, tree.ScanPhysical(func(key int64, value []byte) bool {
+		assert.False(t, seen[key], "key %d yielded twice", key)
+		assert.Equal(t, byte('v'), value[0])
+		seen[key] = true
+		return true
+	}))
+	assert.Equal(t, n, len(seen))
+
+	// fn 返回 false 时提前结束，页面都要释放
+	rows := 0
+	assert.Nil(t, tree.ScanPhysical(func(int64, []byte) bool {
+		rows++
+		return rows < 10
+	}))
+	assert.Equal(t, 10, rows)
+	for i := 0; i < 50; i++ {
+		p := bpm.NewPage()
+		assert.NotNil(t, p, "buffer pool exhausted by an abandoned physical scan")
+		bpm.UnpinPage(p.ID(), false)
+	}
+}
+
+// seekCountingDisk 统计不连续的页读取（需要寻道的读），每次寻道额外等待 seekDelay
+type seekCountingDisk struct {
+	disk.DiskManager
+	last      page.PageID
+	seeks     int
+	seekDelay time.Duration
+}
+
+func (d *seekCountingDisk) ReadPage(pageID page.PageID, p *page.Page) error {
+	if pageID != d.last+1 {
+		d.seeks++
+		time.Sleep(d.seekDelay)
+	}
+	d.last = pageID
+	return d.DiskManager.ReadPage(pageID, p)
+}
+
+// benchmarkScanOrder 在乱序插入、叶子不连续的树上做冷缓存全表扫描
+// seeks/op 是每次扫描中不连续的页读取次数
+func benchmarkScanOrder(b *testing.B, physical bool) {
+	file := "bench_scan_order.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	diskManager, err := disk.NewDiskManager(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer diskManager.Close()
+	dm := &seekCountingDisk{DiskManager: diskManager, seekDelay: 20 * time.Microsecond}
+	bpm := buffer.NewBufferPoolManager(dm, 16)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+	for _, k := range rand.New(rand.NewSource(1)).Perm(5000) {
+		tree.Insert(int64(k), []byte("value"))
+	}
+
+	b.ResetTimer()
+	dm.seeks = 0
+	var rows int
+	for i := 0; i < b.N; i++ {
+		// 清空缓冲池，每次都从磁盘读
+		bpm.EvictWhere(func(page.PageID) bool { return true })
+		if physical {
+			tree.ScanPhysical(func(int64, []byte) bool {
+				rows++
+				return true
+			})
+			continue
+		}
+		for it := tree.Begin(); it != nil; {
+			rows++
+			if !it.Next() {
+				break
+			}
+		}
+	}
+	b.ReportMetric(float64(dm.seeks)/float64(b.N), "seeks/op")
+	if rows != 5000*b.N {
+		b.Fatalf("scanned %d rows, want %d", rows, 5000*b.N)
+	}
+}
+
+func BenchmarkScanLogical(b *testing.B)  { benchmarkScanOrder(b, false) }
+func BenchmarkScanPhysical(b *testing.B) { benchmarkScanOrder(b, true) }
+
+// 叶子链表或孩子指针成环时，遍历必须以 ErrTreeCorrupt 结束而不是一直转圈
+func TestBPlusTreeCycleDetection(t *testing.T) {
+	file := "test_cycle.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	dm, _ := disk.NewDiskManager(file)
+	defer dm.Close()
+	bpm := buffer.NewBufferPoolManager(dm, 100)
+	tree := NewBPlusTree(page.InvalidPageID, bpm)
+	for i := 0; i < 2000; i++ {
+		tree.Insert(int64(i), []byte("val"))
+	}
+
+	// 在规定时间内跑完 fn，超时说明遍历陷入了环
+	finishes := func(name string, fn func()) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fn()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s did not terminate", name)
+		}
+	}
+
+	// 让 Key 500 所在的叶子指向自己
+	leafRaw := tree.FindLeafPage(500)
+	leaf := page.NewBPlusTreePage(leafRaw)
+	leaf.SetNextPageID(leaf.GetPageID())
+	bpm.UnpinPage(leafRaw.ID(), true)
+
+	var count int
+	finishes("scan over a self-referencing leaf", func() {
+		it := tree.Begin()
+		defer it.Close()
+		for count = 1; it.Next(); count++ {
+		}
+		if !errors.Is(it.Err(), ErrTreeCorrupt) {
+			t.Errorf("Expected ErrTreeCorrupt, got %v", it.Err())
+		}
+	})
+	if count > 2000 {
+		t.Fatalf("Iterator returned %d rows from a 2000-row tree", count)
+	}
+
+	// 根的第一个孩子指回根：从根往下的路径永远到不了叶子
+	rootRaw := bpm.FetchPage(tree.GetRootPageId())
+	root := page.NewBPlusTreePage(rootRaw)
+	root.SetValueAsPageID(0, uint32(root.GetPageID()))
+	bpm.UnpinPage(rootRaw.ID(), true)
+
+	finishes("descent into a child cycle", func() {
+		if leaf := tree.FindLeafPage(0); leaf != nil {
+			t.Errorf("Expected no leaf for a cyclic descent")
+		}
+		if it := tree.Begin(); it != nil {
+			t.Errorf("Expected no iterator for a cyclic descent")
+		}
+		if !errors.Is(tree.Err(), ErrTreeCorrupt) {
+			t.Errorf("Expected ErrTreeCorrupt, got %v", tree.Err())
+		}
+		tree.Stats()
+		if _, err := tree.Pages(); !errors.Is(err, ErrTreeCorrupt) {
+			t.Errorf("Pages: expected ErrTreeCorrupt, got %v", err)
+		}
+		if _, _, err := tree.Nodes(0, 10); !errors.Is(err, ErrTreeCorrupt) {
+			t.Errorf("Nodes: expected ErrTreeCorrupt, got %v", err)
+		}
+		if err := tree.Verify(); err == nil {
+			t.Errorf("Verify: expected an error")
+		}
+	})
+}
+
+// bulkPairs 返回 n 个按 Key 递增的键值对，每隔 97 个 Key 有一个放不进叶子槽位、要用溢出页的长值
+func bulkPairs(n int) []KV {
+	pairs := make([]KV, n)
+	for i := range pairs {
+		val := make([]byte, 8)
+		binary.BigEndian.PutUint64(val, uint64(i*10))
+		if i%97 == 0 {
+			val = append(val, make([]byte, 300)...)
+			val[len(val)-1] = byte(i)
+		}
+		pairs[i] = KV{Key: int64(i * 3), Value: val}
+	}
+	return pairs
+}
+
+func newBulkTestTree(t *testing.T, file string) *BPlusTree {
+	t.Helper()
+	_ = os.Remove(file)
+	t.Cleanup(func() { os.Remove(file) })
+	dm, err := disk.NewDiskManager(file)
+	assert.Nil(t, err)
+	return NewBPlusTree(page.InvalidPageID, buffer.NewBufferPoolManager(dm, 100))
+}
+
+// BulkLoad 建出的树与逐个 Insert 得到的树在迭代器看来完全一样，并且之后可以照常插入和删除
+func TestBulkLoadMatchesInsert(t *testing.T) {
+	pairs := bulkPairs(10000)
+	inserted := newBulkTestTree(t, "test_bulk_insert.db")
+	for _, kv := range pairs {
+		assert.True(t, inserted.Insert(kv.Key, kv.Value))
+	}
+	loaded := newBulkTestTree(t, "test_bulk_load.db")
+	assert.NoError(t, loaded.BulkLoad(pairs))
+	assert.NoError(t, loaded.Verify())
+
+	scan := func(tree *BPlusTree) []KV {
+		var out []KV
+		it := tree.Begin()
+		assert.NotNil(t, it)
+		defer it.Close()
+		for {
+			out = append(out, KV{Key: it.Key(), Value: it.Value()})
+			if !it.Next() {
+				break
+			}
+		}
+		return out
+	}
+	assert.Equal(t, scan(inserted), scan(loaded))
+	assert.Equal(t, pairs, scan(loaded))
+	for _, i := range []int{0, 97, 5000, 9999} {
+		val, found := loaded.GetValue(pairs[i].Key)
+		assert.True(t, found)
+		assert.Equal(t, pairs[i].Value, val)
+	}
+	_, found := loaded.GetValue(1)
+	assert.False(t, found)
+
+	// 叶子填到接近满：比逐个插入（分裂后各半满）少得多的页
+	bulk, incremental := loaded.Stats(), inserted.Stats()
+	assert.Equal(t, int64(len(pairs)), bulk.KeyCount)
+	assert.Less(t, bulk.LeafPages, incremental.LeafPages)
+	assert.Greater(t, bulk.FillFactor, 0.9)
+
+	for k := int64(1); k < 3000; k += 3 {
+		assert.True(t, loaded.Insert(k, []byte("new")))
+	}
+	for k := int64(0); k < 6000; k += 6 {
+		assert.True(t, loaded.Remove(k))
+	}
+	assert.NoError(t, loaded.Verify())
+	val, found := loaded.GetValue(1)
+	assert.True(t, found)
+	assert.Equal(t, []byte("new"), val)
+}
+
+func TestBulkLoadErrors(t *testing.T) {
+	tree := newBulkTestTree(t, "test_bulk_errors.db")
+	assert.Error(t, tree.BulkLoad([]KV{{Key: 2}, {Key: 1}}))
+	assert.Error(t, tree.BulkLoad([]KV{{Key: 1}, {Key: 1}}))
+	assert.True(t, tree.IsEmpty())
+
+	assert.NoError(t, tree.BulkLoad(nil))
+	assert.True(t, tree.IsEmpty())
+	assert.NoError(t, tree.BulkLoad([]KV{{Key: 1, Value: []byte("a")}}))
+	assert.Equal(t, 1, tree.Stats().Height)
+	assert.Error(t, tree.BulkLoad([]KV{{Key: 2}}), "a non-empty tree cannot be bulk loaded")
+}
+
+// benchmarkSortedLoad 用逐个 Insert 或 BulkLoad 导入 10000 个有序的 Key
+func benchmarkSortedLoad(b *testing.B, bulk bool) {
+	pairs := bulkPairs(10000)
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		file := "bench_sorted_load.db"
+		os.Remove(file)
+		dm, _ := disk.NewDiskManager(file)
+		tree := NewBPlusTree(page.InvalidPageID, buffer.NewBufferPoolManager(dm, 1024))
+		b.StartTimer()
+
+		if bulk {
+			if err := tree.BulkLoad(pairs); err != nil {
+				b.Fatal(err)
+			}
+		} else {
+			for _, kv := range pairs {
+				tree.Insert(kv.Key, kv.Value)
+			}
+		}
+
+		b.StopTimer()
+		dm.Close()
+		os.Remove(file)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkSortedInsert(b *testing.B) { benchmarkSortedLoad(b, false) }
+func BenchmarkBulkLoad(b *testing.B)     { benchmarkSortedLoad(b, true) }
+
+// 迭代器在处理当前叶子时预读下一个叶子：冷缓存上的扫描结果不变，扫描结束（包括提前结束）后没有页面仍被 Pin 住
+func TestScanPrefetch(t *testing.T) {
+	tree := newBulkTestTree(t, "test_scan_prefetch.db")
+	pairs := bulkPairs(3000)
+	assert.NoError(t, tree.BulkLoad(pairs))
+
+	for _, r := range []struct{ low, high int64 }{
+		{math.MinInt64, math.MaxInt64}, // 整表
+		{300, 900},                     // 有上界，停在中间
+		{8000, 8003},                   // 只读一个叶子
+	} {
+		_, _, err := tree.bpm.EvictWhere(func(page.PageID) bool { return true })
+		assert.NoError(t, err)
+
+		var keys []int64
+		if it := tree.Scan(r.low, r.high); it != nil {
+			for {
+				keys = append(keys, it.Key())
+				if !it.Next() {
+					break
+				}
+			}
+			assert.NoError(t, it.Err())
+		}
+		var want []int64
+		for _, kv := range pairs {
+			if kv.Key >= r.low && kv.Key <= r.high {
+				want = append(want, kv.Key)
+			}
+		}
+		assert.Equal(t, want, keys, "scan [%d, %d]", r.low, r.high)
+		// FlushAllPages 先等预读结束，有页面没有释放时返回 ErrPagesPinned
+		assert.NoError(t, tree.bpm.FlushAllPages(), "scan [%d, %d]", r.low, r.high)
+	}
+
+	// 提前 Close 的迭代器
+	it := tree.Begin()
+	assert.NotNil(t, it)
+	it.Next()
+	it.Close()
+	assert.NoError(t, tree.bpm.FlushAllPages())
+}
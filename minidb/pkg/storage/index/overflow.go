@@ -0,0 +1,187 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/page"
+)
+
+// 叶子的值槽位固定为 page.SizeOfVal 字节，放不下的值存放在一串溢出页中，槽位里只记总长度和第一个溢出页的页号。
+// 槽位的格式由第一个字节区分：
+//
+//	inlineTag    [inlineTag][长度 1 字节][值]，值放得下，但以 0 结尾或以标记字节开头
+//	overflowTag  [overflowTag][总长度 4 字节][第一个溢出页的页号 4 字节]
+//	其他         值本身，后面补 0，读出时去掉末尾的 0；旧版本写出的槽位都是这种格式
+//
+// 0xFE 和 0xFF 不会出现在 UTF-8 文本中，文本值总是按最后一种格式存放，与旧版本写出的槽位相同；
+// 以 0 结尾的值（例如 binary 编码的整数）改用 inlineTag，不会再被当成填充去掉。
+//
+// 溢出页沿用 B+ 树节点的页头：页类型为 page.KindOverflow，Count 是本页存放的字节数，
+// NextPageID 是下一个溢出页，0 表示结束；数据从 page.HeaderSize 开始。
+// 溢出页只属于一个槽位：覆盖或删除值时立即释放，不会被两行共享
+const (
+	inlineTag   = 0xFE
+	overflowTag = 0xFF
+
+	inlineHeader   = 2
+	overflowHeader = 9
+	maxInlineValue = page.SizeOfVal - inlineHeader
+)
+
+// encodeValue 把 val 编码成叶子槽位的内容，需要时用 newPage 分配溢出页并写入
+// 分配页面失败时释放已经写好的溢出页，返回 false
+func encodeValue(bpm *buffer.BufferPoolManager, newPage func() *page.Page, val []byte) ([]byte, bool) {
+	n := len(val)
+	switch {
+	case n <= page.SizeOfVal && (n == 0 || val[n-1] != 0 && val[0] != inlineTag && val[0] != overflowTag):
+		return val, true
+	case n <= maxInlineValue:
+		slot := make([]byte, inlineHeader+n)
+		slot[0], slot[1] = inlineTag, byte(n)
+		copy(slot[inlineHeader:], val)
+		return slot, true
+	}
+
+	first, ok := writeOverflow(bpm, newPage, val)
+	if !ok {
+		return nil, false
+	}
+	slot := make([]byte, overflowHeader)
+	slot[0] = overflowTag
+	binary.LittleEndian.PutUint32(slot[1:], uint32(n))
+	binary.LittleEndian.PutUint32(slot[5:], uint32(first))
+	return slot, true
+}
+
+// writeOverflow 把 val 依次写入新分配的溢出页，返回第一个溢出页的页号
+// 前一页保持 Pin 住，直到分配到下一页、填上它的页号
+func writeOverflow(bpm *buffer.BufferPoolManager, newPage func() *page.Page, val []byte) (page.PageID, bool) {
+	var first page.PageID
+	var prev *page.BPlusTreePage
+	for len(val) > 0 {
+		p := newPage()
+		if p == nil {
+			if prev != nil {
+				bpm.UnpinPage(page.PageID(prev.GetPageID()), true)
+			}
+			freeOverflow(bpm, first)
+			return 0, false
+		}
+		node := page.NewBPlusTreePage(p)
+		node.Init(uint32(p.ID()), page.KindOverflow, 0)
+		n := copy(node.Data[page.HeaderSize:], val)
+		node.SetCount(int32(n))
+		val = val[n:]
+		if prev == nil {
+			first = p.ID()
+		} else {
+			prev.SetNextPageID(uint32(p.ID()))
+			bpm.UnpinPage(page.PageID(prev.GetPageID()), true)
+		}
+		prev = node
+	}
+	bpm.UnpinPage(page.PageID(prev.GetPageID()), true)
+	return first, true
+}
+
+// readValue 把槽位中的内容还原成写入时的值
+// 普通格式和 inlineTag 格式返回的切片引用 slot，溢出的值读入新分配的切片
+func readValue(bpm *buffer.BufferPoolManager, slot []byte) ([]byte, error) {
+	switch slot[0] {
+	case inlineTag:
+		n := int(slot[1])
+		if n > maxInlineValue {
+			return nil, corruptf("inline value claims %d bytes, a slot holds at most %d", n, maxInlineValue)
+		}
+		return slot[inlineHeader : inlineHeader+n], nil
+	case overflowTag:
+		val := make([]byte, 0, overflowLen(slot))
+		err := walkOverflow(bpm, slot, func(_ page.PageID, data []byte) {
+			val = append(val, data...)
+		})
+		return val, err
+	}
+	return bytes.TrimRight(slot, "\x00"), nil
+}
+
+// overflowPages 返回槽位引用的溢出页，值没有溢出时返回 nil
+func overflowPages(bpm *buffer.BufferPoolManager, slot []byte) ([]page.PageID, error) {
+	if slot[0] != overflowTag {
+		return nil, nil
+	}
+	var pages []page.PageID
+	err := walkOverflow(bpm, slot, func(pid page.PageID, _ []byte) {
+		pages = append(pages, pid)
+	})
+	return pages, err
+}
+
+// freeValue 释放槽位引用的溢出页，值没有溢出时不做任何事
+// slot 必须是槽位的拷贝或在槽位被覆盖之前调用
+func freeValue(bpm *buffer.BufferPoolManager, slot []byte) {
+	if len(slot) > 0 && slot[0] == overflowTag {
+		freeOverflow(bpm, overflowFirst(slot))
+	}
+}
+
+// freeOverflow 沿链表释放从 first 开始的溢出页
+// 链表损坏时只释放能读到的部分，剩下的页不再复用，只浪费空间
+func freeOverflow(bpm *buffer.BufferPoolManager, first page.PageID) {
+	var pages []page.PageID
+	seen := make(map[page.PageID]bool)
+	for pid := first; pid != 0 && !seen[pid]; {
+		raw, _ := fetchPage(bpm, pid)
+		if raw == nil {
+			break
+		}
+		node := page.NewBPlusTreePage(raw)
+		next, ok := page.PageID(node.GetNextPageID()), node.GetPageType() == page.KindOverflow
+		bpm.UnpinPage(pid, false)
+		if !ok {
+			break
+		}
+		seen[pid] = true
+		pages = append(pages, pid)
+		pid = next
+	}
+	for _, pid := range pages {
+		bpm.DeletePage(pid)
+	}
+}
+
+func overflowLen(slot []byte) int {
+	return int(binary.LittleEndian.Uint32(slot[1:]))
+}
+
+func overflowFirst(slot []byte) page.PageID {
+	return page.PageID(binary.LittleEndian.Uint32(slot[5:]))
+}
+
+// walkOverflow 按顺序对槽位引用的每个溢出页调用 visit，data 是本页存放的那一段，只在 visit 返回前有效
+// 每页至少存放一个字节，读满总长度就停下，所以链表成环也不会一直走下去
+func walkOverflow(bpm *buffer.BufferPoolManager, slot []byte, visit func(pid page.PageID, data []byte)) error {
+	total, pid := overflowLen(slot), overflowFirst(slot)
+	for read := 0; read < total; {
+		if pid == 0 {
+			return corruptf("overflow chain of %d bytes ends after %d bytes", total, read)
+		}
+		raw, err := fetchPage(bpm, pid)
+		if raw == nil {
+			return fetchFailed("overflow page", pid, err)
+		}
+		node := page.NewBPlusTreePage(raw)
+		n := int(node.GetCount())
+		if node.GetPageType() != page.KindOverflow || n <= 0 || n > len(node.Data)-page.HeaderSize || n > total-read {
+			bpm.UnpinPage(pid, false)
+			return corruptf("page %d is not a valid overflow page for a %d-byte value", pid, total)
+		}
+		visit(pid, node.Data[page.HeaderSize:page.HeaderSize+n])
+		next := page.PageID(node.GetNextPageID())
+		bpm.UnpinPage(pid, false)
+		read += n
+		pid = next
+	}
+	return nil
+}
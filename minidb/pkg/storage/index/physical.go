@@ -0,0 +1,43 @@
+package index
+
+import (
+	"slices"
+
+	"minidb/pkg/storage/page"
+)
+
+// ScanPhysical 按页号（也就是文件偏移）升序读取所有叶子，对每一行调用 fn，fn 返回 false 时停止
+// 叶子链表的顺序在随机插入后会在文件里来回跳，这里不管主键顺序，让磁盘读尽量是顺序的；
+// 结果的行序没有保证，只适合聚合、计数这类不关心顺序的查询。
+// value 通常直接引用被 Pin 住的页，只在 fn 返回前有效
+func (tree *BPlusTree) ScanPhysical(fn func(key int64, value []byte) bool) error {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	_, leaves, err := tree.collectPages()
+	if err != nil {
+		return err
+	}
+	slices.Sort(leaves)
+
+	for _, pid := range leaves {
+		raw, err := fetchPage(tree.bpm, pid)
+		if raw == nil {
+			return fetchFailed("page", pid, err)
+		}
+		node := page.NewBPlusTreePage(raw)
+		for i := int32(0); i < node.GetCount(); i++ {
+			value, err := readValue(tree.bpm, node.GetValueRef(i))
+			if err != nil {
+				tree.bpm.UnpinPage(pid, false)
+				return err
+			}
+			if !fn(node.GetKey(i), value) {
+				tree.bpm.UnpinPage(pid, false)
+				return nil
+			}
+		}
+		tree.bpm.UnpinPage(pid, false)
+	}
+	return nil
+}
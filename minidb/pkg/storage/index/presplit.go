@@ -0,0 +1,113 @@
+package index
+
+import (
+	"errors"
+	"math"
+
+	"minidb/pkg/storage/page"
+)
+
+// presplitEntry 是建树过程中某一层的一个节点：页号 + 该子树负责的最小 Key
+type presplitEntry struct {
+	pageID page.PageID
+	low    int64
+}
+
+// PreSplit 为空树预先建好叶子和内部节点：n 个分界点得到 n+1 个空叶子，
+// 第 i 个叶子负责 [boundaries[i-1], boundaries[i])
+// 之后的插入直接落到各自的叶子，不用从单个根叶子开始层层分裂，
+// 并发批量导入时不同的写者从一开始就写不同的叶子
+// 分界点必须严格递增；树中已有数据时返回错误
+func (tree *BPlusTree) PreSplit(boundaries []int64) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] <= boundaries[i-1] {
+			return errors.New("pre-split boundaries must be strictly increasing")
+		}
+	}
+
+	if tree.IsEmpty() {
+		tree.StartNewTree()
+	}
+	rootRaw := tree.fetchPage(tree.rootPageId)
+	if rootRaw == nil {
+		return errors.New("pre-split: failed to fetch root page")
+	}
+	root := page.NewBPlusTreePage(rootRaw)
+	if !root.IsLeaf() || root.GetCount() != 0 {
+		tree.bpm.UnpinPage(rootRaw.ID(), false)
+		return errors.New("pre-split requires an empty tree")
+	}
+	fanout := int(root.MaxDegree() - 1)
+	tree.bpm.UnpinPage(rootRaw.ID(), false)
+	if len(boundaries) == 0 {
+		return nil
+	}
+
+	// 1. 叶子层：原来的空根作为最左叶子，其余新建，按顺序串成链表
+	level := []presplitEntry{{pageID: tree.rootPageId, low: math.MinInt64}}
+	for _, b := range boundaries {
+		p := tree.newPage()
+		if p == nil {
+			return errors.New("pre-split: failed to allocate leaf page")
+		}
+		leaf := page.NewBPlusTreePage(p)
+		leaf.Init(uint32(p.ID()), page.KindLeaf, 0)
+		tree.bpm.UnpinPage(p.ID(), true)
+		level = append(level, presplitEntry{pageID: p.ID(), low: b})
+	}
+	for i := 0; i+1 < len(level); i++ {
+		if !tree.updateNode(level[i].pageID, func(n *page.BPlusTreePage) {
+			n.SetNextPageID(uint32(level[i+1].pageID))
+		}) {
+			return errors.New("pre-split: failed to link leaves")
+		}
+	}
+
+	// 2. 逐层向上建内部节点，每层尽量均匀地分组，直到只剩一个根
+	for len(level) > 1 {
+		groups := (len(level) + fanout - 1) / fanout
+		var parents []presplitEntry
+		for g := 0; g < groups; g++ {
+			children := level[g*len(level)/groups : (g+1)*len(level)/groups]
+
+			p := tree.newPage()
+			if p == nil {
+				return errors.New("pre-split: failed to allocate internal page")
+			}
+			node := page.NewBPlusTreePage(p)
+			node.Init(uint32(p.ID()), page.KindInternal, 0)
+			for i, c := range children {
+				node.SetKey(int32(i), c.low)
+				node.SetValueAsPageID(int32(i), uint32(c.pageID))
+			}
+			node.SetCount(int32(len(children)))
+			tree.bpm.UnpinPage(p.ID(), true)
+
+			for _, c := range children {
+				if !tree.updateNode(c.pageID, func(n *page.BPlusTreePage) {
+					n.SetParentID(uint32(p.ID()))
+				}) {
+					return errors.New("pre-split: failed to set parent")
+				}
+			}
+			parents = append(parents, presplitEntry{pageID: p.ID(), low: children[0].low})
+		}
+		level = parents
+	}
+	tree.rootPageId = level[0].pageID
+	return nil
+}
+
+// updateNode Pin 住节点执行 fn，然后标脏释放；页面取不到时返回 false
+func (tree *BPlusTree) updateNode(id page.PageID, fn func(*page.BPlusTreePage)) bool {
+	raw := tree.fetchPage(id)
+	if raw == nil {
+		return false
+	}
+	fn(page.NewBPlusTreePage(raw))
+	tree.bpm.UnpinPage(id, true)
+	return true
+}
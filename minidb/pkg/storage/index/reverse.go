@@ -0,0 +1,194 @@
+package index
+
+import (
+	"bytes"
+	"math"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/page"
+)
+
+// ReverseIterator 按 Key 从大到小遍历 B+ 树
+// 叶子链表只有向右的指针，所以迭代器记下从根到当前叶子经过的内部节点和孩子下标，
+// 读完一个叶子后沿这条路径回退到左边最近的子树，再下降到它最右边的叶子；
+// 路径上只记页号，内部节点不保持 Pin，调用方需要在遍历期间持有表的读锁
+type ReverseIterator struct {
+	tree     *BPlusTree
+	bpm      *buffer.BufferPoolManager
+	path     []reverseFrame      // 从根开始的内部节点，以及当前所在孩子的下标
+	currPage *page.BPlusTreePage // 当前被 Pin 住的叶子
+	currIdx  int32
+	lowKey   int64 // 下界（包含），越过后迭代结束
+
+	lastKey int64 // 已经返回的最小 Key，合法的树上后面的 Key 必须更小
+	hasLast bool
+	err     error
+}
+
+type reverseFrame struct {
+	id  page.PageID
+	idx int32
+}
+
+// ReverseScan 返回从大到小遍历 [low, high] 范围内 Key 的迭代器，范围为空时返回 nil
+func (tree *BPlusTree) ReverseScan(low, high int64) *ReverseIterator {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() || low > high {
+		return nil
+	}
+	it := &ReverseIterator{tree: tree, bpm: tree.bpm, lowKey: low}
+	if !it.descend(tree.rootPageId, high) {
+		tree.setErr(it.err)
+		return nil
+	}
+	// high 比所在叶子的 Key 都小（或叶子为空）：回退到左边的叶子
+	if it.currIdx < 0 && !it.Next() {
+		tree.setErr(it.err)
+		return nil
+	}
+	if !it.checkBound() {
+		return nil
+	}
+	return it
+}
+
+// descend 从 pid 往下走到 key 所在的叶子，停在最后一个 <= key 的槽位上，没有这样的槽位时 currIdx 为 -1
+func (it *ReverseIterator) descend(pid page.PageID, key int64) bool {
+	for {
+		if len(it.path) >= MaxTreeDepth {
+			it.err = it.tree.tooDeep(pid)
+			return false
+		}
+		raw, err := fetchPage(it.bpm, pid)
+		if raw == nil {
+			it.err = err
+			return false
+		}
+		node := page.NewBPlusTreePage(raw)
+		idx := node.GetCount() - 1
+		for idx >= 0 && node.GetKey(idx) > key {
+			idx--
+		}
+		if node.IsLeaf() {
+			it.currPage, it.currIdx = node, idx
+			return true
+		}
+		// key 比所有分隔 Key 都小时走第一个孩子，与 FindLeafPage 相同
+		idx = max(idx, 0)
+		child := page.PageID(node.GetValueAsPageID(idx))
+		it.bpm.UnpinPage(pid, false)
+		it.path = append(it.path, reverseFrame{id: pid, idx: idx})
+		pid = child
+	}
+}
+
+// prevLeaf 释放当前叶子，移到左边相邻的叶子的最后一个槽位，已经是最左边的叶子时返回 false
+func (it *ReverseIterator) prevLeaf() bool {
+	it.Close()
+	for len(it.path) > 0 {
+		top := &it.path[len(it.path)-1]
+		if top.idx == 0 {
+			it.path = it.path[:len(it.path)-1]
+			continue
+		}
+		top.idx--
+		raw, err := fetchPage(it.bpm, top.id)
+		if raw == nil {
+			it.err = err
+			return false
+		}
+		child := page.PageID(page.NewBPlusTreePage(raw).GetValueAsPageID(top.idx))
+		it.bpm.UnpinPage(top.id, false)
+		return it.descend(child, math.MaxInt64)
+	}
+	return false
+}
+
+// Key 返回当前游标位置的 Key
+func (it *ReverseIterator) Key() int64 {
+	if it.currPage == nil {
+		return -1
+	}
+	return it.currPage.GetKey(it.currIdx)
+}
+
+// Value 返回当前游标位置的 Value 的拷贝
+func (it *ReverseIterator) Value() []byte {
+	return bytes.Clone(it.ValueRef())
+}
+
+// ValueRef 返回当前 Value 的只读视图，与 TreeIterator.ValueRef 相同，只在下一次 Next 或 Close 之前有效
+func (it *ReverseIterator) ValueRef() []byte {
+	if it.currPage == nil {
+		return nil
+	}
+	val, err := readValue(it.bpm, it.currPage.GetValueRef(it.currIdx))
+	if err != nil {
+		it.err = err
+	}
+	return val
+}
+
+// PageID 返回当前行所在的叶子页号
+func (it *ReverseIterator) PageID() page.PageID {
+	if it.currPage == nil {
+		return page.InvalidPageID
+	}
+	return page.PageID(it.currPage.GetPageID())
+}
+
+// Slot 返回当前行在叶子页内的槽位下标
+func (it *ReverseIterator) Slot() int32 {
+	return it.currIdx
+}
+
+// Next 移到下一个更小的 Key，跳过空叶子；越过下界或走完整棵树时返回 false
+func (it *ReverseIterator) Next() bool {
+	if it.currPage == nil {
+		return false
+	}
+	if it.err != nil {
+		it.Close()
+		return false
+	}
+	if it.currIdx >= 0 {
+		it.lastKey, it.hasLast = it.Key(), true
+	}
+	it.currIdx--
+	for it.currIdx < 0 {
+		if !it.prevLeaf() {
+			it.Close()
+			return false
+		}
+	}
+	if it.hasLast && it.Key() >= it.lastKey {
+		it.err = corruptf("leaf %d holds key %d after key %d in reverse order", it.currPage.GetPageID(), it.Key(), it.lastKey)
+		it.Close()
+		return false
+	}
+	return it.checkBound()
+}
+
+// checkBound 当前 Key 小于下界时结束迭代并释放页面
+func (it *ReverseIterator) checkBound() bool {
+	if it.Key() < it.lowKey {
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// Err 返回迭代过程中发现的结构错误或页面校验和错误，Next 返回 false 后调用；正常走到末尾时为 nil
+func (it *ReverseIterator) Err() error {
+	return it.err
+}
+
+// Close 关闭迭代器
+func (it *ReverseIterator) Close() {
+	if it.currPage != nil {
+		it.bpm.UnpinPage(page.PageID(it.currPage.GetPageID()), false)
+		it.currPage = nil
+	}
+}
@@ -0,0 +1,82 @@
+package index
+
+import (
+	"minidb/pkg/storage/page"
+)
+
+// TreeStats 描述一棵 B+ 树的结构信息
+type TreeStats struct {
+	Height        int     // 树高（只有根叶子时为 1）
+	LeafPages     int     // 叶子节点数
+	InternalPages int     // 内部节点数
+	KeyCount      int64   // 叶子中的 Key 总数
+	FillFactor    float64 // 叶子平均填充率 (0~1)
+}
+
+// TotalPages 返回树占用的总页数
+func (s TreeStats) TotalPages() int {
+	return s.LeafPages + s.InternalPages
+}
+
+// MinPoolFrames 返回对高为 height 的树做插入时缓冲池至少需要的 Frame 数
+// 最坏情况下分裂一路传到根：每层同时 Pin 住原节点和新兄弟，再加上新根，
+// 以及内部节点分裂时逐个改写父指针的孩子页。少于这个数时插入会因为找不到可淘汰的 Frame 而失败
+func MinPoolFrames(height int) int {
+	return 2*max(height, 1) + 2
+}
+
+// Stats 遍历整棵树统计结构信息
+// 每次只 Pin 一个页面：先读出孩子列表再 Unpin，然后递归
+func (tree *BPlusTree) Stats() TreeStats {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	var stats TreeStats
+	if tree.IsEmpty() {
+		return stats
+	}
+
+	var leafCapacity int64
+	tree.collectStats(tree.rootPageId, 1, &stats, &leafCapacity)
+	if leafCapacity > 0 {
+		stats.FillFactor = float64(stats.KeyCount) / float64(leafCapacity)
+	}
+	return stats
+}
+
+func (tree *BPlusTree) collectStats(pageId page.PageID, depth int, stats *TreeStats, leafCapacity *int64) {
+	// 孩子指针成环时递归不会结束，超过最大层数就停下，错误由 Err 报告；
+	// 发现错误后其余分支也不再展开，否则环上每个节点的孩子都会被重复走一遍
+	if tree.Err() != nil || tree.descentTooDeep(depth, pageId) {
+		return
+	}
+	raw := tree.fetchPage(pageId)
+	if raw == nil {
+		return
+	}
+	node := page.NewBPlusTreePage(raw)
+
+	if depth > stats.Height {
+		stats.Height = depth
+	}
+
+	if node.IsLeaf() {
+		stats.LeafPages++
+		stats.KeyCount += int64(node.GetCount())
+		*leafCapacity += int64(node.MaxDegree() - 1)
+		tree.bpm.UnpinPage(pageId, false)
+		return
+	}
+
+	stats.InternalPages++
+	count := node.GetCount()
+	children := make([]page.PageID, 0, count)
+	for i := int32(0); i < count; i++ {
+		children = append(children, page.PageID(node.GetValueAsPageID(i)))
+	}
+	tree.bpm.UnpinPage(pageId, false)
+
+	for _, child := range children {
+		tree.collectStats(child, depth+1, stats, leafCapacity)
+	}
+}
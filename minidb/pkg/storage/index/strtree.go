@@ -0,0 +1,482 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/page"
+)
+
+// BPlusTreeStr 是以定长字符串为主键的 B+ 树，节点布局见 page.BPlusTreeStrPage，Key 按字节序排列
+// 结构与 BPlusTree 相同（分裂、父指针、叶子链表），目前只支持插入、覆盖、点查和顺序遍历，不支持删除
+type BPlusTreeStr struct {
+	bpm        *buffer.BufferPoolManager
+	rootPageId page.PageID
+	space      int // 新页分配到哪个表空间（数据文件）
+	mu         sync.RWMutex
+}
+
+func NewBPlusTreeStr(rootPageId page.PageID, bpm *buffer.BufferPoolManager) *BPlusTreeStr {
+	return &BPlusTreeStr{
+		rootPageId: rootPageId,
+		bpm:        bpm,
+	}
+}
+
+// SetTablespace 指定之后分裂、建根时新页所在的表空间，默认为 0
+func (tree *BPlusTreeStr) SetTablespace(space int) {
+	tree.space = space
+}
+
+// newPage 在树所属的表空间中分配新页
+func (tree *BPlusTreeStr) newPage() *page.Page {
+	return tree.bpm.NewPageIn(tree.space)
+}
+
+func (tree *BPlusTreeStr) GetRootPageId() page.PageID {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.rootPageId
+}
+
+func (tree *BPlusTreeStr) IsEmpty() bool {
+	return tree.rootPageId == page.InvalidPageID
+}
+
+func (tree *BPlusTreeStr) StartNewTree() {
+	p := tree.bpm.NewPageIn(tree.space)
+	if p == nil {
+		panic("failed to new page")
+	}
+	defer tree.bpm.UnpinPage(p.ID(), true)
+
+	root := page.NewBPlusTreeStrPage(p)
+	root.Init(uint32(p.ID()), page.KindLeaf, 0)
+	tree.rootPageId = p.ID()
+}
+
+// findLeafPage 从根下降到 key 所在的叶子，返回的页已被 Pin 住，调用方持有锁
+func (tree *BPlusTreeStr) findLeafPage(key []byte) *page.Page {
+	currPage := tree.bpm.FetchPage(tree.rootPageId)
+	if currPage == nil {
+		return nil
+	}
+	for depth := 1; ; depth++ {
+		node := page.NewBPlusTreeStrPage(currPage)
+		if node.IsLeaf() {
+			return currPage
+		}
+		if depth > MaxTreeDepth {
+			tree.bpm.UnpinPage(currPage.ID(), false)
+			return nil
+		}
+
+		// 最后一个 Key <= key 的孩子；key 比所有 Key 都小时走最左孩子
+		childPageId := node.GetValueAsPageID(0)
+		for i := node.GetCount() - 1; i > 0; i-- {
+			if node.CompareKey(i, key) <= 0 {
+				childPageId = node.GetValueAsPageID(i)
+				break
+			}
+		}
+		tree.bpm.UnpinPage(currPage.ID(), false)
+		if currPage = tree.bpm.FetchPage(page.PageID(childPageId)); currPage == nil {
+			return nil
+		}
+	}
+}
+
+// findSlot 在叶子中查找 key，找到时返回槽位下标
+func findSlot(leaf *page.BPlusTreeStrPage, key []byte) (int32, bool) {
+	for i := int32(0); i < leaf.GetCount(); i++ {
+		if leaf.CompareKey(i, key) == 0 {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (tree *BPlusTreeStr) GetValue(key string) ([]byte, bool) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if tree.IsEmpty() {
+		return nil, false
+	}
+
+	leafPage := tree.findLeafPage([]byte(key))
+	if leafPage == nil {
+		return nil, false
+	}
+	defer tree.bpm.UnpinPage(leafPage.ID(), false)
+
+	leaf := page.NewBPlusTreeStrPage(leafPage)
+	if i, ok := findSlot(leaf, []byte(key)); ok {
+		val, err := readValue(tree.bpm, leaf.GetValueRef(i))
+		return bytes.Clone(val), err == nil
+	}
+	return nil, false
+}
+
+// Update 原地覆盖已存在的 Key 的值，Key 不存在或分配溢出页失败时返回 false
+func (tree *BPlusTreeStr) Update(key string, val []byte) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.IsEmpty() {
+		return false
+	}
+
+	leafPage := tree.findLeafPage([]byte(key))
+	if leafPage == nil {
+		return false
+	}
+	leaf := page.NewBPlusTreeStrPage(leafPage)
+	i, ok := findSlot(leaf, []byte(key))
+	if !ok {
+		tree.bpm.UnpinPage(leafPage.ID(), false)
+		return false
+	}
+	slot, ok := encodeValue(tree.bpm, tree.newPage, val)
+	if !ok {
+		tree.bpm.UnpinPage(leafPage.ID(), false)
+		return false
+	}
+	old := leaf.GetValue(i)
+	leaf.SetValue(i, slot) // SetValue 先清空槽位，不会留下旧值的尾巴
+	tree.bpm.UnpinPage(leafPage.ID(), true)
+	freeValue(tree.bpm, old)
+	return true
+}
+
+// Insert 插入一对 Key/Value，Key 已存在或分配页面失败时返回 false
+// Key 超过 page.SizeOfStrKey 字节时会被截断，调用方应事先检查；长值的处理与 BPlusTree.Insert 相同
+func (tree *BPlusTreeStr) Insert(key string, val []byte) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	slot, ok := encodeValue(tree.bpm, tree.newPage, val)
+	if !ok {
+		return false
+	}
+	if !tree.insert(key, slot) {
+		freeValue(tree.bpm, slot)
+		return false
+	}
+	return true
+}
+
+// insert 把编码好的槽位内容插入叶子，调用方持有写锁
+func (tree *BPlusTreeStr) insert(key string, val []byte) bool {
+	if tree.IsEmpty() {
+		tree.StartNewTree()
+	}
+
+	leafPageRaw := tree.findLeafPage([]byte(key))
+	if leafPageRaw == nil {
+		return false
+	}
+	leafNode := page.NewBPlusTreeStrPage(leafPageRaw)
+	if _, exists := findSlot(leafNode, []byte(key)); exists {
+		tree.bpm.UnpinPage(leafPageRaw.ID(), false)
+		return false
+	}
+
+	if !leafNode.IsFull() {
+		leafNode.InsertLeaf(key, val)
+		tree.bpm.UnpinPage(leafPageRaw.ID(), true)
+		return true
+	}
+
+	newPageRaw := tree.bpm.NewPageIn(tree.space)
+	if newPageRaw == nil {
+		tree.bpm.UnpinPage(leafPageRaw.ID(), false)
+		return false
+	}
+	siblingNode := page.NewBPlusTreeStrPage(newPageRaw)
+	siblingNode.Init(uint32(newPageRaw.ID()), page.KindLeaf, leafNode.GetParentID())
+	siblingNode.SetNextPageID(leafNode.GetNextPageID())
+	leafNode.SetNextPageID(siblingNode.GetPageID())
+	leafNode.MoveHalfTo(siblingNode)
+
+	if siblingNode.CompareKey(0, []byte(key)) <= 0 {
+		siblingNode.InsertLeaf(key, val)
+	} else {
+		leafNode.InsertLeaf(key, val)
+	}
+	tree.insertIntoParent(leafNode, siblingNode.GetKey(0), siblingNode)
+
+	tree.bpm.UnpinPage(newPageRaw.ID(), true)
+	tree.bpm.UnpinPage(leafPageRaw.ID(), true)
+	return true
+}
+
+// insertIntoParent 把分裂出的 newNode 挂到 oldNode 的父节点上，父节点满了继续向上分裂，与 BPlusTree.InsertIntoParent 相同
+func (tree *BPlusTreeStr) insertIntoParent(oldNode *page.BPlusTreeStrPage, key string, newNode *page.BPlusTreeStrPage) {
+	if oldNode.GetPageID() == uint32(tree.rootPageId) {
+		newRootPageRaw := tree.bpm.NewPageIn(tree.space)
+		if newRootPageRaw == nil {
+			return
+		}
+		newRoot := page.NewBPlusTreeStrPage(newRootPageRaw)
+		newRoot.Init(uint32(newRootPageRaw.ID()), page.KindInternal, 0)
+
+		newRoot.SetCount(2)
+		newRoot.SetKey(0, oldNode.GetKey(0))
+		newRoot.SetValueAsPageID(0, oldNode.GetPageID())
+		newRoot.SetKey(1, key)
+		newRoot.SetValueAsPageID(1, newNode.GetPageID())
+
+		tree.rootPageId = newRootPageRaw.ID()
+		oldNode.SetParentID(newRoot.GetPageID())
+		newNode.SetParentID(newRoot.GetPageID())
+
+		tree.bpm.UnpinPage(newRootPageRaw.ID(), true)
+		return
+	}
+
+	parentPageRaw := tree.bpm.FetchPage(page.PageID(oldNode.GetParentID()))
+	if parentPageRaw == nil {
+		return
+	}
+	parentNode := page.NewBPlusTreeStrPage(parentPageRaw)
+
+	if parentNode.IsFull() {
+		newParentSiblingRaw := tree.bpm.NewPageIn(tree.space)
+		if newParentSiblingRaw == nil {
+			tree.bpm.UnpinPage(parentPageRaw.ID(), false)
+			return
+		}
+		parentSibling := page.NewBPlusTreeStrPage(newParentSiblingRaw)
+		parentSibling.Init(uint32(newParentSiblingRaw.ID()), page.KindInternal, parentNode.GetParentID())
+		parentNode.MoveHalfTo(parentSibling)
+
+		// 移过去的孩子改挂到新的父节点下
+		for i := int32(0); i < parentSibling.GetCount(); i++ {
+			childPageRaw := tree.bpm.FetchPage(page.PageID(parentSibling.GetValueAsPageID(i)))
+			if childPageRaw != nil {
+				page.NewBPlusTreeStrPage(childPageRaw).SetParentID(parentSibling.GetPageID())
+				tree.bpm.UnpinPage(childPageRaw.ID(), true)
+			}
+		}
+
+		targetNode := parentNode
+		if parentSibling.CompareKey(0, []byte(key)) <= 0 {
+			targetNode = parentSibling
+		}
+		insertStrInternal(targetNode, key, newNode.GetPageID())
+		newNode.SetParentID(targetNode.GetPageID())
+
+		tree.insertIntoParent(parentNode, parentSibling.GetKey(0), parentSibling)
+		tree.bpm.UnpinPage(newParentSiblingRaw.ID(), true)
+	} else {
+		insertStrInternal(parentNode, key, newNode.GetPageID())
+	}
+	tree.bpm.UnpinPage(parentPageRaw.ID(), true)
+}
+
+// insertStrInternal 在内部节点中按顺序插入一个孩子指针
+// Key[0] 只是最左孩子的下界，新分裂出的孩子总在某个孩子右侧，从 1 开始比较
+func insertStrInternal(node *page.BPlusTreeStrPage, key string, pageID uint32) {
+	count := node.GetCount()
+	insertIdx := count
+	for i := int32(1); i < count; i++ {
+		if node.CompareKey(i, []byte(key)) > 0 {
+			insertIdx = i
+			break
+		}
+	}
+
+	for i := count; i > insertIdx; i-- {
+		node.SetKey(i, node.GetKey(i-1))
+		node.SetValueAsPageID(i, node.GetValueAsPageID(i-1))
+	}
+	node.SetKey(insertIdx, key)
+	node.SetValueAsPageID(insertIdx, pageID)
+	node.SetCount(count + 1)
+}
+
+// Begin 返回从最小的 Key 开始的迭代器，树为空时返回 nil
+func (tree *BPlusTreeStr) Begin() *StrTreeIterator {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() {
+		return nil
+	}
+	pageRaw := tree.bpm.FetchPage(tree.rootPageId)
+	for depth := 1; pageRaw != nil; depth++ {
+		node := page.NewBPlusTreeStrPage(pageRaw)
+		if node.IsLeaf() {
+			it := &StrTreeIterator{bpm: tree.bpm, currPage: node, currIdx: -1}
+			if !it.Next() {
+				return nil
+			}
+			return it
+		}
+		childId := page.PageID(node.GetValueAsPageID(0))
+		tree.bpm.UnpinPage(pageRaw.ID(), false)
+		if depth > MaxTreeDepth {
+			return nil
+		}
+		pageRaw = tree.bpm.FetchPage(childId)
+	}
+	return nil
+}
+
+// Seek 返回从第一个 >= key 的 Key 开始的迭代器，没有这样的 Key 时返回 nil
+func (tree *BPlusTreeStr) Seek(key string) *StrTreeIterator {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() {
+		return nil
+	}
+	leafPage := tree.findLeafPage([]byte(key))
+	if leafPage == nil {
+		return nil
+	}
+	leaf := page.NewBPlusTreeStrPage(leafPage)
+	idx := leaf.GetCount()
+	for i := int32(0); i < leaf.GetCount(); i++ {
+		if leaf.CompareKey(i, []byte(key)) >= 0 {
+			idx = i
+			break
+		}
+	}
+	// 停在目标槽位之前，由 Next 前进过去；key 比叶子中所有 Key 都大时 Next 会走到下一个叶子
+	it := &StrTreeIterator{bpm: tree.bpm, currPage: leaf, currIdx: idx - 1}
+	if !it.Next() {
+		return nil
+	}
+	return it
+}
+
+// Pages 按层返回树的全部页号，包括长值的溢出页
+func (tree *BPlusTreeStr) Pages() ([]page.PageID, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() {
+		return nil, nil
+	}
+	var pages []page.PageID
+	level := []page.PageID{tree.rootPageId}
+	seen := map[page.PageID]bool{tree.rootPageId: true}
+	for depth := 1; len(level) > 0; depth++ {
+		if depth > MaxTreeDepth {
+			return nil, corruptf("descent from root %d went below depth %d", tree.rootPageId, MaxTreeDepth)
+		}
+		var next []page.PageID
+		for _, pid := range level {
+			raw := tree.bpm.FetchPage(pid)
+			if raw == nil {
+				return nil, fmt.Errorf("page %d: fetch failed", pid)
+			}
+			node := page.NewBPlusTreeStrPage(raw)
+			for i := int32(0); i < node.GetCount(); i++ {
+				if node.IsLeaf() {
+					// 叶子里只有长值的溢出页
+					overflow, err := overflowPages(tree.bpm, node.GetValueRef(i))
+					if err != nil {
+						tree.bpm.UnpinPage(pid, false)
+						return nil, err
+					}
+					pages = append(pages, overflow...)
+					continue
+				}
+				child := page.PageID(node.GetValueAsPageID(i))
+				if seen[child] {
+					tree.bpm.UnpinPage(pid, false)
+					return nil, corruptf("page %d referenced twice", child)
+				}
+				seen[child] = true
+				next = append(next, child)
+			}
+			tree.bpm.UnpinPage(pid, false)
+		}
+		pages = append(pages, level...)
+		level = next
+	}
+	return pages, nil
+}
+
+// StrTreeIterator 沿叶子链表遍历 BPlusTreeStr，用法与 TreeIterator 相同
+type StrTreeIterator struct {
+	bpm      *buffer.BufferPoolManager
+	currPage *page.BPlusTreeStrPage // 当前被 Pin 住的页
+	currIdx  int32
+	lastKey  string // 上一个叶子的最后一个 Key，用于发现叶子链表成环
+	err      error
+}
+
+func (it *StrTreeIterator) Key() string {
+	return it.currPage.GetKey(it.currIdx)
+}
+
+// Value 返回当前 Value 的拷贝，溢出页损坏时返回 nil，错误见 Err，下一次 Next 返回 false
+func (it *StrTreeIterator) Value() []byte {
+	val, err := readValue(it.bpm, it.currPage.GetValueRef(it.currIdx))
+	if err != nil {
+		it.err = err
+	}
+	return bytes.Clone(val)
+}
+
+// PageID 返回当前行所在的叶子页号
+func (it *StrTreeIterator) PageID() page.PageID {
+	return page.PageID(it.currPage.GetPageID())
+}
+
+// Slot 返回当前行在叶子页内的槽位下标
+func (it *StrTreeIterator) Slot() int32 {
+	return it.currIdx
+}
+
+// Next 前进到下一个 Key，跳过空叶子；走到末尾或发现叶子链表损坏时返回 false，后者见 Err
+func (it *StrTreeIterator) Next() bool {
+	if it.currPage == nil {
+		return false
+	}
+	if it.err != nil {
+		it.Close()
+		return false
+	}
+	it.currIdx++
+	for it.currIdx >= it.currPage.GetCount() {
+		if n := it.currPage.GetCount(); n > 0 {
+			it.lastKey = it.currPage.GetKey(n - 1)
+		}
+		nextPageId := it.currPage.GetNextPageID()
+		it.Close()
+		if nextPageId == 0 {
+			return false
+		}
+		rawPage, err := fetchPage(it.bpm, page.PageID(nextPageId))
+		if rawPage == nil {
+			it.err = err
+			return false
+		}
+		it.currPage = page.NewBPlusTreeStrPage(rawPage)
+		it.currIdx = 0
+		if it.lastKey != "" && it.currPage.GetCount() > 0 && it.currPage.GetKey(0) <= it.lastKey {
+			it.err = corruptf("leaf %d follows a leaf ending at key %q but starts at key %q",
+				it.currPage.GetPageID(), it.lastKey, it.currPage.GetKey(0))
+			it.Close()
+			return false
+		}
+	}
+	return true
+}
+
+// Err 返回迭代过程中发现的结构错误或页面校验和错误，Next 返回 false 后调用；正常走到末尾时为 nil
+func (it *StrTreeIterator) Err() error {
+	return it.err
+}
+
+func (it *StrTreeIterator) Close() {
+	if it.currPage != nil {
+		it.bpm.UnpinPage(page.PageID(it.currPage.GetPageID()), false)
+		it.currPage = nil
+	}
+}
@@ -0,0 +1,84 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"minidb/pkg/buffer"
+	"minidb/pkg/storage/disk"
+	"minidb/pkg/storage/page"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPlusTreeStr(t *testing.T) {
+	file := "test_strtree.db"
+	_ = os.Remove(file)
+	defer os.Remove(file)
+
+	dm, err := disk.NewDiskManager(file)
+	assert.Nil(t, err)
+	bpm := buffer.NewBufferPoolManager(dm, 50)
+	tree := NewBPlusTreeStr(page.InvalidPageID, bpm)
+	assert.Nil(t, tree.Begin(), "empty tree")
+
+	// 乱序插入足够多的 Key，让内部节点也发生分裂；长度不同的 Key 检验补 0 之后的顺序
+	var keys []string
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, fmt.Sprintf("user%d", i))
+	}
+	keys = append(keys, "a", "ab", "abc", "b")
+	rand.New(rand.NewSource(1)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for _, k := range keys {
+		assert.True(t, tree.Insert(k, []byte("v-"+k)), "insert %s", k)
+	}
+	assert.False(t, tree.Insert("user7", []byte("dup")), "duplicate key")
+
+	for _, k := range keys {
+		v, ok := tree.GetValue(k)
+		assert.True(t, ok, "get %s", k)
+		assert.Equal(t, "v-"+k, string(v))
+	}
+	_, ok := tree.GetValue("user")
+	assert.False(t, ok)
+
+	assert.True(t, tree.Update("abc", []byte("x")))
+	v, _ := tree.GetValue("abc")
+	assert.Equal(t, "x", string(v))
+	assert.False(t, tree.Update("missing", []byte("x")))
+	assert.True(t, tree.Update("ab", []byte("ab\x00")))
+	v, _ = tree.GetValue("ab")
+	assert.Equal(t, "ab\x00", string(v), "trailing zero byte must be kept")
+
+	slices.Sort(keys)
+	var got []string
+	for it := tree.Begin(); ; {
+		got = append(got, it.Key())
+		if !it.Next() {
+			assert.Nil(t, it.Err())
+			break
+		}
+	}
+	assert.Equal(t, keys, got)
+
+	// Seek 停在第一个 >= key 的 Key，可以跨叶子；比所有 Key 都大时返回 nil
+	for _, c := range []struct{ seek, want string }{
+		{"", "a"}, {"ab", "ab"}, {"abd", "b"}, {"user10", "user10"}, {"user1000a", "user1001"}, {"user999", "user999"},
+	} {
+		it := tree.Seek(c.seek)
+		if assert.NotNil(t, it, "seek %q", c.seek) {
+			assert.Equal(t, c.want, it.Key(), "seek %q", c.seek)
+			it.Close()
+		}
+	}
+	assert.Nil(t, tree.Seek("zzz"))
+
+	pages, err := tree.Pages()
+	assert.Nil(t, err)
+	assert.Greater(t, len(pages), 2000/int(page.MaxStrDegreeFor(page.PageSize)))
+	for _, f := range bpm.Frames() {
+		assert.Zero(t, f.PinCount, "page %d is still pinned", f.PageID)
+	}
+}
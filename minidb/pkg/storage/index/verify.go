@@ -0,0 +1,113 @@
+package index
+
+import (
+	"fmt"
+
+	"minidb/pkg/storage/page"
+)
+
+// Verify 检查树的结构是否合法，返回发现的第一个问题：
+// 节点内 Key 严格递增、子树的 Key 落在父节点分隔 Key 划定的范围内、
+// 父指针正确、所有叶子深度相同，以及叶子链表与树的中序一致
+// 内部节点的 Key[0] 只是最左孩子的下界（可能已过期），不参与检查
+func (tree *BPlusTree) Verify() error {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() {
+		return nil
+	}
+	v := &treeVerifier{tree: tree, leafDepth: -1}
+	if err := v.visit(tree.rootPageId, 0, 0, nil, nil); err != nil {
+		return err
+	}
+
+	// 叶子链表必须按中序依次串起所有叶子
+	for i, id := range v.leaves {
+		raw, err := fetchPage(tree.bpm, id)
+		if raw == nil {
+			return fetchFailed("leaf", id, err)
+		}
+		next := page.PageID(page.NewBPlusTreePage(raw).GetNextPageID())
+		tree.bpm.UnpinPage(id, false)
+
+		want := page.PageID(0)
+		if i+1 < len(v.leaves) {
+			want = v.leaves[i+1]
+		}
+		if next != want {
+			return fmt.Errorf("leaf %d: next pointer is %d, want %d", id, next, want)
+		}
+	}
+	return nil
+}
+
+type treeVerifier struct {
+	tree      *BPlusTree
+	leafDepth int
+	leaves    []page.PageID // 按中序收集的叶子
+}
+
+// visit 检查以 id 为根的子树，子树中的 Key 必须在 [low, high) 内，nil 表示不限
+func (v *treeVerifier) visit(id page.PageID, parent page.PageID, depth int, low, high *int64) error {
+	if depth >= MaxTreeDepth {
+		return v.tree.tooDeep(id)
+	}
+	raw, err := fetchPage(v.tree.bpm, id)
+	if raw == nil {
+		return fetchFailed("page", id, err)
+	}
+	defer v.tree.bpm.UnpinPage(id, false)
+	node := page.NewBPlusTreePage(raw)
+
+	if id != v.tree.rootPageId && page.PageID(node.GetParentID()) != parent {
+		return fmt.Errorf("page %d: parent is %d, want %d", id, node.GetParentID(), parent)
+	}
+	count := node.GetCount()
+
+	if node.IsLeaf() {
+		if v.leafDepth == -1 {
+			v.leafDepth = depth
+		} else if depth != v.leafDepth {
+			return fmt.Errorf("leaf %d at depth %d, other leaves at depth %d", id, depth, v.leafDepth)
+		}
+		for i := int32(0); i < count; i++ {
+			key := node.GetKey(i)
+			if i > 0 && key <= node.GetKey(i-1) {
+				return fmt.Errorf("leaf %d: keys out of order at slot %d", id, i)
+			}
+			if (low != nil && key < *low) || (high != nil && key >= *high) {
+				return fmt.Errorf("leaf %d: key %d outside its parent's range", id, key)
+			}
+		}
+		v.leaves = append(v.leaves, id)
+		return nil
+	}
+
+	if count == 0 {
+		return fmt.Errorf("internal page %d has no children", id)
+	}
+	for i := int32(2); i < count; i++ {
+		if node.GetKey(i) <= node.GetKey(i-1) {
+			return fmt.Errorf("internal page %d: separators out of order at slot %d", id, i)
+		}
+	}
+	for i := int32(0); i < count; i++ {
+		childLow, childHigh := low, high
+		if i > 0 {
+			k := node.GetKey(i)
+			if (low != nil && k < *low) || (high != nil && k >= *high) {
+				return fmt.Errorf("internal page %d: separator %d outside its parent's range", id, k)
+			}
+			childLow = &k
+		}
+		if i+1 < count {
+			k := node.GetKey(i + 1)
+			childHigh = &k
+		}
+		if err := v.visit(page.PageID(node.GetValueAsPageID(i)), id, depth+1, childLow, childHigh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
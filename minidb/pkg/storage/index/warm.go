@@ -0,0 +1,125 @@
+package index
+
+import "minidb/pkg/storage/page"
+
+// Warm 按层（广度优先）把树的前 maxDepth 层读入缓冲池，最多读 maxPages 页
+// 页面读入后立即 Unpin，仍留在缓冲池中直到被 LRU 淘汰；返回读入的页数
+func (tree *BPlusTree) Warm(maxDepth int, maxPages int) int {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.IsEmpty() || maxDepth <= 0 || maxPages <= 0 {
+		return 0
+	}
+
+	loaded := 0
+	level := []page.PageID{tree.rootPageId}
+	for depth := 1; depth <= maxDepth && len(level) > 0; depth++ {
+		var next []page.PageID
+		for _, pid := range level {
+			if loaded >= maxPages {
+				return loaded
+			}
+			raw := tree.fetchPage(pid)
+			if raw == nil {
+				return loaded
+			}
+			loaded++
+
+			node := page.NewBPlusTreePage(raw)
+			if !node.IsLeaf() && depth < maxDepth {
+				for i := int32(0); i < node.GetCount(); i++ {
+					next = append(next, page.PageID(node.GetValueAsPageID(i)))
+				}
+			}
+			tree.bpm.UnpinPage(pid, false)
+		}
+		level = next
+	}
+	return loaded
+}
+
+// Pages 返回树占用的所有页号（内部节点、叶子和长值的溢出页）
+// 叶子的页号从父节点的孩子指针得到；溢出页的页号记在叶子的槽位里，所以每个叶子都要读一遍，一次只 Pin 住一页
+func (tree *BPlusTree) Pages() ([]page.PageID, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	internal, leaves, err := tree.collectPages()
+	if err != nil {
+		return nil, err
+	}
+	pages := append(internal, leaves...)
+	for _, pid := range leaves {
+		raw, err := fetchPage(tree.bpm, pid)
+		if raw == nil {
+			return nil, fetchFailed("page", pid, err)
+		}
+		node := page.NewBPlusTreePage(raw)
+		for i := int32(0); i < node.GetCount() && err == nil; i++ {
+			var overflow []page.PageID
+			overflow, err = overflowPages(tree.bpm, node.GetValueRef(i))
+			pages = append(pages, overflow...)
+		}
+		tree.bpm.UnpinPage(pid, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// collectPages 按层遍历内部节点，分别返回内部节点和叶子的页号，调用方持有读锁
+func (tree *BPlusTree) collectPages() (internal, leaves []page.PageID, err error) {
+	if tree.IsEmpty() {
+		return nil, nil, nil
+	}
+
+	// 所有叶子深度相同，先沿最左路径求出树高
+	height := 0
+	for pid := tree.rootPageId; ; {
+		raw, err := fetchPage(tree.bpm, pid)
+		if raw == nil {
+			return nil, nil, fetchFailed("page", pid, err)
+		}
+		node := page.NewBPlusTreePage(raw)
+		height++
+		if height > MaxTreeDepth {
+			tree.bpm.UnpinPage(pid, false)
+			return nil, nil, tree.tooDeep(pid)
+		}
+		leaf := node.IsLeaf()
+		next := page.PageID(node.GetValueAsPageID(0))
+		tree.bpm.UnpinPage(pid, false)
+		if leaf {
+			break
+		}
+		pid = next
+	}
+
+	level := []page.PageID{tree.rootPageId}
+	seen := map[page.PageID]bool{tree.rootPageId: true}
+	for depth := 1; depth < height; depth++ {
+		internal = append(internal, level...)
+		var next []page.PageID
+		for _, pid := range level {
+			raw, err := fetchPage(tree.bpm, pid)
+			if raw == nil {
+				return nil, nil, fetchFailed("page", pid, err)
+			}
+			node := page.NewBPlusTreePage(raw)
+			for i := int32(0); i < node.GetCount(); i++ {
+				child := page.PageID(node.GetValueAsPageID(i))
+				if seen[child] {
+					tree.bpm.UnpinPage(pid, false)
+					return nil, nil, corruptf("page %d is a child of more than one node", child)
+				}
+				seen[child] = true
+				next = append(next, child)
+			}
+			tree.bpm.UnpinPage(pid, false)
+		}
+		level = next
+	}
+	return internal, level, nil
+}
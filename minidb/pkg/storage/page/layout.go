@@ -15,17 +15,23 @@ const (
 	OffsetPageType   = 8
 	OffsetCount      = 12
 	OffsetNextPageID = 16
-	OffsetMaxCount   = 20
+	OffsetChecksum   = 20 // 整页的 CRC32，由 DiskManager 在写盘时填写、读盘时校验，B+ 树不使用
 
-	HeaderSize = 24
+	SizeOfChecksum = 4
 
-	// MaxDegree 28 fits safely in 4096 bytes (24 header + 28*136 = 3832)
-	MaxDegree = 29
+	HeaderSize = 24
 )
 
+// MaxDegreeFor 根据页大小计算节点的最大度数
+// 以叶子槽位 (8 key + 128 val) 为准，例如 4096 字节页: (4096-24)/136 = 29
+func MaxDegreeFor(pageSize int) int32 {
+	return int32((pageSize - HeaderSize) / (SizeOfInt64 + SizeOfVal))
+}
+
 const (
 	KindInternal = 1
 	KindLeaf     = 2
+	KindOverflow = 3 // 存放放不进叶子槽位的长值，见 index/overflow.go
 )
 
 type BPlusTreePage struct {
@@ -33,7 +39,7 @@ type BPlusTreePage struct {
 }
 
 func NewBPlusTreePage(p *Page) *BPlusTreePage {
-	return &BPlusTreePage{Data: p.Data[:]}
+	return &BPlusTreePage{Data: p.Bytes()}
 }
 
 func (p *BPlusTreePage) Init(pageID uint32, pageType uint32, parentID uint32) {
@@ -112,9 +118,18 @@ func (p *BPlusTreePage) GetValue(index int32) []byte {
 	return val
 }
 
+// GetValueRef 返回直接指向页缓冲区的 Value 切片，不做拷贝
+// 只在页面被 Pin 住期间有效，调用者不得修改或长期持有
+func (p *BPlusTreePage) GetValueRef(index int32) []byte {
+	offset := p.getPairOffset(index) + SizeOfInt64
+	return p.Data[offset : offset+SizeOfVal : offset+SizeOfVal]
+}
+
 func (p *BPlusTreePage) SetValue(index int32, val []byte) {
 	offset := p.getPairOffset(index) + SizeOfInt64
-	copy(p.Data[offset:offset+SizeOfVal], val)
+	slot := p.Data[offset : offset+SizeOfVal]
+	clear(slot)
+	copy(slot, val)
 }
 
 func (p *BPlusTreePage) GetValueAsPageID(index int32) uint32 {
@@ -127,8 +142,13 @@ func (node *BPlusTreePage) SetValueAsPageID(index int32, pageID uint32) {
 	binary.LittleEndian.PutUint32(node.Data[offset:], pageID)
 }
 
+// MaxDegree 返回当前页大小下节点的最大度数
+func (node *BPlusTreePage) MaxDegree() int32 {
+	return MaxDegreeFor(len(node.Data))
+}
+
 func (node *BPlusTreePage) IsFull() bool {
-	return node.GetCount() >= int32(MaxDegree-1)
+	return node.GetCount() >= node.MaxDegree()-1
 }
 
 func (node *BPlusTreePage) InsertLeaf(key int64, val []byte) bool {
@@ -173,10 +193,10 @@ func (node *BPlusTreePage) MoveHalfTo(recipient *BPlusTreePage) {
 
 func (p *BPlusTreePage) MinDegree() int32 {
 	if p.IsLeaf() {
-		return int32(MaxDegree) / 2
+		return p.MaxDegree() / 2
 	}
 	// 内部节点最少需要保留 MaxDegree/2 个指针
-	return int32(MaxDegree+1) / 2
+	return (p.MaxDegree() + 1) / 2
 }
 
 // Remove 删除指定 index 的元素
@@ -204,10 +224,6 @@ func (p *BPlusTreePage) MoveAllTo(recipient *BPlusTreePage, middleKey int64) {
 	startIdx := recipient.GetCount()
 	count := p.GetCount()
 
-	// 内部节点合并时，需要先把父节点的分割 Key 拉下来放在中间
-	// 这是一个简化处理，我们假设在 BPlusTree 层处理具体的 Key 逻辑，
-	// 这里只负责物理搬运。
-
 	for i := int32(0); i < count; i++ {
 		recipient.SetKey(startIdx+i, p.GetKey(i))
 		if p.IsLeaf() {
@@ -217,6 +233,11 @@ func (p *BPlusTreePage) MoveAllTo(recipient *BPlusTreePage, middleKey int64) {
 		}
 	}
 
+	// 内部节点合并时，把父节点的分割 Key 拉下来作为第一个孩子的下界
+	if !p.IsLeaf() && count > 0 {
+		recipient.SetKey(startIdx, middleKey)
+	}
+
 	recipient.SetCount(startIdx + count)
 	p.SetCount(0)
 }
@@ -7,7 +7,7 @@ import (
 
 func TestPageLayout(t *testing.T) {
 	// 1. 创建一个原始的 Page
-	rawPage := &Page{}
+	rawPage := NewPage(PageSize)
 	
 	// 2. 包装成 BPlusTreePage
 	node := NewBPlusTreePage(rawPage)
@@ -1,9 +1,18 @@
 package page
 
-// PageSize 定义一页的大小为 4KB (4096 bytes)
+import "sync"
+
+// PageSize 定义默认的页大小为 4KB (4096 bytes)
 // 这是一个非常标准的数据库页大小，通常和操作系统的内存页大小一致
+// 每个数据库可以在创建时选择其他页大小（见 MinPageSize / MaxPageSize）
 const PageSize = 4096
 
+// 允许的页大小范围，页大小必须是 2 的幂
+const (
+	MinPageSize = 4096
+	MaxPageSize = 16384
+)
+
 // PageID 是页面的唯一标识符
 // 使用 int32 是为了方便计算，且 -1 可以用来表示无效页
 type PageID int32
@@ -11,12 +20,27 @@ type PageID int32
 const (
 	InvalidPageID PageID = -1
 )
+
+// ValidPageSize 检查页大小是否合法
+func ValidPageSize(size int) bool {
+	return size >= MinPageSize && size <= MaxPageSize && size&(size-1) == 0
+}
+
 // Page 结构体代表内存中的一个缓冲页
 type Page struct {
 	id       PageID
 	pinCount int32
 	isDirty  bool
-	Data     [PageSize]byte // 实际存储数据的字节数组
+	Data     []byte // 实际存储数据的字节数组，长度就是数据库的页大小
+
+	// latch 保护 Data 的内容，由 B+ 树在并发的点查和叶子内写入之间使用（见 index 包的 InsertInLeaf）；
+	// 与 pinCount 无关：缓冲池只保证 Pin 住的页不被换出，不管谁在读写页的内容
+	latch sync.RWMutex
+}
+
+// NewPage 创建一个指定页大小的内存页，只分配 size 字节，不按 MaxPageSize 分配
+func NewPage(size int) *Page {
+	return &Page{Data: make([]byte, size)}
 }
 
 // 下面是一些 Helper 方法，方便后续 Buffer Pool 使用
@@ -29,6 +53,16 @@ func (p *Page) SetID(id PageID) {
 	p.id = id
 }
 
+// Size 返回该页的大小
+func (p *Page) Size() int {
+	return len(p.Data)
+}
+
+// Bytes 返回页数据切片（即 Data 本身）
+func (p *Page) Bytes() []byte {
+	return p.Data
+}
+
 func (p *Page) PinCount() int32 {
 	return p.pinCount
 }
@@ -45,8 +79,19 @@ func (p *Page) SetDirty(dirty bool) {
 	p.isDirty = dirty
 }
 
+// RLatch 加读闩，可以与其他读闩共存
+func (p *Page) RLatch() { p.latch.RLock() }
+
+// RUnlatch 释放读闩
+func (p *Page) RUnlatch() { p.latch.RUnlock() }
+
+// WLatch 加写闩，与所有其他闩互斥
+func (p *Page) WLatch() { p.latch.Lock() }
+
+// WUnlatch 释放写闩
+func (p *Page) WUnlatch() { p.latch.Unlock() }
+
 // Clear 将页面数据清空（通常在重用页面时调用）
 func (p *Page) Clear() {
-    // 这种写法比循环赋值更快
-	p.Data = [PageSize]byte{}
-}
\ No newline at end of file
+	clear(p.Data)
+}
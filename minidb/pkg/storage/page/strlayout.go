@@ -0,0 +1,160 @@
+package page
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SizeOfStrKey 是字符串主键的定长槽位，不足的部分补 0，所以 Key 中不能含有 0 字节
+// 补 0 不影响顺序：较短的 Key 在补齐的位置上是 0，比任何实际字符都小，按字节比较的结果与比较原串相同
+const SizeOfStrKey = 32
+
+// MaxStrDegreeFor 根据页大小计算字符串主键节点的最大度数
+// 以叶子槽位 (32 key + 128 val) 为准，例如 4096 字节页: (4096-24)/160 = 25
+func MaxStrDegreeFor(pageSize int) int32 {
+	return int32((pageSize - HeaderSize) / (SizeOfStrKey + SizeOfVal))
+}
+
+// BPlusTreeStrPage 是字符串主键的 B+ 树节点，页头与 BPlusTreePage 相同，槽位中的 Key 为 SizeOfStrKey 字节
+type BPlusTreeStrPage struct {
+	Data []byte
+}
+
+func NewBPlusTreeStrPage(p *Page) *BPlusTreeStrPage {
+	return &BPlusTreeStrPage{Data: p.Bytes()}
+}
+
+// header 复用 BPlusTreePage 的页头读写
+func (p *BPlusTreeStrPage) header() *BPlusTreePage {
+	return &BPlusTreePage{Data: p.Data}
+}
+
+func (p *BPlusTreeStrPage) Init(pageID uint32, pageType uint32, parentID uint32) {
+	p.header().Init(pageID, pageType, parentID)
+}
+
+func (p *BPlusTreeStrPage) GetPageID() uint32       { return p.header().GetPageID() }
+func (p *BPlusTreeStrPage) GetParentID() uint32     { return p.header().GetParentID() }
+func (p *BPlusTreeStrPage) SetParentID(id uint32)   { p.header().SetParentID(id) }
+func (p *BPlusTreeStrPage) GetPageType() uint32     { return p.header().GetPageType() }
+func (p *BPlusTreeStrPage) GetCount() int32         { return p.header().GetCount() }
+func (p *BPlusTreeStrPage) SetCount(count int32)    { p.header().SetCount(count) }
+func (p *BPlusTreeStrPage) GetNextPageID() uint32   { return p.header().GetNextPageID() }
+func (p *BPlusTreeStrPage) SetNextPageID(id uint32) { p.header().SetNextPageID(id) }
+func (p *BPlusTreeStrPage) IsLeaf() bool            { return p.header().IsLeaf() }
+
+func (p *BPlusTreeStrPage) getKeyOffset(index int32) int {
+	slotSize := SizeOfStrKey + SizeOfVal
+	if !p.IsLeaf() {
+		slotSize = SizeOfStrKey + SizeOfPageID
+	}
+	return HeaderSize + int(index)*slotSize
+}
+
+// keyRef 返回 Key 去掉补齐的 0 之后的字节，直接引用页缓冲区
+func (p *BPlusTreeStrPage) keyRef(index int32) []byte {
+	offset := p.getKeyOffset(index)
+	return bytes.TrimRight(p.Data[offset:offset+SizeOfStrKey], "\x00")
+}
+
+func (p *BPlusTreeStrPage) GetKey(index int32) string {
+	return string(p.keyRef(index))
+}
+
+// SetKey 写入 Key，超过 SizeOfStrKey 的部分被截断，调用方应事先检查长度
+func (p *BPlusTreeStrPage) SetKey(index int32, key string) {
+	offset := p.getKeyOffset(index)
+	slot := p.Data[offset : offset+SizeOfStrKey]
+	clear(slot)
+	copy(slot, key)
+}
+
+// CompareKey 按字节比较槽位 index 的 Key 与 key，返回 -1、0 或 1
+func (p *BPlusTreeStrPage) CompareKey(index int32, key []byte) int {
+	return bytes.Compare(p.keyRef(index), key)
+}
+
+func (p *BPlusTreeStrPage) GetValue(index int32) []byte {
+	offset := p.getKeyOffset(index) + SizeOfStrKey
+	val := make([]byte, SizeOfVal)
+	copy(val, p.Data[offset:offset+SizeOfVal])
+	return val
+}
+
+// GetValueRef 返回直接指向页缓冲区的 Value 切片，与 BPlusTreePage.GetValueRef 相同
+func (p *BPlusTreeStrPage) GetValueRef(index int32) []byte {
+	offset := p.getKeyOffset(index) + SizeOfStrKey
+	return p.Data[offset : offset+SizeOfVal : offset+SizeOfVal]
+}
+
+func (p *BPlusTreeStrPage) SetValue(index int32, val []byte) {
+	offset := p.getKeyOffset(index) + SizeOfStrKey
+	slot := p.Data[offset : offset+SizeOfVal]
+	clear(slot)
+	copy(slot, val)
+}
+
+func (p *BPlusTreeStrPage) GetValueAsPageID(index int32) uint32 {
+	offset := p.getKeyOffset(index) + SizeOfStrKey
+	return binary.LittleEndian.Uint32(p.Data[offset : offset+SizeOfPageID])
+}
+
+func (p *BPlusTreeStrPage) SetValueAsPageID(index int32, pageID uint32) {
+	offset := p.getKeyOffset(index) + SizeOfStrKey
+	binary.LittleEndian.PutUint32(p.Data[offset:], pageID)
+}
+
+// MaxDegree 返回当前页大小下节点的最大度数
+func (p *BPlusTreeStrPage) MaxDegree() int32 {
+	return MaxStrDegreeFor(len(p.Data))
+}
+
+func (p *BPlusTreeStrPage) IsFull() bool {
+	return p.GetCount() >= p.MaxDegree()-1
+}
+
+// InsertLeaf 按顺序插入一对 Key/Value，Key 已存在时返回 false
+func (p *BPlusTreeStrPage) InsertLeaf(key string, val []byte) bool {
+	count := p.GetCount()
+	kb := []byte(key)
+	index := int32(0)
+	for ; index < count; index++ {
+		c := p.CompareKey(index, kb)
+		if c == 0 {
+			return false
+		}
+		if c > 0 {
+			break
+		}
+	}
+
+	for i := count; i > index; i-- {
+		p.SetKey(i, p.GetKey(i-1))
+		p.SetValue(i, p.GetValueRef(i-1))
+	}
+
+	p.SetKey(index, key)
+	p.SetValue(index, val)
+	p.SetCount(count + 1)
+	return true
+}
+
+// MoveHalfTo 把后一半槽位移到 recipient，用于分裂；叶子和内部节点都适用
+func (p *BPlusTreeStrPage) MoveHalfTo(recipient *BPlusTreeStrPage) {
+	count := p.GetCount()
+	splitIdx := count / 2
+	moveCount := count - splitIdx
+
+	for i := int32(0); i < moveCount; i++ {
+		srcIdx := splitIdx + i
+		recipient.SetKey(i, p.GetKey(srcIdx))
+		if p.IsLeaf() {
+			recipient.SetValue(i, p.GetValueRef(srcIdx))
+		} else {
+			recipient.SetValueAsPageID(i, p.GetValueAsPageID(srcIdx))
+		}
+	}
+
+	recipient.SetCount(moveCount)
+	p.SetCount(splitIdx)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucket 是单个连接的令牌桶限流器：每秒补充 rate 个令牌，最多攒 burst 个
+// 每条语句消耗一个令牌，桶空时拒绝执行。只在连接自己的 goroutine 中使用，不需要加锁
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time // 测试时替换为假时钟
+}
+
+// newTokenBucket 创建一个装满令牌的桶，burst 小于 1 时按 1 处理
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{rate: rate, burst: math.Max(float64(burst), 1), now: time.Now}
+	b.tokens = b.burst
+	b.last = b.now()
+	return b
+}
+
+// Allow 尝试取一个令牌，成功时返回 true
+func (b *tokenBucket) Allow() bool {
+	now := b.now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
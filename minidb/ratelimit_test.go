@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(5, 5)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	// 一次突发：桶里的 5 个令牌用完后拒绝
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if b.Allow() {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("burst: allowed %d, want 5", allowed)
+	}
+
+	// 每 200ms 补充一个令牌
+	now = now.Add(100 * time.Millisecond)
+	if b.Allow() {
+		t.Fatal("allowed before a token was refilled")
+	}
+	now = now.Add(150 * time.Millisecond)
+	if !b.Allow() || b.Allow() {
+		t.Fatal("expected exactly one token after 250ms")
+	}
+
+	// 空闲很久也最多攒 burst 个令牌
+	now = now.Add(time.Hour)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if b.Allow() {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("after idle: allowed %d, want 5", allowed)
+	}
+
+	// 低于每秒一次的限速仍然允许单条语句
+	slow := newTokenBucket(0.5, 0)
+	slow.now = func() time.Time { return now }
+	slow.last = now
+	if !slow.Allow() || slow.Allow() {
+		t.Fatal("burst below 1 should allow exactly one query")
+	}
+	now = now.Add(2 * time.Second)
+	if !slow.Allow() {
+		t.Fatal("expected a token after 2s at 0.5 qps")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"minidb/pkg/db"
+)
+
+// replay 在 dataDir 下建一个全新的默认数据库，按顺序执行命令日志中的语句
+// dataDir 必须不存在，避免把日志叠加到已有数据上、得到和原来不同的结果
+func replay(logFile, dataDir string) error {
+	f, err := os.Open(logFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := os.Stat(dataDir); err == nil {
+		return fmt.Errorf("replay directory %s already exists, choose a fresh one", dataDir)
+	}
+
+	engine := openDatabase(dataDir)
+	res, err := db.Replay(engine, f, os.Stdout)
+	if closeErr := engine.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("close replayed database: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔁 Replayed %d statements from %d sessions into %s (%d errors)\n", res.Statements, res.Sessions, dataDir, res.Errors)
+	return nil
+}
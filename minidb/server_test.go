@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dialPipe 在内存管道上启动一个连接的服务端，完成分帧握手后返回客户端用的收发函数
+func dialPipe(t *testing.T) func(msg string) string {
+	t.Helper()
+	send, _ := dialPipeConn(t)
+	return send
+}
+
+// dialPipeConn 与 dialPipe 相同，另外返回客户端一端的连接，用于只发送、不等回复的消息
+func dialPipeConn(t *testing.T) (func(msg string) string, net.Conn) {
+	t.Helper()
+	globalEngine = openDatabase(t.TempDir())
+	t.Cleanup(func() { globalEngine.Close() })
+	return connectPipe(t)
+}
+
+// connectPipe 在当前的 globalEngine 上再建立一个连接，返回值与 dialPipeConn 相同
+func connectPipe(t *testing.T) (func(msg string) string, net.Conn) {
+	t.Helper()
+	client, server := net.Pipe()
+	go handleClient(server)
+	t.Cleanup(func() { client.Close() })
+
+	r := bufio.NewReader(client)
+	if _, err := r.ReadString('\n'); err != nil { // 欢迎语
+		t.Fatal(err)
+	}
+	if _, err := client.Write([]byte(FramedHandshake + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasSuffix(line, "OK framed\n") {
+		t.Fatalf("handshake reply %q, %v", line, err)
+	}
+	return func(msg string) string {
+		t.Helper()
+		if err := writeFrame(client, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}, client
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range []string{"select * from t", "", strings.Repeat("x", 70000)} {
+		if err := writeFrame(&buf, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"select * from t", "", strings.Repeat("x", 70000)} {
+		if got, err := readFrame(&buf); err != nil || got != want {
+			t.Fatalf("readFrame = %.20q (%d bytes), %v; want %.20q", got, len(got), err, want)
+		}
+	}
+	// 两帧之间正常断开是 EOF，读到一半断开是 ErrUnexpectedEOF
+	if _, err := readFrame(&buf); err != io.EOF {
+		t.Errorf("clean end of stream: got %v, want EOF", err)
+	}
+
+	var frame bytes.Buffer
+	writeFrame(&frame, []byte("hello"))
+	whole := frame.Bytes()
+	for name, input := range map[string][]byte{
+		"truncated header": whole[:2],
+		"truncated body":   whole[:len(whole)-2],
+		"header only":      whole[:4],
+	} {
+		if _, err := readFrame(bytes.NewReader(input)); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v, want ErrUnexpectedEOF", name, err)
+		}
+	}
+
+	// 超过上限的长度前缀在分配内容之前就被拒绝
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MaxFrameSize+1)
+	_, err := readFrame(bytes.NewReader(header[:]))
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("oversized frame: got %v", err)
+	}
+}
+
+func TestMultiStatementMessage(t *testing.T) {
+	send := dialPipe(t)
+	send("use mydb; set timing = off")
+
+	// 所有语句的结果按顺序放在同一帧里返回，引号内的分号不拆分
+	reply := send("create table t (id int, name varchar); insert into t values (1, 'a;b'); select * from t;")
+	created := strings.Index(reply, "Query OK, 0 rows affected.")
+	inserted := strings.Index(reply, "Query OK, 1 row affected.")
+	selected := strings.Index(reply, "a;b")
+	if created < 0 || inserted < created || selected < inserted {
+		t.Fatalf("combined reply out of order:\n%s", reply)
+	}
+
+	// 默认在第一条出错的语句处停止
+	reply = send("insert into t values (2, 'x'); insert into t values (1, 'dup'); insert into t values (3, 'y')")
+	if strings.Count(reply, "Query OK") != 1 || strings.Count(reply, "Error:") != 1 {
+		t.Fatalf("stop on error: reply\n%s", reply)
+	}
+	if reply := send("select * from t where id = 3"); !strings.Contains(reply, "(0 rows)") {
+		t.Fatalf("statement after the error was executed:\n%s", reply)
+	}
+
+	// set on_error = continue 之后继续执行出错语句后面的语句
+	reply = send("set on_error = continue; insert into t values (1, 'dup'); insert into t values (3, 'y')")
+	if strings.Count(reply, "Error:") != 1 || !strings.Contains(reply, "Query OK, 1 row affected.") {
+		t.Fatalf("continue on error: reply\n%s", reply)
+	}
+	if reply := send("select * from t where id = 3"); !strings.Contains(reply, "(1 row)") {
+		t.Fatalf("statement after the error was not executed:\n%s", reply)
+	}
+}
+
+func TestCopyFromStdin(t *testing.T) {
+	send, client := dialPipeConn(t)
+	send("use mydb; set timing = off")
+	send("create table t (id int, name varchar, qty int)")
+
+	reply := send("copy into t from stdin")
+	if !strings.Contains(reply, "Enter rows for 't'") {
+		t.Fatalf("copy start reply:\n%s", reply)
+	}
+	// 数据分成多帧连续发送，中间没有回复；只有带结束行的最后一帧有回复
+	const rows, perFrame = 20000, 2500
+	var frame strings.Builder
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&frame, "%d,name-%d,%d\n", i, i, i%7)
+		if i%perFrame == 0 && i < rows {
+			if err := writeFrame(client, []byte(frame.String())); err != nil {
+				t.Fatal(err)
+			}
+			frame.Reset()
+		}
+	}
+	frame.WriteString(`\.`)
+	if reply := send(frame.String()); !strings.Contains(reply, fmt.Sprintf("COPY OK, %d rows loaded.", rows)) {
+		t.Fatalf("copy end reply:\n%s", reply)
+	}
+	if reply := send("select count(*) from t"); !strings.Contains(reply, fmt.Sprint(rows)) {
+		t.Fatalf("count after copy:\n%s", reply)
+	}
+	if reply := send("select * from t where id = 12345"); !strings.Contains(reply, "name-12345") {
+		t.Fatalf("copied row:\n%s", reply)
+	}
+
+	// 出错的行之后不再写入，结束时报告行号；之后连接回到普通语句
+	send("copy into t from stdin")
+	reply = send("20001,a,1\nnot-a-key,b,2\n20002,c,3\n\\.")
+	if !strings.Contains(reply, "Error: copy into t, line 2") {
+		t.Fatalf("copy error reply:\n%s", reply)
+	}
+	if reply := send("select * from t where id > 20000"); !strings.Contains(reply, "(0 rows)") {
+		t.Fatalf("rows of the failed copy were loaded:\n%s", reply)
+	}
+	if reply := send("copy into nope from stdin"); !strings.Contains(reply, "not found") {
+		t.Fatalf("copy into a missing table:\n%s", reply)
+	}
+}
+
+func TestConcurrentUseDatabase(t *testing.T) {
+	send1, _ := dialPipeConn(t)
+	send2, conn2 := connectPipe(t)
+	send1("set timing = off; create database db1; create database db2")
+	send2("set timing = off")
+
+	// 两个连接交替在各自的库中建同名表、写入，互不影响
+	send1("use db1; create table t (id int, name varchar)")
+	send2("use db2; create table t (id int, name varchar)")
+	for i := 0; i < 20; i++ {
+		send1(fmt.Sprintf("insert into t values (%d, 'one')", i))
+		send2(fmt.Sprintf("insert into t values (%d, 'two')", i))
+	}
+	if reply := send1("select * from t where id = 5"); !strings.Contains(reply, "one") {
+		t.Fatalf("db1 reply:\n%s", reply)
+	}
+	if reply := send2("select * from t where id = 5"); !strings.Contains(reply, "two") {
+		t.Fatalf("db2 reply:\n%s", reply)
+	}
+	// use 时才打开的库与默认库使用相同的选项，例如双写缓冲区
+	for _, name := range []string{DefaultDB, "db1", "db2"} {
+		if _, err := os.Stat(filepath.Join(globalEngine.DataRoot, name, DBFile+".dwb")); err != nil {
+			t.Fatalf("double-write buffer of %s: %v", name, err)
+		}
+	}
+
+	// 另一个连接在用的库不能删除
+	if reply := send1("drop database db2"); !strings.Contains(reply, "in use") {
+		t.Fatalf("drop of a database in use:\n%s", reply)
+	}
+	send2("use mydb")
+	if reply := send1("drop database db2"); !strings.Contains(reply, "Database dropped.") {
+		t.Fatalf("drop after the other connection left:\n%s", reply)
+	}
+	conn2.Close()
+}